@@ -0,0 +1,129 @@
+package app
+
+import (
+	"backend/config"
+	"backend/controllers"
+	"backend/policy"
+	"backend/services"
+	"backend/utils"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// Services agrupa los servicios que se inyectan en los controllers
+type Services struct {
+	Activities   *services.ActivityService
+	Inscriptions *services.InscriptionService
+	Users        *services.UserService
+}
+
+// NewServices arma los servicios sobre los repositorios dados: en producción
+// services.DBStore, en tests puede ser services.MemoryStore.
+func NewServices(users services.UserRepository, activities services.ActivityRepository, inscriptions services.InscriptionRepository) Services {
+	return Services{
+		Activities:   services.NewActivityService(activities, users),
+		Inscriptions: services.NewInscriptionService(inscriptions, activities, users),
+		Users:        services.NewUserService(users),
+	}
+}
+
+// NewRouter arma el router con todas las rutas de la API. Es el único lugar
+// donde se registran rutas: el servidor y los tests usan el mismo router.
+func NewRouter(cfg config.Config, svc Services) *gin.Engine {
+	router := gin.Default()
+	activityController := controllers.NewActivityController(svc.Activities)
+	inscriptionController := controllers.NewInscriptionController(svc.Inscriptions, svc.Activities)
+	userController := controllers.NewUserController(svc.Users)
+
+	// CORS para el frontend React, con los orígenes de la configuración
+	router.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.CORS.AllowedOrigins,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", utils.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", utils.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
+	}))
+
+	// Cada request lleva un ID, que se devuelve en X-Request-ID y queda en la auditoría
+	router.Use(utils.RequestID())
+
+	// Authentication routes
+	router.POST("/login", controllers.Login)
+	router.POST("/login/2fa", controllers.LoginTwoFactor)
+	router.POST("/login/2fa/setup", controllers.LoginTwoFactorSetup)
+	router.GET("/auth/oidc/providers", controllers.GetOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", controllers.OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", controllers.OIDCCallback)
+	router.POST("/register", controllers.Register)
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS)
+	router.POST("/auth/refresh", controllers.RefreshToken)
+	router.POST("/auth/logout", utils.JwtAuthMiddleware(), controllers.Logout)
+	router.POST("/auth/password/forgot", controllers.ForgotPassword)
+	router.POST("/auth/password/reset", controllers.ResetPassword)
+	router.POST("/auth/email/verify", controllers.VerifyEmail)
+	router.POST("/invitations/accept", controllers.AcceptInvitation)
+
+	// Perfil del usuario autenticado
+	router.GET("/me", utils.JwtAuthMiddleware(), controllers.GetMe)
+	router.PATCH("/me", utils.JwtAuthMiddleware(), controllers.UpdateMe)
+	router.POST("/me/email/verification", utils.JwtAuthMiddleware(), controllers.ResendEmailVerification)
+
+	// Segundo factor (TOTP) del usuario autenticado
+	router.POST("/auth/2fa/enroll", utils.JwtAuthMiddleware(), controllers.EnrollTwoFactor)
+	router.POST("/auth/2fa/verify", utils.JwtAuthMiddleware(), controllers.ConfirmTwoFactor)
+	router.POST("/auth/2fa/disable", utils.JwtAuthMiddleware(), controllers.DisableTwoFactor)
+
+	// User routes: cada socio solo accede a su usuario, los admins a todos
+	router.GET("/users", utils.JwtAuthMiddleware(), userController.GetAllUsers)
+	router.GET("/users/:id", utils.JwtAuthMiddleware(), userController.GetUserByID)
+	router.PUT("/users/:id", utils.JwtAuthMiddleware(), userController.UpdateUser)
+	router.DELETE("/users/:id", utils.JwtAuthMiddleware(), userController.DeleteUser)
+	router.GET("/users/:id/inscriptions", utils.JwtAuthMiddleware(), inscriptionController.GetInscriptionsByUserID)
+	router.PUT("/users/:id/roles", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermRolesWrite), controllers.SetUserRoles)
+	router.POST("/users/:id/unlock", utils.JwtAuthMiddleware(), controllers.UnlockUser)
+	router.DELETE("/users/:id/2fa", utils.JwtAuthMiddleware(), controllers.ResetUserTwoFactor)
+	router.GET("/roles", utils.JwtAuthMiddleware(), controllers.GetRoles)
+
+	// Las cuentas de staff y admin solo se crean por invitación
+	router.POST("/admin/invitations", utils.JwtAuthMiddleware(), controllers.CreateInvitation)
+
+	// Registro de auditoría: quién cambió qué (requiere el permiso audit:read)
+	router.GET("/audit", utils.JwtAuthMiddleware(), controllers.GetAuditEvents)
+
+	// Activity routes
+	router.GET("/activities", activityController.GetActivities)
+	router.GET("/activities/:id", activityController.GetActivityByID)
+	router.GET("/activities/:id/inscriptions", utils.JwtAuthMiddleware(), inscriptionController.GetActivityRoster)
+	// Rutas de actividades que requieren el permiso activities:write
+	router.POST("/activities", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermActivitiesWrite), activityController.CreateActivity)
+	router.PUT("/activities/:id", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermActivitiesWrite), activityController.UpdateActivity)
+	router.DELETE("/activities/:id", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermActivitiesWrite), activityController.DeleteActivity)
+
+	// Activity filters and search
+	router.GET("/activities/category/:categoria", activityController.GetActivitiesByCategory)
+	router.GET("/activities/profesor/:profesor", activityController.GetActivitiesByProfesor)
+	router.GET("/activities/day/:dia", activityController.GetActivitiesByDay)
+	router.GET("/activities/available", activityController.GetActivitiesWithAvailableSlots)
+	router.GET("/activities/search", activityController.SearchActivitiesByName)
+	router.PUT("/activities/:id/slots", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermActivitiesWrite), activityController.UpdateActivitySlots) // También requiere permiso para actualizar cupos
+	// Recurrencia y sesiones con fecha de las actividades
+	router.GET("/activities/:id/schedule", activityController.GetSchedule)
+	router.PUT("/activities/:id/schedule", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermActivitiesWrite), activityController.SetSchedule)
+	router.GET("/activities/:id/sessions", activityController.GetSessions)
+
+	//Inscriptions routes
+	router.GET("/inscriptions", utils.JwtAuthMiddleware(), utils.RequirePermission(policy.PermInscriptionsRead), inscriptionController.GetInscriptions)
+	router.GET("/inscription/:id", utils.JwtAuthMiddleware(), inscriptionController.GetInscriptionByID)
+	router.POST("/inscription", utils.JwtAuthMiddleware(), inscriptionController.CreateInscription)
+	router.GET("/inscriptions/myactivities/:id", utils.JwtAuthMiddleware(), inscriptionController.GetActivitiesByUser)
+	router.DELETE("/inscriptions/:id", utils.JwtAuthMiddleware(), inscriptionController.DeleteInscription)
+
+	// Waitlist routes
+	router.GET("/inscriptions/waitlist/:id", utils.JwtAuthMiddleware(), inscriptionController.GetWaitlistByUser)
+	router.DELETE("/inscriptions/waitlist/:id", utils.JwtAuthMiddleware(), inscriptionController.LeaveWaitlist)
+
+	return router
+}
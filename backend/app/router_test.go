@@ -0,0 +1,669 @@
+package app
+
+import (
+	"backend/clients"
+	"backend/config"
+	"backend/dao"
+	"backend/mailer"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testDatabases numera las bases en memoria para que cada test tenga la suya
+var testDatabases atomic.Int64
+
+// testApp es el servidor completo, armado con NewRouter igual que en main.go,
+// sobre una base SQLite en memoria migrada y con datos de prueba
+type testApp struct {
+	router *gin.Engine
+	// member está inscripto en yoga y en la lista de espera de full
+	member dao.User
+	// other ocupa el único cupo de full
+	other dao.User
+	admin dao.User
+	// yoga y free tienen cupos; full no tiene cupos
+	yoga, free, full dao.Activity
+	inscription      dao.Inscription
+	waitlist         dao.WaitlistEntry
+}
+
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.Default()
+	cfg.Database = config.DatabaseConfig{
+		Driver: config.DriverSQLite,
+		DSN:    fmt.Sprintf("file:e2e_%d?mode=memory&cache=shared", testDatabases.Add(1)),
+	}
+
+	previous := clients.DB
+	client := clients.NewDatabaseClient(cfg.Database)
+	sqlDB, err := client.DB.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	t.Cleanup(func() {
+		sqlDB.Close()
+		clients.DB = previous
+	})
+	if _, err := clients.MigrateUp(client.DB); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	if err := client.Prepare(); err != nil {
+		t.Fatalf("database not ready: %v", err)
+	}
+
+	services.SetAttemptStore(services.NewMemoryAttemptStore())
+	services.SetMailer(mailer.NewMemoryMailer())
+
+	app := &testApp{}
+	app.seed(t, client)
+
+	store := services.NewDBStore()
+	app.router = NewRouter(cfg, NewServices(store, store, store))
+	return app
+}
+
+func (a *testApp) seed(t *testing.T, client *clients.DatabaseClient) {
+	t.Helper()
+	roles := map[string]dao.Role{}
+	all, err := clients.GetRoles()
+	if err != nil {
+		t.Fatalf("failed to get roles: %v", err)
+	}
+	for _, role := range all {
+		roles[role.Nombre] = role
+	}
+
+	hash, err := utils.NewPasswordHasher().Hash("secreto")
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	newUser := func(username, role string) dao.User {
+		email := username + "@example.com"
+		now := time.Now()
+		user := dao.User{Name: username, Username: username, PasswordHash: hash, Email: &email, EmailVerificadoEn: &now, Roles: []dao.Role{roles[role]}}
+		if err := client.DB.Create(&user).Error; err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+		return user
+	}
+	a.member = newUser("member", dao.RolSocio)
+	a.other = newUser("other", dao.RolSocio)
+	a.admin = newUser("admin", dao.RolAdmin)
+
+	a.yoga = dao.Activity{Nombre: "Yoga", Profesor: "Luz", Capacidad: 5, Categoria: "Relax", Descripcion: "Yoga", Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}}}
+	a.free = dao.Activity{Nombre: "Box", Profesor: "Tito", Capacidad: 5, Categoria: "Fuerza", Descripcion: "Box", Horarios: []dao.ActivitySlot{{Dia: 2, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	a.full = dao.Activity{Nombre: "Spinning", Profesor: "Ana", Capacidad: 1, Categoria: "Aeróbico", Descripcion: "Spinning", Horarios: []dao.ActivitySlot{{Dia: 3, Hora_inicio: "18:00", Hora_fin: "19:00"}}}
+	for _, activity := range []*dao.Activity{&a.yoga, &a.free, &a.full} {
+		if err := client.DB.Create(activity).Error; err != nil {
+			t.Fatalf("failed to seed activity: %v", err)
+		}
+	}
+
+	a.inscription = dao.Inscription{ID_usuario: a.member.ID, ID_actividad: a.yoga.ID_actividad}
+	client.DB.Create(&a.inscription)
+	client.DB.Create(&dao.Inscription{ID_usuario: a.other.ID, ID_actividad: a.full.ID_actividad})
+	a.waitlist = dao.WaitlistEntry{ID_usuario: a.member.ID, ID_actividad: a.full.ID_actividad}
+	client.DB.Create(&a.waitlist)
+}
+
+// tokenFor abre una sesión para el usuario y devuelve su access token
+func (a *testApp) tokenFor(t *testing.T, user dao.User) string {
+	t.Helper()
+	tokens, err := services.IssueTokens(user.ID)
+	if err != nil {
+		t.Fatalf("failed to issue tokens: %v", err)
+	}
+	return tokens.Token
+}
+
+// do envía un request al router. Los {placeholders} del path y del body se
+// reemplazan por los IDs de los datos de prueba.
+func (a *testApp) do(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	replacer := strings.NewReplacer(
+		"{member}", fmt.Sprint(a.member.ID),
+		"{other}", fmt.Sprint(a.other.ID),
+		"{admin}", fmt.Sprint(a.admin.ID),
+		"{yoga}", fmt.Sprint(a.yoga.ID_actividad),
+		"{free}", fmt.Sprint(a.free.ID_actividad),
+		"{full}", fmt.Sprint(a.full.ID_actividad),
+		"{inscription}", fmt.Sprint(a.inscription.ID_inscripcion),
+		"{waitlist}", fmt.Sprint(a.waitlist.ID_espera),
+	)
+	req := httptest.NewRequest(method, replacer.Replace(path), bytes.NewBufferString(replacer.Replace(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	a.router.ServeHTTP(w, req)
+	return w
+}
+
+// decode lee el cuerpo JSON de una respuesta
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body.String(), err)
+	}
+}
+
+type persona int
+
+const (
+	anonymous persona = iota
+	member
+	admin
+)
+
+// routeCase es un request a una ruta de NewRouter con la respuesta esperada
+type routeCase struct {
+	method string
+	route  string // la ruta tal como se registra en el router
+	path   string // vacío usa route
+	as     persona
+	body   string
+	want   int
+}
+
+// routeCases cubre todas las rutas del router; TestEveryRouteIsCovered falla
+// si se agrega una ruta sin un caso acá
+var routeCases = []routeCase{
+	// Autenticación
+	{method: "POST", route: "/login", body: `{"username":"member","password":"secreto"}`, want: http.StatusOK},
+	{method: "POST", route: "/login", body: `{"username":"member","password":"incorrecta"}`, want: http.StatusUnauthorized},
+	{method: "POST", route: "/login/2fa", body: `{"challenge_token":"invalido","code":"123456"}`, want: http.StatusUnauthorized},
+	{method: "POST", route: "/login/2fa/setup", body: `{"challenge_token":"invalido"}`, want: http.StatusUnauthorized},
+	{method: "GET", route: "/auth/oidc/providers", want: http.StatusOK},
+	{method: "GET", route: "/auth/oidc/:provider/login", path: "/auth/oidc/desconocido/login", want: http.StatusNotFound},
+	{method: "GET", route: "/auth/oidc/:provider/callback", path: "/auth/oidc/desconocido/callback?state=x&code=y", want: http.StatusNotFound},
+	{method: "POST", route: "/register", body: `{"name":"Nuevo","username":"nuevo","password":"secreto123","email":"nuevo@example.com"}`, want: http.StatusCreated},
+	{method: "POST", route: "/register", body: `{"name":"Otro","username":"member","password":"secreto123","email":"otro@example.com"}`, want: http.StatusBadRequest},
+	{method: "GET", route: "/.well-known/jwks.json", want: http.StatusOK},
+	{method: "POST", route: "/auth/refresh", body: `{"refresh_token":"invalido"}`, want: http.StatusUnauthorized},
+	{method: "POST", route: "/auth/logout", as: member, body: `{}`, want: http.StatusOK},
+	{method: "POST", route: "/auth/password/forgot", body: `{"email":"member@example.com"}`, want: http.StatusAccepted},
+	{method: "POST", route: "/auth/password/reset", body: `{"token":"invalido","password":"nueva-clave"}`, want: http.StatusBadRequest},
+	{method: "POST", route: "/auth/email/verify", body: `{"token":"invalido"}`, want: http.StatusBadRequest},
+	{method: "POST", route: "/invitations/accept", body: `{"token":"invalido","username":"staff","password":"secreto123"}`, want: http.StatusBadRequest},
+
+	// Perfil y segundo factor
+	{method: "GET", route: "/me", as: member, want: http.StatusOK},
+	{method: "PATCH", route: "/me", as: member, body: `{"name":"Socio"}`, want: http.StatusOK},
+	{method: "POST", route: "/me/email/verification", as: member, want: http.StatusConflict},
+	{method: "POST", route: "/auth/2fa/enroll", as: member, want: http.StatusOK},
+	{method: "POST", route: "/auth/2fa/verify", as: member, body: `{"code":"000000"}`, want: http.StatusBadRequest},
+	{method: "POST", route: "/auth/2fa/disable", as: member, body: `{"code":"000000"}`, want: http.StatusBadRequest},
+
+	// Usuarios
+	{method: "GET", route: "/users", as: member, want: http.StatusForbidden},
+	{method: "GET", route: "/users", as: admin, want: http.StatusOK},
+	{method: "GET", route: "/users/:id", path: "/users/{member}", as: member, want: http.StatusOK},
+	{method: "GET", route: "/users/:id", path: "/users/{other}", as: member, want: http.StatusForbidden},
+	{method: "PUT", route: "/users/:id", path: "/users/{member}", as: member, body: `{"name":"Socio"}`, want: http.StatusOK},
+	{method: "PUT", route: "/users/:id", path: "/users/{other}", as: member, body: `{"name":"Socio"}`, want: http.StatusForbidden},
+	{method: "DELETE", route: "/users/:id", path: "/users/{other}", as: member, want: http.StatusForbidden},
+	{method: "DELETE", route: "/users/:id", path: "/users/{other}", as: admin, want: http.StatusOK},
+	{method: "GET", route: "/users/:id/inscriptions", path: "/users/{member}/inscriptions", as: member, want: http.StatusOK},
+	{method: "GET", route: "/users/:id/inscriptions", path: "/users/{other}/inscriptions", as: member, want: http.StatusForbidden},
+	{method: "PUT", route: "/users/:id/roles", path: "/users/{member}/roles", as: member, body: `{"roles":["admin"]}`, want: http.StatusForbidden},
+	{method: "PUT", route: "/users/:id/roles", path: "/users/{member}/roles", as: admin, body: `{"roles":["instructor"]}`, want: http.StatusOK},
+	{method: "POST", route: "/users/:id/unlock", path: "/users/{member}/unlock", as: member, want: http.StatusForbidden},
+	{method: "POST", route: "/users/:id/unlock", path: "/users/{member}/unlock", as: admin, want: http.StatusOK},
+	{method: "DELETE", route: "/users/:id/2fa", path: "/users/{member}/2fa", as: member, want: http.StatusForbidden},
+	{method: "GET", route: "/roles", as: admin, want: http.StatusOK},
+	{method: "POST", route: "/admin/invitations", as: member, body: `{"email":"staff@example.com","role":"recepcion"}`, want: http.StatusForbidden},
+	{method: "GET", route: "/audit", as: member, want: http.StatusForbidden},
+	{method: "GET", route: "/audit", as: admin, want: http.StatusOK},
+
+	// Actividades
+	{method: "GET", route: "/activities", want: http.StatusOK},
+	{method: "GET", route: "/activities/:id", path: "/activities/{yoga}", want: http.StatusOK},
+	{method: "GET", route: "/activities/:id", path: "/activities/9999", want: http.StatusNotFound},
+	{method: "GET", route: "/activities/:id/inscriptions", path: "/activities/{yoga}/inscriptions", as: member, want: http.StatusForbidden},
+	{method: "GET", route: "/activities/:id/inscriptions", path: "/activities/{yoga}/inscriptions", as: admin, want: http.StatusOK},
+	{method: "POST", route: "/activities", as: member, body: newActivityBody, want: http.StatusForbidden},
+	{method: "POST", route: "/activities", as: admin, body: newActivityBody, want: http.StatusCreated},
+	{method: "PUT", route: "/activities/:id", path: "/activities/{free}", as: member, body: newActivityBody, want: http.StatusForbidden},
+	{method: "PUT", route: "/activities/:id", path: "/activities/{free}", as: admin, body: newActivityBody, want: http.StatusOK},
+	{method: "DELETE", route: "/activities/:id", path: "/activities/{free}", as: member, want: http.StatusForbidden},
+	{method: "DELETE", route: "/activities/:id", path: "/activities/{free}", as: admin, want: http.StatusOK},
+	{method: "GET", route: "/activities/category/:categoria", path: "/activities/category/Relax", want: http.StatusOK},
+	{method: "GET", route: "/activities/profesor/:profesor", path: "/activities/profesor/Luz", want: http.StatusOK},
+	{method: "GET", route: "/activities/day/:dia", path: "/activities/day/1", want: http.StatusOK},
+	{method: "GET", route: "/activities/day/:dia", path: "/activities/day/lunes", want: http.StatusBadRequest},
+	{method: "GET", route: "/activities/available", want: http.StatusOK},
+	{method: "GET", route: "/activities/search", path: "/activities/search?name=yo", want: http.StatusOK},
+	{method: "PUT", route: "/activities/:id/slots", path: "/activities/{yoga}/slots", as: member, body: `{"capacidad":10}`, want: http.StatusForbidden},
+	{method: "PUT", route: "/activities/:id/slots", path: "/activities/{yoga}/slots", as: admin, body: `{"capacidad":10}`, want: http.StatusOK},
+	{method: "GET", route: "/activities/:id/schedule", path: "/activities/{yoga}/schedule", want: http.StatusNotFound},
+	{method: "PUT", route: "/activities/:id/schedule", path: "/activities/{yoga}/schedule", as: member, body: `{"fecha_inicio":"2030-01-07"}`, want: http.StatusForbidden},
+	{method: "PUT", route: "/activities/:id/schedule", path: "/activities/{yoga}/schedule", as: admin, body: `{"fecha_inicio":"2030-01-07"}`, want: http.StatusOK},
+	{method: "PUT", route: "/activities/:id/schedule", path: "/activities/{yoga}/schedule", as: admin, body: `{"fecha_inicio":"07/01/2030"}`, want: http.StatusBadRequest},
+	{method: "GET", route: "/activities/:id/sessions", path: "/activities/{yoga}/sessions", want: http.StatusOK},
+	{method: "GET", route: "/activities/:id/sessions", path: "/activities/{yoga}/sessions?from=mañana", want: http.StatusBadRequest},
+	{method: "GET", route: "/activities/:id/sessions", path: "/activities/9999/sessions", want: http.StatusNotFound},
+
+	// Inscripciones y listas de espera
+	{method: "GET", route: "/inscription/:id", path: "/inscription/{inscription}", as: member, want: http.StatusOK},
+	{method: "GET", route: "/inscription/:id", path: "/inscription/{inscription}", as: admin, want: http.StatusOK},
+	{method: "GET", route: "/inscriptions", as: member, want: http.StatusForbidden},
+	{method: "GET", route: "/inscriptions", path: "/inscriptions?estado=activa", as: admin, want: http.StatusOK},
+	{method: "GET", route: "/inscriptions", path: "/inscriptions?estado=pendiente", as: admin, want: http.StatusBadRequest},
+	{method: "POST", route: "/inscription", as: member, body: `{"actividad_id":{free}}`, want: http.StatusCreated},
+	{method: "POST", route: "/inscription", as: member, body: `{"actividad_id":{yoga}}`, want: http.StatusConflict},
+	{method: "POST", route: "/inscription", as: member, body: `{"usuario_id":{other},"actividad_id":{free}}`, want: http.StatusForbidden},
+	{method: "GET", route: "/inscriptions/myactivities/:id", path: "/inscriptions/myactivities/{member}", as: member, want: http.StatusOK},
+	{method: "DELETE", route: "/inscriptions/:id", path: "/inscriptions/{inscription}", as: member, want: http.StatusOK},
+	{method: "GET", route: "/inscriptions/waitlist/:id", path: "/inscriptions/waitlist/{member}", as: member, want: http.StatusOK},
+	{method: "DELETE", route: "/inscriptions/waitlist/:id", path: "/inscriptions/waitlist/{waitlist}", as: member, want: http.StatusOK},
+}
+
+const newActivityBody = `{"name":"Pilates","description":"Pilates","profesor":"Sol","categoria":"Relax","capacidad":8,"dia":4,"hora_inicio":"09:00","hora_fin":"10:00"}`
+
+func TestRoutes(t *testing.T) {
+	for _, tc := range routeCases {
+		path := tc.path
+		if path == "" {
+			path = tc.route
+		}
+		name := fmt.Sprintf("%s %s as %s", tc.method, path, [...]string{"anonymous", "member", "admin"}[tc.as])
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t)
+			token := ""
+			switch tc.as {
+			case member:
+				token = app.tokenFor(t, app.member)
+			case admin:
+				token = app.tokenFor(t, app.admin)
+			}
+
+			w := app.do(t, tc.method, path, token, tc.body)
+			if w.Code != tc.want {
+				t.Errorf("expected %d, got %d: %s", tc.want, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestEveryRouteIsCovered(t *testing.T) {
+	covered := map[string]bool{}
+	for _, tc := range routeCases {
+		covered[tc.method+" "+tc.route] = true
+	}
+
+	app := newTestApp(t)
+	for _, route := range app.router.Routes() {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("route %s %s has no case in routeCases", route.Method, route.Path)
+		}
+	}
+}
+
+// publicRoutes son las únicas rutas que se atienden sin token
+var publicRoutes = map[string]bool{
+	"POST /login":                         true,
+	"POST /login/2fa":                     true,
+	"POST /login/2fa/setup":               true,
+	"GET /auth/oidc/providers":            true,
+	"GET /auth/oidc/:provider/login":      true,
+	"GET /auth/oidc/:provider/callback":   true,
+	"POST /register":                      true,
+	"GET /.well-known/jwks.json":          true,
+	"POST /auth/refresh":                  true,
+	"POST /auth/password/forgot":          true,
+	"POST /auth/password/reset":           true,
+	"POST /auth/email/verify":             true,
+	"POST /invitations/accept":            true,
+	"GET /activities":                     true,
+	"GET /activities/:id":                 true,
+	"GET /activities/category/:categoria": true,
+	"GET /activities/profesor/:profesor":  true,
+	"GET /activities/day/:dia":            true,
+	"GET /activities/available":           true,
+	"GET /activities/search":              true,
+	"GET /activities/:id/schedule":        true,
+	"GET /activities/:id/sessions":        true,
+}
+
+var routeParam = regexp.MustCompile(`:[a-z_]+`)
+
+func TestProtectedRoutesRejectMissingOrInvalidTokens(t *testing.T) {
+	app := newTestApp(t)
+	for _, route := range app.router.Routes() {
+		if publicRoutes[route.Method+" "+route.Path] {
+			continue
+		}
+		path := routeParam.ReplaceAllString(route.Path, "1")
+		for name, token := range map[string]string{"without token": "", "with invalid token": "invalido"} {
+			if w := app.do(t, route.Method, path, token, `{}`); w.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s %s: expected 401, got %d", route.Method, route.Path, name, w.Code)
+			}
+		}
+	}
+}
+
+func TestLoginThenUseTheAPI(t *testing.T) {
+	app := newTestApp(t)
+
+	w := app.do(t, "POST", "/login", "", `{"username":"member","password":"secreto"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login failed: %d %s", w.Code, w.Body.String())
+	}
+	var login struct {
+		User struct {
+			Token string `json:"token"`
+		} `json:"user"`
+	}
+	decode(t, w, &login)
+	token := login.User.Token
+
+	w = app.do(t, "GET", "/me", token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /me failed: %d %s", w.Code, w.Body.String())
+	}
+	var me struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	decode(t, w, &me)
+	if me.User.Username != "member" {
+		t.Errorf("expected member, got %q", me.User.Username)
+	}
+
+	if w := app.do(t, "POST", "/auth/logout", token, `{}`); w.Code != http.StatusOK {
+		t.Fatalf("logout failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "GET", "/me", token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 after logout, got %d", w.Code)
+	}
+}
+
+func TestActivityLifecycle(t *testing.T) {
+	app := newTestApp(t)
+	token := app.tokenFor(t, app.admin)
+
+	w := app.do(t, "POST", "/activities", token, newActivityBody)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Activity struct {
+			ID int `json:"id"`
+		} `json:"activity"`
+	}
+	decode(t, w, &created)
+	path := fmt.Sprintf("/activities/%d", created.Activity.ID)
+
+	for _, search := range []string{"/activities/category/Relax", "/activities/profesor/Sol", "/activities/day/4", "/activities/available", "/activities/search?name=pila"} {
+		w := app.do(t, "GET", search, "", "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"Pilates"`) {
+			t.Errorf("GET %s did not return the new activity: %d %s", search, w.Code, w.Body.String())
+		}
+	}
+
+	updated := strings.Replace(newActivityBody, `"capacidad":8`, `"capacidad":12`, 1)
+	if w := app.do(t, "PUT", path, token, updated); w.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", w.Code, w.Body.String())
+	}
+	var got struct {
+		Activity struct {
+			Capacidad        int `json:"capacidad"`
+			CuposDisponibles int `json:"cupos_disponibles"`
+		} `json:"activity"`
+	}
+	decode(t, app.do(t, "GET", path, "", ""), &got)
+	if got.Activity.Capacidad != 12 || got.Activity.CuposDisponibles != 12 {
+		t.Errorf("expected 12 slots after update, got %+v", got.Activity)
+	}
+
+	if w := app.do(t, "DELETE", path, token, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "GET", path, "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %d", w.Code)
+	}
+}
+
+func TestMultiDayActivity(t *testing.T) {
+	app := newTestApp(t)
+	token := app.tokenFor(t, app.admin)
+
+	body := `{"name":"Spinning","description":"Spinning","profesor":"Ana","categoria":"Aeróbico","capacidad":1,
+		"horarios":[{"dia":5,"hora_inicio":"19:00","hora_fin":"20:00"},{"dia":1,"hora_inicio":"19:00","hora_fin":"20:00"},{"dia":3,"hora_inicio":"19:00","hora_fin":"20:00"}]}`
+	w := app.do(t, "POST", "/activities", token, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create failed: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Activity struct {
+			ID       int `json:"id"`
+			Dia      int `json:"dia"`
+			Horarios []struct {
+				Dia int `json:"dia"`
+			} `json:"horarios"`
+		} `json:"activity"`
+	}
+	decode(t, w, &created)
+	if len(created.Activity.Horarios) != 3 || created.Activity.Horarios[0].Dia != 1 || created.Activity.Dia != 1 {
+		t.Fatalf("expected three horarios starting on monday, got %+v", created.Activity)
+	}
+	path := fmt.Sprintf("/activities/%d", created.Activity.ID)
+
+	// Es una sola actividad: aparece en cada uno de sus días y comparte el cupo
+	for day, want := range map[int]bool{1: true, 2: false, 3: true, 5: true} {
+		w := app.do(t, "GET", fmt.Sprintf("/activities/day/%d", day), "", "")
+		if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"Spinning"`) != want {
+			t.Errorf("GET /activities/day/%d: %d %s", day, w.Code, w.Body.String())
+		}
+	}
+	body = fmt.Sprintf(`{"actividad_id":%d}`, created.Activity.ID)
+	if w := app.do(t, "POST", "/inscription", app.tokenFor(t, app.member), body); w.Code != http.StatusCreated {
+		t.Fatalf("inscription failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "POST", "/inscription", app.tokenFor(t, app.other), body); w.Code != http.StatusConflict {
+		t.Errorf("expected the three days to share one cupo, got %d %s", w.Code, w.Body.String())
+	}
+
+	// dia solo alcanza para actividades de un solo día; los horarios se reemplazan enteros
+	if w := app.do(t, "PUT", path, token, `{"dia":2}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 updating dia of a multi-day activity, got %d %s", w.Code, w.Body.String())
+	}
+	w = app.do(t, "PUT", path, token, `{"horarios":[{"dia":2,"hora_inicio":"19:00","hora_fin":"20:00"},{"dia":9,"hora_inicio":"19:00","hora_fin":"8"}]}`)
+	var invalid struct {
+		Fields []struct {
+			Field string `json:"field"`
+		} `json:"fields"`
+	}
+	decode(t, w, &invalid)
+	if w.Code != http.StatusBadRequest || len(invalid.Fields) != 2 || invalid.Fields[0].Field != "horarios[1].dia" || invalid.Fields[1].Field != "horarios[1].hora_fin" {
+		t.Errorf("expected 400 with the invalid fields, got %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "PUT", path, token, `{"horarios":[{"dia":2,"hora_inicio":"19:00","hora_fin":"20:00"},{"dia":4,"hora_inicio":"19:00","hora_fin":"20:00"}]}`); w.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", w.Code, w.Body.String())
+	}
+	for day, want := range map[int]bool{1: false, 2: true, 4: true} {
+		w := app.do(t, "GET", fmt.Sprintf("/activities/day/%d", day), "", "")
+		if strings.Contains(w.Body.String(), `"Spinning"`) != want {
+			t.Errorf("GET /activities/day/%d after the update: %s", day, w.Body.String())
+		}
+	}
+}
+
+func TestInscriptionLifecycle(t *testing.T) {
+	app := newTestApp(t)
+	memberToken := app.tokenFor(t, app.member)
+	otherToken := app.tokenFor(t, app.other)
+
+	// full no tiene cupos: sin lista_espera se rechaza, con lista_espera se anota
+	body := fmt.Sprintf(`{"actividad_id":%d}`, app.free.ID_actividad)
+	if w := app.do(t, "POST", "/inscription", memberToken, body); w.Code != http.StatusCreated {
+		t.Fatalf("inscription failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "DELETE", "/inscriptions/waitlist/{waitlist}", memberToken, ""); w.Code != http.StatusOK {
+		t.Fatalf("leave waitlist failed: %d %s", w.Code, w.Body.String())
+	}
+	body = fmt.Sprintf(`{"actividad_id":%d}`, app.full.ID_actividad)
+	if w := app.do(t, "POST", "/inscription", memberToken, body); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 on a full activity, got %d %s", w.Code, w.Body.String())
+	}
+	body = fmt.Sprintf(`{"actividad_id":%d,"lista_espera":true}`, app.full.ID_actividad)
+	if w := app.do(t, "POST", "/inscription", memberToken, body); w.Code != http.StatusAccepted {
+		t.Fatalf("join waitlist failed: %d %s", w.Code, w.Body.String())
+	}
+
+	// Cuando other cancela, member pasa de la lista de espera a estar inscripto
+	var inscriptions []struct {
+		ID          int    `json:"id"`
+		ActividadID int    `json:"actividad_id"`
+		Estado      string `json:"estado"`
+	}
+	decode(t, app.do(t, "GET", "/users/{other}/inscriptions", otherToken, ""), &inscriptions)
+	if len(inscriptions) != 1 {
+		t.Fatalf("expected one inscription for other, got %+v", inscriptions)
+	}
+	if w := app.do(t, "DELETE", fmt.Sprintf("/inscriptions/%d", inscriptions[0].ID), otherToken, `{"reason":"viaje"}`); w.Code != http.StatusOK {
+		t.Fatalf("cancel failed: %d %s", w.Code, w.Body.String())
+	}
+
+	decode(t, app.do(t, "GET", "/users/{member}/inscriptions?estado=activa", memberToken, ""), &inscriptions)
+	enrolled := map[int]bool{}
+	for _, inscription := range inscriptions {
+		enrolled[inscription.ActividadID] = true
+	}
+	for _, activity := range []dao.Activity{app.yoga, app.free, app.full} {
+		if !enrolled[activity.ID_actividad] {
+			t.Errorf("member is not inscribed in %s: %+v", activity.Nombre, inscriptions)
+		}
+	}
+	if w := app.do(t, "GET", "/inscriptions/waitlist/{member}", memberToken, ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"actividad_id"`) {
+		t.Errorf("expected an empty waitlist after the promotion: %d %s", w.Code, w.Body.String())
+	}
+
+	// El roster de full lo ve el admin, no un socio
+	if w := app.do(t, "GET", "/activities/{full}/inscriptions", memberToken, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for the roster, got %d", w.Code)
+	}
+	w := app.do(t, "GET", "/activities/{full}/inscriptions", app.tokenFor(t, app.admin), "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"member"`) {
+		t.Errorf("expected member in the roster: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSessionBookingLifecycle(t *testing.T) {
+	app := newTestApp(t)
+	adminToken := app.tokenFor(t, app.admin)
+	memberToken := app.tokenFor(t, app.member)
+	otherToken := app.tokenFor(t, app.other)
+
+	// free se repite los martes de 10:00 a 11:00 desde hoy
+	body := fmt.Sprintf(`{"fecha_inicio":%q}`, time.Now().Format("2006-01-02"))
+	if w := app.do(t, "PUT", "/activities/{free}/schedule", adminToken, body); w.Code != http.StatusOK {
+		t.Fatalf("set schedule failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "PUT", "/activities/{free}/slots", adminToken, `{"capacidad":2}`); w.Code != http.StatusOK {
+		t.Fatalf("update slots failed: %d %s", w.Code, w.Body.String())
+	}
+
+	type session struct {
+		ID               int       `json:"id"`
+		Inicio           time.Time `json:"inicio"`
+		CuposDisponibles int       `json:"cupos_disponibles"`
+	}
+	var listed struct {
+		Sessions []session `json:"sessions"`
+	}
+	decode(t, app.do(t, "GET", "/activities/{free}/sessions", "", ""), &listed)
+	if len(listed.Sessions) < 7 {
+		t.Fatalf("expected about eight weeks of sessions, got %+v", listed.Sessions)
+	}
+	for _, s := range listed.Sessions {
+		inicio := s.Inicio.In(time.Local)
+		if inicio.Weekday() != time.Tuesday || inicio.Hour() != 10 || s.CuposDisponibles != 2 {
+			t.Errorf("unexpected session %+v", s)
+		}
+	}
+	first, second := listed.Sessions[0], listed.Sessions[1]
+
+	// Cada sesión tiene su propio cupo
+	book := func(token string, sessionID int) *httptest.ResponseRecorder {
+		return app.do(t, "POST", "/inscription", token, fmt.Sprintf(`{"sesion_id":%d}`, sessionID))
+	}
+	w := book(memberToken, first.ID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("booking failed: %d %s", w.Code, w.Body.String())
+	}
+	var booked struct {
+		ActividadID int `json:"actividad_id"`
+		SesionID    int `json:"sesion_id"`
+	}
+	decode(t, w, &booked)
+	if booked.ActividadID != app.free.ID_actividad || booked.SesionID != first.ID {
+		t.Errorf("unexpected booking %+v", booked)
+	}
+	if w := book(memberToken, first.ID); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 booking the same session twice, got %d %s", w.Code, w.Body.String())
+	}
+	if w := book(otherToken, first.ID); w.Code != http.StatusCreated {
+		t.Fatalf("second booking failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := book(adminToken, first.ID); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 on a full session, got %d %s", w.Code, w.Body.String())
+	}
+	if w := book(otherToken, second.ID); w.Code != http.StatusCreated {
+		t.Fatalf("booking the next session failed: %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "POST", "/inscription", memberToken, `{"actividad_id":{free}}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a weekly inscription to a scheduled activity, got %d %s", w.Code, w.Body.String())
+	}
+	if w := app.do(t, "PUT", "/activities/{free}/slots", adminToken, `{"capacidad":1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 lowering capacity below a session's bookings, got %d %s", w.Code, w.Body.String())
+	}
+
+	decode(t, app.do(t, "GET", "/activities/{free}/sessions", "", ""), &listed)
+	if listed.Sessions[0].CuposDisponibles != 0 || listed.Sessions[1].CuposDisponibles != 1 || listed.Sessions[2].CuposDisponibles != 2 {
+		t.Errorf("unexpected slots per session: %+v", listed.Sessions[:3])
+	}
+
+	// Una excepción en la fecha de la segunda sesión la suspende y cancela sus reservas
+	body = fmt.Sprintf(`{"fecha_inicio":%q,"excepciones":[%q]}`, time.Now().Format("2006-01-02"), second.Inicio.In(time.Local).Format("2006-01-02"))
+	if w := app.do(t, "PUT", "/activities/{free}/schedule", adminToken, body); w.Code != http.StatusOK {
+		t.Fatalf("update schedule failed: %d %s", w.Code, w.Body.String())
+	}
+	decode(t, app.do(t, "GET", "/activities/{free}/sessions", "", ""), &listed)
+	for _, s := range listed.Sessions {
+		if s.ID == second.ID {
+			t.Errorf("expected the second session to be cancelled: %+v", listed.Sessions)
+		}
+	}
+	var inscriptions []struct {
+		SesionID     int    `json:"sesion_id"`
+		Estado       string `json:"estado"`
+		CancelReason string `json:"cancel_reason"`
+	}
+	decode(t, app.do(t, "GET", "/users/{other}/inscriptions", otherToken, ""), &inscriptions)
+	states := map[int]string{}
+	for _, inscription := range inscriptions {
+		states[inscription.SesionID] = inscription.Estado + " " + inscription.CancelReason
+	}
+	if states[first.ID] != "activa " || states[second.ID] != "cancelada clase suspendida" {
+		t.Errorf("unexpected bookings after the exception: %+v", inscriptions)
+	}
+}
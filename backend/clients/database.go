@@ -0,0 +1,49 @@
+package clients
+
+import (
+	"backend/config"
+	"fmt"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Open abre la conexión con el motor indicado en la configuración. Las
+// consultas del paquete usan SQL portable, así que sirven para los tres.
+func Open(cfg config.DatabaseConfig) (*gorm.DB, error) {
+	dsn := cfg.ConnectionString()
+
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case config.DriverMySQL:
+		dialector = mysql.Open(dsn)
+	case config.DriverPostgres:
+		dialector = postgres.Open(dsn)
+	case config.DriverSQLite:
+		dialector = sqlite.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Driver == config.DriverSQLite {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		// SQLite no admite escrituras concurrentes: una sola conexión serializa
+		// las transacciones y además mantiene viva la base en memoria
+		sqlDB.SetMaxOpenConns(1)
+		// Las claves foráneas vienen desactivadas en SQLite
+		if err := db.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
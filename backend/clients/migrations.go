@@ -0,0 +1,870 @@
+package clients
+
+import (
+	"backend/dao"
+	"backend/policy"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrSchemaOutdated indica que hay migraciones sin aplicar y el servidor no debe arrancar
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// migration es un cambio de esquema versionado. up y down corren dentro de la
+// misma transacción que registra (o borra) la versión en schema_migrations.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+	down    func(tx *gorm.DB) error
+}
+
+// migrations es la lista ordenada de migraciones. Una migración publicada no
+// se modifica: cualquier cambio de esquema o de datos va en una versión nueva.
+//
+// Cada migración describe sus tablas con estructuras propias, copiadas de los
+// modelos de dao al publicarla, y no con los modelos, que siguen cambiando.
+// Así cada versión parte del esquema que dejó la anterior y no necesita
+// comprobar lo que ya existe.
+var migrations = []migration{
+	{version: 1, name: "baseline", up: migrateBaseline, down: dropBaseline},
+	{version: 2, name: "class_sessions", up: migrateClassSessions, down: dropClassSessions},
+	{version: 3, name: "activity_slots", up: migrateActivitySlots, down: dropActivitySlots},
+}
+
+// MigrationStatus es el estado de una migración: AppliedAt es nil si está pendiente
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// GetMigrationStatus lista todas las migraciones conocidas con su estado
+func GetMigrationStatus(db *gorm.DB) ([]MigrationStatus, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if row, ok := applied[m.version]; ok {
+			appliedAt := row.AplicadaEn
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// CheckSchema verifica que estén aplicadas todas las migraciones y ninguna
+// desconocida, es decir, que el esquema sea exactamente el que espera el código
+func CheckSchema(db *gorm.DB) error {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for version := range applied {
+		if findMigration(version) == nil {
+			return fmt.Errorf("database schema version %d is newer than this build", version)
+		}
+	}
+	if pending := len(migrations) - len(applied); pending > 0 {
+		return fmt.Errorf("%w: %d pending migrations (run `migrate up`)", ErrSchemaOutdated, pending)
+	}
+	return nil
+}
+
+// MigrateUp aplica en orden las migraciones pendientes, cada una en su propia
+// transacción, y devuelve cuántas aplicó
+func MigrateUp(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&dao.SchemaMigration{}); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = withoutForeignKeys(db, func() error {
+		for _, m := range migrations {
+			if _, ok := applied[m.version]; ok {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&dao.SchemaMigration{Version: m.version, Nombre: m.name, AplicadaEn: time.Now()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrateDown revierte las últimas steps migraciones aplicadas, de la más
+// nueva a la más vieja, y devuelve cuántas revirtió
+func MigrateDown(db *gorm.DB, steps int) (int, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	count := 0
+	err = withoutForeignKeys(db, func() error {
+		for _, version := range versions {
+			m := findMigration(version)
+			if m == nil {
+				return fmt.Errorf("database schema version %d is newer than this build", version)
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := m.down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&dao.SchemaMigration{}, m.version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d (%s) failed: %w", m.version, m.name, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// appliedMigrations devuelve las versiones registradas en schema_migrations.
+// Una base sin esa tabla no tiene ninguna migración aplicada.
+func appliedMigrations(db *gorm.DB) (map[int]dao.SchemaMigration, error) {
+	applied := make(map[int]dao.SchemaMigration)
+	if !db.Migrator().HasTable(&dao.SchemaMigration{}) {
+		return applied, nil
+	}
+
+	var rows []dao.SchemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// findMigration busca una migración por versión
+func findMigration(version int) *migration {
+	for i := range migrations {
+		if migrations[i].version == version {
+			return &migrations[i]
+		}
+	}
+	return nil
+}
+
+// withoutForeignKeys desactiva las claves foráneas de SQLite mientras corre fn.
+// SQLite modifica columnas recreando la tabla y, con las claves activas, borrar
+// la tabla vieja borraría en cascada las filas que la referencian. En los
+// demás motores no hace nada.
+func withoutForeignKeys(db *gorm.DB, fn func() error) error {
+	if db.Dialector.Name() != "sqlite" {
+		return fn()
+	}
+
+	var enabled int
+	if err := db.Raw("PRAGMA foreign_keys").Scan(&enabled).Error; err != nil {
+		return err
+	}
+	if enabled == 0 {
+		return fn()
+	}
+	if err := db.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+		return err
+	}
+	defer db.Exec("PRAGMA foreign_keys = ON")
+	return fn()
+}
+
+// ================ MIGRACIÓN 1: LÍNEA BASE ================
+
+// Las tablas de la línea base, tal como eran cuando se publicó. No usan los
+// modelos de dao, que siguen cambiando: la misma migración tiene que crear
+// siempre el mismo esquema, y los cambios posteriores van en versiones nuevas.
+
+type baselineRole struct {
+	ID_rol      int    `gorm:"primary_key;auto_increment"`
+	Nombre      string `gorm:"not null;size:50;uniqueIndex"`
+	Descripcion string `gorm:"size:255"`
+
+	Permisos []baselineRolePermission `gorm:"foreignKey:ID_rol;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineRole) TableName() string { return "roles" }
+
+type baselineRolePermission struct {
+	ID_rol  int    `gorm:"primary_key;autoIncrement:false"`
+	Permiso string `gorm:"primary_key;size:64"`
+}
+
+func (baselineRolePermission) TableName() string { return "role_permissions" }
+
+type baselineUser struct {
+	ID                         int     `gorm:"primary_key"`
+	Name                       string  `gorm:"not_null"`
+	Username                   string  `gorm:"unique"`
+	PasswordHash               string  `gorm:"not_null"`
+	Email                      *string `gorm:"size:191;uniqueIndex"`
+	EmailVerificadoEn          *time.Time
+	Telefono                   string `gorm:"size:16"`
+	FechaNacimiento            *time.Time
+	ContactoEmergenciaNombre   string `gorm:"size:100"`
+	ContactoEmergenciaTelefono string `gorm:"size:16"`
+	FotoURL                    string `gorm:"size:512"`
+
+	Roles []baselineRole `gorm:"many2many:user_roles;joinForeignKey:ID_usuario;joinReferences:ID_rol"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineActivity struct {
+	ID_actividad  int    `gorm:"primary_key;auto_increment"`
+	Nombre        string `gorm:"not null;size:100"`
+	Profesor      string `gorm:"not null;size:100"`
+	Capacidad     int    `gorm:"not null;default:1"`
+	Categoria     string `gorm:"not null;size:100"`
+	Descripcion   string `gorm:"not null;size:255"`
+	Dia           int    `gorm:"not null;size:20"`
+	Hora_inicio   string `gorm:"not null;size:20"`
+	Hora_fin      string `gorm:"not null;size:20"`
+	ID_instructor *int   `gorm:"index"`
+}
+
+func (baselineActivity) TableName() string { return "activities" }
+
+type baselineInscription struct {
+	ID_inscripcion    int       `gorm:"primary_key;auto_increment"`
+	Fecha_inscripcion time.Time `gorm:"autoCreateTime"`
+	Estado            string    `gorm:"default:'activa';size:20"`
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
+	CancelledAt       *time.Time
+	CancelledBy       *int
+	CancelReason      string  `gorm:"size:255"`
+	ID_usuario        int     `gorm:"not null;index:idx_inscription_user_activity"`
+	ID_actividad      int     `gorm:"not null;index:idx_inscription_user_activity"`
+	Clave_activa      *string `gorm:"size:64;uniqueIndex"`
+
+	Usuario   baselineUser     `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+	Actividad baselineActivity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineInscription) TableName() string { return "inscriptions" }
+
+type baselineInscriptionHistory struct {
+	ID_historial   int       `gorm:"primary_key;auto_increment"`
+	ID_inscripcion int       `gorm:"not null;index"`
+	Estado         string    `gorm:"not null;size:20"`
+	Detalle        string    `gorm:"size:255"`
+	CreatedAt      time.Time `gorm:"autoCreateTime"`
+}
+
+func (baselineInscriptionHistory) TableName() string { return "inscription_histories" }
+
+type baselineWaitlistEntry struct {
+	ID_espera    int       `gorm:"primary_key;auto_increment"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	ID_usuario   int       `gorm:"not null;uniqueIndex:idx_waitlist_user_activity"`
+	ID_actividad int       `gorm:"not null;uniqueIndex:idx_waitlist_user_activity"`
+
+	Usuario   baselineUser     `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+	Actividad baselineActivity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineWaitlistEntry) TableName() string { return "waitlist_entries" }
+
+type baselineRefreshToken struct {
+	ID_refresh int       `gorm:"primary_key;auto_increment"`
+	TokenHash  string    `gorm:"size:64;not null;uniqueIndex"`
+	FamilyID   string    `gorm:"size:64;not null;index"`
+	ID_usuario int       `gorm:"not null;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	UsedAt     *time.Time
+	RevokedAt  *time.Time
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineRefreshToken) TableName() string { return "refresh_tokens" }
+
+type baselineRevokedToken struct {
+	JTI       string    `gorm:"primary_key;size:64"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
+
+func (baselineRevokedToken) TableName() string { return "revoked_tokens" }
+
+type baselinePasswordReset struct {
+	ID_reset   int       `gorm:"primary_key;auto_increment"`
+	TokenHash  string    `gorm:"size:64;not null;uniqueIndex"`
+	ID_usuario int       `gorm:"not null;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	UsedAt     *time.Time
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselinePasswordReset) TableName() string { return "password_resets" }
+
+type baselineInvitacion struct {
+	ID_invitacion string    `gorm:"primary_key;size:64"`
+	Email         string    `gorm:"size:191;not null;index"`
+	Roles         string    `gorm:"size:191;not null"`
+	ID_invitador  int       `gorm:"not null"`
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+	ExpiresAt     time.Time `gorm:"not null;index"`
+	AceptadaEn    *time.Time
+	ID_usuario    *int
+}
+
+func (baselineInvitacion) TableName() string { return "invitacions" }
+
+type baselineLoginThrottle struct {
+	Clave          string `gorm:"primary_key;size:191"`
+	Fallos         int    `gorm:"not null;default:0"`
+	UltimoFallo    *time.Time
+	BloqueadoHasta *time.Time `gorm:"index"`
+}
+
+func (baselineLoginThrottle) TableName() string { return "login_throttles" }
+
+type baselineLoginAttempt struct {
+	ID_intento int       `gorm:"primary_key;auto_increment"`
+	Username   string    `gorm:"size:191;index"`
+	IP         string    `gorm:"size:64;index"`
+	Motivo     string    `gorm:"size:32;not null"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (baselineLoginAttempt) TableName() string { return "login_attempts" }
+
+type baselineTwoFactor struct {
+	ID_usuario   int    `gorm:"primary_key;autoIncrement:false"`
+	Secreto      string `gorm:"size:64;not null"`
+	Activo       bool   `gorm:"not null;default:false"`
+	UltimoPaso   int64  `gorm:"not null;default:0"`
+	ConfirmadoEn *time.Time
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineTwoFactor) TableName() string { return "two_factors" }
+
+type baselineRecoveryCode struct {
+	ID_codigo  int    `gorm:"primary_key;auto_increment"`
+	ID_usuario int    `gorm:"not null;index"`
+	CodeHash   string `gorm:"size:64;not null;uniqueIndex"`
+	UsedAt     *time.Time
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineRecoveryCode) TableName() string { return "recovery_codes" }
+
+type baselineTwoFactorChallenge struct {
+	ID_challenge int       `gorm:"primary_key;auto_increment"`
+	TokenHash    string    `gorm:"size:64;not null;uniqueIndex"`
+	ID_usuario   int       `gorm:"not null;index"`
+	IP           string    `gorm:"size:64"`
+	Intentos     int       `gorm:"not null;default:0"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	UsedAt       *time.Time
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineTwoFactorChallenge) TableName() string { return "two_factor_challenges" }
+
+type baselineExternalIdentity struct {
+	ID_identidad int       `gorm:"primary_key;auto_increment"`
+	Proveedor    string    `gorm:"size:50;not null;uniqueIndex:idx_provider_subject"`
+	Subject      string    `gorm:"size:191;not null;uniqueIndex:idx_provider_subject"`
+	ID_usuario   int       `gorm:"not null;index"`
+	Email        string    `gorm:"size:191"`
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+
+	Usuario baselineUser `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+}
+
+func (baselineExternalIdentity) TableName() string { return "external_identities" }
+
+type baselineOIDCLoginState struct {
+	StateHash    string    `gorm:"primary_key;size:64"`
+	Proveedor    string    `gorm:"size:50;not null"`
+	Nonce        string    `gorm:"size:64;not null"`
+	CodeVerifier string    `gorm:"size:128;not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
+
+// El nombre es el que GORM deriva de OIDCLoginState
+func (baselineOIDCLoginState) TableName() string { return "o_id_c_login_states" }
+
+type baselineAuditEvent struct {
+	ID_evento  int       `gorm:"primary_key;auto_increment"`
+	ID_actor   *int      `gorm:"index"`
+	Accion     string    `gorm:"size:64;not null;index"`
+	Entidad    string    `gorm:"size:32;not null;index:idx_audit_entity"`
+	ID_entidad string    `gorm:"size:64;index:idx_audit_entity"`
+	Antes      string    `gorm:"type:text"`
+	Despues    string    `gorm:"type:text"`
+	IP         string    `gorm:"size:64"`
+	RequestID  string    `gorm:"size:64;index"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index"`
+}
+
+func (baselineAuditEvent) TableName() string { return "audit_events" }
+
+// migrateBaseline crea todas las tablas y siembra los roles. También convierte
+// las bases creadas antes de las migraciones versionadas, cuando el servidor
+// hacía AutoMigrate al iniciar: es idempotente y sirve sobre esas bases.
+func migrateBaseline(db *gorm.DB) error {
+	// Migrar todas las tablas en el orden correcto (respetando foreign keys)
+	err := db.AutoMigrate(&baselineRole{}, &baselineRolePermission{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate Role tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineUser{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate User table: %w", err)
+	}
+
+	err = seedBaselineRoles(db)
+	if err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+
+	err = migrateAdminRoles(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate admin roles: %w", err)
+	}
+
+	// Borrar is_admin rehace la tabla en SQLite, que pierde sus índices
+	err = db.AutoMigrate(&baselineUser{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate User table: %w", err)
+	}
+
+	err = migrateActivityCapacity(db)
+	if err != nil {
+		return fmt.Errorf("failed to migrate activity capacity: %w", err)
+	}
+
+	err = dropMisplacedActivityConstraints(db)
+	if err != nil {
+		return fmt.Errorf("failed to drop misplaced activity constraints: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineActivity{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate Activity table: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineInscription{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate Inscription table: %w", err)
+	}
+
+	err = fillActiveKeys(db)
+	if err != nil {
+		return fmt.Errorf("failed to fill inscription keys: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineInscriptionHistory{}, &baselineWaitlistEntry{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate Waitlist tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineRefreshToken{}, &baselineRevokedToken{}, &baselinePasswordReset{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate token tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineInvitacion{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate Invitation table: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineLoginThrottle{}, &baselineLoginAttempt{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate login attempt tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineTwoFactor{}, &baselineRecoveryCode{}, &baselineTwoFactorChallenge{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate two-factor tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineExternalIdentity{}, &baselineOIDCLoginState{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate external identity tables: %w", err)
+	}
+
+	err = db.AutoMigrate(&baselineAuditEvent{})
+	if err != nil {
+		return fmt.Errorf("failed to migrate audit table: %w", err)
+	}
+
+	// El antiguo índice único impedía volver a inscribirse después de cancelar,
+	// ahora que las inscripciones canceladas se conservan
+	if db.Migrator().HasIndex(&baselineInscription{}, "idx_user_activity") {
+		if err := db.Migrator().DropIndex(&baselineInscription{}, "idx_user_activity"); err != nil {
+			return fmt.Errorf("failed to drop legacy inscription index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dropBaseline borra todas las tablas de la línea base, de las que dependen
+// hacia las que son referenciadas
+func dropBaseline(db *gorm.DB) error {
+	return db.Migrator().DropTable(
+		&baselineAuditEvent{},
+		&baselineExternalIdentity{}, &baselineOIDCLoginState{},
+		&baselineTwoFactor{}, &baselineRecoveryCode{}, &baselineTwoFactorChallenge{},
+		&baselineLoginThrottle{}, &baselineLoginAttempt{},
+		&baselineInvitacion{},
+		&baselineRefreshToken{}, &baselineRevokedToken{}, &baselinePasswordReset{},
+		&baselineInscriptionHistory{}, &baselineWaitlistEntry{},
+		&baselineInscription{},
+		&baselineActivity{},
+		"user_roles",
+		&baselineUser{},
+		&baselineRolePermission{}, &baselineRole{},
+	)
+}
+
+// seedBaselineRoles crea los roles de la política con sus permisos. Al
+// iniciar, Prepare los vuelve a sincronizar con la política vigente.
+func seedBaselineRoles(db *gorm.DB) error {
+	for name, permissions := range policy.DefaultRoles {
+		role := baselineRole{Nombre: name}
+		if err := db.Where("nombre = ?", name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			err := db.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&baselineRolePermission{ID_rol: role.ID_rol, Permiso: permission}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fillActiveKeys completa Clave_activa de las inscripciones activas creadas
+// antes de que existiera la columna. Si un usuario ya tenía dos, solo la
+// primera queda con clave. Es idempotente.
+func fillActiveKeys(db *gorm.DB) error {
+	var inscriptions []baselineInscription
+	if err := db.Where("estado = ? AND clave_activa IS NULL", dao.EstadoActiva).Order("id_inscripcion").Find(&inscriptions).Error; err != nil {
+		return err
+	}
+	for _, inscription := range inscriptions {
+		clave := dao.ClaveActiva(inscription.ID_usuario, inscription.ID_actividad, nil)
+		err := db.Model(&baselineInscription{}).Where("id_inscripcion = ?", inscription.ID_inscripcion).Update("clave_activa", clave).Error
+		if isDuplicateKey(db, err) {
+			fmt.Printf("Warning: duplicate inscription %d left without key\n", inscription.ID_inscripcion)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropMisplacedActivityConstraints borra las claves foráneas que versiones
+// anteriores creaban al revés, sobre activities apuntando a inscriptions y a
+// waitlist_entries, y que impedían crear actividades. Es idempotente.
+func dropMisplacedActivityConstraints(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&baselineActivity{}) {
+		return nil
+	}
+	for _, name := range []string{"fk_inscriptions_actividad", "fk_waitlist_entries_actividad"} {
+		if migrator.HasConstraint(&baselineActivity{}, name) {
+			if err := migrator.DropConstraint(&baselineActivity{}, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// migrateActivityCapacity convierte la antigua columna cupos (cupos restantes)
+// en la capacidad fija de la actividad: capacidad = cupos + inscripciones activas.
+// Es idempotente: si la columna cupos ya no existe no hace nada.
+func migrateActivityCapacity(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&baselineActivity{}) || !migrator.HasColumn(&baselineActivity{}, "cupos") {
+		return nil
+	}
+
+	if !migrator.HasColumn(&baselineActivity{}, "capacidad") {
+		if err := migrator.AddColumn(&baselineActivity{}, "Capacidad"); err != nil {
+			return err
+		}
+	}
+
+	// El esquema con cupos no tenía sesiones: cuentan todas las inscripciones activas
+	backfill := "UPDATE activities SET capacidad = cupos"
+	if migrator.HasTable(&baselineInscription{}) {
+		backfill += ` + (SELECT COUNT(*) FROM inscriptions
+			WHERE inscriptions.id_actividad = activities.id_actividad AND inscriptions.estado = 'activa')`
+	}
+	if err := db.Exec(backfill).Error; err != nil {
+		return err
+	}
+
+	return migrator.DropColumn(&baselineActivity{}, "cupos")
+}
+
+// migrateAdminRoles reemplaza la antigua columna is_admin por roles: los admins
+// reciben el rol admin y el resto de los usuarios sin roles el rol socio.
+// Es idempotente: si la columna is_admin ya no existe no hace nada.
+func migrateAdminRoles(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasColumn(&baselineUser{}, "is_admin") {
+		return nil
+	}
+
+	var admin, socio baselineRole
+	if err := db.Where("nombre = ?", dao.RolAdmin).First(&admin).Error; err != nil {
+		return err
+	}
+	if err := db.Where("nombre = ?", dao.RolSocio).First(&socio).Error; err != nil {
+		return err
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO user_roles (id_usuario, id_rol)
+			SELECT id, ? FROM users WHERE is_admin = ?
+			AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.id_usuario = users.id AND user_roles.id_rol = ?)`,
+			admin.ID_rol, true, admin.ID_rol).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO user_roles (id_usuario, id_rol)
+			SELECT id, ? FROM users
+			WHERE NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.id_usuario = users.id)`,
+			socio.ID_rol).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return migrator.DropColumn(&baselineUser{}, "is_admin")
+}
+
+// ================ MIGRACIÓN 2: SESIONES ================
+
+type sessionsSchedule struct {
+	ID_actividad int       `gorm:"primary_key;autoIncrement:false"`
+	Fecha_inicio string    `gorm:"not null;size:10"`
+	Fecha_fin    *string   `gorm:"size:10"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+
+	Actividad baselineActivity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (sessionsSchedule) TableName() string { return "schedules" }
+
+type sessionsScheduleException struct {
+	ID_excepcion int    `gorm:"primary_key;auto_increment"`
+	ID_actividad int    `gorm:"not null;uniqueIndex:idx_exception_activity_date"`
+	Fecha        string `gorm:"not null;size:10;uniqueIndex:idx_exception_activity_date"`
+
+	Actividad baselineActivity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (sessionsScheduleException) TableName() string { return "schedule_exceptions" }
+
+type sessionsClassSession struct {
+	ID_sesion    int       `gorm:"primary_key;auto_increment"`
+	ID_actividad int       `gorm:"not null;uniqueIndex:idx_session_activity_start"`
+	Inicio       time.Time `gorm:"not null;uniqueIndex:idx_session_activity_start"`
+	Fin          time.Time `gorm:"not null"`
+	Cancelada    bool      `gorm:"not null;default:false"`
+
+	Actividad baselineActivity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (sessionsClassSession) TableName() string { return "class_sessions" }
+
+// sessionsInscription es baselineInscription con la sesión reservada
+type sessionsInscription struct {
+	ID_inscripcion    int       `gorm:"primary_key;auto_increment"`
+	Fecha_inscripcion time.Time `gorm:"autoCreateTime"`
+	Estado            string    `gorm:"default:'activa';size:20"`
+	CreatedAt         time.Time `gorm:"autoCreateTime"`
+	UpdatedAt         time.Time `gorm:"autoUpdateTime"`
+	CancelledAt       *time.Time
+	CancelledBy       *int
+	CancelReason      string  `gorm:"size:255"`
+	ID_usuario        int     `gorm:"not null;index:idx_inscription_user_activity"`
+	ID_actividad      int     `gorm:"not null;index:idx_inscription_user_activity"`
+	Clave_activa      *string `gorm:"size:64;uniqueIndex"`
+	ID_sesion         *int    `gorm:"index"`
+
+	Usuario   baselineUser          `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+	Actividad baselineActivity      `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+	Sesion    *sessionsClassSession `gorm:"foreignKey:ID_sesion;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+func (sessionsInscription) TableName() string { return "inscriptions" }
+
+// migrateClassSessions crea la recurrencia de las actividades, sus sesiones y
+// la sesión reservada por cada inscripción
+func migrateClassSessions(db *gorm.DB) error {
+	if err := db.AutoMigrate(&sessionsSchedule{}, &sessionsScheduleException{}, &sessionsClassSession{}); err != nil {
+		return fmt.Errorf("failed to migrate session tables: %w", err)
+	}
+
+	// AutoMigrate agrega la columna, la foreign key y después los índices, que
+	// SQLite pierde al rehacer la tabla para agregar la foreign key
+	if err := db.AutoMigrate(&sessionsInscription{}); err != nil {
+		return fmt.Errorf("failed to add inscription session column: %w", err)
+	}
+	return nil
+}
+
+// dropClassSessions revierte migrateClassSessions. Las reservas de sesiones
+// quedan como inscripciones semanales.
+func dropClassSessions(db *gorm.DB) error {
+	if err := db.Migrator().DropConstraint(&sessionsInscription{}, "Sesion"); err != nil {
+		return err
+	}
+	if err := db.Migrator().DropColumn(&sessionsInscription{}, "ID_sesion"); err != nil {
+		return err
+	}
+	// En SQLite borrar la columna rehace la tabla sin sus índices
+	if err := db.AutoMigrate(&baselineInscription{}); err != nil {
+		return err
+	}
+	return db.Migrator().DropTable(&sessionsClassSession{}, &sessionsScheduleException{}, &sessionsSchedule{})
+}
+
+// ================ MIGRACIÓN 3: HORARIOS ================
+
+// slotsActivity es baselineActivity con los horarios en activity_slots
+type slotsActivity struct {
+	ID_actividad  int    `gorm:"primary_key;auto_increment"`
+	Nombre        string `gorm:"not null;size:100"`
+	Profesor      string `gorm:"not null;size:100"`
+	Capacidad     int    `gorm:"not null;default:1"`
+	Categoria     string `gorm:"not null;size:100"`
+	Descripcion   string `gorm:"not null;size:255"`
+	ID_instructor *int   `gorm:"index"`
+
+	Horarios []slotsActivitySlot `gorm:"foreignKey:ID_actividad;constraint:OnDelete:CASCADE"`
+}
+
+func (slotsActivity) TableName() string { return "activities" }
+
+type slotsActivitySlot struct {
+	ID_horario   int    `gorm:"primary_key;auto_increment"`
+	ID_actividad int    `gorm:"not null;index"`
+	Dia          int    `gorm:"not null"`
+	Hora_inicio  string `gorm:"not null;size:20"`
+	Hora_fin     string `gorm:"not null;size:20"`
+}
+
+func (slotsActivitySlot) TableName() string { return "activity_slots" }
+
+// legacyActivityTimetable son las columnas de horario que activities tenía
+// antes de activity_slots, cuando cada actividad se dictaba un solo día
+type legacyActivityTimetable struct {
+	Dia         int    `gorm:"not null;default:1"`
+	Hora_inicio string `gorm:"not null;default:'';size:20"`
+	Hora_fin    string `gorm:"not null;default:'';size:20"`
+}
+
+func (legacyActivityTimetable) TableName() string {
+	return "activities"
+}
+
+// migrateActivitySlots pasa los horarios de las actividades a activity_slots,
+// donde una actividad puede tener varios días por semana. Cada actividad de un
+// solo día conserva ese día y horario.
+func migrateActivitySlots(db *gorm.DB) error {
+	// slotsActivity primero: la foreign key de activity_slots sale de sus Horarios
+	if err := db.AutoMigrate(&slotsActivity{}, &slotsActivitySlot{}); err != nil {
+		return fmt.Errorf("failed to migrate activity slot table: %w", err)
+	}
+
+	err := db.Exec(`INSERT INTO activity_slots (id_actividad, dia, hora_inicio, hora_fin)
+		SELECT id_actividad, dia, hora_inicio, hora_fin FROM activities
+		WHERE id_actividad NOT IN (SELECT id_actividad FROM activity_slots)`).Error
+	if err != nil {
+		return fmt.Errorf("failed to copy activity timetables: %w", err)
+	}
+	for _, column := range []string{"dia", "hora_inicio", "hora_fin"} {
+		if err := db.Migrator().DropColumn(&legacyActivityTimetable{}, column); err != nil {
+			return fmt.Errorf("failed to drop activity column %s: %w", column, err)
+		}
+	}
+	// En SQLite borrar columnas rehace la tabla sin sus índices
+	if err := db.AutoMigrate(&slotsActivity{}); err != nil {
+		return fmt.Errorf("failed to restore activity indexes: %w", err)
+	}
+	return nil
+}
+
+// dropActivitySlots revierte migrateActivitySlots. Cada actividad se queda con
+// el primero de sus horarios.
+func dropActivitySlots(db *gorm.DB) error {
+	migrator := db.Migrator()
+	for _, field := range []string{"Dia", "Hora_inicio", "Hora_fin"} {
+		if err := migrator.AddColumn(&legacyActivityTimetable{}, field); err != nil {
+			return err
+		}
+	}
+
+	firstSlot := func(column string) string {
+		return `(SELECT ` + column + ` FROM activity_slots
+			WHERE activity_slots.id_actividad = activities.id_actividad ORDER BY id_horario LIMIT 1)`
+	}
+	err := db.Exec(`UPDATE activities SET dia = ` + firstSlot("dia") +
+		`, hora_inicio = ` + firstSlot("hora_inicio") +
+		`, hora_fin = ` + firstSlot("hora_fin") +
+		` WHERE EXISTS (SELECT 1 FROM activity_slots WHERE activity_slots.id_actividad = activities.id_actividad)`).Error
+	if err != nil {
+		return err
+	}
+	return migrator.DropTable(&slotsActivitySlot{})
+}
@@ -0,0 +1,192 @@
+package clients
+
+import (
+	"backend/config"
+	"backend/dao"
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestMigrateUpDownAndStatus(t *testing.T) {
+	previous := DB
+	defer func() { DB = previous }()
+
+	client := NewDatabaseClient(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:migrate_up_down?mode=memory&cache=shared"})
+	sqlDB, _ := client.DB.DB()
+	defer sqlDB.Close()
+
+	// Una base vacía tiene todas las migraciones pendientes y no puede atender pedidos
+	if err := client.Prepare(); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated on an empty database, got %v", err)
+	}
+
+	applied, err := MigrateUp(client.DB)
+	if err != nil || applied != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d (%v)", len(migrations), applied, err)
+	}
+	if applied, err := MigrateUp(client.DB); err != nil || applied != 0 {
+		t.Fatalf("expected nothing left to apply, got %d (%v)", applied, err)
+	}
+
+	statuses, err := GetMigrationStatus(client.DB)
+	if err != nil {
+		t.Fatalf("failed to get status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("expected migration %d (%s) to be applied", status.Version, status.Name)
+		}
+	}
+
+	// Una base creada antes de las migraciones versionadas solo tiene la línea
+	// base y no tiene schema_migrations: se adopta sin perder filas
+	user := dao.User{Name: "Socio", Username: "socio", PasswordHash: "x"}
+	client.DB.Create(&user)
+	activity := dao.Activity{Nombre: "Yoga", Capacidad: 5, Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}}}
+	client.DB.Create(&activity)
+	if err := client.DB.Create(&dao.Inscription{ID_usuario: user.ID, ID_actividad: activity.ID_actividad, Estado: dao.EstadoActiva}).Error; err != nil {
+		t.Fatalf("failed to create inscription: %v", err)
+	}
+	if _, err := MigrateDown(client.DB, len(migrations)-1); err != nil {
+		t.Fatalf("failed to revert to the baseline: %v", err)
+	}
+	client.DB.Migrator().DropTable(&dao.SchemaMigration{})
+	if applied, err := MigrateUp(client.DB); err != nil || applied != len(migrations) {
+		t.Fatalf("failed to adopt an unversioned database: %d (%v)", applied, err)
+	}
+	var inscriptions int64
+	client.DB.Model(&dao.Inscription{}).Count(&inscriptions)
+	if inscriptions != 1 {
+		t.Fatalf("expected the inscription to survive the baseline, got %d", inscriptions)
+	}
+	assertSchemaCoversModels(t, client.DB)
+
+	if !client.DB.Migrator().HasConstraint(&dao.Inscription{}, "Sesion") {
+		t.Fatal("expected the inscription session foreign key")
+	}
+	if !client.DB.Migrator().HasConstraint(&dao.Activity{}, "Horarios") {
+		t.Fatal("expected the activity slot foreign key")
+	}
+
+	// Revertir los horarios deja a cada actividad con su primer día y volver a
+	// aplicarlos lo pasa otra vez a activity_slots
+	client.DB.Create(&dao.ActivitySlot{ID_actividad: activity.ID_actividad, Dia: 3, Hora_inicio: "18:00", Hora_fin: "19:00"})
+	if _, err := MigrateDown(client.DB, 1); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	var legacy legacyActivityTimetable
+	client.DB.First(&legacy)
+	if client.DB.Migrator().HasTable(&dao.ActivitySlot{}) || legacy.Dia != 1 || legacy.Hora_inicio != "08:00" || legacy.Hora_fin != "09:00" {
+		t.Fatalf("expected the slots down to keep the first horario in activities, got %+v", legacy)
+	}
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("failed to migrate again: %v", err)
+	}
+	var slots []dao.ActivitySlot
+	client.DB.Find(&slots)
+	if len(slots) != 1 || slots[0].ID_actividad != activity.ID_actividad || slots[0].Dia != 1 || client.DB.Migrator().HasColumn(&legacyActivityTimetable{}, "dia") {
+		t.Fatalf("expected the single day to move to activity_slots, got %+v", slots)
+	}
+	if _, err := MigrateDown(client.DB, 1); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+
+	// Revertir las sesiones conserva las inscripciones
+	if _, err := MigrateDown(client.DB, 1); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	if client.DB.Migrator().HasTable(&dao.ClassSession{}) || client.DB.Migrator().HasColumn(&dao.Inscription{}, "ID_sesion") {
+		t.Fatal("expected the sessions down to drop the session tables and column")
+	}
+	client.DB.Model(&dao.Inscription{}).Count(&inscriptions)
+	if inscriptions != 1 {
+		t.Fatalf("expected the inscription to survive the sessions down, got %d", inscriptions)
+	}
+
+	if _, err := MigrateDown(client.DB, 1); err != nil {
+		t.Fatalf("failed to revert: %v", err)
+	}
+	if client.DB.Migrator().HasTable(&dao.Activity{}) {
+		t.Fatal("expected the baseline down to drop the tables")
+	}
+	if err := CheckSchema(client.DB); !errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected ErrSchemaOutdated after reverting, got %v", err)
+	}
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("failed to migrate again: %v", err)
+	}
+	if err := CheckSchema(client.DB); err != nil {
+		t.Fatalf("expected an up to date schema, got %v", err)
+	}
+}
+
+func TestCheckSchemaRejectsUnknownVersions(t *testing.T) {
+	previous := DB
+	defer func() { DB = previous }()
+
+	client := NewDatabaseClient(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:migrate_newer?mode=memory&cache=shared"})
+	sqlDB, _ := client.DB.DB()
+	defer sqlDB.Close()
+
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	// Una versión que este build no conoce la aplicó un binario más nuevo
+	client.DB.Create(&dao.SchemaMigration{Version: 9999, Nombre: "future"})
+
+	err := CheckSchema(client.DB)
+	if err == nil || errors.Is(err, ErrSchemaOutdated) {
+		t.Fatalf("expected an error for a newer schema, got %v", err)
+	}
+	if _, err := MigrateDown(client.DB, 1); err == nil {
+		t.Fatal("expected reverting an unknown migration to fail")
+	}
+}
+
+// Las migraciones no usan los modelos de dao: si un modelo cambia sin una
+// migración nueva, el esquema migrado deja de cubrirlo
+func TestMigrationsCoverCurrentModels(t *testing.T) {
+	client := NewDatabaseClient(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:migrate_models?mode=memory&cache=shared"})
+	sqlDB, _ := client.DB.DB()
+	defer sqlDB.Close()
+
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	assertSchemaCoversModels(t, client.DB)
+}
+
+// assertSchemaCoversModels comprueba que la base tenga las tablas, columnas,
+// índices y foreign keys de los modelos actuales
+func assertSchemaCoversModels(t *testing.T, db *gorm.DB) {
+	t.Helper()
+	models := []interface{}{&dao.Role{}, &dao.RolePermission{}, &dao.User{}, &dao.Activity{}, &dao.ActivitySlot{}, &dao.Schedule{}, &dao.ScheduleException{}, &dao.ClassSession{}, &dao.Inscription{}, &dao.InscriptionHistory{}, &dao.WaitlistEntry{}, &dao.RefreshToken{}, &dao.RevokedToken{}, &dao.PasswordReset{}, &dao.LoginThrottle{}, &dao.LoginAttempt{}, &dao.TwoFactor{}, &dao.RecoveryCode{}, &dao.TwoFactorChallenge{}, &dao.ExternalIdentity{}, &dao.OIDCLoginState{}, &dao.Invitacion{}, &dao.AuditEvent{}}
+	migrator := db.Migrator()
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("failed to parse %T: %v", model, err)
+		}
+		if !migrator.HasTable(model) {
+			t.Errorf("missing table %s", stmt.Schema.Table)
+			continue
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !field.IgnoreMigration && !migrator.HasColumn(model, field.DBName) {
+				t.Errorf("missing column %s.%s", stmt.Schema.Table, field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(model, index.Name) {
+				t.Errorf("missing index %s", index.Name)
+			}
+		}
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if constraint := rel.ParseConstraint(); constraint != nil && constraint.Schema == stmt.Schema && !migrator.HasConstraint(model, constraint.Name) {
+				t.Errorf("missing foreign key %s", constraint.Name)
+			}
+		}
+	}
+}
@@ -1,76 +1,134 @@
 package clients
 
 import (
+	"backend/config"
 	"backend/dao"
+	"backend/policy"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"time"
 
-	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var (
 	DB *gorm.DB
 )
 
-type MysqlClient struct {
-	DB *gorm.DB
+var (
+	// ErrNoAvailableSlots indica que la actividad ya no tiene cupos libres
+	ErrNoAvailableSlots = errors.New("activity has no available slots")
+	// ErrAlreadyInscribed indica que el usuario ya está inscripto en la actividad
+	ErrAlreadyInscribed = errors.New("user already inscribed in this activity")
+	// ErrAlreadyInWaitlist indica que el usuario ya está en la lista de espera de la actividad
+	ErrAlreadyInWaitlist = errors.New("user already in waitlist")
+	// ErrSlotsAvailable indica que la actividad tiene cupos y no corresponde anotarse en la lista de espera
+	ErrSlotsAvailable = errors.New("activity has available slots")
+	// ErrCapacityBelowInscriptions indica que la nueva capacidad no alcanza para las inscripciones activas
+	ErrCapacityBelowInscriptions = errors.New("capacidad cannot be lower than active inscriptions")
+	// ErrSessionUnavailable indica que la sesión no existe, está cancelada o ya empezó
+	ErrSessionUnavailable = errors.New("session is not available for booking")
+	// ErrInscriptionNotActive indica que la inscripción ya fue cancelada o completada
+	ErrInscriptionNotActive = errors.New("inscription is not active")
+	// ErrInvalidRefreshToken indica que el refresh token no existe, venció o fue revocado
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused indica que se presentó un refresh token ya canjeado
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrInvalidOIDCState indica que el state del callback no corresponde a un login en curso
+	ErrInvalidOIDCState = errors.New("invalid or expired state")
+	// ErrInvalidResetToken indica que el token para restablecer la contraseña no existe, venció o ya se usó
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	// ErrInvalidInvitation indica que la invitación no existe, venció o ya se aceptó
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+	// ErrInvalidVerificationToken indica que el link de verificación es de un email que el usuario ya no tiene
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+)
+
+// activeInscriptionsCount cuenta las inscripciones semanales activas de la actividad de la fila actual
+const activeInscriptionsCount = `(SELECT COUNT(*) FROM inscriptions
+	WHERE inscriptions.id_actividad = activities.id_actividad AND inscriptions.id_sesion IS NULL
+	AND inscriptions.estado = 'activa')`
+
+// availableSlotsSelect selecciona la actividad junto con sus cupos_disponibles
+const availableSlotsSelect = "activities.*, activities.capacidad - " + activeInscriptionsCount + " AS cupos_disponibles"
+
+// withAvailableSlots agrega a la consulta el cálculo de cupos_disponibles
+func withAvailableSlots(db *gorm.DB) *gorm.DB {
+	return db.Select(availableSlotsSelect)
 }
 
-func NewMysqlClient() *MysqlClient {
-	dsnFormat := "%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4&loc=Local"
-	//server isma
-	//dsn := fmt.Sprintf(dsnFormat, "root", "Dinorex-2705", "127.0.0.1", 3306, "gym")
-	//server lucas
-	//dsn := fmt.Sprintf(dsnFormat, "root", "root", "localhost", 3306, "backend")
-	//server franco
-	dsn := fmt.Sprintf(dsnFormat, "root", "franco2510", "localhost", 3306, "backend")
+// orderedSlots ordena los horarios de una actividad por día y hora
+func orderedSlots(db *gorm.DB) *gorm.DB {
+	return db.Order("dia, hora_inicio, id_horario")
+}
 
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		panic(fmt.Errorf("failed to connect to database: %v", err))
-	}
+// withTimetable precarga los horarios semanales de las actividades
+func withTimetable(db *gorm.DB) *gorm.DB {
+	return db.Preload("Horarios", orderedSlots)
+}
 
-	// IMPORTANTE: Asignar la conexión a la variable global DB ANTES de hacer migraciones
-	DB = db
+// sessionSlotsSelect selecciona la sesión junto con sus cupos_disponibles
+const sessionSlotsSelect = `class_sessions.*, activities.capacidad - (SELECT COUNT(*) FROM inscriptions
+	WHERE inscriptions.id_sesion = class_sessions.id_sesion AND inscriptions.estado = 'activa') AS cupos_disponibles`
 
-	// Migrar todas las tablas en el orden correcto (respetando foreign keys)
-	err = DB.AutoMigrate(&dao.User{})
-	if err != nil {
-		panic(fmt.Errorf("failed to migrate User table: %v", err))
-	}
+// withSessionSlots agrega a la consulta de sesiones el cálculo de cupos_disponibles
+func withSessionSlots(db *gorm.DB) *gorm.DB {
+	return db.Select(sessionSlotsSelect).Joins("JOIN activities ON activities.id_actividad = class_sessions.id_actividad")
+}
 
-	err = DB.AutoMigrate(&dao.Activity{})
-	if err != nil {
-		panic(fmt.Errorf("failed to migrate Activity table: %v", err))
+// forSession limita las inscripciones a las de la sesión, o a las semanales si sessionID es nil
+func forSession(sessionID *int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if sessionID == nil {
+			return db.Where("id_sesion IS NULL")
+		}
+		return db.Where("id_sesion = ?", *sessionID)
 	}
+}
 
-	err = DB.AutoMigrate(&dao.Inscription{})
-	if err != nil {
-		panic(fmt.Errorf("failed to migrate Inscription table: %v", err))
-	}
+// DatabaseClient es la conexión a la base de datos
+type DatabaseClient struct {
+	DB *gorm.DB
+}
 
-	// Crear índices adicionales si es necesario
-	err = DB.Exec(`
-		CREATE UNIQUE INDEX IF NOT EXISTS idx_user_activity 
-		ON inscriptions (ID_usuario, ID_actividad)
-	`).Error
+// NewDatabaseClient se conecta a la base de la configuración (MySQL, PostgreSQL
+// o SQLite). No migra: eso lo hace MigrateUp, desde el comando migrate o al
+// iniciar si está activado database.auto_migrate.
+func NewDatabaseClient(cfg config.DatabaseConfig) *DatabaseClient {
+	db, err := Open(cfg)
 	if err != nil {
-		fmt.Printf("Warning: Could not create unique index: %v\n", err)
+		panic(fmt.Errorf("failed to connect to database: %v", err))
 	}
 
-	fmt.Println("Database migration completed successfully")
+	// IMPORTANTE: Asignar la conexión a la variable global DB
+	DB = db
 
-	return &MysqlClient{
+	return &DatabaseClient{
 		DB: db,
 	}
 }
 
+// Prepare deja la base lista para atender pedidos: verifica que el esquema esté
+// al día y sincroniza los permisos de los roles con la política
+func (c *DatabaseClient) Prepare() error {
+	if err := CheckSchema(c.DB); err != nil {
+		return err
+	}
+	if err := SeedRoles(policy.DefaultRoles); err != nil {
+		return fmt.Errorf("failed to seed roles: %w", err)
+	}
+	return nil
+}
+
 // ================ USER METHODS ================
 
 // GetUserByID obtiene un usuario por su ID
 func GetUserByID(id int) (dao.User, error) {
 	var user dao.User
-	if err := DB.First(&user, id).Error; err != nil {
+	if err := DB.Preload("Roles").First(&user, id).Error; err != nil {
 		return dao.User{}, err
 	}
 	return user, nil
@@ -79,15 +137,34 @@ func GetUserByID(id int) (dao.User, error) {
 // GetUserByUsername obtiene un usuario por su username
 func GetUserByUsername(username string) (dao.User, error) {
 	var user dao.User
-	if err := DB.Where("username = ?", username).First(&user).Error; err != nil {
+	if err := DB.Preload("Roles").Where("username = ?", username).First(&user).Error; err != nil {
+		return dao.User{}, err
+	}
+	return user, nil
+}
+
+// GetUserByEmail obtiene un usuario por email
+func GetUserByEmail(email string) (dao.User, error) {
+	var user dao.User
+	if err := DB.Preload("Roles").Where("email = ?", email).First(&user).Error; err != nil {
 		return dao.User{}, err
 	}
 	return user, nil
 }
 
 // CreateUser crea un nuevo usuario en la base de datos
-func CreateUser(user dao.User) (dao.User, error) {
-	if err := DB.Create(&user).Error; err != nil {
+func CreateUser(user dao.User, audit dao.AuditEvent) (dao.User, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		// Sin usuario autenticado, el que se registra es el actor
+		if audit.ID_actor == nil {
+			audit.ID_actor = &user.ID
+		}
+		return recordAudit(tx, audit, dao.AccionUsuarioRegistrado, dao.EntidadUsuario, user.ID, nil, user)
+	})
+	if err != nil {
 		return dao.User{}, err
 	}
 	return user, nil
@@ -96,20 +173,82 @@ func CreateUser(user dao.User) (dao.User, error) {
 // GetAllUsers obtiene todos los usuarios
 func GetAllUsers() ([]dao.User, error) {
 	var users []dao.User
-	if err := DB.Find(&users).Error; err != nil {
+	if err := DB.Preload("Roles").Find(&users).Error; err != nil {
 		return nil, err
 	}
 	return users, nil
 }
 
-// UpdateUser actualiza un usuario existente
-func UpdateUser(user dao.User) error {
-	return DB.Save(&user).Error
+// UpdateUser actualiza un usuario existente. Los roles se cambian con SetUserRoles.
+// Si cambia la contraseña se cierran todas las sesiones del usuario.
+func UpdateUser(user dao.User, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before dao.User
+		if err := tx.First(&before, user.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Omit("Roles").Save(&user).Error; err != nil {
+			return err
+		}
+		if user.PasswordHash != before.PasswordHash {
+			err := tx.Model(&dao.RefreshToken{}).
+				Where("id_usuario = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", time.Now()).Error
+			if err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, audit, dao.AccionUsuarioModificado, dao.EntidadUsuario, user.ID, before, user)
+	})
+}
+
+// UpdatePasswordHash reemplaza el hash de la contraseña de un usuario
+func UpdatePasswordHash(id int, passwordHash string) error {
+	return DB.Model(&dao.User{}).Where("id = ?", id).Update("password_hash", passwordHash).Error
+}
+
+// MarkEmailVerified marca como verificado el email del usuario, solo si sigue
+// siendo el mismo que se envió en el link. Verificar dos veces no es un error.
+func MarkEmailVerified(id int, email string, at time.Time, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&dao.User{}).
+			Where("id = ? AND email = ? AND email_verificado_en IS NULL", id, email).
+			Update("email_verificado_en", at)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return recordAudit(tx, audit, dao.AccionEmailVerificado, dao.EntidadUsuario, id,
+				map[string]interface{}{"email_verificado_en": nil}, map[string]interface{}{"email_verificado_en": at})
+		}
+
+		var count int64
+		if err := tx.Model(&dao.User{}).Where("id = ? AND email = ?", id, email).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrInvalidVerificationToken
+		}
+		return nil
+	})
 }
 
 // DeleteUser elimina un usuario por ID
-func DeleteUser(id int) error {
-	return DB.Delete(&dao.User{}, id).Error
+func DeleteUser(id int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before dao.User
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		// user_roles no borra en cascada: sin esto falla la FK de cualquier usuario con roles
+		if err := tx.Model(&before).Association("Roles").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Delete(&dao.User{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionUsuarioEliminado, dao.EntidadUsuario, id, before, nil)
+	})
 }
 
 // ================ ACTIVITY METHODS ================
@@ -117,7 +256,7 @@ func DeleteUser(id int) error {
 // GetActivityByID obtiene una actividad por su ID
 func GetActivityByID(id int) (dao.Activity, error) {
 	var activity dao.Activity
-	if err := DB.First(&activity, id).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).First(&activity, id).Error; err != nil {
 		return dao.Activity{}, err
 	}
 	return activity, nil
@@ -126,15 +265,21 @@ func GetActivityByID(id int) (dao.Activity, error) {
 // GetActivities obtiene todas las actividades
 func GetActivities() (dao.Activities, error) {
 	var activities dao.Activities
-	if err := DB.Find(&activities).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
 }
 
 // InsertActivity crea una nueva actividad en la base de datos
-func InsertActivity(activity dao.Activity) (dao.Activity, error) {
-	if err := DB.Create(&activity).Error; err != nil {
+func InsertActivity(activity dao.Activity, audit dao.AuditEvent) (dao.Activity, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&activity).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionActividadCreada, dao.EntidadActividad, activity.ID_actividad, nil, activity)
+	})
+	if err != nil {
 		return dao.Activity{}, err
 	}
 	return activity, nil
@@ -142,13 +287,12 @@ func InsertActivity(activity dao.Activity) (dao.Activity, error) {
 func GetActivitiesByUserID(userID int) (dao.Activities, error) {
 	var activities dao.Activities
 
-	// Realizar una consulta JOIN para obtener las actividades a las que el usuario está inscrito
+	// Actividades a las que el usuario está inscrito; con reservas a varias
+	// sesiones la actividad aparece una sola vez
 	err := DB.
-		Table("activities").
-		Select("activities.*").
-		Joins("JOIN inscriptions ON inscriptions.id_actividad = activities.id_actividad").
-		Where("inscriptions.id_usuario = ?", userID).
-		Scan(&activities).Error
+		Scopes(withAvailableSlots, withTimetable).
+		Where("activities.id_actividad IN (SELECT inscriptions.id_actividad FROM inscriptions WHERE inscriptions.id_usuario = ? AND inscriptions.estado = ?)", userID, dao.EstadoActiva).
+		Find(&activities).Error
 
 	if err != nil {
 		return nil, err
@@ -160,7 +304,7 @@ func GetActivitiesByUserID(userID int) (dao.Activities, error) {
 // GetActivitiesByCategory obtiene actividades por categoría
 func GetActivitiesByCategory(categoria string) (dao.Activities, error) {
 	var activities dao.Activities
-	if err := DB.Where("categoria = ?", categoria).Find(&activities).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).Where("categoria = ?", categoria).Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
@@ -169,50 +313,167 @@ func GetActivitiesByCategory(categoria string) (dao.Activities, error) {
 // GetActivitiesByProfesor obtiene actividades por profesor
 func GetActivitiesByProfesor(profesor string) (dao.Activities, error) {
 	var activities dao.Activities
-	if err := DB.Where("profesor = ?", profesor).Find(&activities).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).Where("profesor = ?", profesor).Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
 }
 
-// GetActivitiesByDay obtiene actividades por día
+// GetActivitiesByDay obtiene las actividades que tienen algún horario ese día
 func GetActivitiesByDay(dia string) (dao.Activities, error) {
 	var activities dao.Activities
-	if err := DB.Where("dia = ?", dia).Find(&activities).Error; err != nil {
+	err := DB.Scopes(withAvailableSlots, withTimetable).
+		Where("activities.id_actividad IN (SELECT activity_slots.id_actividad FROM activity_slots WHERE activity_slots.dia = ?)", dia).
+		Find(&activities).Error
+	if err != nil {
 		return nil, err
 	}
 	return activities, nil
 }
 
-// UpdateActivity actualiza una actividad existente
-func UpdateActivity(activity dao.Activity) error {
-	return DB.Save(&activity).Error
+// UpdateActivity actualiza una actividad existente y reemplaza sus horarios
+// por los de activity. La capacidad nunca puede quedar por debajo de las
+// inscripciones activas. Si sessions no es nil, en la misma transacción
+// sincroniza las sesiones entre from y to con ellas, como SyncSessions.
+func UpdateActivity(activity dao.Activity, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before, err := ensureCapacity(tx, activity.ID_actividad, activity.Capacidad)
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(&activity).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_actividad = ?", activity.ID_actividad).Delete(&dao.ActivitySlot{}).Error; err != nil {
+			return err
+		}
+		for i := range activity.Horarios {
+			activity.Horarios[i].ID_horario = 0
+			activity.Horarios[i].ID_actividad = activity.ID_actividad
+		}
+		if len(activity.Horarios) > 0 {
+			if err := tx.Create(&activity.Horarios).Error; err != nil {
+				return err
+			}
+		}
+		if err := recordAudit(tx, audit, dao.AccionActividadModificada, dao.EntidadActividad, activity.ID_actividad, before, activity); err != nil {
+			return err
+		}
+		if sessions == nil {
+			return nil
+		}
+		_, err = syncSessions(tx, activity.ID_actividad, sessions, from, to, audit)
+		return err
+	})
 }
 
 // DeleteActivity elimina una actividad por ID
-func DeleteActivity(id int) error {
-	return DB.Delete(&dao.Activity{}, id).Error
+func DeleteActivity(id int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before dao.Activity
+		if err := tx.Scopes(withTimetable).First(&before, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&dao.Activity{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionActividadEliminada, dao.EntidadActividad, id, before, nil)
+	})
 }
 
 // GetActivitiesWithAvailableSlots obtiene actividades con cupos disponibles
 func GetActivitiesWithAvailableSlots() (dao.Activities, error) {
 	var activities dao.Activities
-	if err := DB.Where("cupos > 0").Find(&activities).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).Where("activities.capacidad > " + activeInscriptionsCount).Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
 }
 
-// UpdateActivitySlots actualiza los cupos de una actividad
-func UpdateActivitySlots(id int, newSlots int) error {
-	return DB.Model(&dao.Activity{}).Where("id_actividad = ?", id).Update("cupos", newSlots).Error
+// UpdateActivityCapacity actualiza la capacidad de una actividad
+func UpdateActivityCapacity(id int, capacidad int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		before, err := ensureCapacity(tx, id, capacidad)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&dao.Activity{}).Where("id_actividad = ?", id).Update("capacidad", capacidad).Error; err != nil {
+			return err
+		}
+		after := before
+		after.Capacidad = capacidad
+		return recordAudit(tx, audit, dao.AccionCapacidadModificada, dao.EntidadActividad, id, before, after)
+	})
+}
+
+// lockActivity bloquea la fila de la actividad hasta el final de la
+// transacción. Escribe la fila en lugar de usar SELECT ... FOR UPDATE, que
+// SQLite ignora: así la transacción toma el bloqueo de escritura antes de leer
+// en cualquier motor, y las inscripciones simultáneas esperan su turno.
+func lockActivity(tx *gorm.DB, activityID int) error {
+	return tx.Exec("UPDATE activities SET capacidad = capacidad WHERE id_actividad = ?", activityID).Error
+}
+
+// ensureCapacity bloquea la fila de la actividad y verifica que la capacidad
+// alcance para las inscripciones semanales activas y para las de cada sesión
+// futura. Devuelve la actividad como estaba.
+func ensureCapacity(tx *gorm.DB, activityID int, capacidad int) (dao.Activity, error) {
+	var activity dao.Activity
+	if err := lockActivity(tx, activityID); err != nil {
+		return dao.Activity{}, err
+	}
+	if err := tx.Scopes(withTimetable).First(&activity, activityID).Error; err != nil {
+		return dao.Activity{}, err
+	}
+
+	active, err := countActiveInscriptions(tx, activityID, nil)
+	if err != nil {
+		return dao.Activity{}, err
+	}
+	var busiestSession int64
+	err = tx.Model(&dao.Inscription{}).
+		Select("COUNT(*)").
+		Joins("JOIN class_sessions ON class_sessions.id_sesion = inscriptions.id_sesion").
+		Where("inscriptions.id_actividad = ? AND inscriptions.estado = ? AND class_sessions.inicio > ?", activityID, dao.EstadoActiva, time.Now()).
+		Group("inscriptions.id_sesion").
+		Order("COUNT(*) DESC").
+		Limit(1).
+		Scan(&busiestSession).Error
+	if err != nil {
+		return dao.Activity{}, err
+	}
+	if int64(capacidad) < active || int64(capacidad) < busiestSession {
+		return dao.Activity{}, ErrCapacityBelowInscriptions
+	}
+	return activity, nil
+}
+
+// countActiveInscriptionsForUser cuenta las inscripciones activas de un usuario en una actividad
+func countActiveInscriptionsForUser(tx *gorm.DB, userID int, activityID int, sessionID *int) (int64, error) {
+	var count int64
+	err := tx.Model(&dao.Inscription{}).
+		Scopes(forSession(sessionID)).
+		Where("ID_usuario = ? AND ID_actividad = ? AND estado = ?", userID, activityID, dao.EstadoActiva).
+		Count(&count).Error
+	return count, err
+}
+
+// countActiveInscriptions cuenta las inscripciones activas de una actividad:
+// las semanales, o las de la sesión si sessionID no es nil
+func countActiveInscriptions(tx *gorm.DB, activityID int, sessionID *int) (int64, error) {
+	var count int64
+	err := tx.Model(&dao.Inscription{}).
+		Scopes(forSession(sessionID)).
+		Where("ID_actividad = ? AND estado = ?", activityID, dao.EstadoActiva).
+		Count(&count).Error
+	return count, err
 }
 
 // SearchActivitiesByName busca actividades por nombre (búsqueda parcial)
 func SearchActivitiesByName(name string) (dao.Activities, error) {
 	var activities dao.Activities
 	searchPattern := "%" + name + "%"
-	if err := DB.Where("nombre LIKE ?", searchPattern).Find(&activities).Error; err != nil {
+	if err := DB.Scopes(withAvailableSlots, withTimetable).Where("LOWER(nombre) LIKE LOWER(?)", searchPattern).Find(&activities).Error; err != nil {
 		return nil, err
 	}
 	return activities, nil
@@ -220,11 +481,267 @@ func SearchActivitiesByName(name string) (dao.Activities, error) {
 
 // ================ INSCRIPTION METHODS ================
 
-func CreateInscription(inscription dao.Inscription) (dao.Inscription, error) {
-	if err := DB.Create(&inscription).Error; err != nil {
-		return dao.Inscription{}, err
+// EnrollUser crea una inscripción en una única transacción. La fila de la
+// actividad se bloquea antes de contar las inscripciones activas, así dos
+// inscripciones simultáneas al último cupo no pueden confirmarse ambas.
+// Si la inscripción tiene ID_sesion reserva esa sesión, que tiene su propio
+// cupo; si no, es la inscripción semanal a la actividad.
+// Devuelve la inscripción creada y la actividad con los cupos ya actualizados.
+func EnrollUser(inscription dao.Inscription, audit dao.AuditEvent) (dao.Inscription, dao.Activity, error) {
+	var activity dao.Activity
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockActivity(tx, inscription.ID_actividad); err != nil {
+			return err
+		}
+		if err := tx.Scopes(withTimetable).First(&activity, inscription.ID_actividad).Error; err != nil {
+			return err
+		}
+
+		if inscription.ID_sesion != nil {
+			var session dao.ClassSession
+			err := tx.Where("id_sesion = ? AND id_actividad = ? AND cancelada = ? AND inicio > ?",
+				*inscription.ID_sesion, inscription.ID_actividad, false, time.Now()).First(&session).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrSessionUnavailable
+			}
+			if err != nil {
+				return err
+			}
+			inscription.Sesion = &session
+		}
+
+		existing, err := countActiveInscriptionsForUser(tx, inscription.ID_usuario, inscription.ID_actividad, inscription.ID_sesion)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrAlreadyInscribed
+		}
+
+		active, err := countActiveInscriptions(tx, inscription.ID_actividad, inscription.ID_sesion)
+		if err != nil {
+			return err
+		}
+		if active >= int64(activity.Capacidad) {
+			return ErrNoAvailableSlots
+		}
+
+		if err := createInscriptionWithHistory(tx, &inscription, "inscripción creada"); err != nil {
+			// El índice único de Clave_activa atrapa la inscripción simultánea
+			// del mismo usuario que el conteo no llegó a ver
+			if isDuplicateKey(tx, err) {
+				return ErrAlreadyInscribed
+			}
+			return err
+		}
+		if err := recordAudit(tx, audit, dao.AccionInscripcionCreada, dao.EntidadInscripcion, inscription.ID_inscripcion, nil, inscription); err != nil {
+			return err
+		}
+
+		// Si estaba en la lista de espera de esta actividad ya no lo necesita.
+		// La lista de espera es de la inscripción semanal, no de las sesiones,
+		// y reservar una sesión no cambia los cupos semanales.
+		if inscription.ID_sesion != nil {
+			inscription.Sesion.CuposDisponibles = activity.Capacidad - int(active) - 1
+			weekly, err := countActiveInscriptions(tx, inscription.ID_actividad, nil)
+			if err != nil {
+				return err
+			}
+			activity.CuposDisponibles = activity.Capacidad - int(weekly)
+			return nil
+		}
+		if err := tx.Where("ID_usuario = ? AND ID_actividad = ?", inscription.ID_usuario, inscription.ID_actividad).
+			Delete(&dao.WaitlistEntry{}).Error; err != nil {
+			return err
+		}
+
+		activity.CuposDisponibles = activity.Capacidad - int(active) - 1
+		return nil
+	})
+	if err != nil {
+		return dao.Inscription{}, dao.Activity{}, err
 	}
-	return inscription, nil
+
+	return inscription, activity, nil
+}
+
+// isDuplicateKey indica si err es la violación de un índice único. Traduce el
+// error del driver, así que no depende de TranslateError en la configuración.
+func isDuplicateKey(db *gorm.DB, err error) bool {
+	if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok {
+		err = translator.Translate(err)
+	}
+	return errors.Is(err, gorm.ErrDuplicatedKey)
+}
+
+// CancelInscription marca una inscripción activa como cancelada y, en la misma
+// transacción, promueve al primer usuario de la lista de espera al cupo
+// liberado. Cancelar la reserva de una sesión solo libera el cupo de la sesión.
+func CancelInscription(id int, cancelledBy int, reason string, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var inscription dao.Inscription
+		if err := tx.First(&inscription, id).Error; err != nil {
+			return err
+		}
+
+		var activity dao.Activity
+		if err := lockActivity(tx, inscription.ID_actividad); err != nil {
+			return err
+		}
+		if err := tx.First(&activity, inscription.ID_actividad).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		// La condición sobre el estado evita cancelar dos veces ante pedidos concurrentes
+		result := tx.Model(&dao.Inscription{}).
+			Where("ID_inscripcion = ? AND estado = ?", id, dao.EstadoActiva).
+			Updates(map[string]interface{}{
+				"estado":        dao.EstadoCancelada,
+				"cancelled_at":  now,
+				"cancelled_by":  cancelledBy,
+				"cancel_reason": reason,
+				"clave_activa":  nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInscriptionNotActive
+		}
+
+		detalle := "cancelada"
+		if reason != "" {
+			detalle += ": " + reason
+		}
+		if err := addInscriptionHistory(tx, id, dao.EstadoCancelada, detalle); err != nil {
+			return err
+		}
+
+		var cancelled dao.Inscription
+		if err := tx.First(&cancelled, id).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, audit, dao.AccionInscripcionCancelada, dao.EntidadInscripcion, id, inscription, cancelled); err != nil {
+			return err
+		}
+
+		if inscription.ID_sesion != nil {
+			return nil
+		}
+		return promoteFromWaitlist(tx, activity, audit)
+	})
+}
+
+// CompleteInscription marca una inscripción activa como completada una vez
+// terminada la clase
+func CompleteInscription(id int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&dao.Inscription{}).
+			Where("ID_inscripcion = ? AND estado = ?", id, dao.EstadoActiva).
+			Updates(map[string]interface{}{"estado": dao.EstadoCompletada, "clave_activa": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInscriptionNotActive
+		}
+		if err := addInscriptionHistory(tx, id, dao.EstadoCompletada, "clase finalizada"); err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionInscripcionCompletada, dao.EntidadInscripcion, id,
+			map[string]string{"estado": dao.EstadoActiva}, map[string]string{"estado": dao.EstadoCompletada})
+	})
+}
+
+// GetActiveSessionBookings obtiene las reservas activas de sesiones junto con
+// su sesión. Las inscripciones semanales no se incluyen.
+func GetActiveSessionBookings() ([]dao.Inscription, error) {
+	var inscriptions []dao.Inscription
+	if err := DB.Preload("Sesion").Where("estado = ? AND id_sesion IS NOT NULL", dao.EstadoActiva).Find(&inscriptions).Error; err != nil {
+		return nil, err
+	}
+	return inscriptions, nil
+}
+
+// GetActiveInscriptionsByActivityID obtiene los inscriptos activos de una actividad, con su usuario
+func GetActiveInscriptionsByActivityID(activityID int) ([]dao.Inscription, error) {
+	var inscriptions []dao.Inscription
+	err := DB.Preload("Usuario").
+		Where("id_actividad = ? AND estado = ?", activityID, dao.EstadoActiva).
+		Order("id_inscripcion").
+		Find(&inscriptions).Error
+	if err != nil {
+		return nil, err
+	}
+	return inscriptions, nil
+}
+
+// promoteFromWaitlist inscribe a los primeros usuarios de la lista de espera
+// mientras la actividad tenga cupos semanales libres. Debe llamarse con la fila
+// de la actividad bloqueada. Las promociones se auditan con el actor que liberó
+// el cupo.
+func promoteFromWaitlist(tx *gorm.DB, activity dao.Activity, audit dao.AuditEvent) error {
+	for {
+		active, err := countActiveInscriptions(tx, activity.ID_actividad, nil)
+		if err != nil {
+			return err
+		}
+		if active >= int64(activity.Capacidad) {
+			return nil
+		}
+
+		var next dao.WaitlistEntry
+		err = tx.Where("ID_actividad = ?", activity.ID_actividad).Order("ID_espera").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&next).Error; err != nil {
+			return err
+		}
+
+		existing, err := countActiveInscriptionsForUser(tx, next.ID_usuario, next.ID_actividad, nil)
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			continue
+		}
+
+		promoted := dao.Inscription{
+			ID_usuario:   next.ID_usuario,
+			ID_actividad: next.ID_actividad,
+		}
+		if err := createInscriptionWithHistory(tx, &promoted, "promovida desde lista de espera"); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, audit, dao.AccionInscripcionPromovida, dao.EntidadInscripcion, promoted.ID_inscripcion, nil, promoted); err != nil {
+			return err
+		}
+	}
+}
+
+// createInscriptionWithHistory crea una inscripción activa y registra el alta en su historial
+func createInscriptionWithHistory(tx *gorm.DB, inscription *dao.Inscription, detalle string) error {
+	inscription.Estado = dao.EstadoActiva
+	if err := tx.Create(inscription).Error; err != nil {
+		return err
+	}
+	return addInscriptionHistory(tx, inscription.ID_inscripcion, dao.EstadoActiva, detalle)
+}
+
+// addInscriptionHistory registra un cambio de estado en el historial de la inscripción
+func addInscriptionHistory(tx *gorm.DB, inscriptionID int, estado string, detalle string) error {
+	return tx.Create(&dao.InscriptionHistory{
+		ID_inscripcion: inscriptionID,
+		Estado:         estado,
+		Detalle:        detalle,
+	}).Error
 }
 
 func GetInscriptionByID(id int) (dao.Inscription, error) {
@@ -235,38 +752,58 @@ func GetInscriptionByID(id int) (dao.Inscription, error) {
 	return inscription, nil
 }
 
+// GetInscriptionByUserAndActivity obtiene la inscripción semanal activa de un usuario a una actividad
 func GetInscriptionByUserAndActivity(userID int, activityID int) (dao.Inscription, error) {
 	var inscription dao.Inscription
-	if err := DB.Where("ID_usuario = ? AND ID_actividad = ?", userID, activityID).First(&inscription).Error; err != nil {
+	if err := DB.Scopes(forSession(nil)).Where("ID_usuario = ? AND ID_actividad = ? AND estado = ?", userID, activityID, dao.EstadoActiva).First(&inscription).Error; err != nil {
 		return dao.Inscription{}, err
 	}
 	return inscription, nil
 }
-func GetInscriptionsByUserID(userID int) ([]dao.Inscription, error) {
+
+// GetInscriptionsByUserID obtiene las inscripciones de un usuario, filtradas
+// por estado si estado no está vacío, con su usuario y su actividad
+func GetInscriptionsByUserID(userID int, estado string) ([]dao.Inscription, error) {
 	var inscriptions []dao.Inscription
-	if err := DB.Where("ID_usuario = ?", userID).Find(&inscriptions).Error; err != nil {
+	query := DB.Scopes(withRelations).Where("ID_usuario = ?", userID)
+	if estado != "" {
+		query = query.Where("estado = ?", estado)
+	}
+	if err := query.Order("id_inscripcion").Find(&inscriptions).Error; err != nil {
 		return nil, err
 	}
 	return inscriptions, nil
 }
-func GetAllInscriptions() ([]dao.Inscription, error) {
+
+// GetAllInscriptions obtiene todas las inscripciones, filtradas por estado si
+// estado no está vacío, con su usuario y su actividad
+func GetAllInscriptions(estado string) ([]dao.Inscription, error) {
 	var inscriptions []dao.Inscription
-	if err := DB.Find(&inscriptions).Error; err != nil {
+	query := DB.Scopes(withRelations)
+	if estado != "" {
+		query = query.Where("estado = ?", estado)
+	}
+	if err := query.Order("id_inscripcion").Find(&inscriptions).Error; err != nil {
 		return nil, err
 	}
 	return inscriptions, nil
 }
 
+// withRelations carga el usuario (con sus roles), la actividad (con sus cupos
+// disponibles) y la sesión reservada de cada inscripción. Son unas pocas
+// consultas fijas, sin importar cuántas inscripciones haya.
+func withRelations(db *gorm.DB) *gorm.DB {
+	return db.Preload("Usuario.Roles").Preload("Actividad", withAvailableSlots).Preload("Actividad.Horarios", orderedSlots).Preload("Sesion", withSessionSlots)
+}
+
 // GetUserActivities devuelve todas las actividades a las que está inscripto un usuario
 func GetUserActivities(userID int) ([]dao.Activity, error) {
 	var activities []dao.Activity
 
 	err := DB.
-		Table("activities").
-		Select("activities.*").
-		Joins("JOIN inscriptions ON inscriptions.id_actividad = activities.id_actividad").
-		Where("inscriptions.id_usuario = ?", userID).
-		Scan(&activities).Error
+		Scopes(withAvailableSlots, withTimetable).
+		Where("activities.id_actividad IN (SELECT inscriptions.id_actividad FROM inscriptions WHERE inscriptions.id_usuario = ? AND inscriptions.estado = ?)", userID, dao.EstadoActiva).
+		Find(&activities).Error
 
 	if err != nil {
 		return nil, err
@@ -274,6 +811,1128 @@ func GetUserActivities(userID int) ([]dao.Activity, error) {
 
 	return activities, nil
 }
-func DeleteInscription(id int) error {
-	return DB.Delete(&dao.Inscription{}, id).Error
+
+// GetInscriptionHistory devuelve los cambios de estado de una inscripción en orden cronológico
+func GetInscriptionHistory(inscriptionID int) ([]dao.InscriptionHistory, error) {
+	var history []dao.InscriptionHistory
+	if err := DB.Where("ID_inscripcion = ?", inscriptionID).Order("ID_historial").Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ================ SCHEDULE METHODS ================
+
+// GetSchedule obtiene la recurrencia de una actividad con sus excepciones
+func GetSchedule(activityID int) (dao.Schedule, error) {
+	var schedule dao.Schedule
+	if err := DB.First(&schedule, activityID).Error; err != nil {
+		return dao.Schedule{}, err
+	}
+	exceptions, err := scheduleExceptions(DB, []int{activityID})
+	if err != nil {
+		return dao.Schedule{}, err
+	}
+	schedule.Excepciones = exceptions[activityID]
+	return schedule, nil
+}
+
+// GetSchedules obtiene todas las recurrencias con su actividad y sus excepciones
+func GetSchedules() ([]dao.Schedule, error) {
+	var schedules []dao.Schedule
+	if err := DB.Preload("Actividad.Horarios", orderedSlots).Order("id_actividad").Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(schedules))
+	for _, schedule := range schedules {
+		ids = append(ids, schedule.ID_actividad)
+	}
+	exceptions, err := scheduleExceptions(DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		schedules[i].Excepciones = exceptions[schedules[i].ID_actividad]
+	}
+	return schedules, nil
+}
+
+// scheduleExceptions devuelve las fechas sin clase de cada actividad, ordenadas
+func scheduleExceptions(db *gorm.DB, activityIDs []int) (map[int][]string, error) {
+	var rows []dao.ScheduleException
+	if err := db.Where("id_actividad IN ?", activityIDs).Order("fecha").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	exceptions := make(map[int][]string)
+	for _, row := range rows {
+		exceptions[row.ID_actividad] = append(exceptions[row.ID_actividad], row.Fecha)
+	}
+	return exceptions, nil
+}
+
+// SaveSchedule crea o reemplaza la recurrencia de una actividad y, en la misma
+// transacción, sincroniza sus sesiones entre from y to con las generadas a
+// partir de la nueva recurrencia
+func SaveSchedule(schedule dao.Schedule, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockActivity(tx, schedule.ID_actividad); err != nil {
+			return err
+		}
+		if err := tx.First(&dao.Activity{}, schedule.ID_actividad).Error; err != nil {
+			return err
+		}
+
+		var before interface{}
+		var existing dao.Schedule
+		err := tx.First(&existing, schedule.ID_actividad).Error
+		switch {
+		case err == nil:
+			exceptions, err := scheduleExceptions(tx, []int{schedule.ID_actividad})
+			if err != nil {
+				return err
+			}
+			existing.Excepciones = exceptions[schedule.ID_actividad]
+			before = existing
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if err := tx.Omit(clause.Associations).Save(&schedule).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_actividad = ?", schedule.ID_actividad).Delete(&dao.ScheduleException{}).Error; err != nil {
+			return err
+		}
+		for _, fecha := range schedule.Excepciones {
+			exception := dao.ScheduleException{ID_actividad: schedule.ID_actividad, Fecha: fecha}
+			if err := tx.Omit(clause.Associations).Create(&exception).Error; err != nil {
+				return err
+			}
+		}
+
+		if _, err := syncSessions(tx, schedule.ID_actividad, sessions, from, to, audit); err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionRecurrenciaModificada, dao.EntidadActividad, schedule.ID_actividad, before, schedule)
+	})
+}
+
+// SyncSessions sincroniza las sesiones de una actividad entre from y to con las
+// generadas a partir de su recurrencia. Devuelve cuántas sesiones se crearon.
+func SyncSessions(activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) (int, error) {
+	var created int
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockActivity(tx, activityID); err != nil {
+			return err
+		}
+		if err := tx.First(&dao.Activity{}, activityID).Error; err != nil {
+			return err
+		}
+		var err error
+		created, err = syncSessions(tx, activityID, sessions, from, to, audit)
+		return err
+	})
+	return created, err
+}
+
+// syncSessions deja en [from, to) exactamente las sesiones pedidas: crea las
+// que faltan, reactiva y actualiza las que siguen y cancela las que ya no
+// están. Una sesión cancelada conserva sus inscripciones, canceladas; si nunca
+// tuvo inscripciones se borra. Debe llamarse con la fila de la actividad bloqueada.
+func syncSessions(tx *gorm.DB, activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) (int, error) {
+	var existing []dao.ClassSession
+	if err := tx.Where("id_actividad = ? AND inicio >= ? AND inicio < ?", activityID, from, to).Find(&existing).Error; err != nil {
+		return 0, err
+	}
+
+	wanted := make(map[int64]dao.ClassSession, len(sessions))
+	for _, session := range sessions {
+		wanted[session.Inicio.Unix()] = session
+	}
+
+	for _, session := range existing {
+		want, ok := wanted[session.Inicio.Unix()]
+		if !ok {
+			if session.Cancelada {
+				continue
+			}
+			if err := cancelSession(tx, session, audit); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		delete(wanted, session.Inicio.Unix())
+		if session.Cancelada || !session.Fin.Equal(want.Fin) {
+			err := tx.Model(&dao.ClassSession{}).Where("id_sesion = ?", session.ID_sesion).
+				Updates(map[string]interface{}{"cancelada": false, "fin": want.Fin}).Error
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	created := 0
+	for _, session := range sessions {
+		if _, ok := wanted[session.Inicio.Unix()]; !ok {
+			continue
+		}
+		session.ID_sesion = 0
+		session.ID_actividad = activityID
+		session.Cancelada = false
+		if err := tx.Omit(clause.Associations).Create(&session).Error; err != nil {
+			return 0, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+// cancelSession cancela una sesión que dejó de estar en la recurrencia junto
+// con sus inscripciones activas, o la borra si nunca tuvo inscripciones
+func cancelSession(tx *gorm.DB, session dao.ClassSession, audit dao.AuditEvent) error {
+	var inscriptions []dao.Inscription
+	if err := tx.Where("id_sesion = ?", session.ID_sesion).Find(&inscriptions).Error; err != nil {
+		return err
+	}
+	if len(inscriptions) == 0 {
+		return tx.Delete(&session).Error
+	}
+
+	now := time.Now()
+	for _, inscription := range inscriptions {
+		if inscription.Estado != dao.EstadoActiva {
+			continue
+		}
+		cancelled := inscription
+		cancelled.Estado = dao.EstadoCancelada
+		cancelled.CancelledAt = &now
+		cancelled.CancelledBy = audit.ID_actor
+		cancelled.CancelReason = "clase suspendida"
+		err := tx.Model(&dao.Inscription{}).Where("id_inscripcion = ?", inscription.ID_inscripcion).
+			Updates(map[string]interface{}{
+				"estado":        cancelled.Estado,
+				"cancelled_at":  now,
+				"cancelled_by":  cancelled.CancelledBy,
+				"cancel_reason": cancelled.CancelReason,
+				"clave_activa":  nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+		if err := addInscriptionHistory(tx, inscription.ID_inscripcion, dao.EstadoCancelada, "cancelada: "+cancelled.CancelReason); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, audit, dao.AccionInscripcionCancelada, dao.EntidadInscripcion, inscription.ID_inscripcion, inscription, cancelled); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&dao.ClassSession{}).Where("id_sesion = ?", session.ID_sesion).Update("cancelada", true).Error
+}
+
+// GetSessions obtiene las sesiones no canceladas de una actividad que empiezan
+// entre from y to, en orden, con sus cupos disponibles
+func GetSessions(activityID int, from, to time.Time) ([]dao.ClassSession, error) {
+	var sessions []dao.ClassSession
+	err := DB.Scopes(withSessionSlots).
+		Where("class_sessions.id_actividad = ? AND class_sessions.cancelada = ? AND class_sessions.inicio >= ? AND class_sessions.inicio < ?",
+			activityID, false, from, to).
+		Order("class_sessions.inicio").
+		Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetSessionByID obtiene una sesión con sus cupos disponibles
+func GetSessionByID(id int) (dao.ClassSession, error) {
+	var session dao.ClassSession
+	if err := DB.Scopes(withSessionSlots).Where("class_sessions.id_sesion = ?", id).First(&session).Error; err != nil {
+		return dao.ClassSession{}, err
+	}
+	return session, nil
+}
+
+// ================ WAITLIST METHODS ================
+
+// waitlistPositionSelect selecciona la entrada junto con su lugar en la fila de la actividad
+const waitlistPositionSelect = `waitlist_entries.*, (SELECT COUNT(*) FROM waitlist_entries AS previas
+	WHERE previas.id_actividad = waitlist_entries.id_actividad AND previas.id_espera <= waitlist_entries.id_espera) AS posicion`
+
+// JoinWaitlist anota a un usuario en la lista de espera de una actividad completa.
+// Devuelve la entrada creada con su posición en la fila.
+func JoinWaitlist(entry dao.WaitlistEntry, audit dao.AuditEvent) (dao.WaitlistEntry, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var activity dao.Activity
+		if err := lockActivity(tx, entry.ID_actividad); err != nil {
+			return err
+		}
+		if err := tx.First(&activity, entry.ID_actividad).Error; err != nil {
+			return err
+		}
+
+		inscribed, err := countActiveInscriptionsForUser(tx, entry.ID_usuario, entry.ID_actividad, nil)
+		if err != nil {
+			return err
+		}
+		if inscribed > 0 {
+			return ErrAlreadyInscribed
+		}
+
+		// Se liberó un cupo desde que falló la inscripción: no tiene sentido esperar
+		active, err := countActiveInscriptions(tx, entry.ID_actividad, nil)
+		if err != nil {
+			return err
+		}
+		if active < int64(activity.Capacidad) {
+			return ErrSlotsAvailable
+		}
+
+		var waiting int64
+		if err := tx.Model(&dao.WaitlistEntry{}).
+			Where("ID_usuario = ? AND ID_actividad = ?", entry.ID_usuario, entry.ID_actividad).
+			Count(&waiting).Error; err != nil {
+			return err
+		}
+		if waiting > 0 {
+			return ErrAlreadyInWaitlist
+		}
+
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, audit, dao.AccionListaEsperaAnotado, dao.EntidadListaEspera, entry.ID_espera, nil, entry); err != nil {
+			return err
+		}
+		return tx.Select(waitlistPositionSelect).First(&entry, entry.ID_espera).Error
+	})
+	if err != nil {
+		return dao.WaitlistEntry{}, err
+	}
+	return entry, nil
+}
+
+// GetWaitlistEntryByID obtiene una entrada de la lista de espera con su posición
+func GetWaitlistEntryByID(id int) (dao.WaitlistEntry, error) {
+	var entry dao.WaitlistEntry
+	if err := DB.Select(waitlistPositionSelect).First(&entry, id).Error; err != nil {
+		return dao.WaitlistEntry{}, err
+	}
+	return entry, nil
+}
+
+// GetWaitlistByUserID obtiene las listas de espera en las que está anotado un usuario
+func GetWaitlistByUserID(userID int) ([]dao.WaitlistEntry, error) {
+	var entries []dao.WaitlistEntry
+	if err := DB.Select(waitlistPositionSelect).Where("ID_usuario = ?", userID).Order("ID_espera").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DeleteWaitlistEntry saca a un usuario de la lista de espera
+func DeleteWaitlistEntry(id int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before dao.WaitlistEntry
+		if err := tx.First(&before, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&dao.WaitlistEntry{}, id).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionListaEsperaBaja, dao.EntidadListaEspera, id, before, nil)
+	})
+}
+
+// ================ TOKEN METHODS ================
+
+// CreateRefreshToken guarda un refresh token nuevo (el primero de una familia)
+func CreateRefreshToken(token dao.RefreshToken) (dao.RefreshToken, error) {
+	if err := DB.Create(&token).Error; err != nil {
+		return dao.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// GetRefreshTokenByHash obtiene un refresh token por el hash de su valor
+func GetRefreshTokenByHash(tokenHash string) (dao.RefreshToken, error) {
+	var token dao.RefreshToken
+	if err := DB.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return dao.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken canjea el refresh token con hash tokenHash por next, que
+// hereda su familia y usuario. Si el token ya había sido canjeado se asume que
+// fue robado: se revoca toda la familia y se devuelve ErrRefreshTokenReused.
+func RotateRefreshToken(tokenHash string, next dao.RefreshToken, now time.Time) (dao.RefreshToken, error) {
+	var current dao.RefreshToken
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if current.RevokedAt != nil || !current.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+		if current.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		// Update condicional: de dos canjes simultáneos solo uno puede ganar
+		result := tx.Model(&dao.RefreshToken{}).
+			Where("id_refresh = ? AND used_at IS NULL", current.ID_refresh).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		next.FamilyID = current.FamilyID
+		next.ID_usuario = current.ID_usuario
+		return tx.Create(&next).Error
+	})
+
+	if errors.Is(err, ErrRefreshTokenReused) {
+		// Fuera de la transacción, que ya fue revertida
+		if revokeErr := RevokeTokenFamily(current.FamilyID, now); revokeErr != nil {
+			return dao.RefreshToken{}, revokeErr
+		}
+	}
+	if err != nil {
+		return dao.RefreshToken{}, err
+	}
+	return next, nil
+}
+
+// RevokeTokenFamily revoca todos los refresh tokens de una familia y, con
+// ellos, los access tokens emitidos a partir de esa familia
+func RevokeTokenFamily(familyID string, now time.Time) error {
+	return DB.Model(&dao.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeUserTokens revoca todas las sesiones de un usuario
+func RevokeUserTokens(userID int, now time.Time) error {
+	return DB.Model(&dao.RefreshToken{}).
+		Where("id_usuario = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+// RevokeAccessToken revoca un access token por su jti hasta su vencimiento
+func RevokeAccessToken(jti string, expiresAt time.Time) error {
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&dao.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsAccessTokenRevoked indica si un access token fue revocado, ya sea por su
+// jti o porque se revocó la familia de refresh tokens de la que proviene
+func IsAccessTokenRevoked(jti string, familyID string) (bool, error) {
+	var count int64
+	if err := DB.Model(&dao.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 || familyID == "" {
+		return count > 0, nil
+	}
+
+	if err := DB.Model(&dao.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NOT NULL", familyID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PurgeExpiredTokens borra los refresh tokens, las revocaciones, los tokens
+// para restablecer la contraseña y los pasos intermedios de login ya vencidos
+func PurgeExpiredTokens(now time.Time) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expires_at < ?", now).Delete(&dao.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", now).Delete(&dao.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", now).Delete(&dao.TwoFactorChallenge{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expires_at < ?", now).Delete(&dao.OIDCLoginState{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("expires_at < ?", now).Delete(&dao.RefreshToken{}).Error
+	})
+}
+
+// ================ PASSWORD RESET METHODS ================
+
+// CreatePasswordReset guarda un token para restablecer la contraseña. Los
+// tokens anteriores del usuario que no se usaron dejan de valer.
+func CreatePasswordReset(reset dao.PasswordReset, now time.Time) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&dao.PasswordReset{}).
+			Where("id_usuario = ? AND used_at IS NULL", reset.ID_usuario).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&reset).Error
+	})
+}
+
+// CountPasswordResetsSince cuenta los tokens pedidos por un usuario desde since
+func CountPasswordResetsSince(userID int, since time.Time) (int64, error) {
+	var count int64
+	err := DB.Model(&dao.PasswordReset{}).
+		Where("id_usuario = ? AND created_at >= ?", userID, since).
+		Count(&count).Error
+	return count, err
+}
+
+// ResetPassword canjea el token con hash tokenHash: guarda la nueva contraseña
+// y cierra todas las sesiones del usuario. Devuelve el ID del usuario.
+func ResetPassword(tokenHash string, passwordHash string, now time.Time, audit dao.AuditEvent) (int, error) {
+	var reset dao.PasswordReset
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", tokenHash).
+			First(&reset).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+		if reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+			return ErrInvalidResetToken
+		}
+
+		// Update condicional: el token se puede usar una sola vez
+		result := tx.Model(&dao.PasswordReset{}).
+			Where("id_reset = ? AND used_at IS NULL", reset.ID_reset).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidResetToken
+		}
+
+		err = tx.Model(&dao.User{}).
+			Where("id = ?", reset.ID_usuario).
+			Update("password_hash", passwordHash).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&dao.RefreshToken{}).
+			Where("id_usuario = ? AND revoked_at IS NULL", reset.ID_usuario).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		// Quien tiene el token actúa como el usuario
+		audit.ID_actor = &reset.ID_usuario
+		return recordAudit(tx, audit, dao.AccionContrasenaCambiada, dao.EntidadUsuario, reset.ID_usuario, nil, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return reset.ID_usuario, nil
+}
+
+// ================ INVITATION METHODS ================
+
+// CreateInvitation guarda una invitación para crear una cuenta de staff
+func CreateInvitation(invitation dao.Invitacion, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionInvitacionCreada, dao.EntidadInvitacion, invitation.ID_invitacion, nil, invitation)
+	})
+}
+
+// GetInvitation obtiene una invitación por su ID (el jti del token)
+func GetInvitation(id string) (dao.Invitacion, error) {
+	var invitation dao.Invitacion
+	if err := DB.Where("id_invitacion = ?", id).First(&invitation).Error; err != nil {
+		return dao.Invitacion{}, err
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation crea el usuario invitado y marca la invitación como aceptada
+// en una sola transacción, así cada invitación crea una única cuenta
+func AcceptInvitation(invitationID string, user dao.User, now time.Time, audit dao.AuditEvent) (dao.User, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		var invitation dao.Invitacion
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id_invitacion = ?", invitationID).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidInvitation
+		}
+		if err != nil {
+			return err
+		}
+		if invitation.AceptadaEn != nil || !invitation.ExpiresAt.After(now) {
+			return ErrInvalidInvitation
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		// Update condicional: la invitación se puede aceptar una sola vez
+		result := tx.Model(&dao.Invitacion{}).
+			Where("id_invitacion = ? AND aceptada_en IS NULL", invitationID).
+			Updates(map[string]interface{}{"aceptada_en": now, "id_usuario": user.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		// El actor es el usuario recién creado
+		audit.ID_actor = &user.ID
+		return recordAudit(tx, audit, dao.AccionInvitacionAceptada, dao.EntidadUsuario, user.ID, nil, user)
+	})
+	if err != nil {
+		return dao.User{}, err
+	}
+	return user, nil
+}
+
+// ================ TWO FACTOR METHODS ================
+
+// GetTwoFactor obtiene el segundo factor de un usuario
+func GetTwoFactor(userID int) (dao.TwoFactor, error) {
+	var twoFactor dao.TwoFactor
+	if err := DB.Where("id_usuario = ?", userID).First(&twoFactor).Error; err != nil {
+		return dao.TwoFactor{}, err
+	}
+	return twoFactor, nil
+}
+
+// SaveTwoFactorSecret guarda un secreto TOTP sin confirmar. Reemplaza a otro
+// sin confirmar, pero nunca a un segundo factor activo.
+func SaveTwoFactorSecret(userID int, secret string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id_usuario = ? AND activo = ?", userID, false).Delete(&dao.TwoFactor{})
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Create(&dao.TwoFactor{ID_usuario: userID, Secreto: secret}).Error
+	})
+}
+
+// ActivateTwoFactor confirma el segundo factor con el paso TOTP ya validado y
+// reemplaza los códigos de recuperación del usuario
+func ActivateTwoFactor(userID int, step int64, codeHashes []string, now time.Time, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&dao.TwoFactor{}).
+			Where("id_usuario = ? AND activo = ?", userID, false).
+			Updates(map[string]interface{}{"activo": true, "ultimo_paso": step, "confirmado_en": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.Where("id_usuario = ?", userID).Delete(&dao.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		codes := make([]dao.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, dao.RecoveryCode{ID_usuario: userID, CodeHash: hash})
+		}
+		if err := tx.Create(&codes).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionSegundoFactorActivado, dao.EntidadUsuario, userID, nil, nil)
+	})
+}
+
+// UseTOTPStep registra que se usó el paso TOTP step. Devuelve false si ya se
+// había usado ese paso u otro posterior, es decir, si el código es repetido.
+func UseTOTPStep(userID int, step int64) (bool, error) {
+	result := DB.Model(&dao.TwoFactor{}).
+		Where("id_usuario = ? AND ultimo_paso < ?", userID, step).
+		Update("ultimo_paso", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// UseRecoveryCode marca como usado un código de recuperación. Devuelve false
+// si el código no es del usuario o ya se usó.
+func UseRecoveryCode(userID int, codeHash string, now time.Time) (bool, error) {
+	result := DB.Model(&dao.RecoveryCode{}).
+		Where("id_usuario = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// DeleteTwoFactor quita el segundo factor de un usuario y sus códigos de recuperación
+func DeleteTwoFactor(userID int, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id_usuario = ?", userID).Delete(&dao.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("id_usuario = ?", userID).Delete(&dao.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionSegundoFactorQuitado, dao.EntidadUsuario, userID, nil, nil)
+	})
+}
+
+// CreateTwoFactorChallenge guarda el paso intermedio de un login con segundo factor
+func CreateTwoFactorChallenge(challenge dao.TwoFactorChallenge) error {
+	return DB.Create(&challenge).Error
+}
+
+// GetTwoFactorChallenge obtiene un paso de login por el hash de su token
+func GetTwoFactorChallenge(tokenHash string) (dao.TwoFactorChallenge, error) {
+	var challenge dao.TwoFactorChallenge
+	if err := DB.Where("token_hash = ?", tokenHash).First(&challenge).Error; err != nil {
+		return dao.TwoFactorChallenge{}, err
+	}
+	return challenge, nil
+}
+
+// RecordChallengeAttempt suma un código incorrecto al paso de login
+func RecordChallengeAttempt(challengeID int) error {
+	return DB.Model(&dao.TwoFactorChallenge{}).
+		Where("id_challenge = ?", challengeID).
+		Update("intentos", gorm.Expr("intentos + 1")).Error
+}
+
+// ConsumeTwoFactorChallenge marca el paso de login como usado. Devuelve false
+// si ya se había usado, para que un mismo paso no emita dos sesiones.
+func ConsumeTwoFactorChallenge(challengeID int, now time.Time) (bool, error) {
+	result := DB.Model(&dao.TwoFactorChallenge{}).
+		Where("id_challenge = ? AND used_at IS NULL", challengeID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// ================ EXTERNAL IDENTITY METHODS ================
+
+// CreateOIDCLoginState guarda un login con proveedor externo en curso
+func CreateOIDCLoginState(state dao.OIDCLoginState) error {
+	return DB.Create(&state).Error
+}
+
+// ConsumeOIDCLoginState obtiene y borra un login en curso, que solo se puede
+// completar una vez
+func ConsumeOIDCLoginState(stateHash string, now time.Time) (dao.OIDCLoginState, error) {
+	var state dao.OIDCLoginState
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state_hash = ?", stateHash).
+			First(&state).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidOIDCState
+		}
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("state_hash = ?", stateHash).Delete(&dao.OIDCLoginState{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || !state.ExpiresAt.After(now) {
+			return ErrInvalidOIDCState
+		}
+		return nil
+	})
+	if err != nil {
+		return dao.OIDCLoginState{}, err
+	}
+	return state, nil
+}
+
+// GetUserByIdentity obtiene el usuario vinculado a una identidad externa
+func GetUserByIdentity(provider, subject string) (dao.User, error) {
+	var identity dao.ExternalIdentity
+	if err := DB.Where("proveedor = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return dao.User{}, err
+	}
+	return GetUserByID(identity.ID_usuario)
+}
+
+// LinkIdentity vincula una identidad externa a un usuario existente
+func LinkIdentity(identity dao.ExternalIdentity, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionIdentidadVinculada, dao.EntidadUsuario, identity.ID_usuario, nil,
+			map[string]string{"proveedor": identity.Proveedor, "subject": identity.Subject})
+	})
+}
+
+// CreateUserWithIdentity crea un usuario nuevo vinculado a una identidad externa
+func CreateUserWithIdentity(user dao.User, identity dao.ExternalIdentity, audit dao.AuditEvent) (dao.User, error) {
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		identity.ID_usuario = user.ID
+		if err := tx.Create(&identity).Error; err != nil {
+			return err
+		}
+		audit.ID_actor = &user.ID
+		return recordAudit(tx, audit, dao.AccionUsuarioRegistrado, dao.EntidadUsuario, user.ID, nil, user)
+	})
+	if err != nil {
+		return dao.User{}, err
+	}
+	return user, nil
+}
+
+// ================ LOGIN ATTEMPT METHODS ================
+
+// GetLoginThrottle obtiene los fallos de login de una clave. Si no hay fallos
+// registrados devuelve el estado vacío.
+func GetLoginThrottle(key string) (dao.LoginThrottle, error) {
+	throttle := dao.LoginThrottle{Clave: key}
+	err := DB.Where("clave = ?", key).First(&throttle).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return throttle, nil
+	}
+	if err != nil {
+		return dao.LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+// UpdateLoginThrottle aplica update sobre los fallos de una clave con la fila
+// bloqueada, para que logins simultáneos no pierdan fallos
+func UpdateLoginThrottle(key string, update func(*dao.LoginThrottle)) (dao.LoginThrottle, error) {
+	var throttle dao.LoginThrottle
+
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		// Crear la fila si no existe, sin fallos ni fechas; si otro login la
+		// creó antes no pasa nada
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&dao.LoginThrottle{Clave: key}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("clave = ?", key).
+			First(&throttle).Error
+		if err != nil {
+			return err
+		}
+
+		update(&throttle)
+		return tx.Save(&throttle).Error
+	})
+	if err != nil {
+		return dao.LoginThrottle{}, err
+	}
+	return throttle, nil
+}
+
+// DeleteLoginThrottle olvida los fallos de una clave
+func DeleteLoginThrottle(key string) error {
+	return DB.Where("clave = ?", key).Delete(&dao.LoginThrottle{}).Error
+}
+
+// PurgeLoginThrottles borra las claves sin fallos ni bloqueos posteriores a before
+func PurgeLoginThrottles(before time.Time) error {
+	return DB.Where("(ultimo_fallo IS NULL OR ultimo_fallo < ?) AND (bloqueado_hasta IS NULL OR bloqueado_hasta < ?)", before, before).
+		Delete(&dao.LoginThrottle{}).Error
+}
+
+// CreateLoginAttempt registra un intento de login rechazado
+func CreateLoginAttempt(attempt dao.LoginAttempt) error {
+	return DB.Create(&attempt).Error
+}
+
+// ================ AUDIT METHODS ================
+
+// auditOmitted son las claves que no se guardan en before/after: relaciones
+// que se auditan por separado y columnas que cambian solas
+var auditOmitted = map[string]bool{
+	"Roles": true, "Usuario": true, "actividad": true, "Actividad": true,
+	"CuposDisponibles": true, "updated_at": true, "UpdatedAt": true,
+}
+
+// auditRedacted son las claves con secretos; se registra que cambiaron pero no el valor
+var auditRedacted = map[string]bool{
+	"PasswordHash": true, "Secreto": true, "TokenHash": true, "CodeHash": true,
+}
+
+const auditRedactedValue = "[redacted]"
+
+// recordAudit guarda un evento de auditoría dentro de la transacción del cambio.
+// event trae el actor, la IP y el request ID; before y after son el estado de la
+// entidad antes y después (nil si no existía o ya no existe). En las
+// modificaciones solo se guardan los campos que cambiaron.
+func recordAudit(tx *gorm.DB, event dao.AuditEvent, action, entity string, entityID interface{}, before, after interface{}) error {
+	beforeMap, err := auditSnapshot(before)
+	if err != nil {
+		return err
+	}
+	afterMap, err := auditSnapshot(after)
+	if err != nil {
+		return err
+	}
+	if beforeMap != nil && afterMap != nil {
+		for key, value := range beforeMap {
+			if reflect.DeepEqual(value, afterMap[key]) {
+				delete(beforeMap, key)
+				delete(afterMap, key)
+			}
+		}
+	}
+	// Se tapan después de comparar, para que conste que el secreto cambió
+	redactAudit(beforeMap)
+	redactAudit(afterMap)
+
+	event.ID_evento = 0
+	event.Accion = action
+	event.Entidad = entity
+	event.ID_entidad = fmt.Sprint(entityID)
+	if event.Antes, err = auditJSON(beforeMap); err != nil {
+		return err
+	}
+	if event.Despues, err = auditJSON(afterMap); err != nil {
+		return err
+	}
+	return tx.Create(&event).Error
+}
+
+// auditSnapshot pasa la entidad a un mapa sin relaciones
+func auditSnapshot(value interface{}) (map[string]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, err
+	}
+	for key := range snapshot {
+		if auditOmitted[key] {
+			delete(snapshot, key)
+		}
+	}
+	return snapshot, nil
+}
+
+func redactAudit(snapshot map[string]interface{}) {
+	for key := range snapshot {
+		if auditRedacted[key] {
+			snapshot[key] = auditRedactedValue
+		}
+	}
+}
+
+func auditJSON(snapshot map[string]interface{}) (string, error) {
+	if snapshot == nil {
+		return "", nil
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// CreateAuditEvent registra un evento que no acompaña a ningún cambio de fila
+func CreateAuditEvent(event dao.AuditEvent, action, entity string, entityID interface{}) error {
+	return recordAudit(DB, event, action, entity, entityID, nil, nil)
+}
+
+// AuditFilter son los filtros de GetAuditEvents. Los valores vacíos no filtran.
+type AuditFilter struct {
+	ActorID    int
+	Accion     string
+	Entidad    string
+	ID_entidad string
+	RequestID  string
+	Desde      *time.Time
+	Hasta      *time.Time
+	Page       int
+	PageSize   int
+}
+
+// GetAuditEvents devuelve una página de eventos, del más nuevo al más viejo,
+// junto con el total de eventos que cumplen el filtro
+func GetAuditEvents(filter AuditFilter) ([]dao.AuditEvent, int64, error) {
+	query := DB.Model(&dao.AuditEvent{})
+	if filter.ActorID != 0 {
+		query = query.Where("id_actor = ?", filter.ActorID)
+	}
+	if filter.Accion != "" {
+		query = query.Where("accion = ?", filter.Accion)
+	}
+	if filter.Entidad != "" {
+		query = query.Where("entidad = ?", filter.Entidad)
+	}
+	if filter.ID_entidad != "" {
+		query = query.Where("id_entidad = ?", filter.ID_entidad)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.Desde != nil {
+		query = query.Where("created_at >= ?", *filter.Desde)
+	}
+	if filter.Hasta != nil {
+		query = query.Where("created_at < ?", *filter.Hasta)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var events []dao.AuditEvent
+	err := query.Order("id_evento DESC").
+		Offset((filter.Page - 1) * filter.PageSize).
+		Limit(filter.PageSize).
+		Find(&events).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return events, total, nil
+}
+
+// ================ ROLE METHODS ================
+
+// SeedRoles crea los roles que falten y les agrega los permisos que falten.
+// No quita permisos, para respetar los que se hayan otorgado a mano.
+func SeedRoles(roles map[string][]string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		return seedRoles(tx, roles)
+	})
+}
+
+// seedRoles siembra los roles dentro de una transacción ya abierta
+func seedRoles(tx *gorm.DB, roles map[string][]string) error {
+	for name, permissions := range roles {
+		role := dao.Role{Nombre: name}
+		if err := tx.Where("nombre = ?", name).FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+		for _, permission := range permissions {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&dao.RolePermission{ID_rol: role.ID_rol, Permiso: permission}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// GetRoles obtiene todos los roles con sus permisos
+func GetRoles() ([]dao.Role, error) {
+	var roles []dao.Role
+	if err := DB.Preload("Permisos").Order("nombre").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetRolesByNames obtiene los roles con esos nombres
+func GetRolesByNames(names []string) ([]dao.Role, error) {
+	var roles []dao.Role
+	if err := DB.Where("nombre IN ?", names).Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// CountUsersWithRole cuenta los usuarios que tienen el rol
+func CountUsersWithRole(name string) (int64, error) {
+	var count int64
+	err := DB.Model(&dao.User{}).
+		Joins("JOIN user_roles ON user_roles.id_usuario = users.id").
+		Joins("JOIN roles ON roles.id_rol = user_roles.id_rol").
+		Where("roles.nombre = ?", name).
+		Count(&count).Error
+	return count, err
+}
+
+// GetPermissionsByRoles obtiene los permisos que otorgan en conjunto los roles
+func GetPermissionsByRoles(names []string) ([]string, error) {
+	var permissions []string
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := DB.Model(&dao.RolePermission{}).
+		Distinct("role_permissions.permiso").
+		Joins("JOIN roles ON roles.id_rol = role_permissions.id_rol").
+		Where("roles.nombre IN ?", names).
+		Pluck("role_permissions.permiso", &permissions).Error
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// SetUserRoles reemplaza los roles de un usuario y revoca sus sesiones, para
+// que los tokens emitidos con los roles anteriores dejen de valer
+func SetUserRoles(userID int, roles []dao.Role, now time.Time, audit dao.AuditEvent) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var before dao.User
+		if err := tx.Preload("Roles").First(&before, userID).Error; err != nil {
+			return err
+		}
+		user := dao.User{ID: userID}
+		if err := tx.Model(&user).Association("Roles").Replace(roles); err != nil {
+			return err
+		}
+		err := tx.Model(&dao.RefreshToken{}).
+			Where("id_usuario = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, audit, dao.AccionRolesAsignados, dao.EntidadUsuario, userID,
+			map[string][]string{"roles": roleNamesOf(before.Roles)}, map[string][]string{"roles": roleNamesOf(roles)})
+	})
+}
+
+func roleNamesOf(roles []dao.Role) []string {
+	names := []string{}
+	for _, role := range roles {
+		names = append(names, role.Nombre)
+	}
+	return names
 }
@@ -0,0 +1,207 @@
+package clients
+
+import (
+	"backend/config"
+	"backend/dao"
+	"backend/policy"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMigrateActivityCapacityBackfillsFromRemainingSlots(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:migrate_capacity?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+
+	// Esquema anterior: cupos guardaba los cupos restantes
+	statements := []string{
+		"CREATE TABLE `activities` (`id_actividad` integer PRIMARY KEY AUTOINCREMENT,`nombre` text NOT NULL,`profesor` text NOT NULL," +
+			"`cupos` integer NOT NULL DEFAULT 1,`categoria` text NOT NULL,`descripcion` text NOT NULL,`dia` integer NOT NULL," +
+			"`hora_inicio` text NOT NULL,`hora_fin` text NOT NULL)",
+		"CREATE TABLE `inscriptions` (`id_inscripcion` integer PRIMARY KEY AUTOINCREMENT,`estado` text DEFAULT 'activa'," +
+			"`id_usuario` integer NOT NULL,`id_actividad` integer NOT NULL)",
+		`INSERT INTO activities (nombre, profesor, cupos, categoria, descripcion, dia, hora_inicio, hora_fin)
+			VALUES ('Zumba', 'Ana', 3, 'Aeróbico', 'Zumba', 1, '08:00', '09:00')`,
+		`INSERT INTO inscriptions (id_usuario, id_actividad) VALUES (1, 1), (2, 1)`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("failed to prepare legacy schema: %v", err)
+		}
+	}
+
+	if err := migrateActivityCapacity(db); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	// Debe ser idempotente
+	if err := migrateActivityCapacity(db); err != nil {
+		t.Fatalf("second migration run failed: %v", err)
+	}
+
+	if db.Migrator().HasColumn(&dao.Activity{}, "cupos") {
+		t.Error("expected legacy cupos column to be dropped")
+	}
+
+	// Los cupos se leen de las inscripciones semanales, columna que agrega la
+	// migración de sesiones, y el día pasa a activity_slots
+	if err := db.Migrator().AddColumn(&dao.Inscription{}, "ID_sesion"); err != nil {
+		t.Fatalf("failed to add session column: %v", err)
+	}
+	if err := migrateActivitySlots(db); err != nil {
+		t.Fatalf("slots migration failed: %v", err)
+	}
+
+	DB = db
+	activity, err := GetActivityByID(1)
+	if err != nil {
+		t.Fatalf("failed to load activity: %v", err)
+	}
+	if activity.Capacidad != 5 {
+		t.Errorf("expected capacidad 5, got %d", activity.Capacidad)
+	}
+	if activity.CuposDisponibles != 3 {
+		t.Errorf("expected 3 cupos disponibles, got %d", activity.CuposDisponibles)
+	}
+	if len(activity.Horarios) != 1 || activity.Horarios[0].Dia != 1 || activity.Horarios[0].Hora_inicio != "08:00" {
+		t.Errorf("expected the legacy day as the only horario, got %+v", activity.Horarios)
+	}
+}
+
+func TestMigrateAdminRolesAssignsRolesFromIsAdmin(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:migrate_admin_roles?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	defer sqlDB.Close()
+	DB = db
+
+	// Esquema anterior: is_admin era una columna de users
+	statements := []string{
+		"CREATE TABLE `users` (`id` integer PRIMARY KEY AUTOINCREMENT,`name` text,`username` text UNIQUE,`password_hash` text,`is_admin` numeric DEFAULT false)",
+		`INSERT INTO users (name, username, password_hash, is_admin) VALUES ('Dueña', 'duena', 'x', true), ('Socio', 'socio', 'x', false)`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("failed to prepare legacy schema: %v", err)
+		}
+	}
+	if err := db.AutoMigrate(&dao.Role{}, &dao.RolePermission{}, &dao.User{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := SeedRoles(policy.DefaultRoles); err != nil {
+		t.Fatalf("failed to seed roles: %v", err)
+	}
+
+	if err := migrateAdminRoles(db); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	// Debe ser idempotente
+	if err := migrateAdminRoles(db); err != nil {
+		t.Fatalf("second migration run failed: %v", err)
+	}
+
+	if db.Migrator().HasColumn(&dao.User{}, "is_admin") {
+		t.Error("expected legacy is_admin column to be dropped")
+	}
+
+	expected := map[string]string{"duena": dao.RolAdmin, "socio": dao.RolSocio}
+	for username, role := range expected {
+		user, err := GetUserByUsername(username)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", username, err)
+		}
+		if len(user.Roles) != 1 || user.Roles[0].Nombre != role {
+			t.Errorf("expected %s to have only role %s, got %+v", username, role, user.Roles)
+		}
+	}
+
+	permissions, err := GetPermissionsByRoles([]string{dao.RolAdmin})
+	if err != nil {
+		t.Fatalf("failed to load permissions: %v", err)
+	}
+	if len(permissions) != len(policy.DefaultRoles[dao.RolAdmin]) {
+		t.Errorf("expected admin permissions %v, got %v", policy.DefaultRoles[dao.RolAdmin], permissions)
+	}
+}
+
+func TestNewDatabaseClientBootsOnInMemorySQLite(t *testing.T) {
+	previous := DB
+	defer func() { DB = previous }()
+
+	client := NewDatabaseClient(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:boot_sqlite?mode=memory&cache=shared"})
+	sqlDB, _ := client.DB.DB()
+	defer sqlDB.Close()
+
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if err := client.Prepare(); err != nil {
+		t.Fatalf("expected the database to be ready: %v", err)
+	}
+
+	var roles int64
+	client.DB.Model(&dao.Role{}).Count(&roles)
+	if roles != int64(len(policy.DefaultRoles)) {
+		t.Fatalf("expected %d seeded roles, got %d", len(policy.DefaultRoles), roles)
+	}
+
+	activity := dao.Activity{Nombre: "Yoga Matinal", Profesor: "Ana", Capacidad: 5, Categoria: "Relax", Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}}}
+	if err := client.DB.Create(&activity).Error; err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+	activities, err := SearchActivitiesByName("yoga")
+	if err != nil {
+		t.Fatalf("search failed: %v", err)
+	}
+	if len(activities) != 1 {
+		t.Fatalf("expected a case-insensitive match, got %d activities", len(activities))
+	}
+}
+
+func TestUpdateActivityRollsBackWhenSessionsFail(t *testing.T) {
+	previous := DB
+	defer func() { DB = previous }()
+
+	client := NewDatabaseClient(config.DatabaseConfig{Driver: config.DriverSQLite, DSN: "file:update_activity_sessions?mode=memory&cache=shared"})
+	sqlDB, _ := client.DB.DB()
+	defer sqlDB.Close()
+	if _, err := MigrateUp(client.DB); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	DB = client.DB
+
+	activity := dao.Activity{Nombre: "Yoga", Profesor: "Ana", Capacidad: 5, Categoria: "Relax", Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}}}
+	if err := DB.Create(&activity).Error; err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+
+	// Dos sesiones con el mismo inicio violan el índice único: la actividad
+	// no puede quedar con el horario nuevo y las sesiones viejas
+	from := time.Now()
+	start := from.Add(24 * time.Hour)
+	sessions := []dao.ClassSession{{Inicio: start, Fin: start.Add(time.Hour)}, {Inicio: start, Fin: start.Add(time.Hour)}}
+	updated := activity
+	updated.Nombre = "Yoga Matinal"
+	updated.Horarios = []dao.ActivitySlot{{Dia: 2, Hora_inicio: "10:00", Hora_fin: "11:00"}}
+	if err := UpdateActivity(updated, sessions, from, from.Add(48*time.Hour), dao.AuditEvent{}); err == nil {
+		t.Fatal("expected the session sync to fail")
+	}
+
+	stored, err := GetActivityByID(activity.ID_actividad)
+	if err != nil {
+		t.Fatalf("failed to reload activity: %v", err)
+	}
+	if stored.Nombre != "Yoga" || len(stored.Horarios) != 1 || stored.Horarios[0].Dia != 1 {
+		t.Errorf("expected the activity update to roll back, got %+v", stored)
+	}
+}
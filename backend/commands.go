@@ -0,0 +1,113 @@
+package main
+
+import (
+	"backend/clients"
+	"backend/services"
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// runCommand ejecuta un comando de administración en lugar de iniciar el servidor:
+//
+//	go run . migrate up|down|status
+//	go run . bootstrap-admin -name "Dueña" -username duena -email duena@gimnasio.com
+func runCommand(database *clients.DatabaseClient, args []string, stdin io.Reader, stdout io.Writer) error {
+	switch args[0] {
+	case "migrate":
+		return migrate(database, args[1:], stdout)
+	case "bootstrap-admin":
+		if err := database.Prepare(); err != nil {
+			return err
+		}
+		return bootstrapAdmin(args[1:], stdin, stdout)
+	default:
+		return fmt.Errorf("unknown command %q (available: migrate, bootstrap-admin)", args[0])
+	}
+}
+
+// migrate aplica (up), revierte (down -steps N, por defecto la última) o
+// lista (status) las migraciones del esquema
+func migrate(database *clients.DatabaseClient, args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate up|down|status")
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := clients.MigrateUp(database.DB)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Applied %d migrations.\n", applied)
+		return nil
+	case "down":
+		flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "cantidad de migraciones a revertir")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *steps < 1 {
+			return fmt.Errorf("-steps must be at least 1")
+		}
+		reverted, err := clients.MigrateDown(database.DB, *steps)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Reverted %d migrations.\n", reverted)
+		return nil
+	case "status":
+		statuses, err := clients.GetMigrationStatus(database.DB)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(stdout, "%4d  %-30s  %s\n", status.Version, status.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (available: up, down, status)", args[0])
+	}
+}
+
+// bootstrapAdmin crea el primer admin. La contraseña se lee de
+// BOOTSTRAP_ADMIN_PASSWORD o, si no está, de la entrada estándar, para que no
+// quede en el historial de la terminal.
+func bootstrapAdmin(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("bootstrap-admin", flag.ContinueOnError)
+	name := flags.String("name", "Admin", "nombre del admin")
+	username := flags.String("username", "", "username del admin (obligatorio)")
+	email := flags.String("email", "", "email del admin (obligatorio)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" || *email == "" {
+		flags.Usage()
+		return fmt.Errorf("-username and -email are required")
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Fprint(stdout, "Password: ")
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	user, err := services.BootstrapAdmin(*name, *username, *email, password)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Admin %s created with id %d. Set up two-factor authentication on first login.\n", user.Username, user.ID)
+	return nil
+}
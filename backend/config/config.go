@@ -0,0 +1,335 @@
+// Package config arma la configuración del servidor. Cada valor sale, en este
+// orden de prioridad, de una variable de entorno, del archivo YAML opcional o
+// del valor por defecto, así nadie tiene que editar el código para apuntar a
+// su base de datos.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile es el archivo que se lee si existe y no se indica CONFIG_FILE
+const DefaultFile = "config.yaml"
+
+// Config es la configuración completa del servidor
+type Config struct {
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	CORS     CORSConfig     `yaml:"cors"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Log      LogConfig      `yaml:"log"`
+	URLs     URLConfig      `yaml:"urls"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port"` // SERVER_PORT
+}
+
+// Motores de base de datos soportados
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	// DriverSQLite sirve para desarrollo y tests: sin DSN usa una base en memoria
+	DriverSQLite = "sqlite"
+)
+
+// sqliteInMemory es la base SQLite que se usa si no se indica un archivo
+const sqliteInMemory = "file:gym?mode=memory&cache=shared"
+
+// DatabaseConfig indica a qué base conectarse. Si se indica DSN se usa tal
+// cual; si no, se arma con los demás campos (con SQLite, una base en memoria).
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver"`   // DB_DRIVER: mysql, postgres o sqlite
+	DSN      string `yaml:"dsn"`      // DB_DSN; con sqlite, el archivo de la base
+	Host     string `yaml:"host"`     // DB_HOST
+	Port     int    `yaml:"port"`     // DB_PORT; 0 usa el puerto habitual del motor
+	User     string `yaml:"user"`     // DB_USER
+	Password string `yaml:"password"` // DB_PASSWORD
+	Name     string `yaml:"name"`     // DB_NAME
+
+	// AutoMigrate aplica las migraciones pendientes al iniciar (DB_AUTO_MIGRATE).
+	// Pensado para desarrollo; en producción se corre `migrate up` antes de desplegar.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// ConnectionString devuelve el DSN en el formato del driver
+func (d DatabaseConfig) ConnectionString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	switch d.Driver {
+	case DriverSQLite:
+		return sqliteInMemory
+	case DriverPostgres:
+		port := d.Port
+		if port == 0 {
+			port = 5432
+		}
+		dsn := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(d.User, d.Password),
+			Host:     net.JoinHostPort(d.Host, strconv.Itoa(port)),
+			Path:     "/" + d.Name,
+			RawQuery: "sslmode=disable",
+		}
+		return dsn.String()
+	default:
+		port := d.Port
+		if port == 0 {
+			port = 3306
+		}
+		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true&charset=utf8mb4&loc=Local",
+			d.User, d.Password, d.Host, port, d.Name)
+	}
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `yaml:"allowed_origins"` // CORS_ALLOWED_ORIGINS, separados por comas
+}
+
+// JWTConfig son las claves de firma y la duración de los tokens. Sin clave ni
+// secreto se genera una clave efímera: las sesiones se pierden al reiniciar.
+type JWTConfig struct {
+	SigningKeyFile   string        `yaml:"signing_key_file"`  // JWT_SIGNING_KEY_FILE, PEM RSA o Ed25519
+	SigningKeyID     string        `yaml:"signing_key_id"`    // JWT_SIGNING_KEY_ID
+	Secret           string        `yaml:"secret"`            // JWT_SECRET, HS256
+	VerificationKeys string        `yaml:"verification_keys"` // JWT_VERIFICATION_KEYS, "kid=archivo.pem,kid2=archivo2.pem"
+	AccessTokenTTL   time.Duration `yaml:"access_token_ttl"`  // JWT_ACCESS_TOKEN_TTL, por ejemplo "15m"
+	RefreshTokenTTL  time.Duration `yaml:"refresh_token_ttl"` // JWT_REFRESH_TOKEN_TTL, por ejemplo "720h"
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"` // LOG_LEVEL: debug, info, warn o error
+}
+
+// URLConfig son las páginas del frontend a las que apuntan los links de los
+// emails. Vacías, se usan las de localhost:3000.
+type URLConfig struct {
+	PasswordReset     string `yaml:"password_reset"`     // PASSWORD_RESET_URL
+	EmailVerification string `yaml:"email_verification"` // EMAIL_VERIFICATION_URL
+	Invitation        string `yaml:"invitation"`         // INVITATION_URL
+}
+
+// Default devuelve la configuración para desarrollo local
+func Default() Config {
+	return Config{
+		Server: ServerConfig{Port: 8080},
+		Database: DatabaseConfig{
+			Driver: DriverMySQL,
+			Host:   "localhost",
+			User:   "root",
+			Name:   "backend",
+		},
+		CORS: CORSConfig{AllowedOrigins: []string{"http://localhost:3000"}},
+		JWT: JWTConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Log: LogConfig{Level: "info"},
+	}
+}
+
+// Load arma la configuración: los valores por defecto, después el archivo de
+// CONFIG_FILE (o config.yaml si existe) y por último las variables de entorno.
+// Devuelve un error con todos los valores inválidos.
+func Load() (Config, error) {
+	cfg := Default()
+
+	path, required := os.LookupEnv("CONFIG_FILE")
+	if !required {
+		path = DefaultFile
+	}
+	if path != "" {
+		if err := cfg.loadFile(path, required); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadFile aplica el archivo YAML sobre la configuración. Las claves
+// desconocidas son un error, para no ignorar un typo en silencio.
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv aplica las variables de entorno definidas sobre la configuración
+func (c *Config) loadEnv() error {
+	var errs []error
+
+	setString := func(name string, target *string) {
+		if value, ok := os.LookupEnv(name); ok {
+			*target = value
+		}
+	}
+	setInt := func(name string, target *int) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setBool := func(name string, target *bool) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+	setDuration := func(name string, target *time.Duration) {
+		if value, ok := os.LookupEnv(name); ok {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration like 15m or 720h", name))
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	setInt("SERVER_PORT", &c.Server.Port)
+
+	setString("DB_DRIVER", &c.Database.Driver)
+	setString("DB_DSN", &c.Database.DSN)
+	setString("DB_HOST", &c.Database.Host)
+	setInt("DB_PORT", &c.Database.Port)
+	setString("DB_USER", &c.Database.User)
+	setString("DB_PASSWORD", &c.Database.Password)
+	setString("DB_NAME", &c.Database.Name)
+	setBool("DB_AUTO_MIGRATE", &c.Database.AutoMigrate)
+
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		c.CORS.AllowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				c.CORS.AllowedOrigins = append(c.CORS.AllowedOrigins, origin)
+			}
+		}
+	}
+
+	setString("JWT_SIGNING_KEY_FILE", &c.JWT.SigningKeyFile)
+	setString("JWT_SIGNING_KEY_ID", &c.JWT.SigningKeyID)
+	setString("JWT_SECRET", &c.JWT.Secret)
+	setString("JWT_VERIFICATION_KEYS", &c.JWT.VerificationKeys)
+	setDuration("JWT_ACCESS_TOKEN_TTL", &c.JWT.AccessTokenTTL)
+	setDuration("JWT_REFRESH_TOKEN_TTL", &c.JWT.RefreshTokenTTL)
+
+	setString("LOG_LEVEL", &c.Log.Level)
+
+	setString("PASSWORD_RESET_URL", &c.URLs.PasswordReset)
+	setString("EMAIL_VERIFICATION_URL", &c.URLs.EmailVerification)
+	setString("INVITATION_URL", &c.URLs.Invitation)
+
+	return errors.Join(errs...)
+}
+
+// Validate revisa que la configuración tenga sentido antes de iniciar el servidor
+func (c Config) Validate() error {
+	var errs []error
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("server port %d is out of range", c.Server.Port))
+	}
+
+	switch c.Database.Driver {
+	case DriverMySQL, DriverPostgres, DriverSQLite:
+	default:
+		errs = append(errs, fmt.Errorf("unknown database driver %q (available: mysql, postgres, sqlite)", c.Database.Driver))
+	}
+	if c.Database.DSN == "" && c.Database.Driver != DriverSQLite {
+		if c.Database.Host == "" {
+			errs = append(errs, errors.New("database host is required"))
+		}
+		if c.Database.Port < 0 || c.Database.Port > 65535 {
+			errs = append(errs, fmt.Errorf("database port %d is out of range", c.Database.Port))
+		}
+		if c.Database.User == "" {
+			errs = append(errs, errors.New("database user is required"))
+		}
+		if c.Database.Name == "" {
+			errs = append(errs, errors.New("database name is required"))
+		}
+	}
+
+	if len(c.CORS.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("at least one CORS origin is required"))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if parsed, err := url.Parse(origin); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") ||
+			parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			errs = append(errs, fmt.Errorf("invalid CORS origin %q", origin))
+		}
+	}
+
+	if c.JWT.SigningKeyFile != "" && c.JWT.Secret != "" {
+		errs = append(errs, errors.New("configure either a JWT signing key file or a JWT secret, not both"))
+	}
+	if c.JWT.Secret != "" && len(c.JWT.Secret) < 32 {
+		errs = append(errs, errors.New("JWT secret must be at least 32 characters"))
+	}
+	if c.JWT.AccessTokenTTL <= 0 || c.JWT.RefreshTokenTTL <= 0 {
+		errs = append(errs, errors.New("JWT token durations must be positive"))
+	} else if c.JWT.AccessTokenTTL >= c.JWT.RefreshTokenTTL {
+		errs = append(errs, errors.New("JWT access token duration must be shorter than the refresh token duration"))
+	}
+
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", c.Log.Level))
+	}
+
+	for _, link := range []struct{ name, value string }{
+		{"password reset", c.URLs.PasswordReset},
+		{"email verification", c.URLs.EmailVerification},
+		{"invitation", c.URLs.Invitation},
+	} {
+		if link.value == "" {
+			continue
+		}
+		if parsed, err := url.Parse(link.value); err != nil || !parsed.IsAbs() || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid %s URL %q", link.name, link.value))
+		}
+	}
+
+	return errors.Join(errs...)
+}
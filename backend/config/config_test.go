@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// inTempDir ejecuta el test en un directorio vacío, para que no se lea un config.yaml local
+func inTempDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	inTempDir(t)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Server.Port != 8080 || cfg.Log.Level != "info" || cfg.JWT.AccessTokenTTL != 15*time.Minute {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	want := "root:@tcp(localhost:3306)/backend?parseTime=true&charset=utf8mb4&loc=Local"
+	if got := cfg.Database.ConnectionString(); got != want {
+		t.Errorf("ConnectionString() = %q, want %q", got, want)
+	}
+}
+
+func TestLoadFileThenEnv(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, filepath.Join(dir, DefaultFile), `
+server:
+  port: 9000
+database:
+  host: db.internal
+  password: secreto
+cors:
+  allowed_origins: [https://gimnasio.example.com]
+jwt:
+  access_token_ttl: 5m
+log:
+  level: debug
+`)
+	t.Setenv("DB_PASSWORD", "desde-env")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("DB_AUTO_MIGRATE", "true")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Database.Host != "db.internal" || cfg.Log.Level != "debug" {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.Database.Password != "desde-env" || !cfg.Database.AutoMigrate {
+		t.Errorf("env must override the file, got %+v", cfg.Database)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 || cfg.CORS.AllowedOrigins[1] != "https://b.example.com" {
+		t.Errorf("unexpected origins: %v", cfg.CORS.AllowedOrigins)
+	}
+	if cfg.JWT.AccessTokenTTL != 5*time.Minute || cfg.JWT.RefreshTokenTTL != 30*24*time.Hour {
+		t.Errorf("unexpected token durations: %+v", cfg.JWT)
+	}
+}
+
+func TestLoadConfigFileFromEnv(t *testing.T) {
+	dir := inTempDir(t)
+	path := filepath.Join(dir, "otro.yaml")
+	writeFile(t, path, "server:\n  port: 7000\n")
+	t.Setenv("CONFIG_FILE", path)
+
+	cfg, err := Load()
+	if err != nil || cfg.Server.Port != 7000 {
+		t.Fatalf("expected port from CONFIG_FILE, got %d (%v)", cfg.Server.Port, err)
+	}
+
+	// Si se indica CONFIG_FILE el archivo tiene que existir
+	t.Setenv("CONFIG_FILE", filepath.Join(dir, "no-existe.yaml"))
+	if _, err := Load(); err == nil {
+		t.Error("expected error for a missing CONFIG_FILE")
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	dir := inTempDir(t)
+	writeFile(t, filepath.Join(dir, DefaultFile), "server:\n  prot: 9000\n")
+
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("expected error naming the unknown key, got %v", err)
+	}
+}
+
+func TestLoadReportsAllInvalidValues(t *testing.T) {
+	inTempDir(t)
+	t.Setenv("SERVER_PORT", "70000")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "localhost:3000")
+	t.Setenv("JWT_SECRET", "corto")
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("INVITATION_URL", "/accept-invitation")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{"server port", "CORS origin", "JWT secret", "log level", "invitation URL"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error to mention %q, got %v", want, err)
+		}
+	}
+
+	t.Setenv("SERVER_PORT", "ocho mil")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "SERVER_PORT") {
+		t.Errorf("expected error for a non numeric SERVER_PORT, got %v", err)
+	}
+
+	t.Setenv("DB_AUTO_MIGRATE", "sí")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "DB_AUTO_MIGRATE") {
+		t.Errorf("expected error for a non boolean DB_AUTO_MIGRATE, got %v", err)
+	}
+}
+
+func TestConnectionStringPerDriver(t *testing.T) {
+	db := DatabaseConfig{Host: "db", User: "gym", Password: "p@ss word", Name: "gimnasio"}
+
+	db.Driver = DriverPostgres
+	if got, want := db.ConnectionString(), "postgres://gym:p%40ss%20word@db:5432/gimnasio?sslmode=disable"; got != want {
+		t.Errorf("postgres ConnectionString() = %q, want %q", got, want)
+	}
+
+	db.Driver = DriverSQLite
+	if got := db.ConnectionString(); !strings.Contains(got, "mode=memory") {
+		t.Errorf("sqlite without DSN must be in memory, got %q", got)
+	}
+	db.DSN = "gimnasio.db"
+	if got := db.ConnectionString(); got != "gimnasio.db" {
+		t.Errorf("sqlite ConnectionString() = %q, want the DSN", got)
+	}
+}
+
+func TestValidateDatabaseDriver(t *testing.T) {
+	cfg := Default()
+	cfg.Database = DatabaseConfig{Driver: DriverSQLite}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("sqlite needs no host, user or name, got %v", err)
+	}
+
+	cfg.Database.Driver = "oracle"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "oracle") {
+		t.Errorf("expected error for an unknown driver, got %v", err)
+	}
+}
+
+func TestValidateTokenDurations(t *testing.T) {
+	cfg := Default()
+	cfg.JWT.AccessTokenTTL = time.Hour
+	cfg.JWT.RefreshTokenTTL = time.Minute
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected error when the access token outlives the refresh token")
+	}
+
+	cfg = Default()
+	cfg.Database = DatabaseConfig{Driver: DriverMySQL, DSN: "user:pass@tcp(db:3306)/gym"}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("a DSN alone must be enough, got %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package controllers
 
 import (
 	"backend/domain"
+	"backend/policy"
 	"backend/services"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -10,8 +12,17 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// ActivityController atiende las rutas de actividades
+type ActivityController struct {
+	activities *services.ActivityService
+}
+
+func NewActivityController(activities *services.ActivityService) *ActivityController {
+	return &ActivityController{activities: activities}
+}
+
 // GetActivityByID obtiene una actividad por ID
-func GetActivityByID(c *gin.Context) {
+func (ac *ActivityController) GetActivityByID(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -23,7 +34,7 @@ func GetActivityByID(c *gin.Context) {
 		return
 	}
 
-	activity, err := services.GetActivityByID(id)
+	activity, err := ac.activities.GetActivityByID(id)
 	if err != nil {
 		log.WithError(err).WithField("activity_id", id).Error("Activity not found")
 		c.JSON(http.StatusNotFound, gin.H{
@@ -40,8 +51,8 @@ func GetActivityByID(c *gin.Context) {
 }
 
 // GetActivities obtiene todas las actividades
-func GetActivities(c *gin.Context) {
-	activities, err := services.GetActivities()
+func (ac *ActivityController) GetActivities(c *gin.Context) {
+	activities, err := ac.activities.GetActivities()
 	if err != nil {
 		log.WithError(err).Error("Failed to get activities")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -58,26 +69,10 @@ func GetActivities(c *gin.Context) {
 	})
 }
 
-// CreateActivity crea una nueva actividad - REQUIERE SER ADMIN
-func CreateActivity(c *gin.Context) {
-	// Verificar autenticación y rol de administrador
-	isAdmin, exists := c.Get("is_admin")
-	if !exists {
-		log.Error("Admin status not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "Authentication required",
-			"success": false,
-		})
-		return
-	}
-
-	if isAdmin != true {
-		userID, _ := c.Get("user_id")
-		log.WithField("user_id", userID).Warn("Unauthorized attempt to create activity by non-admin user")
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "You do not have permission to create activities",
-			"success": false,
-		})
+// CreateActivity crea una nueva actividad - REQUIERE EL PERMISO activities:write
+func (ac *ActivityController) CreateActivity(c *gin.Context) {
+	// Verificar el permiso para administrar actividades
+	if !authorize(c, policy.WriteActivities, 0) {
 		return
 	}
 
@@ -91,7 +86,10 @@ func CreateActivity(c *gin.Context) {
 		return
 	}
 
-	createdActivity, err := services.InsertActivity(activity)
+	createdActivity, err := ac.activities.InsertActivity(activity, actorOf(c))
+	if respondValidationError(c, err) {
+		return
+	}
 	if err != nil {
 		log.WithError(err).WithField("activity_name", activity.Name).Error("Failed to create activity")
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -114,26 +112,27 @@ func CreateActivity(c *gin.Context) {
 	})
 }
 
-// UpdateActivity actualiza una actividad existente - REQUIERE SER ADMIN
-func UpdateActivity(c *gin.Context) {
-	// Verificar autenticación y rol de administrador
-	isAdmin, exists := c.Get("is_admin")
-	if !exists {
-		log.Error("Admin status not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "Authentication required",
-			"success": false,
-		})
-		return
+// respondValidationError responde 400 con los campos inválidos si err es un
+// *services.ValidationError
+func respondValidationError(c *gin.Context, err error) bool {
+	var invalid *services.ValidationError
+	if !errors.As(err, &invalid) {
+		return false
 	}
 
-	if isAdmin != true {
-		userID, _ := c.Get("user_id")
-		log.WithField("user_id", userID).Warn("Unauthorized attempt to update activity by non-admin user")
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "You do not have permission to update activities",
-			"success": false,
-		})
+	log.WithField("fields", invalid.Fields).Warn("Invalid activity request")
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "Invalid activity",
+		"fields":  invalid.Fields,
+		"success": false,
+	})
+	return true
+}
+
+// UpdateActivity actualiza una actividad existente - REQUIERE EL PERMISO activities:write
+func (ac *ActivityController) UpdateActivity(c *gin.Context) {
+	// Verificar el permiso para administrar actividades
+	if !authorize(c, policy.WriteActivities, 0) {
 		return
 	}
 
@@ -160,7 +159,11 @@ func UpdateActivity(c *gin.Context) {
 
 	activity.ID = id // Asegurar que el ID coincida
 
-	if err := services.UpdateActivity(activity); err != nil {
+	err = ac.activities.UpdateActivity(activity, actorOf(c))
+	if respondValidationError(c, err) {
+		return
+	}
+	if err != nil {
 		log.WithError(err).WithField("activity_id", id).Error("Failed to update activity")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   err.Error(),
@@ -181,26 +184,10 @@ func UpdateActivity(c *gin.Context) {
 	})
 }
 
-// DeleteActivity elimina una actividad - REQUIERE SER ADMIN
-func DeleteActivity(c *gin.Context) {
-	// Verificar autenticación y rol de administrador
-	isAdmin, exists := c.Get("is_admin")
-	if !exists {
-		log.Error("Admin status not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "Authentication required",
-			"success": false,
-		})
-		return
-	}
-
-	if isAdmin != true {
-		userID, _ := c.Get("user_id")
-		log.WithField("user_id", userID).Warn("Unauthorized attempt to delete activity by non-admin user")
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "You do not have permission to delete activities",
-			"success": false,
-		})
+// DeleteActivity elimina una actividad - REQUIERE EL PERMISO activities:write
+func (ac *ActivityController) DeleteActivity(c *gin.Context) {
+	// Verificar el permiso para administrar actividades
+	if !authorize(c, policy.WriteActivities, 0) {
 		return
 	}
 
@@ -215,7 +202,11 @@ func DeleteActivity(c *gin.Context) {
 		return
 	}
 
-	if err := services.DeleteActivity(id); err != nil {
+	if err := ac.activities.DeleteActivity(id, actorOf(c)); err != nil {
+		if err.Error() == "activity not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found", "success": false})
+			return
+		}
 		log.WithError(err).WithField("activity_id", id).Error("Failed to delete activity")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to delete activity",
@@ -237,7 +228,7 @@ func DeleteActivity(c *gin.Context) {
 }
 
 // GetActivitiesByCategory obtiene actividades por categoría
-func GetActivitiesByCategory(c *gin.Context) {
+func (ac *ActivityController) GetActivitiesByCategory(c *gin.Context) {
 	categoria := c.Param("categoria")
 	if categoria == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -247,7 +238,7 @@ func GetActivitiesByCategory(c *gin.Context) {
 		return
 	}
 
-	activities, err := services.GetActivitiesByCategory(categoria)
+	activities, err := ac.activities.GetActivitiesByCategory(categoria)
 	if err != nil {
 		log.WithError(err).WithField("categoria", categoria).Error("Failed to get activities by category")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -266,7 +257,7 @@ func GetActivitiesByCategory(c *gin.Context) {
 }
 
 // GetActivitiesByProfesor obtiene actividades por profesor
-func GetActivitiesByProfesor(c *gin.Context) {
+func (ac *ActivityController) GetActivitiesByProfesor(c *gin.Context) {
 	profesor := c.Param("profesor")
 	if profesor == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -276,7 +267,7 @@ func GetActivitiesByProfesor(c *gin.Context) {
 		return
 	}
 
-	activities, err := services.GetActivitiesByProfesor(profesor)
+	activities, err := ac.activities.GetActivitiesByProfesor(profesor)
 	if err != nil {
 		log.WithError(err).WithField("profesor", profesor).Error("Failed to get activities by profesor")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -295,7 +286,7 @@ func GetActivitiesByProfesor(c *gin.Context) {
 }
 
 // GetActivitiesByDay obtiene actividades por día
-func GetActivitiesByDay(c *gin.Context) {
+func (ac *ActivityController) GetActivitiesByDay(c *gin.Context) {
 	diaParam := c.Param("dia")
 	dia, err := strconv.Atoi(diaParam)
 	if err != nil {
@@ -307,7 +298,7 @@ func GetActivitiesByDay(c *gin.Context) {
 		return
 	}
 
-	activities, err := services.GetActivitiesByDay(dia)
+	activities, err := ac.activities.GetActivitiesByDay(dia)
 	if err != nil {
 		log.WithError(err).WithField("dia", dia).Error("Failed to get activities by day")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -326,8 +317,8 @@ func GetActivitiesByDay(c *gin.Context) {
 }
 
 // GetActivitiesWithAvailableSlots obtiene actividades con cupos disponibles
-func GetActivitiesWithAvailableSlots(c *gin.Context) {
-	activities, err := services.GetActivitiesWithAvailableSlots()
+func (ac *ActivityController) GetActivitiesWithAvailableSlots(c *gin.Context) {
+	activities, err := ac.activities.GetActivitiesWithAvailableSlots()
 	if err != nil {
 		log.WithError(err).Error("Failed to get activities with available slots")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -345,7 +336,7 @@ func GetActivitiesWithAvailableSlots(c *gin.Context) {
 }
 
 // SearchActivitiesByName busca actividades por nombre
-func SearchActivitiesByName(c *gin.Context) {
+func (ac *ActivityController) SearchActivitiesByName(c *gin.Context) {
 	name := c.Query("name")
 	if name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -355,7 +346,7 @@ func SearchActivitiesByName(c *gin.Context) {
 		return
 	}
 
-	activities, err := services.SearchActivitiesByName(name)
+	activities, err := ac.activities.SearchActivitiesByName(name)
 	if err != nil {
 		log.WithError(err).WithField("name", name).Error("Failed to search activities by name")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -373,26 +364,10 @@ func SearchActivitiesByName(c *gin.Context) {
 	})
 }
 
-// UpdateActivitySlots actualiza los cupos de una actividad - REQUIERE SER ADMIN
-func UpdateActivitySlots(c *gin.Context) {
-	// Verificar autenticación y rol de administrador
-	isAdmin, exists := c.Get("is_admin")
-	if !exists {
-		log.Error("Admin status not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":   "Authentication required",
-			"success": false,
-		})
-		return
-	}
-
-	if isAdmin != true {
-		userID, _ := c.Get("user_id")
-		log.WithField("user_id", userID).Warn("Unauthorized attempt to update activity slots by non-admin user")
-		c.JSON(http.StatusForbidden, gin.H{
-			"error":   "You do not have permission to update activity slots",
-			"success": false,
-		})
+// UpdateActivitySlots actualiza los cupos de una actividad - REQUIERE EL PERMISO activities:write
+func (ac *ActivityController) UpdateActivitySlots(c *gin.Context) {
+	// Verificar el permiso para administrar actividades
+	if !authorize(c, policy.WriteActivities, 0) {
 		return
 	}
 
@@ -408,7 +383,7 @@ func UpdateActivitySlots(c *gin.Context) {
 	}
 
 	var request struct {
-		Cupos int `json:"cupos" binding:"required"`
+		Capacidad int `json:"capacidad" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -420,7 +395,7 @@ func UpdateActivitySlots(c *gin.Context) {
 		return
 	}
 
-	if err := services.UpdateActivitySlots(id, request.Cupos); err != nil {
+	if err := ac.activities.UpdateActivitySlots(id, request.Capacidad, actorOf(c)); err != nil {
 		log.WithError(err).WithField("activity_id", id).Error("Failed to update activity slots")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   err.Error(),
@@ -432,7 +407,7 @@ func UpdateActivitySlots(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	log.WithFields(log.Fields{
 		"activity_id": id,
-		"new_slots":   request.Cupos,
+		"capacidad":   request.Capacidad,
 		"updated_by":  userID,
 	}).Info("Activity slots updated successfully")
 
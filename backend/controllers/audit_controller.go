@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/policy"
+	"backend/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetAuditEvents lista el registro de auditoría (REQUIERE EL PERMISO audit:read).
+// Filtros opcionales: actor_id, action, entity, entity_id, request_id, from y
+// to (RFC 3339). Paginado con page y page_size.
+func GetAuditEvents(c *gin.Context) {
+	if !authorize(c, policy.ReadAudit, 0) {
+		return
+	}
+
+	query := domain.AuditQuery{
+		Action:    c.Query("action"),
+		Entity:    c.Query("entity"),
+		EntityID:  c.Query("entity_id"),
+		RequestID: c.Query("request_id"),
+	}
+
+	var invalid string
+	queryInt := func(name string) int {
+		value := c.Query(name)
+		if value == "" {
+			return 0
+		}
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			invalid = name
+			return 0
+		}
+		return parsed
+	}
+	queryTime := func(name string) *time.Time {
+		value := c.Query(name)
+		if value == "" {
+			return nil
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			invalid = name
+			return nil
+		}
+		return &parsed
+	}
+	query.ActorID = queryInt("actor_id")
+	query.Page = queryInt("page")
+	query.PageSize = queryInt("page_size")
+	query.From = queryTime("from")
+	query.To = queryTime("to")
+
+	if invalid != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid " + invalid,
+			"success": false,
+		})
+		return
+	}
+
+	page, err := services.GetAuditEvents(query)
+	if err != nil {
+		log.WithError(err).Error("Failed to get audit events")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve audit events",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    page.Events,
+		"total":     page.Total,
+		"page":      page.Page,
+		"page_size": page.PageSize,
+		"success":   true,
+	})
+}
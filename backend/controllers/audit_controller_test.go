@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"backend/dao"
+	"backend/domain"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type auditResponse struct {
+	Events   []domain.AuditEvent `json:"events"`
+	Total    int64               `json:"total"`
+	Page     int                 `json:"page"`
+	PageSize int                 `json:"page_size"`
+}
+
+// auditFixture siembra una actividad llena con owner inscripto y waiting en la lista de espera
+type auditFixture struct {
+	router                *gin.Engine
+	admin, owner, waiting dao.User
+	activity              dao.Activity
+	inscription           dao.Inscription
+}
+
+func newAuditFixture(t *testing.T) auditFixture {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	f := auditFixture{
+		admin:   dao.User{Name: "Admin", Username: "admin", PasswordHash: "x"},
+		owner:   dao.User{Name: "Owner", Username: "owner", PasswordHash: "x"},
+		waiting: dao.User{Name: "Waiting", Username: "waiting", PasswordHash: "x"},
+	}
+	for _, user := range []*dao.User{&f.admin, &f.owner, &f.waiting} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+	}
+	f.activity = dao.Activity{Nombre: "Yoga", Capacidad: 1, Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	db.Create(&f.activity)
+	f.inscription = dao.Inscription{ID_usuario: f.owner.ID, ID_actividad: f.activity.ID_actividad, Estado: dao.EstadoActiva}
+	db.Create(&f.inscription)
+	db.Create(&dao.WaitlistEntry{ID_usuario: f.waiting.ID, ID_actividad: f.activity.ID_actividad})
+
+	ctl := newTestControllers()
+	router := gin.New()
+	router.Use(utils.RequestID())
+	router.PUT("/admin/activities/:id/slots", authenticatedAs(f.admin.ID, dao.RolAdmin), ctl.activities.UpdateActivitySlots)
+	router.DELETE("/owner/inscriptions/:id", authenticatedAs(f.owner.ID, dao.RolSocio), ctl.inscriptions.DeleteInscription)
+	router.GET("/admin/audit", authenticatedAs(f.admin.ID, dao.RolAdmin), GetAuditEvents)
+	router.GET("/owner/audit", authenticatedAs(f.owner.ID, dao.RolSocio), GetAuditEvents)
+	f.router = router
+	return f
+}
+
+func (f auditFixture) do(t *testing.T, method, path, requestID string, body interface{}, response interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	if requestID != "" {
+		req.Header.Set(utils.RequestIDHeader, requestID)
+	}
+	f.router.ServeHTTP(w, req)
+	if response != nil {
+		json.Unmarshal(w.Body.Bytes(), response)
+	}
+	return w
+}
+
+func TestAuditRecordsCapacityChangeWithDiff(t *testing.T) {
+	f := newAuditFixture(t)
+	activityID := strconv.Itoa(f.activity.ID_actividad)
+
+	w := f.do(t, http.MethodPut, "/admin/activities/"+activityID+"/slots", "req-capacity-1", map[string]int{"capacidad": 5}, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 updating capacity, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(utils.RequestIDHeader); got != "req-capacity-1" {
+		t.Fatalf("expected the request id to be echoed, got %q", got)
+	}
+
+	var response auditResponse
+	w = f.do(t, http.MethodGet, "/admin/audit?entity=activity&entity_id="+activityID, "", nil, &response)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on GET /audit, got %d: %s", w.Code, w.Body.String())
+	}
+	if response.Total != 1 || len(response.Events) != 1 {
+		t.Fatalf("expected one activity event, got %+v", response)
+	}
+
+	event := response.Events[0]
+	if event.Action != dao.AccionCapacidadModificada || event.ActorID == nil || *event.ActorID != f.admin.ID ||
+		event.RequestID != "req-capacity-1" || event.IP == "" {
+		t.Fatalf("unexpected event: %+v", event)
+	}
+	var before, after map[string]interface{}
+	json.Unmarshal(event.Before, &before)
+	json.Unmarshal(event.After, &after)
+	if len(before) != 1 || before["Capacidad"] != float64(1) || len(after) != 1 || after["Capacidad"] != float64(5) {
+		t.Fatalf("expected only the capacity in the diff, got before=%s after=%s", event.Before, event.After)
+	}
+}
+
+func TestAuditRecordsCancellationAndPromotionInOneRequest(t *testing.T) {
+	f := newAuditFixture(t)
+
+	w := f.do(t, http.MethodDelete, "/owner/inscriptions/"+strconv.Itoa(f.inscription.ID_inscripcion), "", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 cancelling, got %d: %s", w.Code, w.Body.String())
+	}
+	requestID := w.Header().Get(utils.RequestIDHeader)
+	if requestID == "" {
+		t.Fatal("expected a generated request id")
+	}
+
+	var response auditResponse
+	f.do(t, http.MethodGet, "/admin/audit?request_id="+requestID, "", nil, &response)
+	if response.Total != 2 {
+		t.Fatalf("expected cancel and promote events, got %+v", response)
+	}
+	// Del más nuevo al más viejo
+	promote, cancel := response.Events[0], response.Events[1]
+	if cancel.Action != dao.AccionInscripcionCancelada || cancel.EntityID != strconv.Itoa(f.inscription.ID_inscripcion) {
+		t.Fatalf("unexpected cancel event: %+v", cancel)
+	}
+	var after map[string]interface{}
+	json.Unmarshal(cancel.After, &after)
+	if after["estado"] != dao.EstadoCancelada {
+		t.Fatalf("expected the new estado in the diff, got %s", cancel.After)
+	}
+	if promote.Action != dao.AccionInscripcionPromovida || string(promote.Before) != "null" ||
+		promote.ActorID == nil || *promote.ActorID != f.owner.ID {
+		t.Fatalf("unexpected promote event: %+v", promote)
+	}
+
+	// Filtrar por actor y por acción
+	f.do(t, http.MethodGet, "/admin/audit?actor_id="+strconv.Itoa(f.owner.ID)+"&action="+dao.AccionInscripcionPromovida, "", nil, &response)
+	if response.Total != 1 || response.Events[0].ID != promote.ID {
+		t.Fatalf("expected only the promote event, got %+v", response)
+	}
+}
+
+func TestAuditPaginationAndValidation(t *testing.T) {
+	f := newAuditFixture(t)
+	activityID := strconv.Itoa(f.activity.ID_actividad)
+	for _, capacidad := range []int{2, 3, 4} {
+		f.do(t, http.MethodPut, "/admin/activities/"+activityID+"/slots", "", map[string]int{"capacidad": capacidad}, nil)
+	}
+
+	var response auditResponse
+	f.do(t, http.MethodGet, "/admin/audit?page=2&page_size=2", "", nil, &response)
+	if response.Total != 3 || response.Page != 2 || response.PageSize != 2 || len(response.Events) != 1 {
+		t.Fatalf("unexpected second page: %+v", response)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	f.do(t, http.MethodGet, "/admin/audit?from="+future, "", nil, &response)
+	if response.Total != 0 {
+		t.Fatalf("expected no events after %s, got %+v", future, response)
+	}
+
+	for _, query := range []string{"page=0", "page_size=abc", "actor_id=-1", "from=yesterday"} {
+		if w := f.do(t, http.MethodGet, "/admin/audit?"+query, "", nil, nil); w.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d", query, w.Code)
+		}
+	}
+	if w := f.do(t, http.MethodGet, "/owner/audit", "", nil, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for a member, got %d", w.Code)
+	}
+}
+
+func TestAuditRejectsMalformedRequestID(t *testing.T) {
+	f := newAuditFixture(t)
+
+	w := f.do(t, http.MethodGet, "/admin/audit", "bad id\nwith newline", nil, nil)
+	got := w.Header().Get(utils.RequestIDHeader)
+	if got == "" || got == "bad id\nwith newline" {
+		t.Fatalf("expected a generated request id, got %q", got)
+	}
+}
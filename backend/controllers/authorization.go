@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/policy"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// principalFrom obtiene el usuario autenticado que JwtAuthMiddleware dejó en el contexto
+func principalFrom(c *gin.Context) policy.Principal {
+	return policy.Principal{
+		UserID:      c.GetInt("user_id"),
+		Roles:       c.GetStringSlice("roles"),
+		Permissions: c.GetStringSlice("permissions"),
+	}
+}
+
+// actorOf arma el actor de los cambios hechos en esta request, para la
+// auditoría. Sin JwtAuthMiddleware el UserID queda en 0.
+func actorOf(c *gin.Context) domain.Actor {
+	return domain.Actor{
+		UserID:    c.GetInt("user_id"),
+		IP:        c.ClientIP(),
+		RequestID: c.GetString("request_id"),
+	}
+}
+
+// authorize aplica la política de autorización sobre un recurso del usuario
+// ownerID. Si la acción no está permitida responde 403 y devuelve false.
+func authorize(c *gin.Context, action policy.Action, ownerID int) bool {
+	principal := principalFrom(c)
+	if policy.Can(principal, action, ownerID) {
+		return true
+	}
+
+	log.WithFields(log.Fields{
+		"user_id":  principal.UserID,
+		"action":   action,
+		"owner_id": ownerID,
+	}).Warn("Forbidden action")
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "You are not allowed to perform this action",
+		"success": false,
+	})
+	return false
+}
@@ -0,0 +1,314 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/policy"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticatedAs simula al usuario que JwtAuthMiddleware deja en el contexto,
+// con los permisos de los roles por defecto
+func authenticatedAs(userID int, roles ...string) gin.HandlerFunc {
+	permissions := []string{}
+	for _, role := range roles {
+		permissions = append(permissions, policy.DefaultRoles[role]...)
+	}
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("roles", roles)
+		c.Set("permissions", permissions)
+		c.Set("is_admin", utils.HasRole(roles, dao.RolAdmin))
+	}
+}
+
+// authFixture son los datos sembrados para probar la política de autorización
+type authFixture struct {
+	owner, other, admin, instructor, frontDesk dao.User
+	// activity tiene cupos, está a cargo de instructor y ya incluye la inscripción de owner
+	activity dao.Activity
+	// free tiene cupos y nadie inscripto
+	free dao.Activity
+	// full no tiene cupos y owner está en su lista de espera
+	full        dao.Activity
+	inscription dao.Inscription
+	waitlist    dao.WaitlistEntry
+}
+
+func seedAuthFixture(t *testing.T) authFixture {
+	t.Helper()
+	db := setupTestDB(t)
+
+	roles := map[string]dao.Role{}
+	all, _ := clients.GetRoles()
+	for _, role := range all {
+		roles[role.Nombre] = role
+	}
+
+	var f authFixture
+	f.owner = verified(dao.User{Name: "Dueño", Username: "owner", PasswordHash: "x", Roles: []dao.Role{roles[dao.RolSocio]}})
+	f.other = verified(dao.User{Name: "Otro", Username: "other", PasswordHash: "x", Roles: []dao.Role{roles[dao.RolSocio]}})
+	f.admin = verified(dao.User{Name: "Admin", Username: "admin", PasswordHash: "x", Roles: []dao.Role{roles[dao.RolAdmin]}})
+	f.instructor = verified(dao.User{Name: "Luz", Username: "instructor", PasswordHash: "x", Roles: []dao.Role{roles[dao.RolInstructor]}})
+	f.frontDesk = verified(dao.User{Name: "Recepción", Username: "frontdesk", PasswordHash: "x", Roles: []dao.Role{roles[dao.RolRecepcion]}})
+	for _, user := range []*dao.User{&f.owner, &f.other, &f.admin, &f.instructor, &f.frontDesk} {
+		db.Create(user)
+	}
+
+	f.activity = dao.Activity{Nombre: "Yoga", Profesor: "Luz", Capacidad: 5, Categoria: "Relax", Descripcion: "Yoga", Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}}, ID_instructor: &f.instructor.ID}
+	f.free = dao.Activity{Nombre: "Box", Profesor: "Tito", Capacidad: 5, Categoria: "Fuerza", Descripcion: "Box", Horarios: []dao.ActivitySlot{{Dia: 2, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	f.full = dao.Activity{Nombre: "Spinning", Profesor: "Ana", Capacidad: 1, Categoria: "Aeróbico", Descripcion: "Spinning", Horarios: []dao.ActivitySlot{{Dia: 3, Hora_inicio: "18:00", Hora_fin: "19:00"}}}
+	for _, activity := range []*dao.Activity{&f.activity, &f.free, &f.full} {
+		db.Create(activity)
+	}
+
+	f.inscription = dao.Inscription{ID_usuario: f.owner.ID, ID_actividad: f.activity.ID_actividad}
+	db.Create(&f.inscription)
+	db.Create(&dao.Inscription{ID_usuario: f.other.ID, ID_actividad: f.full.ID_actividad})
+	f.waitlist = dao.WaitlistEntry{ID_usuario: f.owner.ID, ID_actividad: f.full.ID_actividad}
+	db.Create(&f.waitlist)
+
+	return f
+}
+
+// newPolicyRouter registra las rutas con los mismos middlewares que main.go
+func newPolicyRouter() *gin.Engine {
+	ctl := newTestControllers()
+	router := gin.New()
+	auth := utils.JwtAuthMiddleware()
+	admin := utils.RequirePermission(policy.PermActivitiesWrite)
+
+	router.GET("/users", auth, ctl.users.GetAllUsers)
+	router.GET("/users/:id", auth, ctl.users.GetUserByID)
+	router.PUT("/users/:id", auth, ctl.users.UpdateUser)
+	router.DELETE("/users/:id", auth, ctl.users.DeleteUser)
+	router.GET("/users/:id/inscriptions", auth, ctl.inscriptions.GetInscriptionsByUserID)
+	router.PUT("/users/:id/roles", auth, utils.RequirePermission(policy.PermRolesWrite), SetUserRoles)
+	router.GET("/roles", auth, GetRoles)
+
+	router.GET("/activities", ctl.activities.GetActivities)
+	router.GET("/activities/:id", ctl.activities.GetActivityByID)
+	router.GET("/activities/:id/inscriptions", auth, ctl.inscriptions.GetActivityRoster)
+	router.POST("/activities", auth, admin, ctl.activities.CreateActivity)
+	router.PUT("/activities/:id", auth, admin, ctl.activities.UpdateActivity)
+	router.DELETE("/activities/:id", auth, admin, ctl.activities.DeleteActivity)
+	router.PUT("/activities/:id/slots", auth, admin, ctl.activities.UpdateActivitySlots)
+
+	router.GET("/inscription/:id", auth, ctl.inscriptions.GetInscriptionByID)
+	router.POST("/inscription", auth, ctl.inscriptions.CreateInscription)
+	router.GET("/inscriptions/myactivities/:id", auth, ctl.inscriptions.GetActivitiesByUser)
+	router.DELETE("/inscriptions/:id", auth, ctl.inscriptions.DeleteInscription)
+
+	router.GET("/inscriptions/waitlist/:id", auth, ctl.inscriptions.GetWaitlistByUser)
+	router.DELETE("/inscriptions/waitlist/:id", auth, ctl.inscriptions.LeaveWaitlist)
+	return router
+}
+
+type actor int
+
+const (
+	anonymous actor = iota
+	owner
+	other
+	admin
+	instructor
+	frontDesk
+)
+
+func (a actor) String() string {
+	return [...]string{"anonymous", "owner", "other", "admin", "instructor", "front desk"}[a]
+}
+
+func TestRouteAuthorizationPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	const activityBody = `{"name":"Funcional","profesor":"Leo","categoria":"Fuerza","capacidad":8,"description":"Funcional","dia":4,"hora_inicio":"07:00","hora_fin":"08:00"}`
+
+	cases := []struct {
+		method string
+		// path admite los marcadores {owner}, {activity}, {free}, {inscription} y {waitlist}
+		path string
+		body string
+		want map[actor]int
+	}{
+		{"GET", "/users", "", map[actor]int{anonymous: 401, owner: 403, instructor: 403, frontDesk: 200, admin: 200}},
+		{"GET", "/users/{owner}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, frontDesk: 200, admin: 200}},
+		{"PUT", "/users/{owner}", `{"username":"renamed"}`, map[actor]int{anonymous: 401, other: 403, owner: 200, frontDesk: 403, admin: 200}},
+		{"DELETE", "/users/{owner}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, frontDesk: 403, admin: 200}},
+		{"GET", "/users/{owner}/inscriptions", "", map[actor]int{anonymous: 401, other: 403, owner: 200, frontDesk: 200, admin: 200}},
+		{"PUT", "/users/{owner}/roles", `{"roles":["admin"]}`, map[actor]int{anonymous: 401, owner: 403, other: 403, frontDesk: 403, admin: 200}},
+		{"GET", "/roles", "", map[actor]int{anonymous: 401, owner: 200, admin: 200}},
+
+		{"GET", "/activities", "", map[actor]int{anonymous: 200, owner: 200}},
+		{"GET", "/activities/{activity}", "", map[actor]int{anonymous: 200, owner: 200}},
+		{"GET", "/activities/{activity}/inscriptions", "", map[actor]int{anonymous: 401, owner: 403, instructor: 200, frontDesk: 200, admin: 200}},
+		{"GET", "/activities/{free}/inscriptions", "", map[actor]int{instructor: 403, frontDesk: 200, admin: 200}},
+		{"POST", "/activities", activityBody, map[actor]int{anonymous: 401, owner: 403, frontDesk: 403, admin: 201}},
+		{"PUT", "/activities/{free}", activityBody, map[actor]int{anonymous: 401, owner: 403, instructor: 403, admin: 200}},
+		{"DELETE", "/activities/{free}", "", map[actor]int{anonymous: 401, owner: 403, frontDesk: 403, admin: 200}},
+		{"PUT", "/activities/{free}/slots", `{"capacidad":10}`, map[actor]int{anonymous: 401, owner: 403, frontDesk: 403, admin: 200}},
+
+		{"GET", "/inscription/{inscription}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, instructor: 403, frontDesk: 200, admin: 200}},
+		{"POST", "/inscription", `{"actividad_id":{free}}`, map[actor]int{anonymous: 401, owner: 201}},
+		{"POST", "/inscription", `{"usuario_id":{owner},"actividad_id":{free}}`, map[actor]int{other: 403, owner: 201, instructor: 403, frontDesk: 201, admin: 201}},
+		{"GET", "/inscriptions/myactivities/{owner}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, admin: 200}},
+		{"DELETE", "/inscriptions/{inscription}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, frontDesk: 200, admin: 200}},
+
+		{"GET", "/inscriptions/waitlist/{owner}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, admin: 200}},
+		{"DELETE", "/inscriptions/waitlist/{waitlist}", "", map[actor]int{anonymous: 401, other: 403, owner: 200, admin: 200}},
+	}
+
+	for _, tc := range cases {
+		for who, want := range tc.want {
+			name := fmt.Sprintf("%s %s %s as %s", tc.method, tc.path, tc.body, who)
+			t.Run(name, func(t *testing.T) {
+				// Cada caso usa su propia base para que los DELETE no afecten a los demás
+				f := seedAuthFixture(t)
+				router := newPolicyRouter()
+
+				replacer := strings.NewReplacer(
+					"{owner}", fmt.Sprint(f.owner.ID),
+					"{activity}", fmt.Sprint(f.activity.ID_actividad),
+					"{free}", fmt.Sprint(f.free.ID_actividad),
+					"{inscription}", fmt.Sprint(f.inscription.ID_inscripcion),
+					"{waitlist}", fmt.Sprint(f.waitlist.ID_espera),
+				)
+				req := httptest.NewRequest(tc.method, replacer.Replace(tc.path), bytes.NewBufferString(replacer.Replace(tc.body)))
+				req.Header.Set("Content-Type", "application/json")
+
+				userID := map[actor]int{
+					owner:      f.owner.ID,
+					other:      f.other.ID,
+					admin:      f.admin.ID,
+					instructor: f.instructor.ID,
+					frontDesk:  f.frontDesk.ID,
+				}[who]
+				if who != anonymous {
+					tokens, err := services.IssueTokens(userID)
+					if err != nil {
+						t.Fatalf("failed to issue tokens: %v", err)
+					}
+					req.Header.Set("Authorization", "Bearer "+tokens.Token)
+				}
+
+				w := httptest.NewRecorder()
+				router.ServeHTTP(w, req)
+				if w.Code != want {
+					t.Errorf("expected %d, got %d: %s", want, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestSetUserRolesRevokesSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := seedAuthFixture(t)
+	router := newPolicyRouter()
+
+	ownerTokens, _ := services.IssueTokens(f.owner.ID)
+	adminTokens, _ := services.IssueTokens(f.admin.ID)
+
+	setRoles := func(token string, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/users/%d/roles", f.owner.ID), bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := setRoles(ownerTokens.Token, `{"roles":["admin"]}`); code != http.StatusForbidden {
+		t.Fatalf("expected 403 when a member grants itself admin, got %d", code)
+	}
+	if code := setRoles(adminTokens.Token, `{"roles":["inexistente"]}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown role, got %d", code)
+	}
+	if code := setRoles(adminTokens.Token, `{"roles":["instructor","recepcion"]}`); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+
+	stored, _ := services.NewUserService(services.NewDBStore()).GetUserByID(f.owner.ID)
+	if len(stored.Roles) != 2 || stored.IsAdmin {
+		t.Errorf("expected roles instructor and recepcion, got %+v", stored.Roles)
+	}
+
+	// Los tokens emitidos con los roles anteriores dejan de valer
+	if code := authGet(router, "/roles", ownerTokens.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected previous session to be revoked, got %d", code)
+	}
+	if _, err := services.RefreshTokens(ownerTokens.RefreshToken); err == nil {
+		t.Error("expected previous refresh token to be revoked")
+	}
+
+	newTokens, _ := services.IssueTokens(f.owner.ID)
+	if code := authGet(router, "/users", newTokens.Token); code != http.StatusOK {
+		t.Errorf("expected new session to carry the front desk permissions, got %d", code)
+	}
+}
+
+func TestUpdateUserPasswordRequiresCurrentAndRevokesSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := seedAuthFixture(t)
+	router := newPolicyRouter()
+
+	hash, _ := utils.NewPasswordHasher().Hash("secreto")
+	clients.UpdatePasswordHash(f.owner.ID, hash)
+	ownerTokens, _ := services.IssueTokens(f.owner.ID)
+	adminTokens, _ := services.IssueTokens(f.admin.ID)
+	path := fmt.Sprintf("/users/%d", f.owner.ID)
+
+	updateUser := func(token string, body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Con solo el token no alcanza: el socio confirma la contraseña actual
+	if code := updateUser(ownerTokens.Token, `{"password":"nueva"}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without the current password, got %d", code)
+	}
+	if code := updateUser(ownerTokens.Token, `{"password":"nueva","current_password":"otra"}`); code != http.StatusForbidden {
+		t.Errorf("expected 403 with a wrong current password, got %d", code)
+	}
+	if code := authGet(router, path, ownerTokens.Token); code != http.StatusOK {
+		t.Fatalf("expected the session to survive a rejected change, got %d", code)
+	}
+
+	if code := updateUser(ownerTokens.Token, `{"password":"nueva","current_password":"secreto"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 with the current password, got %d", code)
+	}
+	if code := authGet(router, path, ownerTokens.Token); code != http.StatusUnauthorized {
+		t.Errorf("expected previous session to be revoked, got %d", code)
+	}
+	if _, err := services.RefreshTokens(ownerTokens.RefreshToken); err == nil {
+		t.Error("expected previous refresh token to be revoked")
+	}
+
+	// Un administrador la cambia sin conocer la actual, y también cierra las sesiones
+	ownerTokens, _ = services.IssueTokens(f.owner.ID)
+	if code := updateUser(adminTokens.Token, `{"password":"otra"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 for an admin, got %d", code)
+	}
+	if _, err := services.RefreshTokens(ownerTokens.RefreshToken); err == nil {
+		t.Error("expected the refresh token to be revoked after an admin change")
+	}
+	if code := authGet(router, path, adminTokens.Token); code != http.StatusOK {
+		t.Errorf("expected the admin session to be kept, got %d", code)
+	}
+
+	stored, _ := clients.GetUserByID(f.owner.ID)
+	if ok, _ := utils.NewPasswordHasher().Verify("otra", stored.PasswordHash); !ok {
+		t.Error("expected the new password to be stored")
+	}
+}
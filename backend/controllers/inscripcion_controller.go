@@ -2,54 +2,48 @@ package controllers
 
 import (
 	"backend/domain"
+	"backend/policy"
 	"backend/services"
-	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
+// InscriptionController atiende las rutas de inscripciones y listas de espera
+type InscriptionController struct {
+	inscriptions *services.InscriptionService
+	activities   *services.ActivityService
+}
+
+func NewInscriptionController(inscriptions *services.InscriptionService, activities *services.ActivityService) *InscriptionController {
+	return &InscriptionController{inscriptions: inscriptions, activities: activities}
+}
+
 // GetInscriptionByID maneja la obtención de una inscripción por ID
-func GetInscriptionByID(c *gin.Context) {
+func (ic *InscriptionController) GetInscriptionByID(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
 
-	inscription, err := services.GetInscriptionByID(id)
+	inscription, err := ic.inscriptions.GetInscriptionByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Inscription not found"})
 		return
 	}
 
-	// Convertir a response
-	response := domain.InscripcionResponse{
-		Id:          inscription.Id,
-		UsuarioId:   inscription.UsuarioId,
-		ActividadId: inscription.ActividadId,
-		Usuario: domain.UserResponse{
-			ID:       inscription.Usuario.ID,
-			Username: inscription.Usuario.Username,
-			IsAdmin:  inscription.Usuario.IsAdmin,
-		},
-		Actividad: domain.ActivityResponse{
-			ID:          inscription.Actividad.ID,
-			Name:        inscription.Actividad.Name,
-			Profesor:    inscription.Actividad.Profesor,
-			Categoria:   inscription.Actividad.Categoria,
-			Cupos:       inscription.Actividad.Cupos,
-			Description: inscription.Actividad.Description,
-			Dia:         inscription.Actividad.Dia,
-			HoraInicio:  inscription.Actividad.HoraInicio,
-			HoraFin:     inscription.Actividad.HoraFin,
-		},
+	if !authorize(c, policy.ReadInscription, inscription.UsuarioId) {
+		return
 	}
 
+	// Convertir a response
+	response := toInscripcionResponse(*inscription)
+
 	c.JSON(http.StatusOK, response)
 }
-func GetInscriptionByUserAndActivity(c *gin.Context) {
+func (ic *InscriptionController) GetInscriptionByUserAndActivity(c *gin.Context) {
 	usuarioId, err := strconv.Atoi(c.Param("usuario_id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
@@ -62,40 +56,24 @@ func GetInscriptionByUserAndActivity(c *gin.Context) {
 		return
 	}
 
-	inscription, err := services.GetInscriptionByUserAndActivity(usuarioId, actividadId)
+	if !authorize(c, policy.ReadInscription, usuarioId) {
+		return
+	}
+
+	inscription, err := ic.inscriptions.GetInscriptionByUserAndActivity(usuarioId, actividadId)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Inscription not found"})
 		return
 	}
 
 	// Convertir a response
-	response := domain.InscripcionResponse{
-		Id:          inscription.Id,
-		UsuarioId:   inscription.UsuarioId,
-		ActividadId: inscription.ActividadId,
-		Usuario: domain.UserResponse{
-			ID:       inscription.Usuario.ID,
-			Username: inscription.Usuario.Username,
-			IsAdmin:  inscription.Usuario.IsAdmin,
-		},
-		Actividad: domain.ActivityResponse{
-			ID:          inscription.Actividad.ID,
-			Name:        inscription.Actividad.Name,
-			Profesor:    inscription.Actividad.Profesor,
-			Categoria:   inscription.Actividad.Categoria,
-			Cupos:       inscription.Actividad.Cupos,
-			Description: inscription.Actividad.Description,
-			Dia:         inscription.Actividad.Dia,
-			HoraInicio:  inscription.Actividad.HoraInicio,
-			HoraFin:     inscription.Actividad.HoraFin,
-		},
-	}
+	response := toInscripcionResponse(*inscription)
 
 	c.JSON(http.StatusOK, response)
 }
 
 // CreateInscription maneja la creación de una nueva inscripción
-func CreateInscription(c *gin.Context) {
+func (ic *InscriptionController) CreateInscription(c *gin.Context) {
 	var request domain.InscripcionRequest
 
 	// Validar y bindear el JSON del request
@@ -107,8 +85,13 @@ func CreateInscription(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("usuarioid: %v ", request.UsuarioId)
-	fmt.Printf("actividadoid: %v ", request.ActividadId)
+	// Sin usuario_id se inscribe el usuario autenticado; solo un admin puede inscribir a otro
+	if request.UsuarioId == 0 {
+		request.UsuarioId = c.GetInt("user_id")
+	}
+	if !authorize(c, policy.CreateInscription, request.UsuarioId) {
+		return
+	}
 
 	/*
 		// Validar que los IDs sean válidos
@@ -126,10 +109,11 @@ func CreateInscription(c *gin.Context) {
 	inscripcion := domain.Inscripcion{
 		UsuarioId:   request.UsuarioId,
 		ActividadId: request.ActividadId,
+		SesionId:    request.SesionId,
 	}
 
 	// Llamar al service para crear la inscripción
-	newInscription, err := services.CreateInscription(inscripcion)
+	newInscription, err := ic.inscriptions.CreateInscription(inscripcion, actorOf(c))
 	if err != nil {
 		// Manejar diferentes tipos de errores
 		if err.Error() == "user already inscribed in this activity" {
@@ -137,6 +121,11 @@ func CreateInscription(c *gin.Context) {
 			return
 		}
 		if err.Error() == "activity has no available slots" {
+			// La lista de espera es de la inscripción semanal, no de las sesiones
+			if request.ListaEspera && request.SesionId == nil {
+				ic.joinWaitlist(c, request)
+				return
+			}
 			c.JSON(http.StatusConflict, gin.H{"error": "Activity has no available slots"})
 			return
 		}
@@ -144,10 +133,26 @@ func CreateInscription(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
+		if err.Error() == "email not verified" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email must be verified before enrolling"})
+			return
+		}
 		if err.Error() == "activity not found" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
 			return
 		}
+		if err.Error() == "session not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		if err.Error() == "session is not available for booking" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Session is cancelled or already started"})
+			return
+		}
+		if err.Error() == "session required" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Activity is booked by session: sesion_id is required"})
+			return
+		}
 
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to create inscription",
@@ -157,86 +162,152 @@ func CreateInscription(c *gin.Context) {
 	}
 
 	// Convertir a response
-	response := domain.InscripcionResponse{
-		Id:          newInscription.Id,
-		UsuarioId:   newInscription.UsuarioId,
-		ActividadId: newInscription.ActividadId,
-		Usuario: domain.UserResponse{
-			ID:       newInscription.Usuario.ID,
-			Username: newInscription.Usuario.Username,
-			IsAdmin:  newInscription.Usuario.IsAdmin,
-		},
-		Actividad: domain.ActivityResponse{
-			ID:          newInscription.Actividad.ID,
-			Name:        newInscription.Actividad.Name,
-			Profesor:    newInscription.Actividad.Profesor,
-			Categoria:   newInscription.Actividad.Categoria,
-			Cupos:       newInscription.Actividad.Cupos,
-			Description: newInscription.Actividad.Description,
-			Dia:         newInscription.Actividad.Dia,
-			HoraInicio:  newInscription.Actividad.HoraInicio,
-			HoraFin:     newInscription.Actividad.HoraFin,
-		},
-	}
+	response := toInscripcionResponse(*newInscription)
 
 	c.JSON(http.StatusCreated, response)
 }
-func GetInscriptionsByUserID(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+
+// joinWaitlist anota al usuario en la lista de espera cuando la actividad no tiene cupos
+func (ic *InscriptionController) joinWaitlist(c *gin.Context, request domain.InscripcionRequest) {
+	entry, err := ic.inscriptions.JoinWaitlist(request.UsuarioId, request.ActividadId, actorOf(c))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		switch err.Error() {
+		case "user already in waitlist":
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already in the waitlist for this activity"})
+		case "user already inscribed in this activity":
+			c.JSON(http.StatusConflict, gin.H{"error": "User is already inscribed in this activity"})
+		case "activity has available slots":
+			c.JSON(http.StatusConflict, gin.H{"error": "A slot was released, retry the inscription"})
+		case "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case "email not verified":
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email must be verified before enrolling"})
+		case "activity not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to join waitlist",
+				"details": err.Error(),
+			})
+		}
 		return
 	}
 
-	// Este método requerirá que implementes GetInscriptionsByUserID en el service
-	// Por ahora solo devuelvo un mensaje indicando que no está implementado
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "GetInscriptionsByUserID service method not implemented yet",
-		"user_id": id,
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":      "Activity has no available slots, user added to the waitlist",
+		"lista_espera": entry,
 	})
 }
 
-// Reemplaza la función GetActivitiesByUser en tu controller
-func GetActivitiesByUser(c *gin.Context) {
+// GetWaitlistByUser devuelve las listas de espera del usuario autenticado con su posición
+func (ic *InscriptionController) GetWaitlistByUser(c *gin.Context) {
 	userId, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
 		return
 	}
 
-	// Verificación de autenticación
-	authenticatedUserID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	if !authorize(c, policy.ReadWaitlist, userId) {
+		return
+	}
+
+	entries, err := ic.inscriptions.GetWaitlistByUserID(userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get user waitlist",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// LeaveWaitlist saca al usuario autenticado de una lista de espera
+func (ic *InscriptionController) LeaveWaitlist(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	entry, err := ic.inscriptions.GetWaitlistEntryByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return
+	}
+
+	if !authorize(c, policy.LeaveWaitlist, entry.UsuarioId) {
+		return
+	}
+
+	if err := ic.inscriptions.LeaveWaitlist(id, actorOf(c)); err != nil {
+		if err.Error() == "waitlist entry not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to leave waitlist",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User removed from waitlist",
+		"id":      id,
+	})
+}
+
+// GetInscriptionsByUserID devuelve el historial de inscripciones de un usuario,
+// filtrable con ?estado=activa|cancelada|completada
+func (ic *InscriptionController) GetInscriptionsByUserID(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	if !authorize(c, policy.ReadInscription, id) {
 		return
 	}
 
-	// Convertir authenticatedUserID a int para comparar
-	var authID int
-	switch v := authenticatedUserID.(type) {
-	case int:
-		authID = v
-	case float64:
-		authID = int(v)
-	case string:
-		authID, err = strconv.Atoi(v)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticated user ID format"})
+	inscriptions, err := ic.inscriptions.GetInscriptionsByUserID(id, c.Query("estado"))
+	if err != nil {
+		if err.Error() == "invalid estado" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado, expected activa, cancelada or completada"})
 			return
 		}
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authenticated user ID type"})
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get user inscriptions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	responses := []domain.InscripcionResponse{}
+	for _, inscription := range inscriptions {
+		responses = append(responses, toInscripcionResponse(inscription))
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+// Reemplaza la función GetActivitiesByUser en tu controller
+func (ic *InscriptionController) GetActivitiesByUser(c *gin.Context) {
+	userId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID format"})
 		return
 	}
 
 	// Verificar que el usuario solo puede ver sus propias actividades
-	if authID != userId {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot access other user's activities"})
+	if !authorize(c, policy.ReadInscription, userId) {
 		return
 	}
 
 	// Obtener las inscripciones del usuario
-	inscriptions, err := services.GetMyActivities(userId)
+	inscriptions, err := ic.inscriptions.GetMyActivities(userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to get user activities",
@@ -248,54 +319,162 @@ func GetActivitiesByUser(c *gin.Context) {
 	// Convertir a response format
 	var responses []domain.InscripcionResponse
 	for _, inscription := range inscriptions {
-		response := domain.InscripcionResponse{
-			Id:          inscription.Id,
-			UsuarioId:   inscription.UsuarioId,
-			ActividadId: inscription.ActividadId,
-			Usuario: domain.UserResponse{
-				ID:       inscription.Usuario.ID,
-				Username: inscription.Usuario.Username,
-				IsAdmin:  inscription.Usuario.IsAdmin,
-			},
-			Actividad: domain.ActivityResponse{
-				ID:          inscription.Actividad.ID,
-				Name:        inscription.Actividad.Name,
-				Profesor:    inscription.Actividad.Profesor,
-				Categoria:   inscription.Actividad.Categoria,
-				Cupos:       inscription.Actividad.Cupos,
-				Description: inscription.Actividad.Description,
-				Dia:         inscription.Actividad.Dia,
-				HoraInicio:  inscription.Actividad.HoraInicio,
-				HoraFin:     inscription.Actividad.HoraFin,
-			},
-		}
+		response := toInscripcionResponse(inscription)
 		responses = append(responses, response)
 	}
 
 	c.JSON(http.StatusOK, responses)
 }
 
-// GetInscriptions maneja la obtención de todas las inscripciones (opcional)
-func GetInscriptions(c *gin.Context) {
-	// Este método requerirá que implementes GetAllInscriptions en el service
-	// Por ahora solo devuelvo un mensaje indicando que no está implementado
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "GetAllInscriptions service method not implemented yet",
-	})
+// GetActivityRoster devuelve los inscriptos activos de una actividad. Pueden
+// verlo recepción y admins, y los instructores solo el de sus propias clases.
+func (ic *InscriptionController) GetActivityRoster(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		return
+	}
+
+	activity, err := ic.activities.GetActivityByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return
+	}
+
+	instructorID := 0
+	if activity.InstructorId != nil {
+		instructorID = *activity.InstructorId
+	}
+	if !authorize(c, policy.ReadRoster, instructorID) {
+		return
+	}
+
+	inscriptions, err := ic.inscriptions.GetActivityRoster(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get activity roster",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	responses := []domain.InscripcionResponse{}
+	for _, inscription := range inscriptions {
+		responses = append(responses, toInscripcionResponse(inscription))
+	}
+
+	c.JSON(http.StatusOK, responses)
 }
 
-// DeleteInscription maneja la eliminación de una inscripción (opcional)
-func DeleteInscription(c *gin.Context) {
+// GetInscriptions devuelve las inscripciones de todos los usuarios, filtrable
+// con ?estado=activa|cancelada|completada - REQUIERE EL PERMISO inscriptions:read
+func (ic *InscriptionController) GetInscriptions(c *gin.Context) {
+	inscriptions, err := ic.inscriptions.GetAllInscriptions(c.Query("estado"))
+	if err != nil {
+		if err.Error() == "invalid estado" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid estado, expected activa, cancelada or completada"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to get inscriptions",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	responses := []domain.InscripcionResponse{}
+	for _, inscription := range inscriptions {
+		responses = append(responses, toInscripcionResponse(inscription))
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+// DeleteInscription cancela una inscripción y libera su cupo. El motivo es
+// opcional y se envía como {"reason": "..."}
+func (ic *InscriptionController) DeleteInscription(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 		return
 	}
 
-	// Este método requerirá que implementes DeleteInscription en el service
-	// Por ahora solo devuelvo un mensaje indicando que no está implementado
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"message": "DeleteInscription service method not implemented yet",
+	inscription, err := ic.inscriptions.GetInscriptionByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inscription not found"})
+		return
+	}
+
+	if !authorize(c, policy.CancelInscription, inscription.UsuarioId) {
+		return
+	}
+
+	var request domain.CancelacionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request data",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	if err := ic.inscriptions.DeleteInscription(id, request.Reason, actorOf(c)); err != nil {
+		if err.Error() == "inscription not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Inscription not found"})
+			return
+		}
+		if err.Error() == "inscription is not active" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Inscription is already cancelled or completed"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete inscription",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Inscription cancelled successfully",
 		"id":      id,
 	})
 }
+
+// toInscripcionResponse convierte una inscripción al formato de respuesta
+func toInscripcionResponse(inscription domain.Inscripcion) domain.InscripcionResponse {
+	return domain.InscripcionResponse{
+		Id:          inscription.Id,
+		UsuarioId:   inscription.UsuarioId,
+		ActividadId: inscription.ActividadId,
+		Usuario: domain.UserResponse{
+			ID:       inscription.Usuario.ID,
+			Username: inscription.Usuario.Username,
+			IsAdmin:  inscription.Usuario.IsAdmin,
+		},
+		Actividad: domain.ActivityResponse{
+			ID:               inscription.Actividad.ID,
+			Name:             inscription.Actividad.Name,
+			Profesor:         inscription.Actividad.Profesor,
+			Categoria:        inscription.Actividad.Categoria,
+			Capacidad:        inscription.Actividad.Capacidad,
+			CuposDisponibles: inscription.Actividad.CuposDisponibles,
+			Description:      inscription.Actividad.Description,
+			Horarios:         inscription.Actividad.Horarios,
+			Dia:              inscription.Actividad.Dia,
+			HoraInicio:       inscription.Actividad.HoraInicio,
+			HoraFin:          inscription.Actividad.HoraFin,
+			InstructorId:     inscription.Actividad.InstructorId,
+		},
+		SesionId:         inscription.SesionId,
+		Sesion:           inscription.Sesion,
+		Estado:           inscription.Estado,
+		FechaInscripcion: inscription.FechaInscripcion,
+		CancelledAt:      inscription.CancelledAt,
+		CancelledBy:      inscription.CancelledBy,
+		CancelReason:     inscription.CancelReason,
+		Historial:        inscription.Historial,
+	}
+}
@@ -0,0 +1,454 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/policy"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTestDB abre una base SQLite en memoria y la asigna a clients.DB
+func setupTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	// SQLite no admite escrituras concurrentes: una sola conexión serializa las transacciones
+	return openTestDB(t, fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()), 1)
+}
+
+// setupConcurrentTestDB abre una base SQLite en un archivo con varias
+// conexiones, para que las transacciones simultáneas dependan de los bloqueos
+// de clients y no de un pool de una sola conexión. En modo WAL las lecturas no
+// esperan a las escrituras y busy_timeout hace esperar a las escrituras
+// simultáneas en lugar de fallar.
+func setupConcurrentTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_journal_mode=WAL&_busy_timeout=10000"
+	return openTestDB(t, dsn, 8)
+}
+
+func openTestDB(t *testing.T, dsn string, conns int) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("failed to get sql.DB: %v", err)
+	}
+	sqlDB.SetMaxOpenConns(conns)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(&dao.Role{}, &dao.RolePermission{}, &dao.User{}, &dao.Activity{}, &dao.ActivitySlot{}, &dao.Schedule{}, &dao.ScheduleException{}, &dao.ClassSession{}, &dao.Inscription{}, &dao.InscriptionHistory{}, &dao.WaitlistEntry{}, &dao.RefreshToken{}, &dao.RevokedToken{}, &dao.PasswordReset{}, &dao.LoginThrottle{}, &dao.LoginAttempt{}, &dao.TwoFactor{}, &dao.RecoveryCode{}, &dao.TwoFactorChallenge{}, &dao.ExternalIdentity{}, &dao.OIDCLoginState{}, &dao.Invitacion{}, &dao.AuditEvent{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	clients.DB = db
+	services.SetAttemptStore(services.NewMemoryAttemptStore())
+	if err := clients.SeedRoles(policy.DefaultRoles); err != nil {
+		t.Fatalf("failed to seed roles: %v", err)
+	}
+	return db
+}
+
+// testControllers son los controllers de dominio sobre la base de clients.DB
+type testControllers struct {
+	activities   *ActivityController
+	inscriptions *InscriptionController
+	users        *UserController
+}
+
+func newTestControllers() testControllers {
+	store := services.NewDBStore()
+	activities := services.NewActivityService(store, store)
+	inscriptions := services.NewInscriptionService(store, store, store)
+	return testControllers{
+		activities:   NewActivityController(activities),
+		inscriptions: NewInscriptionController(inscriptions, activities),
+		users:        NewUserController(services.NewUserService(store)),
+	}
+}
+
+// verified le da al usuario un email ya verificado, requisito para inscribirse
+func verified(user dao.User) dao.User {
+	email := strings.ToLower(user.Username) + "@example.com"
+	now := time.Now()
+	user.Email = &email
+	user.EmailVerificadoEn = &now
+	return user
+}
+
+func TestCreateInscriptionConcurrentRequestsDoNotOversell(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupConcurrentTestDB(t)
+
+	const (
+		cupos    = 10
+		requests = 200
+	)
+
+	activity := dao.Activity{
+		Nombre:      "Spinning",
+		Profesor:    "Ana",
+		Capacidad:   cupos,
+		Categoria:   "Aeróbico",
+		Descripcion: "Clase de spinning",
+		Horarios:    []dao.ActivitySlot{{Dia: 1, Hora_inicio: "08:00", Hora_fin: "09:00"}},
+	}
+	if err := db.Create(&activity).Error; err != nil {
+		t.Fatalf("failed to seed activity: %v", err)
+	}
+
+	userIDs := make([]int, requests)
+	for i := range userIDs {
+		user := verified(dao.User{Name: "Socio", Username: fmt.Sprintf("socio%d", i), PasswordHash: "x"})
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatalf("failed to seed user: %v", err)
+		}
+		userIDs[i] = user.ID
+	}
+
+	ctl := newTestControllers()
+	router := gin.New()
+	// Un admin puede inscribir a cualquier usuario
+	router.Use(authenticatedAs(0, dao.RolAdmin))
+	router.POST("/inscription", ctl.inscriptions.CreateInscription)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		statuses = map[int]int{}
+	)
+	for _, userID := range userIDs {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+			body, _ := json.Marshal(map[string]int{"usuario_id": userID, "actividad_id": activity.ID_actividad})
+			req := httptest.NewRequest(http.MethodPost, "/inscription", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			mu.Lock()
+			statuses[w.Code]++
+			mu.Unlock()
+		}(userID)
+	}
+	wg.Wait()
+
+	if statuses[http.StatusCreated] != cupos {
+		t.Errorf("expected %d successful inscriptions, got %d (statuses: %v)", cupos, statuses[http.StatusCreated], statuses)
+	}
+	if statuses[http.StatusConflict] != requests-cupos {
+		t.Errorf("expected %d conflicts, got %d (statuses: %v)", requests-cupos, statuses[http.StatusConflict], statuses)
+	}
+
+	stored, err := clients.GetActivityByID(activity.ID_actividad)
+	if err != nil {
+		t.Fatalf("failed to reload activity: %v", err)
+	}
+	if stored.Capacidad != cupos {
+		t.Errorf("expected capacidad to stay at %d, got %d", cupos, stored.Capacidad)
+	}
+	if stored.CuposDisponibles != 0 {
+		t.Errorf("expected 0 remaining cupos, got %d", stored.CuposDisponibles)
+	}
+
+	var count int64
+	db.Model(&dao.Inscription{}).Where("ID_actividad = ?", activity.ID_actividad).Count(&count)
+	if count != cupos {
+		t.Errorf("expected %d stored inscriptions, got %d", cupos, count)
+	}
+}
+
+func TestDeleteInscriptionReleasesSlot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	activity := dao.Activity{Nombre: "Yoga", Profesor: "Luz", Capacidad: 1, Categoria: "Relax", Descripcion: "Yoga", Horarios: []dao.ActivitySlot{{Dia: 2, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	user := verified(dao.User{Name: "Socio", Username: "socio", PasswordHash: "x"})
+	db.Create(&activity)
+	db.Create(&user)
+
+	ctl := newTestControllers()
+	router := gin.New()
+	router.Use(authenticatedAs(user.ID, dao.RolSocio))
+	router.POST("/inscription", ctl.inscriptions.CreateInscription)
+	router.DELETE("/inscriptions/:id", ctl.inscriptions.DeleteInscription)
+
+	body, _ := json.Marshal(map[string]int{"usuario_id": user.ID, "actividad_id": activity.ID_actividad})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/inscription", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/inscriptions/%d", created.Id), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	stored, _ := clients.GetActivityByID(activity.ID_actividad)
+	if stored.CuposDisponibles != 1 {
+		t.Errorf("expected cupo to be released, got %d", stored.CuposDisponibles)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/inscriptions/%d", created.Id), nil))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 on second delete, got %d", w.Code)
+	}
+}
+
+func TestCancelledInscriptionIsKeptInHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	activity := dao.Activity{Nombre: "Pilates", Profesor: "Sol", Capacidad: 5, Categoria: "Relax", Descripcion: "Pilates", Horarios: []dao.ActivitySlot{{Dia: 4, Hora_inicio: "09:00", Hora_fin: "10:00"}}}
+	user := verified(dao.User{Name: "Socio", Username: "historial", PasswordHash: "x"})
+	db.Create(&activity)
+	db.Create(&user)
+
+	ctl := newTestControllers()
+	router := gin.New()
+	router.Use(authenticatedAs(user.ID, dao.RolSocio))
+	router.POST("/inscription", ctl.inscriptions.CreateInscription)
+	router.DELETE("/inscriptions/:id", ctl.inscriptions.DeleteInscription)
+	router.GET("/users/:id/inscriptions", ctl.inscriptions.GetInscriptionsByUserID)
+
+	body, _ := json.Marshal(map[string]int{"usuario_id": user.ID, "actividad_id": activity.ID_actividad})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/inscription", bytes.NewReader(body)))
+	var created struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/inscriptions/%d", created.Id), bytes.NewReader([]byte(`{"reason":"lesión"}`))))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Después de cancelar puede volver a inscribirse
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/inscription", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected re-inscription to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d/inscriptions?estado=cancelada", user.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var cancelled []struct {
+		Id           int    `json:"id"`
+		Estado       string `json:"estado"`
+		CancelledBy  *int   `json:"cancelled_by"`
+		CancelReason string `json:"cancel_reason"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	if len(cancelled) != 1 {
+		t.Fatalf("expected 1 cancelled inscription, got %d", len(cancelled))
+	}
+	if cancelled[0].Id != created.Id || cancelled[0].CancelReason != "lesión" || cancelled[0].CancelledBy == nil || *cancelled[0].CancelledBy != user.ID {
+		t.Errorf("unexpected cancelled inscription: %+v", cancelled[0])
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/users/%d/inscriptions", user.ID+1), nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another user's history, got %d", w.Code)
+	}
+}
+
+func TestGetInscriptionsListsEveryUserForStaff(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	activity := dao.Activity{Nombre: "Yoga", Profesor: "Sol", Capacidad: 5, Categoria: "Relax", Descripcion: "Yoga", Horarios: []dao.ActivitySlot{{Dia: 2, Hora_inicio: "09:00", Hora_fin: "10:00"}}}
+	db.Create(&activity)
+	users := make([]dao.User, 2)
+	for i := range users {
+		users[i] = verified(dao.User{Name: "Socio", Username: fmt.Sprintf("listado%d", i), PasswordHash: "x"})
+		db.Create(&users[i])
+	}
+	db.Create(&dao.Inscription{ID_usuario: users[0].ID, ID_actividad: activity.ID_actividad, Estado: dao.EstadoActiva})
+	db.Create(&dao.Inscription{ID_usuario: users[1].ID, ID_actividad: activity.ID_actividad, Estado: dao.EstadoCancelada})
+
+	ctl := newTestControllers()
+	get := func(role, url string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.GET("/inscriptions", authenticatedAs(users[0].ID, role), utils.RequirePermission(policy.PermInscriptionsRead), ctl.inscriptions.GetInscriptions)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	w := get(dao.RolRecepcion, "/inscriptions")
+	var all []struct {
+		UsuarioId int    `json:"usuario_id"`
+		Estado    string `json:"estado"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &all)
+	if w.Code != http.StatusOK || len(all) != 2 {
+		t.Fatalf("expected both users' inscriptions, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = get(dao.RolRecepcion, "/inscriptions?estado=cancelada")
+	var cancelled []struct {
+		UsuarioId int    `json:"usuario_id"`
+		Estado    string `json:"estado"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &cancelled)
+	if w.Code != http.StatusOK || len(cancelled) != 1 || cancelled[0].UsuarioId != users[1].ID || cancelled[0].Estado != dao.EstadoCancelada {
+		t.Errorf("expected only the cancelled inscription, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := get(dao.RolRecepcion, "/inscriptions?estado=pendiente"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown estado, got %d", w.Code)
+	}
+	if w := get(dao.RolSocio, "/inscriptions"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a socio, got %d", w.Code)
+	}
+}
+
+func TestWaitlistPromotesFirstUserWhenSlotIsReleased(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	activity := dao.Activity{Nombre: "Crossfit", Profesor: "Leo", Capacidad: 1, Categoria: "Fuerza", Descripcion: "Crossfit", Horarios: []dao.ActivitySlot{{Dia: 3, Hora_inicio: "18:00", Hora_fin: "19:00"}}}
+	db.Create(&activity)
+	users := make([]dao.User, 3)
+	for i := range users {
+		users[i] = verified(dao.User{Name: "Socio", Username: fmt.Sprintf("espera%d", i), PasswordHash: "x"})
+		db.Create(&users[i])
+	}
+
+	ctl := newTestControllers()
+	router := gin.New()
+	router.Use(authenticatedAs(0, dao.RolAdmin))
+	router.POST("/inscription", ctl.inscriptions.CreateInscription)
+	router.GET("/inscription/:id", ctl.inscriptions.GetInscriptionByID)
+	router.DELETE("/inscriptions/:id", ctl.inscriptions.DeleteInscription)
+
+	enroll := func(userID int, waitlist bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"usuario_id": userID, "actividad_id": activity.ID_actividad, "lista_espera": waitlist})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/inscription", bytes.NewReader(body)))
+		return w
+	}
+
+	w := enroll(users[0].ID, false)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var first struct {
+		Id int `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &first)
+
+	if w := enroll(users[1].ID, false); w.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without lista_espera, got %d", w.Code)
+	}
+
+	for i, user := range users[1:] {
+		w := enroll(user.ID, true)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			ListaEspera struct {
+				Posicion int `json:"posicion"`
+			} `json:"lista_espera"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if resp.ListaEspera.Posicion != i+1 {
+			t.Errorf("expected position %d, got %d", i+1, resp.ListaEspera.Posicion)
+		}
+	}
+
+	if w := enroll(users[1].ID, true); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 when joining the waitlist twice, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/inscriptions/%d", first.Id), nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	promoted, err := clients.GetInscriptionByUserAndActivity(users[1].ID, activity.ID_actividad)
+	if err != nil {
+		t.Fatalf("expected first waitlisted user to be promoted: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/inscription/%d", promoted.ID_inscripcion), nil))
+	var detail struct {
+		Historial []struct {
+			Estado  string `json:"estado"`
+			Detalle string `json:"detalle"`
+		} `json:"historial"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &detail)
+	if len(detail.Historial) != 1 || detail.Historial[0].Detalle != "promovida desde lista de espera" {
+		t.Errorf("expected promotion to be recorded in history, got %+v", detail.Historial)
+	}
+
+	remaining, _ := clients.GetWaitlistByUserID(users[2].ID)
+	if len(remaining) != 1 || remaining[0].Posicion != 1 {
+		t.Errorf("expected last user to move up to position 1, got %+v", remaining)
+	}
+}
+
+func TestInscriptionKeyRejectsDuplicatesInDatabase(t *testing.T) {
+	db := setupTestDB(t)
+
+	activity := dao.Activity{Nombre: "Yoga"}
+	user := dao.User{Name: "Socio", Username: "socio", PasswordHash: "x"}
+	db.Create(&activity)
+	db.Create(&user)
+
+	// Sin pasar por EnrollUser: el índice único es la última garantía
+	first := dao.Inscription{ID_usuario: user.ID, ID_actividad: activity.ID_actividad}
+	if err := db.Create(&first).Error; err != nil {
+		t.Fatalf("failed to create inscription: %v", err)
+	}
+	err := db.Create(&dao.Inscription{ID_usuario: user.ID, ID_actividad: activity.ID_actividad}).Error
+	if err == nil {
+		t.Fatal("expected the database to reject a second active inscription")
+	}
+
+	// Cancelada deja de ocupar la clave y se puede volver a inscribir
+	if err := clients.CancelInscription(first.ID_inscripcion, user.ID, "", dao.AuditEvent{}); err != nil {
+		t.Fatalf("failed to cancel inscription: %v", err)
+	}
+	if err := db.Create(&dao.Inscription{ID_usuario: user.ID, ID_actividad: activity.ID_actividad}).Error; err != nil {
+		t.Fatalf("expected a new inscription after cancelling, got %v", err)
+	}
+}
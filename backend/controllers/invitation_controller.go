@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/policy"
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// CreateInvitation invita a crear una cuenta de staff o admin (SOLO ADMIN):
+// {"email": "profe@gimnasio.com", "roles": ["instructor"]}
+func CreateInvitation(c *gin.Context) {
+	if !authorize(c, policy.InviteUser, 0) {
+		return
+	}
+
+	var request domain.InvitationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	invitation, err := services.CreateInvitation(request, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "invalid email", "unknown role", "at least one role is required":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		case "email already exists":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).Error("Failed to create invitation")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invitation", "success": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Invitation sent",
+		"invitation": invitation,
+		"success":    true,
+	})
+}
+
+// AcceptInvitation crea la cuenta invitada. Los roles y el email salen del token.
+func AcceptInvitation(c *gin.Context) {
+	var request domain.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	user, err := services.AcceptInvitation(request, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "invalid or expired invitation", "name cannot be empty", "username cannot be empty",
+			"password cannot be empty", "unknown role":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		case "username already exists", "email already exists":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).Error("Failed to accept invitation")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation", "success": false})
+		}
+		return
+	}
+
+	log.WithField("user_id", user.ID).Info("User registered from invitation")
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User created successfully",
+		"user":    user,
+		"success": true,
+	})
+}
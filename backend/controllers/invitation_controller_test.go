@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/services"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newInvitationRouter(t *testing.T) (*gin.Engine, dao.User) {
+	t.Helper()
+	router, _ := newProfileRouter(t)
+
+	roles, _ := clients.GetRolesByNames([]string{dao.RolAdmin})
+	admin := dao.User{Name: "Admin", Username: "admin", PasswordHash: "x", Roles: roles}
+	clients.DB.Create(&admin)
+
+	router.POST("/admin/invitations", authenticatedAs(admin.ID, dao.RolAdmin), CreateInvitation)
+	router.POST("/frontdesk/invitations", authenticatedAs(admin.ID, dao.RolRecepcion), CreateInvitation)
+	router.POST("/invitations/accept", AcceptInvitation)
+	return router, admin
+}
+
+func TestRegisterIgnoresPrivilegeFields(t *testing.T) {
+	router, _ := newInvitationRouter(t)
+
+	body := map[string]interface{}{
+		"name": "Ana", "username": "ana", "password": "secreto", "email": "ana@example.com",
+		"is_admin": true, "roles": []string{dao.RolAdmin}, "email_verified": true,
+	}
+	var response profileResponse
+	if code := requestJSON(router, http.MethodPost, "/register", "", body, &response); code != http.StatusCreated {
+		t.Fatalf("expected 201 on register, got %d", code)
+	}
+	if response.User.IsAdmin || response.User.EmailVerified || len(response.User.Roles) != 1 || response.User.Roles[0] != dao.RolSocio {
+		t.Errorf("expected a plain unverified member, got %+v", response.User)
+	}
+}
+
+func TestInvitationCreatesStaffAccountOnce(t *testing.T) {
+	router, _ := newInvitationRouter(t)
+	request := map[string]interface{}{"email": "Profe@Example.com", "roles": []string{dao.RolInstructor}}
+
+	if code := requestJSON(router, http.MethodPost, "/frontdesk/invitations", "", request, nil); code != http.StatusForbidden {
+		t.Errorf("expected 403 for front desk, got %d", code)
+	}
+	bad := map[string]interface{}{"email": "profe@example.com", "roles": []string{"superuser"}}
+	if code := requestJSON(router, http.MethodPost, "/admin/invitations", "", bad, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown role, got %d", code)
+	}
+
+	var created struct {
+		Invitation domain.Invitation `json:"invitation"`
+	}
+	if code := requestJSON(router, http.MethodPost, "/admin/invitations", "", request, &created); code != http.StatusCreated {
+		t.Fatalf("expected 201 on invitation, got %d", code)
+	}
+	token := created.Invitation.Token
+	if created.Invitation.Email != "profe@example.com" || token == "" {
+		t.Fatalf("unexpected invitation %+v", created.Invitation)
+	}
+
+	// El token de invitación no sirve como access token
+	if code := authGet(router, "/me", token); code != http.StatusUnauthorized {
+		t.Errorf("expected the invitation token to be rejected as access token, got %d", code)
+	}
+
+	// Los roles van firmados: alterar el token lo invalida
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + parts[1] + "x." + parts[2]
+	accept := map[string]string{"token": tampered, "name": "Profe", "username": "profe", "password": "secreto"}
+	if code := requestJSON(router, http.MethodPost, "/invitations/accept", "", accept, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a tampered token, got %d", code)
+	}
+
+	accept["token"] = token
+	var accepted profileResponse
+	if code := requestJSON(router, http.MethodPost, "/invitations/accept", "", accept, &accepted); code != http.StatusCreated {
+		t.Fatalf("expected 201 on accept, got %d", code)
+	}
+	if accepted.User.Email != "profe@example.com" || !accepted.User.EmailVerified || len(accepted.User.Roles) != 1 || accepted.User.Roles[0] != dao.RolInstructor {
+		t.Errorf("unexpected invited user %+v", accepted.User)
+	}
+	loginForTokens(t, router, "profe", "secreto")
+
+	accept["username"] = "profe2"
+	if code := requestJSON(router, http.MethodPost, "/invitations/accept", "", accept, nil); code != http.StatusBadRequest {
+		t.Errorf("expected the invitation to be single use, got %d", code)
+	}
+}
+
+func TestBootstrapAdminOnlyOnce(t *testing.T) {
+	setupTestDB(t)
+
+	admin, err := services.BootstrapAdmin("Dueña", "duena", "Duena@Example.com", "secreto")
+	if err != nil {
+		t.Fatalf("bootstrap failed: %v", err)
+	}
+	if !admin.IsAdmin || !admin.EmailVerified || admin.Email != "duena@example.com" {
+		t.Errorf("unexpected admin %+v", admin)
+	}
+
+	if _, err := services.BootstrapAdmin("Otra", "otra", "otra@example.com", "secreto"); err == nil || err.Error() != "admin already exists" {
+		t.Errorf("expected a second bootstrap to fail, got %v", err)
+	}
+}
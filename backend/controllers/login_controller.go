@@ -3,7 +3,11 @@ package controllers
 import (
 	"backend/domain"
 	"backend/services"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -16,9 +20,11 @@ type LoginRequest struct {
 
 // LoginResponse estructura para la respuesta de login
 type LoginResponse struct {
-	Message string      `json:"message"`
-	User    domain.User `json:"user,omitempty"`
-	Success bool        `json:"success"`
+	Message string       `json:"message"`
+	User    *domain.User `json:"user,omitempty"`
+	// TwoFactor es el paso siguiente cuando el usuario tiene segundo factor
+	TwoFactor *domain.TwoFactorChallenge `json:"two_factor,omitempty"`
+	Success   bool                       `json:"success"`
 }
 
 // Login maneja el login de usuarios
@@ -35,7 +41,10 @@ func Login(c *gin.Context) {
 	}
 
 	// Validar credenciales
-	user, err := services.ValidateUserCredentials(loginReq.Username, loginReq.Password)
+	user, challenge, err := services.ValidateUserCredentials(loginReq.Username, loginReq.Password, c.ClientIP())
+	if respondLoginThrottled(c, loginReq.Username, err) {
+		return
+	}
 	if err != nil {
 		log.WithError(err).WithField("username", loginReq.Username).Warn("Login failed")
 		c.JSON(http.StatusUnauthorized, LoginResponse{
@@ -45,17 +54,53 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	respondLogin(c, user, challenge)
+}
+
+// respondLogin responde un login exitoso con los tokens o, si el usuario tiene
+// segundo factor, con el challenge para completarlo
+func respondLogin(c *gin.Context, user domain.User, challenge *domain.TwoFactorChallenge) {
+	if challenge != nil {
+		message := "2fa_required"
+		if challenge.SetupRequired {
+			message = "2fa_setup_required"
+		}
+		c.JSON(http.StatusOK, LoginResponse{
+			Message:   message,
+			TwoFactor: challenge,
+			Success:   true,
+		})
+		return
+	}
+
 	log.WithField("user_id", user.ID).Info("User logged in successfully")
 	c.JSON(http.StatusOK, LoginResponse{
 		Message: "Login successful",
-		User:    user,
+		User:    &user,
 		Success: true,
 	})
 }
 
-// Register maneja el registro de nuevos usuarios
+// respondLoginThrottled responde 429 si el login está demorado o bloqueado
+func respondLoginThrottled(c *gin.Context, username string, err error) bool {
+	var locked *services.LoginLockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+
+	log.WithField("username", username).WithField("ip", c.ClientIP()).Warn("Login throttled")
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+	c.JSON(http.StatusTooManyRequests, LoginResponse{
+		Message: "Too many login attempts, try again later",
+		Success: false,
+	})
+	return true
+}
+
+// Register maneja el registro de nuevos socios. Los campos de privilegios
+// (is_admin, roles) no forman parte de la request y se ignoran.
 func Register(c *gin.Context) {
-	var user domain.User
+	var user domain.RegisterRequest
 
 	if err := c.ShouldBindJSON(&user); err != nil {
 		log.WithError(err).Error("Invalid register request")
@@ -67,7 +112,7 @@ func Register(c *gin.Context) {
 	}
 
 	// Crear usuario
-	createdUser, err := services.CreateUser(user)
+	createdUser, err := services.CreateUser(user, actorOf(c))
 	if err != nil {
 		log.WithError(err).WithField("username", user.Username).Error("Failed to create user")
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -84,3 +129,135 @@ func Register(c *gin.Context) {
 		"success": true,
 	})
 }
+
+// GetJWKS publica las claves públicas de verificación de los JWT (RFC 7517)
+func GetJWKS(c *gin.Context) {
+	jwks, err := services.PublicKeys()
+	if err != nil {
+		log.WithError(err).Error("Failed to load JWKS")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to load public keys",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, jwks)
+}
+
+// RefreshToken canjea un refresh token por un nuevo access token y un nuevo refresh token
+func RefreshToken(c *gin.Context) {
+	var request domain.RefreshRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "refresh_token is required",
+			"success": false,
+		})
+		return
+	}
+
+	tokens, err := services.RefreshTokens(request.RefreshToken)
+	if err != nil {
+		switch err.Error() {
+		case "invalid refresh token", "refresh token reuse detected":
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   err.Error(),
+				"success": false,
+			})
+		default:
+			log.WithError(err).Error("Failed to refresh tokens")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to refresh tokens",
+				"success": false,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revoca el access token actual y su sesión. El cuerpo es opcional:
+// {"refresh_token": "..."} para revocar otra sesión o {"all": true} para todas.
+func Logout(c *gin.Context) {
+	var request domain.RefreshRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request format",
+				"success": false,
+			})
+			return
+		}
+	}
+
+	userID := c.GetInt("user_id")
+	expiresAt, _ := c.Get("token_expires_at")
+	expiry, _ := expiresAt.(time.Time)
+
+	err := services.Logout(userID, c.GetString("token_id"), c.GetString("token_family"), expiry, request.RefreshToken, request.All)
+	if err != nil {
+		log.WithError(err).WithField("user_id", userID).Error("Failed to logout")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to logout",
+			"success": false,
+		})
+		return
+	}
+
+	log.WithField("user_id", userID).Info("User logged out")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Logged out successfully",
+		"success": true,
+	})
+}
+
+// ForgotPassword envía por email un link para restablecer la contraseña. Responde
+// lo mismo exista o no la cuenta, para no revelar qué usuarios están registrados.
+func ForgotPassword(c *gin.Context) {
+	var request domain.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.Email == "" && request.Username == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	if err := services.RequestPasswordReset(request.Email, request.Username); err != nil {
+		log.WithError(err).Error("Failed to send password reset email")
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "If the account exists and has an email, a link to reset the password was sent",
+		"success": true,
+	})
+}
+
+// ResetPassword cambia la contraseña con el token recibido por email
+func ResetPassword(c *gin.Context) {
+	var request domain.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	if err := services.ResetPassword(request.Token, request.Password, actorOf(c)); err != nil {
+		switch err.Error() {
+		case "invalid or expired reset token", "password cannot be empty":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).Error("Failed to reset password")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password", "success": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Password reset successfully",
+		"success": true,
+	})
+}
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/mailer"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginUpgradesLegacyPasswordHash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	user := dao.User{Name: "Socio", Username: "legacy", PasswordHash: utils.HashSHA256("secreto")}
+	db.Create(&user)
+
+	router := gin.New()
+	router.POST("/login", Login)
+
+	login := func(password string) int {
+		w := httptest.NewRecorder()
+		body := `{"username":"legacy","password":"` + password + `"}`
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	if code := login("incorrecta"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for a wrong password, got %d", code)
+	}
+	var stored dao.User
+	db.First(&stored, user.ID)
+	if stored.PasswordHash != user.PasswordHash {
+		t.Fatal("failed login must not touch the stored hash")
+	}
+
+	if code := login("secreto"); code != http.StatusOK {
+		t.Fatalf("expected 200 with legacy hash, got %d", code)
+	}
+	db.First(&stored, user.ID)
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Fatalf("expected hash to be upgraded to argon2id, got %s", stored.PasswordHash)
+	}
+
+	if code := login("secreto"); code != http.StatusOK {
+		t.Errorf("expected 200 with upgraded hash, got %d", code)
+	}
+}
+
+// loginForTokens hace login y devuelve el access token y el refresh token
+func loginForTokens(t *testing.T, router *gin.Engine, username, password string) (string, string) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	body := `{"username":"` + username + `","password":"` + password + `"}`
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login failed with %d: %s", w.Code, w.Body.String())
+	}
+
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.User == nil || response.User.Token == "" || response.User.RefreshToken == "" {
+		t.Fatalf("expected access and refresh tokens, got %s", w.Body.String())
+	}
+	return response.User.Token, response.User.RefreshToken
+}
+
+func newAuthRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB(t)
+
+	hash, _ := utils.NewPasswordHasher().Hash("secreto")
+	db.Create(&dao.User{Name: "Socio", Username: "socio", PasswordHash: hash})
+
+	router := gin.New()
+	router.POST("/login", Login)
+	router.POST("/auth/refresh", RefreshToken)
+	router.POST("/auth/logout", utils.JwtAuthMiddleware(), Logout)
+	router.GET("/me", utils.JwtAuthMiddleware(), GetMe)
+	return router
+}
+
+func refresh(router *gin.Engine, refreshToken string) (int, domain.TokenResponse) {
+	w := httptest.NewRecorder()
+	body := `{"refresh_token":"` + refreshToken + `"}`
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewBufferString(body)))
+
+	var tokens domain.TokenResponse
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	return w.Code, tokens
+}
+
+func authGet(router *gin.Engine, path, token string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRefreshTokenRotationAndReuseDetection(t *testing.T) {
+	router := newAuthRouter(t)
+	access, refreshToken := loginForTokens(t, router, "socio", "secreto")
+
+	code, rotated := refresh(router, refreshToken)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200 on refresh, got %d", code)
+	}
+	if rotated.RefreshToken == refreshToken || rotated.Token == "" {
+		t.Fatal("expected a new token pair on refresh")
+	}
+	if code := authGet(router, "/me", rotated.Token); code != http.StatusOK {
+		t.Fatalf("expected refreshed access token to be accepted, got %d", code)
+	}
+
+	// Reusar el refresh token ya canjeado revoca toda la familia
+	if code, _ := refresh(router, refreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 on refresh token reuse, got %d", code)
+	}
+	if code, _ := refresh(router, rotated.RefreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected the whole family to be revoked, got %d", code)
+	}
+	for _, token := range []string{access, rotated.Token} {
+		if code := authGet(router, "/me", token); code != http.StatusUnauthorized {
+			t.Errorf("expected access tokens of a revoked family to be rejected, got %d", code)
+		}
+	}
+
+	// Otras sesiones del usuario no se ven afectadas
+	other, _ := loginForTokens(t, router, "socio", "secreto")
+	if code := authGet(router, "/me", other); code != http.StatusOK {
+		t.Errorf("expected a new session to work, got %d", code)
+	}
+
+	if code, _ := refresh(router, "desconocido"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown refresh token, got %d", code)
+	}
+}
+
+func TestLogoutRevokesAccessAndRefreshTokens(t *testing.T) {
+	router := newAuthRouter(t)
+	access, refreshToken := loginForTokens(t, router, "socio", "secreto")
+	otherAccess, otherRefresh := loginForTokens(t, router, "socio", "secreto")
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on logout, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if code := authGet(router, "/me", access); code != http.StatusUnauthorized {
+		t.Errorf("expected access token to be revoked after logout, got %d", code)
+	}
+	if code, _ := refresh(router, refreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected refresh token to be revoked after logout, got %d", code)
+	}
+	if code := authGet(router, "/me", otherAccess); code != http.StatusOK {
+		t.Errorf("expected the other session to stay valid, got %d", code)
+	}
+
+	// Cerrar todas las sesiones
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/auth/logout", bytes.NewBufferString(`{"all":true}`))
+	req.Header.Set("Authorization", "Bearer "+otherAccess)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 on logout all, got %d", w.Code)
+	}
+	if code, _ := refresh(router, otherRefresh); code != http.StatusUnauthorized {
+		t.Errorf("expected every session to be revoked, got %d", code)
+	}
+}
+
+func TestLoginLockoutAndAdminUnlock(t *testing.T) {
+	router := newAuthRouter(t)
+	db := clients.DB
+
+	var socio dao.User
+	db.Where("username = ?", "socio").First(&socio)
+	router.POST("/users/:id/unlock-as-socio", authenticatedAs(socio.ID, dao.RolSocio), UnlockUser)
+	router.POST("/users/:id/unlock", authenticatedAs(0, dao.RolAdmin), UnlockUser)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := `{"username":"socio","password":"` + password + `"}`
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(body)))
+		return w
+	}
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	// Los primeros fallos no demoran; el siguiente bloquea el username
+	for i := 0; i < 4; i++ {
+		if w := login("incorrecta"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	w := login("secreto")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 while locked even with the right password, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	var attempts []dao.LoginAttempt
+	db.Where("username = ?", "socio").Find(&attempts)
+	reasons := map[string]int{}
+	for _, attempt := range attempts {
+		reasons[attempt.Motivo]++
+	}
+	if reasons[dao.MotivoCredencialesInvalidas] != 4 || reasons[dao.MotivoBloqueado] != 1 {
+		t.Errorf("expected 4 invalid and 1 locked attempts audited, got %v", reasons)
+	}
+
+	if code := post(fmt.Sprintf("/users/%d/unlock-as-socio", socio.ID)); code != http.StatusForbidden {
+		t.Errorf("expected 403 when a member unlocks itself, got %d", code)
+	}
+	if code := post("/users/9999/unlock"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown user, got %d", code)
+	}
+	if code := post(fmt.Sprintf("/users/%d/unlock", socio.ID)); code != http.StatusOK {
+		t.Fatalf("expected 200 on unlock, got %d", code)
+	}
+	if w := login("secreto"); w.Code != http.StatusOK {
+		t.Errorf("expected login to succeed after unlock, got %d", w.Code)
+	}
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	router := newAuthRouter(t)
+	router.POST("/register", Register)
+	router.POST("/auth/password/forgot", ForgotPassword)
+	router.POST("/auth/password/reset", ResetPassword)
+
+	post := func(path, body string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	if code := post("/register", `{"name":"Ana","username":"ana","password":"vieja","email":"Ana@Example.com"}`); code != http.StatusCreated {
+		t.Fatalf("expected 201 on register, got %d", code)
+	}
+
+	// A partir de acá solo interesan los emails de restablecimiento
+	outbox := mailer.NewMemoryMailer()
+	services.SetMailer(outbox)
+	t.Cleanup(func() { services.SetMailer(mailer.NewMemoryMailer()) })
+	_, refreshToken := loginForTokens(t, router, "ana", "vieja")
+
+	// Cuentas inexistentes o sin email reciben la misma respuesta y ningún email
+	for _, body := range []string{`{"email":"nadie@example.com"}`, `{"username":"socio"}`} {
+		if code := post("/auth/password/forgot", body); code != http.StatusAccepted {
+			t.Errorf("expected 202 for %s, got %d", body, code)
+		}
+	}
+	if len(outbox.Messages()) != 0 {
+		t.Fatalf("expected no emails, got %d", len(outbox.Messages()))
+	}
+
+	if code := post("/auth/password/forgot", `{"email":"ana@example.com"}`); code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d", code)
+	}
+	messages := outbox.Messages()
+	if len(messages) != 1 || messages[0].To != "ana@example.com" {
+		t.Fatalf("expected one email to ana@example.com, got %+v", messages)
+	}
+	match := regexp.MustCompile(`token=([^\s]+)`).FindStringSubmatch(messages[0].Body)
+	if match == nil {
+		t.Fatalf("expected a reset link in the email, got %q", messages[0].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+
+	if code := post("/auth/password/reset", `{"token":"otro","password":"nueva"}`); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown token, got %d", code)
+	}
+	if code := post("/auth/password/reset", `{"token":"`+token+`","password":"nueva"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 on reset, got %d", code)
+	}
+	if code := post("/auth/password/reset", `{"token":"`+token+`","password":"otra"}`); code != http.StatusBadRequest {
+		t.Errorf("expected the token to be single use, got %d", code)
+	}
+
+	if code, _ := refresh(router, refreshToken); code != http.StatusUnauthorized {
+		t.Errorf("expected existing sessions to be closed, got %d", code)
+	}
+	if code := post("/login", `{"username":"ana","password":"vieja"}`); code != http.StatusUnauthorized {
+		t.Errorf("expected old password to be rejected, got %d", code)
+	}
+	loginForTokens(t, router, "ana", "nueva")
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	router := newAuthRouter(t)
+	router.POST("/auth/password/reset", ResetPassword)
+
+	var socio dao.User
+	clients.DB.Where("username = ?", "socio").First(&socio)
+	clients.CreatePasswordReset(dao.PasswordReset{
+		TokenHash:  utils.HashSHA256("vencido"),
+		ID_usuario: socio.ID,
+		ExpiresAt:  time.Now().Add(-time.Minute),
+	}, time.Now())
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/password/reset", bytes.NewBufferString(`{"token":"vencido","password":"nueva"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an expired token, got %d", w.Code)
+	}
+}
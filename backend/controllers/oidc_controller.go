@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetOIDCProviders lista los proveedores externos con los que se puede iniciar sesión
+func GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"providers": services.OIDCProviderNames(),
+		"success":   true,
+	})
+}
+
+// OIDCLogin redirige al usuario a la página de login del proveedor externo
+func OIDCLogin(c *gin.Context) {
+	provider := c.Param("provider")
+
+	authURL, err := services.StartOIDCLogin(provider)
+	if err != nil {
+		if err.Error() == "unknown provider" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		log.WithError(err).WithField("provider", provider).Error("Failed to start OIDC login")
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to contact identity provider", "success": false})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback recibe al usuario de vuelta del proveedor externo y responde
+// igual que el login con contraseña
+func OIDCCallback(c *gin.Context) {
+	provider := c.Param("provider")
+
+	// El usuario canceló o el proveedor rechazó el login
+	if providerError := c.Query("error"); providerError != "" {
+		log.WithFields(log.Fields{"provider": provider, "error": providerError}).Warn("OIDC login rejected by provider")
+		c.JSON(http.StatusUnauthorized, LoginResponse{Message: "External authentication failed", Success: false})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code and state are required", "success": false})
+		return
+	}
+
+	user, challenge, err := services.CompleteOIDCLogin(provider, code, state, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "unknown provider":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		case "invalid or expired state", "external authentication failed":
+			c.JSON(http.StatusUnauthorized, LoginResponse{Message: err.Error(), Success: false})
+		default:
+			log.WithError(err).WithField("provider", provider).Error("Failed to complete OIDC login")
+			c.JSON(http.StatusInternalServerError, LoginResponse{Message: "Failed to complete login", Success: false})
+		}
+		return
+	}
+
+	respondLogin(c, user, challenge)
+}
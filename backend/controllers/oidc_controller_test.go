@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/oidc"
+	"backend/oidc/oidctest"
+	"backend/services"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newOIDCRouter(t *testing.T) (*gin.Engine, *oidctest.Server) {
+	t.Helper()
+	router := newAuthRouter(t)
+
+	idp := oidctest.NewServer("gimnasio", "secreto")
+	t.Cleanup(idp.Close)
+	services.SetOIDCProviders(map[string]*oidc.Provider{
+		"mock": {
+			Name:         "mock",
+			Issuer:       idp.Issuer(),
+			ClientID:     "gimnasio",
+			ClientSecret: "secreto",
+			RedirectURL:  "http://localhost:8080/auth/oidc/mock/callback",
+		},
+	})
+	t.Cleanup(func() { services.SetOIDCProviders(nil) })
+
+	router.GET("/auth/oidc/providers", GetOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", OIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", OIDCCallback)
+	return router, idp
+}
+
+// oidcLogin recorre el flujo completo contra el IdP de prueba y devuelve la
+// URL de callback junto con la respuesta del backend
+func oidcLogin(t *testing.T, router *gin.Engine, idp *oidctest.Server, identity oidctest.Identity) (string, int, LoginResponse) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("expected redirect to the provider, got %d", w.Code)
+	}
+
+	callback, err := idp.Authorize(w.Header().Get("Location"), identity)
+	if err != nil {
+		t.Fatalf("provider rejected the authorization request: %v", err)
+	}
+	code, response := oidcCallback(t, router, callback)
+	return callback, code, response
+}
+
+func oidcCallback(t *testing.T, router *gin.Engine, callback string) (int, LoginResponse) {
+	t.Helper()
+	parsed, err := url.Parse(callback)
+	if err != nil {
+		t.Fatalf("invalid callback URL %s: %v", callback, err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, parsed.RequestURI(), nil))
+	var response LoginResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestOIDCLoginCreatesMemberAndReusesIdentity(t *testing.T) {
+	router, idp := newOIDCRouter(t)
+	identity := oidctest.Identity{Subject: "abc-123", Email: "nueva@example.com", EmailVerified: true, Name: "Nueva Socia"}
+
+	callback, code, login := oidcLogin(t, router, idp, identity)
+	if code != http.StatusOK || login.User == nil || login.User.Token == "" || login.User.RefreshToken == "" {
+		t.Fatalf("expected tokens from the callback, got %d %+v", code, login)
+	}
+	if login.User.Name != "Nueva Socia" || login.User.Email != "nueva@example.com" || login.User.IsAdmin {
+		t.Errorf("unexpected user %+v", login.User)
+	}
+	if authGet(router, "/me", login.User.Token) != http.StatusOK {
+		t.Error("expected the issued access token to be accepted")
+	}
+
+	// El state es de un solo uso
+	if code, _ := oidcCallback(t, router, callback); code != http.StatusUnauthorized {
+		t.Errorf("expected replayed state to be rejected, got %d", code)
+	}
+
+	// Un segundo login con la misma identidad entra con el mismo usuario
+	_, code, again := oidcLogin(t, router, idp, identity)
+	if code != http.StatusOK || again.User == nil || again.User.ID != login.User.ID {
+		t.Fatalf("expected the same user on second login, got %d %+v", code, again)
+	}
+
+	var identities int64
+	clients.DB.Model(&dao.ExternalIdentity{}).Count(&identities)
+	if identities != 1 {
+		t.Errorf("expected 1 linked identity, got %d", identities)
+	}
+}
+
+func TestOIDCLoginLinksOnlyVerifiedEmail(t *testing.T) {
+	router, idp := newOIDCRouter(t)
+
+	var socio dao.User
+	clients.DB.Where("username = ?", "socio").First(&socio)
+	email := "socio@example.com"
+	clients.DB.Model(&socio).Update("email", email)
+
+	// Un email sin verificar no alcanza para tomar la cuenta existente
+	_, code, unverified := oidcLogin(t, router, idp, oidctest.Identity{Subject: "no-verificado", Email: email})
+	if code != http.StatusOK || unverified.User == nil {
+		t.Fatalf("expected login to succeed, got %d %+v", code, unverified)
+	}
+	if unverified.User.ID == socio.ID || unverified.User.Email != "" {
+		t.Errorf("expected a separate user without email, got %+v", unverified.User)
+	}
+
+	// Tampoco alcanza que el proveedor lo verifique si el email local no está
+	// verificado: quien lo cargó pudo no ser el dueño de la dirección
+	_, code, preRegistered := oidcLogin(t, router, idp, oidctest.Identity{Subject: "dueño", Email: email, EmailVerified: true})
+	if code != http.StatusOK || preRegistered.User == nil {
+		t.Fatalf("expected login to succeed, got %d %+v", code, preRegistered)
+	}
+	if preRegistered.User.ID == socio.ID || preRegistered.User.Email != "" {
+		t.Errorf("expected a separate user without email, got %+v", preRegistered.User)
+	}
+	clients.DB.First(&socio, socio.ID)
+	if socio.EmailVerificadoEn != nil {
+		t.Error("expected the unverified local email to stay unverified")
+	}
+
+	now := time.Now()
+	clients.DB.Model(&socio).Update("email_verificado_en", &now)
+	_, code, verified := oidcLogin(t, router, idp, oidctest.Identity{Subject: "verificado", Email: "Socio@Example.com", EmailVerified: true})
+	if code != http.StatusOK || verified.User == nil || verified.User.ID != socio.ID {
+		t.Fatalf("expected the verified email to link the existing user, got %d %+v", code, verified)
+	}
+}
+
+func TestOIDCLoginStillRequiresAdminTwoFactor(t *testing.T) {
+	router, idp := newOIDCRouter(t)
+
+	roles, _ := clients.GetRolesByNames([]string{dao.RolAdmin})
+	clients.CreateUserWithIdentity(dao.User{Name: "Admin", Username: "admin", Roles: roles},
+		dao.ExternalIdentity{Proveedor: "mock", Subject: "admin"}, dao.AuditEvent{})
+
+	_, code, login := oidcLogin(t, router, idp, oidctest.Identity{Subject: "admin", Email: "admin@example.com", EmailVerified: true})
+	if code != http.StatusOK || login.User != nil || login.TwoFactor == nil || !login.TwoFactor.SetupRequired {
+		t.Fatalf("expected a 2FA setup challenge without tokens, got %d %+v", code, login)
+	}
+}
+
+func TestOIDCUnknownProviderAndProviderError(t *testing.T) {
+	router, _ := newOIDCRouter(t)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/otro/login", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown provider, got %d", w.Code)
+	}
+
+	if code, _ := oidcCallback(t, router, "/auth/oidc/mock/callback?error=access_denied"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 when the provider rejects the login, got %d", code)
+	}
+	if code, _ := oidcCallback(t, router, "/auth/oidc/mock/callback?code=x&state=desconocido"); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown state, got %d", code)
+	}
+}
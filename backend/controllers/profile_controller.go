@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetMe devuelve el perfil del usuario autenticado
+func GetMe(c *gin.Context) {
+	user, err := services.GetProfile(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "User not found",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":    user,
+		"success": true,
+	})
+}
+
+// UpdateMe modifica el perfil del usuario autenticado. Solo cambia los campos
+// presentes en el cuerpo; el username, la contraseña y los roles no se editan acá.
+func UpdateMe(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var request domain.ProfileUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.WithError(err).Error("Invalid profile update request")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	user, err := services.UpdateProfile(userID, request, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		case "name cannot be empty", "invalid email", "email already exists", "invalid phone",
+			"invalid birth date", "invalid emergency contact", "invalid photo url":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).WithField("user_id", userID).Error("Failed to update profile")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile", "success": false})
+		}
+		return
+	}
+
+	log.WithField("user_id", userID).Info("Profile updated successfully")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Profile updated successfully",
+		"user":    user,
+		"success": true,
+	})
+}
+
+// ResendEmailVerification vuelve a enviar el link de verificación al email del usuario autenticado
+func ResendEmailVerification(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	if err := services.SendEmailVerification(userID); err != nil {
+		switch err.Error() {
+		case "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		case "user has no email", "email already verified":
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).WithField("user_id", userID).Error("Failed to send email verification")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send email verification", "success": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Verification email sent",
+		"success": true,
+	})
+}
+
+// VerifyEmail confirma el email con el token del link enviado por email
+func VerifyEmail(c *gin.Context) {
+	var request domain.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	if err := services.VerifyEmail(request.Token, actorOf(c)); err != nil {
+		if err.Error() == "invalid or expired verification token" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		log.WithError(err).Error("Failed to verify email")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email", "success": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email verified successfully",
+		"success": true,
+	})
+}
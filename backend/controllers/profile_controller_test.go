@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/mailer"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newProfileRouter(t *testing.T) (*gin.Engine, *mailer.MemoryMailer) {
+	t.Helper()
+	router := newAuthRouter(t)
+	ctl := newTestControllers()
+	router.POST("/register", Register)
+	router.PATCH("/me", utils.JwtAuthMiddleware(), UpdateMe)
+	router.POST("/me/email/verification", utils.JwtAuthMiddleware(), ResendEmailVerification)
+	router.POST("/auth/email/verify", VerifyEmail)
+	router.POST("/inscription", utils.JwtAuthMiddleware(), ctl.inscriptions.CreateInscription)
+
+	outbox := mailer.NewMemoryMailer()
+	services.SetMailer(outbox)
+	t.Cleanup(func() { services.SetMailer(mailer.NewMemoryMailer()) })
+	return router, outbox
+}
+
+func requestJSON(router *gin.Engine, method, path, token string, body interface{}, response interface{}) int {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+	if response != nil {
+		json.Unmarshal(w.Body.Bytes(), response)
+	}
+	return w.Code
+}
+
+// lastVerificationToken extrae el token del último link de verificación enviado
+func lastVerificationToken(t *testing.T, outbox *mailer.MemoryMailer, to string) string {
+	t.Helper()
+	messages := outbox.Messages()
+	if len(messages) == 0 || messages[len(messages)-1].To != to {
+		t.Fatalf("expected a verification email to %s, got %+v", to, messages)
+	}
+	match := regexp.MustCompile(`token=([^\s]+)`).FindStringSubmatch(messages[len(messages)-1].Body)
+	if match == nil {
+		t.Fatalf("expected a verification link, got %q", messages[len(messages)-1].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	return token
+}
+
+type profileResponse struct {
+	User domain.User `json:"user"`
+}
+
+func TestRegisterRequiresVerifiedEmailToEnroll(t *testing.T) {
+	router, outbox := newProfileRouter(t)
+
+	activity := dao.Activity{Nombre: "Yoga", Profesor: "Luz", Capacidad: 5, Categoria: "Relax", Descripcion: "Yoga", Horarios: []dao.ActivitySlot{{Dia: 2, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	if err := clients.DB.Create(&activity).Error; err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+
+	register := map[string]interface{}{
+		"name": "Ana", "username": "ana", "password": "secreto", "email": "ana@example.com",
+		"phone": "+54 9 351 123-4567", "birth_date": "1990-05-17",
+		"emergency_contact": map[string]string{"name": "Juan", "phone": "+5493517654321"},
+	}
+	if code := requestJSON(router, http.MethodPost, "/register", "", register, nil); code != http.StatusCreated {
+		t.Fatalf("expected 201 on register, got %d", code)
+	}
+	token := lastVerificationToken(t, outbox, "ana@example.com")
+	access, _ := loginForTokens(t, router, "ana", "secreto")
+
+	var me profileResponse
+	if code := requestJSON(router, http.MethodGet, "/me", access, nil, &me); code != http.StatusOK {
+		t.Fatalf("expected 200 on GET /me, got %d", code)
+	}
+	if me.User.Phone != "+5493511234567" || me.User.BirthDate != "1990-05-17" || me.User.EmergencyContact == nil || me.User.EmailVerified {
+		t.Errorf("unexpected profile %+v", me.User)
+	}
+
+	inscription := map[string]int{"actividad_id": activity.ID_actividad}
+	if code := requestJSON(router, http.MethodPost, "/inscription", access, inscription, nil); code != http.StatusForbidden {
+		t.Fatalf("expected 403 before verifying the email, got %d", code)
+	}
+
+	if code := requestJSON(router, http.MethodPost, "/auth/email/verify", "", map[string]string{"token": access}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected an access token to be rejected as verification token, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPost, "/auth/email/verify", "", map[string]string{"token": token}, nil); code != http.StatusOK {
+		t.Fatalf("expected 200 on verify, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPost, "/me/email/verification", access, nil, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 when the email is already verified, got %d", code)
+	}
+
+	if code := requestJSON(router, http.MethodPost, "/inscription", access, inscription, nil); code != http.StatusCreated {
+		t.Fatalf("expected 201 after verifying the email, got %d", code)
+	}
+}
+
+func TestRegisterValidatesProfile(t *testing.T) {
+	router, _ := newProfileRouter(t)
+
+	cases := map[string]map[string]interface{}{
+		"missing email":     {"name": "Ana", "username": "ana", "password": "x"},
+		"invalid email":     {"name": "Ana", "username": "ana", "password": "x", "email": "ana"},
+		"invalid phone":     {"name": "Ana", "username": "ana", "password": "x", "email": "ana@example.com", "phone": "351-1234567"},
+		"future birth date": {"name": "Ana", "username": "ana", "password": "x", "email": "ana@example.com", "birth_date": "2999-01-01"},
+		"invalid photo":     {"name": "Ana", "username": "ana", "password": "x", "email": "ana@example.com", "photo_url": "javascript:alert(1)"},
+		"incomplete contact": {"name": "Ana", "username": "ana", "password": "x", "email": "ana@example.com",
+			"emergency_contact": map[string]string{"name": "Juan"}},
+	}
+	for name, body := range cases {
+		if code := requestJSON(router, http.MethodPost, "/register", "", body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, code)
+		}
+	}
+}
+
+func TestUpdateMe(t *testing.T) {
+	router, outbox := newProfileRouter(t)
+	access, _ := loginForTokens(t, router, "socio", "secreto")
+
+	if code := requestJSON(router, http.MethodPatch, "/me", access, map[string]string{"phone": "123"}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid phone, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPatch, "/me", access, map[string]string{"name": " "}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty name, got %d", code)
+	}
+
+	var updated profileResponse
+	body := map[string]string{"email": "Socio@Example.com", "phone": "+14155552671", "photo_url": "https://cdn.example.com/socio.png"}
+	if code := requestJSON(router, http.MethodPatch, "/me", access, body, &updated); code != http.StatusOK {
+		t.Fatalf("expected 200 on PATCH /me, got %d", code)
+	}
+	if updated.User.Name != "Socio" || updated.User.Email != "socio@example.com" || updated.User.Phone != "+14155552671" || updated.User.EmailVerified {
+		t.Errorf("unexpected profile %+v", updated.User)
+	}
+	firstToken := lastVerificationToken(t, outbox, "socio@example.com")
+
+	// Cambiar el email invalida el link enviado al anterior
+	if code := requestJSON(router, http.MethodPatch, "/me", access, map[string]string{"email": "otro@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("expected 200 on email change, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPost, "/auth/email/verify", "", map[string]string{"token": firstToken}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected the link for the old email to be rejected, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPost, "/me/email/verification", access, nil, nil); code != http.StatusAccepted {
+		t.Fatalf("expected 202 on resend, got %d", code)
+	}
+	if code := requestJSON(router, http.MethodPost, "/auth/email/verify", "", map[string]string{"token": lastVerificationToken(t, outbox, "otro@example.com")}, nil); code != http.StatusOK {
+		t.Fatalf("expected 200 on verify, got %d", code)
+	}
+
+	// Un string vacío borra el dato; los campos ausentes no cambian
+	var cleared profileResponse
+	if code := requestJSON(router, http.MethodPatch, "/me", access, map[string]string{"phone": ""}, &cleared); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if cleared.User.Phone != "" || cleared.User.PhotoURL == "" || !cleared.User.EmailVerified {
+		t.Errorf("unexpected profile after clearing the phone %+v", cleared.User)
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/policy"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetSchedule obtiene la recurrencia de una actividad
+func (ac *ActivityController) GetSchedule(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid activity ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid activity ID",
+			"success": false,
+		})
+		return
+	}
+
+	schedule, err := ac.activities.GetSchedule(id)
+	if err != nil {
+		switch err.Error() {
+		case "activity not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found", "success": false})
+		case "schedule not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity has no schedule", "success": false})
+		default:
+			log.WithError(err).WithField("activity_id", id).Error("Failed to get schedule")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve schedule", "success": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule,
+		"success":  true,
+	})
+}
+
+// SetSchedule crea o reemplaza la recurrencia de una actividad y regenera sus
+// sesiones - REQUIERE EL PERMISO activities:write
+func (ac *ActivityController) SetSchedule(c *gin.Context) {
+	// Verificar el permiso para administrar actividades
+	if !authorize(c, policy.WriteActivities, 0) {
+		return
+	}
+
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid activity ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid activity ID",
+			"success": false,
+		})
+		return
+	}
+
+	var request domain.Schedule
+	if err := c.ShouldBindJSON(&request); err != nil {
+		log.WithError(err).Error("Invalid schedule request")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	schedule, err := ac.activities.SetSchedule(id, request, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "activity not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found", "success": false})
+		case "invalid fecha_inicio", "invalid fecha_fin", "invalid excepcion",
+			"fecha_fin cannot be before fecha_inicio", "activity has an invalid timetable":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).WithField("activity_id", id).Error("Failed to save schedule")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save schedule", "success": false})
+		}
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	log.WithFields(log.Fields{
+		"activity_id": id,
+		"updated_by":  userID,
+	}).Info("Activity schedule updated successfully")
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule,
+		"success":  true,
+	})
+}
+
+// GetSessions lista las sesiones de una actividad. Acepta from y to como
+// fechas "2006-01-02"; to no se incluye.
+func (ac *ActivityController) GetSessions(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid activity ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid activity ID",
+			"success": false,
+		})
+		return
+	}
+
+	var from, to time.Time
+	if value := c.Query("from"); value != "" {
+		if from, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date", "success": false})
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.ParseInLocation("2006-01-02", value, time.Local); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date", "success": false})
+			return
+		}
+	}
+
+	sessions, err := ac.activities.GetSessions(id, from, to)
+	if err != nil {
+		switch err.Error() {
+		case "activity not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found", "success": false})
+		case "invalid date range":
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be after from", "success": false})
+		default:
+			log.WithError(err).WithField("activity_id", id).Error("Failed to get sessions")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sessions", "success": false})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+		"count":    len(sessions),
+		"success":  true,
+	})
+}
@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"backend/domain"
+	"backend/policy"
+	"backend/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// LoginTwoFactor completa el login con el código del segundo factor
+func LoginTwoFactor(c *gin.Context) {
+	var request domain.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	user, err := services.CompleteTwoFactorLogin(request.ChallengeToken, request.Code, actorOf(c))
+	if respondLoginThrottled(c, "", err) {
+		return
+	}
+	if err != nil {
+		switch err.Error() {
+		case "invalid two-factor code", "invalid or expired challenge":
+			c.JSON(http.StatusUnauthorized, LoginResponse{Message: err.Error(), Success: false})
+		case "two-factor enrolment not started":
+			c.JSON(http.StatusBadRequest, LoginResponse{Message: err.Error(), Success: false})
+		default:
+			log.WithError(err).Error("Failed to complete two-factor login")
+			c.JSON(http.StatusInternalServerError, LoginResponse{Message: "Failed to complete login", Success: false})
+		}
+		return
+	}
+
+	log.WithField("user_id", user.ID).Info("User logged in successfully with second factor")
+	c.JSON(http.StatusOK, LoginResponse{
+		Message: "Login successful",
+		User:    &user,
+		Success: true,
+	})
+}
+
+// LoginTwoFactorSetup devuelve el secreto TOTP para un usuario que debe
+// configurar el segundo factor antes de poder entrar
+func LoginTwoFactorSetup(c *gin.Context) {
+	var request domain.ChallengeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	setup, err := services.TwoFactorSetupForChallenge(request.ChallengeToken)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor": setup,
+		"success":    true,
+	})
+}
+
+// EnrollTwoFactor empieza a configurar el segundo factor del usuario autenticado
+func EnrollTwoFactor(c *gin.Context) {
+	setup, err := services.EnrollTwoFactor(c.GetInt("user_id"))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"two_factor": setup,
+		"success":    true,
+	})
+}
+
+// ConfirmTwoFactor activa el segundo factor del usuario autenticado y devuelve
+// los códigos de recuperación
+func ConfirmTwoFactor(c *gin.Context) {
+	var request domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	codes, err := services.ConfirmTwoFactor(userID, request.Code, actorOf(c))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	log.WithField("user_id", userID).Info("Two-factor authentication enabled")
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+		"success":        true,
+	})
+}
+
+// DisableTwoFactor desactiva el segundo factor del usuario autenticado
+func DisableTwoFactor(c *gin.Context) {
+	var request domain.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	userID := c.GetInt("user_id")
+	if err := services.DisableTwoFactor(userID, request.Code, actorOf(c)); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	log.WithField("user_id", userID).Info("Two-factor authentication disabled")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+		"success": true,
+	})
+}
+
+// ResetUserTwoFactor quita el segundo factor de un usuario (REQUIERE EL PERMISO users:write)
+func ResetUserTwoFactor(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid user ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"success": false,
+		})
+		return
+	}
+
+	if !authorize(c, policy.ResetTwoFactor, id) {
+		return
+	}
+
+	if err := services.ResetUserTwoFactor(id, actorOf(c)); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+
+	log.WithFields(log.Fields{"user_id": id, "by": c.GetInt("user_id")}).Info("Two-factor authentication reset")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication reset",
+		"success": true,
+	})
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch err.Error() {
+	case "user not found":
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+	case "invalid or expired challenge":
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "success": false})
+	case "two-factor authentication is already enabled":
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "success": false})
+	case "two-factor authentication is required for admins":
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "success": false})
+	case "invalid two-factor code", "two-factor enrolment not started", "two-factor authentication is not enabled":
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+	default:
+		log.WithError(err).Error("Two-factor request failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Two-factor request failed", "success": false})
+	}
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/services"
+	"backend/utils"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTwoFactorRouter(t *testing.T) (*gin.Engine, dao.User, dao.User) {
+	t.Helper()
+	router := newAuthRouter(t)
+
+	var socio dao.User
+	clients.DB.Where("username = ?", "socio").First(&socio)
+
+	roles, _ := clients.GetRolesByNames([]string{dao.RolAdmin})
+	hash, _ := utils.NewPasswordHasher().Hash("secreto")
+	admin := dao.User{Name: "Admin", Username: "admin", PasswordHash: hash, Roles: roles}
+	clients.DB.Create(&admin)
+
+	router.POST("/login/2fa", LoginTwoFactor)
+	router.POST("/login/2fa/setup", LoginTwoFactorSetup)
+	router.POST("/auth/2fa/enroll", utils.JwtAuthMiddleware(), EnrollTwoFactor)
+	router.POST("/auth/2fa/verify", utils.JwtAuthMiddleware(), ConfirmTwoFactor)
+	router.POST("/auth/2fa/disable", utils.JwtAuthMiddleware(), DisableTwoFactor)
+	return router, socio, admin
+}
+
+func postJSON(router *gin.Engine, path, token string, body interface{}, response interface{}) int {
+	data, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(data))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	router.ServeHTTP(w, req)
+	if response != nil {
+		json.Unmarshal(w.Body.Bytes(), response)
+	}
+	return w.Code
+}
+
+// totpAt devuelve el código TOTP de offset pasos a partir del actual
+func totpAt(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := utils.TOTPCode(secret, utils.TOTPStep(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("failed to compute TOTP: %v", err)
+	}
+	return code
+}
+
+type setupResponse struct {
+	TwoFactor struct {
+		Secret     string `json:"secret"`
+		OtpauthURI string `json:"otpauth_uri"`
+	} `json:"two_factor"`
+}
+
+func TestAdminMustSetUpTwoFactorOnLogin(t *testing.T) {
+	router, _, _ := newTwoFactorRouter(t)
+	credentials := map[string]string{"username": "admin", "password": "secreto"}
+
+	var login LoginResponse
+	if code := postJSON(router, "/login", "", credentials, &login); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if login.Message != "2fa_setup_required" || login.User != nil || login.TwoFactor == nil || !login.TwoFactor.SetupRequired {
+		t.Fatalf("expected a setup challenge without tokens, got %+v", login)
+	}
+	challenge := login.TwoFactor.ChallengeToken
+
+	var setup setupResponse
+	if code := postJSON(router, "/login/2fa/setup", "", map[string]string{"challenge_token": challenge}, &setup); code != http.StatusOK {
+		t.Fatalf("expected 200 on setup, got %d", code)
+	}
+	secret := setup.TwoFactor.Secret
+	if secret == "" || setup.TwoFactor.OtpauthURI == "" {
+		t.Fatalf("expected secret and otpauth URI, got %+v", setup)
+	}
+
+	body := map[string]string{"challenge_token": challenge, "code": "000000"}
+	if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a wrong code, got %d", code)
+	}
+
+	body["code"] = totpAt(t, secret, 0)
+	var done LoginResponse
+	if code := postJSON(router, "/login/2fa", "", body, &done); code != http.StatusOK {
+		t.Fatalf("expected 200 with a valid code, got %d", code)
+	}
+	if done.User == nil || done.User.Token == "" || len(done.User.RecoveryCodes) != 10 {
+		t.Fatalf("expected tokens and 10 recovery codes, got %+v", done.User)
+	}
+	if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected a challenge to be single use, got %d", code)
+	}
+
+	// A partir de ahora el login pide el código
+	postJSON(router, "/login", "", credentials, &login)
+	if login.Message != "2fa_required" || login.TwoFactor.SetupRequired {
+		t.Fatalf("expected a 2fa challenge, got %+v", login)
+	}
+	challenge = login.TwoFactor.ChallengeToken
+
+	// El código ya usado no se acepta de nuevo
+	body = map[string]string{"challenge_token": challenge, "code": totpAt(t, secret, 0)}
+	if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected a replayed code to be rejected, got %d", code)
+	}
+
+	recovery := done.User.RecoveryCodes[0]
+	body["code"] = recovery
+	if code := postJSON(router, "/login/2fa", "", body, &done); code != http.StatusOK {
+		t.Fatalf("expected 200 with a recovery code, got %d", code)
+	}
+
+	postJSON(router, "/login", "", credentials, &login)
+	body = map[string]string{"challenge_token": login.TwoFactor.ChallengeToken, "code": recovery}
+	if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected a recovery code to be single use, got %d", code)
+	}
+
+	disable := map[string]string{"code": totpAt(t, secret, 1)}
+	if code := postJSON(router, "/auth/2fa/disable", done.User.Token, disable, nil); code != http.StatusForbidden {
+		t.Errorf("expected admins not to be able to disable 2fa, got %d", code)
+	}
+}
+
+func TestMemberOptionalTwoFactor(t *testing.T) {
+	router, socio, _ := newTwoFactorRouter(t)
+	credentials := map[string]string{"username": "socio", "password": "secreto"}
+
+	access, _ := loginForTokens(t, router, "socio", "secreto")
+
+	var setup setupResponse
+	if code := postJSON(router, "/auth/2fa/enroll", access, nil, &setup); code != http.StatusOK {
+		t.Fatalf("expected 200 on enroll, got %d", code)
+	}
+	secret := setup.TwoFactor.Secret
+
+	// Hasta confirmarlo el segundo factor no se exige
+	loginForTokens(t, router, "socio", "secreto")
+
+	if code := postJSON(router, "/auth/2fa/verify", access, map[string]string{"code": "000000"}, nil); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a wrong code, got %d", code)
+	}
+	var verified struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	if code := postJSON(router, "/auth/2fa/verify", access, map[string]string{"code": totpAt(t, secret, 0)}, &verified); code != http.StatusOK {
+		t.Fatalf("expected 200 on verify, got %d", code)
+	}
+	if len(verified.RecoveryCodes) != 10 {
+		t.Errorf("expected 10 recovery codes, got %v", verified.RecoveryCodes)
+	}
+	if code := postJSON(router, "/auth/2fa/enroll", access, nil, nil); code != http.StatusConflict {
+		t.Errorf("expected 409 when 2fa is already enabled, got %d", code)
+	}
+
+	var login LoginResponse
+	postJSON(router, "/login", "", credentials, &login)
+	if login.Message != "2fa_required" {
+		t.Fatalf("expected 2fa to be required once enabled, got %+v", login)
+	}
+
+	// Los códigos incorrectos cuentan como fallos de login
+	body := map[string]string{"challenge_token": login.TwoFactor.ChallengeToken, "code": "000000"}
+	for i := 0; i < 4; i++ {
+		if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i+1, code)
+		}
+	}
+	body["code"] = totpAt(t, secret, 1)
+	if code := postJSON(router, "/login/2fa", "", body, nil); code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 after repeated wrong codes, got %d", code)
+	}
+	var audited int64
+	clients.DB.Model(&dao.LoginAttempt{}).Where("username = ? AND motivo = ?", "socio", dao.MotivoSegundoFactorInvalido).Count(&audited)
+	if audited != 4 {
+		t.Errorf("expected 4 audited second factor failures, got %d", audited)
+	}
+
+	if code := postJSON(router, "/auth/2fa/disable", access, map[string]string{"code": verified.RecoveryCodes[0]}, nil); code != http.StatusOK {
+		t.Fatalf("expected 200 on disable, got %d", code)
+	}
+	// Los códigos incorrectos dejaron demorado al username
+	services.UnlockUser(socio.ID, domain.Actor{})
+	loginForTokens(t, router, "socio", "secreto")
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"backend/domain"
+	"backend/policy"
 	"backend/services"
 	"net/http"
 	"strconv"
@@ -10,8 +11,18 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// UserController atiende las rutas de administración de usuarios. Los roles y
+// el desbloqueo de cuentas usan sus propios servicios.
+type UserController struct {
+	users *services.UserService
+}
+
+func NewUserController(users *services.UserService) *UserController {
+	return &UserController{users: users}
+}
+
 // GetUserByID obtiene un usuario por ID
-func GetUserByID(c *gin.Context) {
+func (uc *UserController) GetUserByID(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -23,7 +34,11 @@ func GetUserByID(c *gin.Context) {
 		return
 	}
 
-	user, err := services.GetUserByID(id)
+	if !authorize(c, policy.ReadUser, id) {
+		return
+	}
+
+	user, err := uc.users.GetUserByID(id)
 	if err != nil {
 		log.WithError(err).WithField("user_id", id).Error("User not found")
 		c.JSON(http.StatusNotFound, gin.H{
@@ -40,8 +55,12 @@ func GetUserByID(c *gin.Context) {
 }
 
 // GetAllUsers obtiene todos los usuarios (solo para admins)
-func GetAllUsers(c *gin.Context) {
-	users, err := services.GetAllUsers()
+func (uc *UserController) GetAllUsers(c *gin.Context) {
+	if !authorize(c, policy.ListUsers, 0) {
+		return
+	}
+
+	users, err := uc.users.GetAllUsers()
 	if err != nil {
 		log.WithError(err).Error("Failed to get users")
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -59,7 +78,7 @@ func GetAllUsers(c *gin.Context) {
 }
 
 // UpdateUser actualiza un usuario existente
-func UpdateUser(c *gin.Context) {
+func (uc *UserController) UpdateUser(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -71,8 +90,12 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	var user domain.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if !authorize(c, policy.UpdateUser, id) {
+		return
+	}
+
+	var request domain.UserUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
 		log.WithError(err).Error("Invalid update request")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "Invalid request format",
@@ -81,14 +104,14 @@ func UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user.ID = id // Asegurar que el ID coincida
-
-	if err := services.UpdateUser(user); err != nil {
+	if err := uc.users.UpdateUser(id, request, actorOf(c)); err != nil {
 		log.WithError(err).WithField("user_id", id).Error("Failed to update user")
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   err.Error(),
-			"success": false,
-		})
+		switch err.Error() {
+		case "invalid current password":
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "success": false})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		}
 		return
 	}
 
@@ -100,7 +123,7 @@ func UpdateUser(c *gin.Context) {
 }
 
 // DeleteUser elimina un usuario
-func DeleteUser(c *gin.Context) {
+func (uc *UserController) DeleteUser(c *gin.Context) {
 	idParam := c.Param("id")
 	id, err := strconv.Atoi(idParam)
 	if err != nil {
@@ -112,7 +135,15 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
-	if err := services.DeleteUser(id); err != nil {
+	if !authorize(c, policy.DeleteUser, id) {
+		return
+	}
+
+	if err := uc.users.DeleteUser(id, actorOf(c)); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found", "success": false})
+			return
+		}
 		log.WithError(err).WithField("user_id", id).Error("Failed to delete user")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to delete user",
@@ -127,3 +158,103 @@ func DeleteUser(c *gin.Context) {
 		"success": true,
 	})
 }
+
+// GetRoles lista los roles disponibles con sus permisos
+func GetRoles(c *gin.Context) {
+	roles, err := services.GetRoles()
+	if err != nil {
+		log.WithError(err).Error("Failed to get roles")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve roles",
+			"success": false,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles":   roles,
+		"success": true,
+	})
+}
+
+// SetUserRoles reemplaza los roles de un usuario: {"roles": ["instructor"]}
+func SetUserRoles(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid user ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"success": false,
+		})
+		return
+	}
+
+	if !authorize(c, policy.AssignRoles, id) {
+		return
+	}
+
+	var request domain.RolesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid request format",
+			"success": false,
+		})
+		return
+	}
+
+	user, err := services.SetUserRoles(id, request.Roles, actorOf(c))
+	if err != nil {
+		switch err.Error() {
+		case "user not found":
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+		case "unknown role", "at least one role is required":
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "success": false})
+		default:
+			log.WithError(err).WithField("user_id", id).Error("Failed to set user roles")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set user roles", "success": false})
+		}
+		return
+	}
+
+	log.WithFields(log.Fields{"user_id": id, "roles": user.Roles, "by": c.GetInt("user_id")}).Info("User roles updated")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User roles updated successfully",
+		"user":    user,
+		"success": true,
+	})
+}
+
+// UnlockUser quita el bloqueo de login de un usuario (REQUIERE EL PERMISO users:write)
+func UnlockUser(c *gin.Context) {
+	idParam := c.Param("id")
+	id, err := strconv.Atoi(idParam)
+	if err != nil {
+		log.WithError(err).WithField("id_param", idParam).Error("Invalid user ID")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid user ID",
+			"success": false,
+		})
+		return
+	}
+
+	if !authorize(c, policy.UnlockUser, id) {
+		return
+	}
+
+	if err := services.UnlockUser(id, actorOf(c)); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "success": false})
+			return
+		}
+		log.WithError(err).WithField("user_id", id).Error("Failed to unlock user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user", "success": false})
+		return
+	}
+
+	log.WithFields(log.Fields{"user_id": id, "by": c.GetInt("user_id")}).Info("User login unlocked")
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User unlocked successfully",
+		"success": true,
+	})
+}
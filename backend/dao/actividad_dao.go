@@ -4,12 +4,27 @@ type Activity struct {
 	ID_actividad int    `gorm:"primary_key;auto_increment"` // Cambiado para MySQL
 	Nombre       string `gorm:"not null;size:100"`
 	Profesor     string `gorm:"not null;size:100"`  // Nombre del profesor
-	Cupos        int    `gorm:"not null;default:1"` // Cupos disponibles
+	Capacidad    int    `gorm:"not null;default:1"` // Capacidad máxima de la actividad
 	Categoria    string `gorm:"not null;size:100"`  // Categoría de la actividad
 	Descripcion  string `gorm:"not null;size:255"`  // Descripción de la actividad
-	Dia          int    `gorm:"not null;size:20"`   // Día de la semana
-	Hora_inicio  string `gorm:"not null;size:20"`   // Hora de inicio
-	Hora_fin     string `gorm:"not null;size:20"`   // Hora de fin
+
+	// Días y horarios en que se dicta cada semana; comparten cupo e inscripciones
+	Horarios []ActivitySlot `gorm:"foreignKey:ID_actividad;constraint:OnDelete:CASCADE"`
+
+	// Usuario instructor a cargo de la clase; puede ver el listado de inscriptos
+	ID_instructor *int `gorm:"index"`
+
+	// Calculado en las consultas: capacidad menos inscripciones activas
+	CuposDisponibles int `gorm:"->;-:migration"`
 }
 
 type Activities []Activity
+
+// Horario semanal de una actividad: un día con su hora de inicio y de fin
+type ActivitySlot struct {
+	ID_horario   int    `gorm:"primary_key;auto_increment"`
+	ID_actividad int    `gorm:"not null;index"`
+	Dia          int    `gorm:"not null"`         // Día de la semana: 1 = lunes ... 7 = domingo
+	Hora_inicio  string `gorm:"not null;size:20"` // Hora de inicio
+	Hora_fin     string `gorm:"not null;size:20"` // Hora de fin
+}
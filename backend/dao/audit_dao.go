@@ -0,0 +1,57 @@
+package dao
+
+import (
+	"time"
+)
+
+// AuditEvent registra un cambio hecho a través de la API: quién, qué, sobre
+// qué entidad y cómo quedó. Se guarda en la misma transacción que el cambio.
+type AuditEvent struct {
+	ID_evento  int    `gorm:"primary_key;auto_increment" json:"id_evento"`
+	ID_actor   *int   `gorm:"index" json:"id_actor"` // nil si no hay usuario autenticado (registro, tareas automáticas)
+	Accion     string `gorm:"size:64;not null;index" json:"accion"`
+	Entidad    string `gorm:"size:32;not null;index:idx_audit_entity" json:"entidad"`
+	ID_entidad string `gorm:"size:64;index:idx_audit_entity" json:"id_entidad"`
+	// Antes y Despues son JSON con los campos que cambiaron; vacíos en altas y bajas respectivamente
+	Antes     string    `gorm:"type:text" json:"antes"`
+	Despues   string    `gorm:"type:text" json:"despues"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	RequestID string    `gorm:"size:64;index" json:"request_id"`
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// Entidades auditadas
+const (
+	EntidadUsuario     = "user"
+	EntidadActividad   = "activity"
+	EntidadInscripcion = "inscription"
+	EntidadListaEspera = "waitlist"
+	EntidadInvitacion  = "invitation"
+)
+
+// Acciones auditadas
+const (
+	AccionUsuarioRegistrado     = "user.register"
+	AccionUsuarioModificado     = "user.update"
+	AccionUsuarioEliminado      = "user.delete"
+	AccionRolesAsignados        = "user.roles"
+	AccionUsuarioDesbloqueado   = "user.unlock"
+	AccionSegundoFactorActivado = "user.enable_2fa"
+	AccionSegundoFactorQuitado  = "user.disable_2fa"
+	AccionContrasenaCambiada    = "user.password_reset"
+	AccionEmailVerificado       = "user.verify_email"
+	AccionIdentidadVinculada    = "user.link_identity"
+	AccionInvitacionCreada      = "invitation.create"
+	AccionInvitacionAceptada    = "invitation.accept"
+	AccionActividadCreada       = "activity.create"
+	AccionActividadModificada   = "activity.update"
+	AccionActividadEliminada    = "activity.delete"
+	AccionCapacidadModificada   = "activity.capacity"
+	AccionRecurrenciaModificada = "activity.schedule"
+	AccionInscripcionCreada     = "inscription.create"
+	AccionInscripcionCancelada  = "inscription.cancel"
+	AccionInscripcionPromovida  = "inscription.promote"
+	AccionInscripcionCompletada = "inscription.complete"
+	AccionListaEsperaAnotado    = "waitlist.join"
+	AccionListaEsperaBaja       = "waitlist.leave"
+)
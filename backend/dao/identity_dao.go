@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"time"
+)
+
+// Identidad de un proveedor externo (OpenID Connect) vinculada a un usuario.
+// El par proveedor + subject identifica a la persona en ese proveedor.
+type ExternalIdentity struct {
+	ID_identidad int       `gorm:"primary_key;auto_increment" json:"id_identidad"`
+	Proveedor    string    `gorm:"size:50;not null;uniqueIndex:idx_provider_subject" json:"proveedor"`
+	Subject      string    `gorm:"size:191;not null;uniqueIndex:idx_provider_subject" json:"subject"`
+	ID_usuario   int       `gorm:"not null;index" json:"id_usuario"`
+	Email        string    `gorm:"size:191" json:"email"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Login con un proveedor externo en curso. Guarda el code_verifier de PKCE y el
+// nonce hasta que el proveedor redirige al callback con el state.
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"primary_key;size:64" json:"-"`
+	Proveedor    string    `gorm:"size:50;not null" json:"proveedor"`
+	Nonce        string    `gorm:"size:64;not null" json:"-"`
+	CodeVerifier string    `gorm:"size:128;not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"not null;index" json:"expires_at"`
+}
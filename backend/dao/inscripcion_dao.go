@@ -1,7 +1,17 @@
 package dao
 
 import (
+	"fmt"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+// Estados posibles de una inscripción
+const (
+	EstadoActiva     = "activa"
+	EstadoCancelada  = "cancelada"
+	EstadoCompletada = "completada"
 )
 
 // Inscripción de un usuario a una actividad
@@ -12,14 +22,55 @@ type Inscription struct {
 	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
 
+	// Datos de la cancelación, solo presentes si Estado es "cancelada"
+	CancelledAt  *time.Time `json:"cancelled_at"`
+	CancelledBy  *int       `json:"cancelled_by"` // Usuario que canceló (el socio o un admin)
+	CancelReason string     `gorm:"size:255" json:"cancel_reason"`
+
 	// Foreign Keys
-	ID_usuario   int `gorm:"not null" json:"id_usuario"`
-	ID_actividad int `gorm:"not null" json:"id_actividad"`
+	ID_usuario   int `gorm:"not null;index:idx_inscription_user_activity" json:"id_usuario"`
+	ID_actividad int `gorm:"not null;index:idx_inscription_user_activity" json:"id_actividad"`
+	// Sesión reservada. Sin sesión es la inscripción semanal a la actividad.
+	ID_sesion *int `gorm:"index" json:"id_sesion"`
+
+	// Un usuario no puede tener dos inscripciones semanales activas a la misma
+	// actividad ni dos a la misma sesión. Como las canceladas se conservan, el
+	// índice único no puede ser sobre usuario y actividad: es sobre esta clave,
+	// que la completa BeforeCreate y vuelve a NULL cuando la inscripción deja
+	// de estar activa. Lo garantiza incluso con inscripciones simultáneas, en
+	// cualquier motor.
+	Clave_activa *string `gorm:"size:64;uniqueIndex" json:"-"`
 
-	// Relaciones
-	Usuario   User     `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
-	Actividad Activity `gorm:"foreignKey:ID_actividad;constraint:OnDelete:CASCADE" json:"actividad"`
+	// Relaciones. belongsTo evita que GORM tome Actividad como has-one,
+	// porque Activity también tiene un campo ID_actividad
+	Usuario   User          `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE"`
+	Actividad Activity      `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE" json:"actividad"`
+	Sesion    *ClassSession `gorm:"foreignKey:ID_sesion;belongsTo:true;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// BeforeCreate completa Clave_activa de las inscripciones que se crean activas
+func (inscription *Inscription) BeforeCreate(tx *gorm.DB) error {
+	if inscription.Estado == "" || inscription.Estado == EstadoActiva {
+		inscription.Clave_activa = ClaveActiva(inscription.ID_usuario, inscription.ID_actividad, inscription.ID_sesion)
+	}
+	return nil
+}
+
+// ClaveActiva es la clave de la inscripción activa de un usuario a una
+// actividad, o a una sesión si sessionID no es nil
+func ClaveActiva(userID int, activityID int, sessionID *int) *string {
+	clave := fmt.Sprintf("%d-%d", userID, activityID)
+	if sessionID != nil {
+		clave = fmt.Sprintf("%s-%d", clave, *sessionID)
+	}
+	return &clave
+}
 
-	// Índice compuesto para evitar inscripciones duplicadas
-	// Un usuario no puede inscribirse dos veces a la misma actividad
+// Cambio de estado de una inscripción, para conservar su historial
+type InscriptionHistory struct {
+	ID_historial   int       `gorm:"primary_key;auto_increment" json:"id_historial"`
+	ID_inscripcion int       `gorm:"not null;index" json:"id_inscripcion"`
+	Estado         string    `gorm:"not null;size:20" json:"estado"`
+	Detalle        string    `gorm:"size:255" json:"detalle"` // Ej: "promovida desde lista de espera"
+	CreatedAt      time.Time `gorm:"autoCreateTime" json:"created_at"`
 }
@@ -0,0 +1,19 @@
+package dao
+
+import (
+	"time"
+)
+
+// Invitacion es una invitación de un admin para crear una cuenta de staff. El
+// token enviado por email está firmado e incluye los roles; acá se guarda su jti
+// para que se pueda aceptar una sola vez.
+type Invitacion struct {
+	ID_invitacion string     `gorm:"primary_key;size:64" json:"id_invitacion"` // jti del token
+	Email         string     `gorm:"size:191;not null;index" json:"email"`
+	Roles         string     `gorm:"size:191;not null" json:"roles"` // Nombres separados por coma
+	ID_invitador  int        `gorm:"not null" json:"id_invitador"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	ExpiresAt     time.Time  `gorm:"not null;index" json:"expires_at"`
+	AceptadaEn    *time.Time `json:"aceptada_en,omitempty"`
+	ID_usuario    *int       `json:"id_usuario,omitempty"` // Usuario creado al aceptarla
+}
@@ -0,0 +1,24 @@
+package dao
+
+import (
+	"time"
+)
+
+// Lugar de un usuario en la lista de espera de una actividad completa.
+// El orden de llegada lo define ID_espera.
+type WaitlistEntry struct {
+	ID_espera int       `gorm:"primary_key;auto_increment" json:"id_espera"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+
+	// Un usuario no puede anotarse dos veces en la misma lista
+	ID_usuario   int `gorm:"not null;uniqueIndex:idx_waitlist_user_activity" json:"id_usuario"`
+	ID_actividad int `gorm:"not null;uniqueIndex:idx_waitlist_user_activity" json:"id_actividad"`
+
+	// Calculado en las consultas: lugar en la fila (1 = próximo en ser promovido)
+	Posicion int `gorm:"->;-:migration" json:"posicion"`
+
+	// Relaciones. belongsTo evita que GORM tome Actividad como has-one,
+	// porque Activity también tiene un campo ID_actividad
+	Usuario   User     `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+	Actividad Activity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -0,0 +1,32 @@
+package dao
+
+import (
+	"time"
+)
+
+// Fallos de login recientes de una clave ("user:<username>" o "ip:<ip>").
+// Es el estado que guarda el store de intentos respaldado por la base.
+// Las fechas son nil mientras no hubo fallos o bloqueos: MySQL en modo
+// estricto rechaza la fecha cero.
+type LoginThrottle struct {
+	Clave          string     `gorm:"primary_key;size:191" json:"clave"`
+	Fallos         int        `gorm:"not null;default:0" json:"fallos"`
+	UltimoFallo    *time.Time `json:"ultimo_fallo"`
+	BloqueadoHasta *time.Time `gorm:"index" json:"bloqueado_hasta"`
+}
+
+// Registro de auditoría de un intento de login rechazado
+type LoginAttempt struct {
+	ID_intento int       `gorm:"primary_key;auto_increment" json:"id_intento"`
+	Username   string    `gorm:"size:191;index" json:"username"`
+	IP         string    `gorm:"size:64;index" json:"ip"`
+	Motivo     string    `gorm:"size:32;not null" json:"motivo"` // invalid_credentials, invalid_second_factor o locked
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// Motivos por los que se rechaza un login
+const (
+	MotivoCredencialesInvalidas = "invalid_credentials"
+	MotivoSegundoFactorInvalido = "invalid_second_factor"
+	MotivoBloqueado             = "locked"
+)
@@ -0,0 +1,19 @@
+package dao
+
+import (
+	"time"
+)
+
+// Token para restablecer la contraseña, enviado por email. Solo se guarda su
+// hash SHA-256 y se puede usar una sola vez antes de ExpiresAt.
+type PasswordReset struct {
+	ID_reset   int        `gorm:"primary_key;auto_increment" json:"id_reset"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ID_usuario int        `gorm:"not null;index" json:"id_usuario"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
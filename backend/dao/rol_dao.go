@@ -0,0 +1,24 @@
+package dao
+
+// Roles predefinidos. Los permisos de cada uno se guardan en role_permissions.
+const (
+	RolSocio      = "socio"
+	RolInstructor = "instructor"
+	RolRecepcion  = "recepcion"
+	RolAdmin      = "admin" // Dueños del gimnasio: todos los permisos
+)
+
+// Rol que agrupa permisos y se asigna a los usuarios
+type Role struct {
+	ID_rol      int    `gorm:"primary_key;auto_increment" json:"id_rol"`
+	Nombre      string `gorm:"not null;size:50;uniqueIndex" json:"nombre"`
+	Descripcion string `gorm:"size:255" json:"descripcion"`
+
+	Permisos []RolePermission `gorm:"foreignKey:ID_rol;constraint:OnDelete:CASCADE" json:"permisos"`
+}
+
+// Permiso otorgado a un rol, con formato "recurso:acción" (ej. "activities:write")
+type RolePermission struct {
+	ID_rol  int    `gorm:"primary_key;autoIncrement:false" json:"id_rol"`
+	Permiso string `gorm:"primary_key;size:64" json:"permiso"`
+}
@@ -0,0 +1,13 @@
+package dao
+
+import (
+	"time"
+)
+
+// Migración de esquema ya aplicada. La tabla schema_migrations tiene una fila
+// por versión; las que faltan son las migraciones pendientes.
+type SchemaMigration struct {
+	Version    int       `gorm:"primary_key;autoIncrement:false"`
+	Nombre     string    `gorm:"size:100;not null"`
+	AplicadaEn time.Time `gorm:"not null"`
+}
@@ -0,0 +1,47 @@
+package dao
+
+import (
+	"time"
+)
+
+// Recurrencia de una actividad: la clase se repite cada semana, en los días y
+// horarios de la actividad, desde Fecha_inicio hasta Fecha_fin. Las fechas
+// tienen el formato "2006-01-02".
+type Schedule struct {
+	ID_actividad int       `gorm:"primary_key;autoIncrement:false"`
+	Fecha_inicio string    `gorm:"not null;size:10"`
+	Fecha_fin    *string   `gorm:"size:10"` // Sin fecha de fin se repite indefinidamente
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+
+	// Fechas sin clase (feriados, vacaciones). Se guardan en schedule_exceptions.
+	Excepciones []string `gorm:"-"`
+
+	Actividad Activity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+// Fecha en la que una actividad con recurrencia no tiene clase
+type ScheduleException struct {
+	ID_excepcion int    `gorm:"primary_key;auto_increment"`
+	ID_actividad int    `gorm:"not null;uniqueIndex:idx_exception_activity_date"`
+	Fecha        string `gorm:"not null;size:10;uniqueIndex:idx_exception_activity_date"`
+
+	Actividad Activity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE"`
+}
+
+// Clase concreta de una actividad, generada a partir de su recurrencia. Cada
+// sesión tiene su propio cupo: la capacidad de la actividad menos sus
+// inscripciones activas.
+type ClassSession struct {
+	ID_sesion    int       `gorm:"primary_key;auto_increment" json:"id_sesion"`
+	ID_actividad int       `gorm:"not null;uniqueIndex:idx_session_activity_start" json:"id_actividad"`
+	Inicio       time.Time `gorm:"not null;uniqueIndex:idx_session_activity_start" json:"inicio"`
+	Fin          time.Time `gorm:"not null" json:"fin"`
+	// Una sesión que dejó de estar en la recurrencia pero tenía inscripciones
+	// se conserva cancelada, con sus inscripciones canceladas
+	Cancelada bool `gorm:"not null;default:false" json:"cancelada"`
+
+	// Calculado en las consultas: capacidad menos inscripciones activas a la sesión
+	CuposDisponibles int `gorm:"->;-:migration" json:"cupos_disponibles"`
+
+	Actividad Activity `gorm:"foreignKey:ID_actividad;belongsTo:true;constraint:OnDelete:CASCADE" json:"-"`
+}
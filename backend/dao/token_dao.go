@@ -0,0 +1,29 @@
+package dao
+
+import (
+	"time"
+)
+
+// Refresh token emitido en el login. Solo se guarda su hash SHA-256.
+// Cada uso lo reemplaza por uno nuevo de la misma familia (rotación); si un
+// token ya usado vuelve a presentarse se revoca toda la familia.
+type RefreshToken struct {
+	ID_refresh int        `gorm:"primary_key;auto_increment" json:"id_refresh"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	FamilyID   string     `gorm:"size:64;not null;index" json:"family_id"`
+	ID_usuario int        `gorm:"not null;index" json:"id_usuario"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Access token revocado antes de su vencimiento (por ejemplo, en el logout).
+// Se puede borrar una vez pasado ExpiresAt.
+type RevokedToken struct {
+	JTI       string    `gorm:"primary_key;size:64" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
@@ -0,0 +1,45 @@
+package dao
+
+import (
+	"time"
+)
+
+// Segundo factor TOTP de un usuario. Mientras Activo es false la inscripción
+// no se confirmó con un código y no se exige en el login.
+type TwoFactor struct {
+	ID_usuario   int        `gorm:"primary_key;autoIncrement:false" json:"id_usuario"`
+	Secreto      string     `gorm:"size:64;not null" json:"-"`
+	Activo       bool       `gorm:"not null;default:false" json:"activo"`
+	UltimoPaso   int64      `gorm:"not null;default:0" json:"-"` // Último paso TOTP usado, para no aceptar un código dos veces
+	ConfirmadoEn *time.Time `json:"confirmado_en,omitempty"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Código de recuperación de un solo uso, para entrar sin el teléfono. Solo se
+// guarda su hash SHA-256.
+type RecoveryCode struct {
+	ID_codigo  int        `gorm:"primary_key;auto_increment" json:"id_codigo"`
+	ID_usuario int        `gorm:"not null;index" json:"id_usuario"`
+	CodeHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// Paso intermedio del login de un usuario con segundo factor: la contraseña
+// ya se verificó y falta el código. Solo se guarda el hash del token.
+type TwoFactorChallenge struct {
+	ID_challenge int        `gorm:"primary_key;auto_increment" json:"id_challenge"`
+	TokenHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ID_usuario   int        `gorm:"not null;index" json:"id_usuario"`
+	IP           string     `gorm:"size:64" json:"ip"`
+	Intentos     int        `gorm:"not null;default:0" json:"intentos"`
+	ExpiresAt    time.Time  `gorm:"not null;index" json:"expires_at"`
+	UsedAt       *time.Time `json:"used_at,omitempty"`
+
+	// Relaciones
+	Usuario User `gorm:"foreignKey:ID_usuario;constraint:OnDelete:CASCADE" json:"-"`
+}
@@ -1,9 +1,25 @@
 package dao
 
+import "time"
+
 type User struct {
 	ID           int    `gorm:"primary_key"`
 	Name         string `gorm:"not_null"`
 	Username     string `gorm:"unique"`
 	PasswordHash string `gorm:"not_null"`
-	IsAdmin      bool   `gorm:"default:false"`
+	// Email es opcional: los usuarios anteriores no lo tienen
+	Email *string `gorm:"size:191;uniqueIndex"`
+	// EmailVerificadoEn es cuándo se confirmó el email actual; nil si no se confirmó.
+	// Sin email verificado el usuario no puede inscribirse.
+	EmailVerificadoEn *time.Time
+
+	// Datos del perfil, todos opcionales
+	Telefono                   string `gorm:"size:16"` // Formato E.164
+	FechaNacimiento            *time.Time
+	ContactoEmergenciaNombre   string `gorm:"size:100"`
+	ContactoEmergenciaTelefono string `gorm:"size:16"` // Formato E.164
+	FotoURL                    string `gorm:"size:512"`
+
+	// Roles del usuario, en la tabla intermedia user_roles
+	Roles []Role `gorm:"many2many:user_roles;joinForeignKey:ID_usuario;joinReferences:ID_rol"`
 }
@@ -1,25 +1,44 @@
 package domain
 
 type Activity struct {
-	ID          int    `json:"id" gorm:"primary_key"`
-	Name        string `json:"name"` // Ej: "Zumba", "Musculación"
-	Profesor    string `json:"profesor"`
-	Cupos       int    `json:"cupos"`       // Ej: 10, 20
-	Categoria   string `json:"categoria"`   // Ej: "Aeróbico", "Fuerza"
-	Description string `json:"description"` // Opcional
-	Dia         int    `json:"dia"`         // Días en que se repite la actividad
-	HoraInicio  string `json:"hora_inicio"` // Ej: "08:00", "10:30"
-	HoraFin     string `json:"hora_fin"`    // Ej: "09:00", "11:30"
+	ID               int       `json:"id" gorm:"primary_key"`
+	Name             string    `json:"name"` // Ej: "Zumba", "Musculación"
+	Profesor         string    `json:"profesor"`
+	Capacidad        int       `json:"capacidad"`               // Ej: 10, 20
+	CuposDisponibles int       `json:"cupos_disponibles"`       // Calculado: capacidad - inscripciones activas
+	Categoria        string    `json:"categoria"`               // Ej: "Aeróbico", "Fuerza"
+	Description      string    `json:"description"`             // Opcional
+	Horarios         []Horario `json:"horarios"`                // Días y horarios en que se repite la actividad
+	Dia              int       `json:"dia"`                     // Primer horario; alcanza para las actividades de un solo día
+	HoraInicio       string    `json:"hora_inicio"`             // Ej: "08:00", "10:30"
+	HoraFin          string    `json:"hora_fin"`                // Ej: "09:00", "11:30"
+	InstructorId     *int      `json:"instructor_id,omitempty"` // Usuario instructor a cargo
+}
+
+// Horario es uno de los días de la semana en que se dicta una actividad
+type Horario struct {
+	Dia        int    `json:"dia"`         // 1 = lunes ... 7 = domingo
+	HoraInicio string `json:"hora_inicio"` // Ej: "08:00", "10:30"
+	HoraFin    string `json:"hora_fin"`    // Ej: "09:00", "11:30"
+}
+
+// FieldError es un campo inválido del pedido y el motivo
+type FieldError struct {
+	Field   string `json:"field"` // Ej: "capacidad", "horarios[1].hora_fin"
+	Message string `json:"message"`
 }
 
 type ActivityResponse struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Profesor    string `json:"profesor"`
-	Categoria   string `json:"categoria"`
-	Cupos       int    `json:"cupos"`
-	Description string `json:"description"`
-	Dia         int    `json:"dia"`
-	HoraInicio  string `json:"hora_inicio"`
-	HoraFin     string `json:"hora_fin"`
+	ID               int       `json:"id"`
+	Name             string    `json:"name"`
+	Profesor         string    `json:"profesor"`
+	Categoria        string    `json:"categoria"`
+	Capacidad        int       `json:"capacidad"`
+	CuposDisponibles int       `json:"cupos_disponibles"`
+	Description      string    `json:"description"`
+	Horarios         []Horario `json:"horarios"`
+	Dia              int       `json:"dia"`
+	HoraInicio       string    `json:"hora_inicio"`
+	HoraFin          string    `json:"hora_fin"`
+	InstructorId     *int      `json:"instructor_id,omitempty"`
 }
@@ -0,0 +1,49 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actor es quién hace un cambio y desde dónde. Los services lo reciben para
+// registrar el cambio en la auditoría. UserID es 0 si no hay usuario autenticado.
+type Actor struct {
+	UserID    int
+	IP        string
+	RequestID string
+}
+
+// AuditEvent es un evento de auditoría tal como lo devuelve GET /audit
+type AuditEvent struct {
+	ID         int             `json:"id"`
+	ActorID    *int            `json:"actor_id"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditQuery son los filtros y la página pedidos en GET /audit
+type AuditQuery struct {
+	ActorID   int
+	Action    string
+	Entity    string
+	EntityID  string
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	Page      int
+	PageSize  int
+}
+
+// AuditPage es una página de eventos de auditoría
+type AuditPage struct {
+	Events   []AuditEvent `json:"events"`
+	Total    int64        `json:"total"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+}
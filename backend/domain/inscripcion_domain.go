@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type Inscripcion struct {
 	Id int `gorm:"primaryKey"`
 
@@ -8,13 +10,27 @@ type Inscripcion struct {
 
 	Actividad   Activity `gorm:"foreignkey:ActividadId"`
 	ActividadId int
+
+	// Sesión reservada; nil en la inscripción semanal a la actividad
+	SesionId *int
+	Sesion   *ClassSession
+
+	Estado           string // activa, cancelada, completada
+	FechaInscripcion time.Time
+	CancelledAt      *time.Time
+	CancelledBy      *int
+	CancelReason     string
+
+	Historial []HistorialEstado `gorm:"-"`
 }
 
 type Inscripciones []Inscripcion
 
 type InscripcionRequest struct {
-	UsuarioId   int `json:"usuario_id" `
-	ActividadId int `json:"actividad_id"`
+	UsuarioId   int  `json:"usuario_id" `
+	ActividadId int  `json:"actividad_id"`
+	SesionId    *int `json:"sesion_id"`    // Sesión a reservar; sin sesión es la inscripción semanal
+	ListaEspera bool `json:"lista_espera"` // Si la actividad está completa, anotarse en la lista de espera
 }
 
 // InscripcionResponse representa la estructura de respuesta para una inscripción
@@ -24,4 +40,25 @@ type InscripcionResponse struct {
 	ActividadId int              `json:"actividad_id"`
 	Usuario     UserResponse     `json:"usuario"`
 	Actividad   ActivityResponse `json:"actividad"`
+	SesionId    *int             `json:"sesion_id,omitempty"`
+	Sesion      *ClassSession    `json:"sesion,omitempty"`
+
+	Estado           string            `json:"estado"`
+	FechaInscripcion time.Time         `json:"fecha_inscripcion"`
+	CancelledAt      *time.Time        `json:"cancelled_at,omitempty"`
+	CancelledBy      *int              `json:"cancelled_by,omitempty"`
+	CancelReason     string            `json:"cancel_reason,omitempty"`
+	Historial        []HistorialEstado `json:"historial,omitempty"`
+}
+
+// CancelacionRequest es el cuerpo opcional al cancelar una inscripción
+type CancelacionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// HistorialEstado representa un cambio de estado de una inscripción
+type HistorialEstado struct {
+	Estado  string    `json:"estado"`
+	Detalle string    `json:"detalle"`
+	Fecha   time.Time `json:"fecha"`
 }
@@ -0,0 +1,12 @@
+package domain
+
+import "time"
+
+// ListaEspera representa el lugar de un usuario en la lista de espera de una actividad
+type ListaEspera struct {
+	Id          int       `json:"id"`
+	UsuarioId   int       `json:"usuario_id"`
+	ActividadId int       `json:"actividad_id"`
+	Posicion    int       `json:"posicion"` // 1 = próximo en obtener un cupo
+	FechaAlta   time.Time `json:"fecha_alta"`
+}
@@ -9,3 +9,63 @@ type LoginResponse struct {
 	UserID int    `json:"user_id"`
 	Token  string `json:"token"`
 }
+
+// RefreshRequest es el cuerpo de POST /auth/refresh y, opcionalmente, de POST /auth/logout
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // Solo en logout: cerrar todas las sesiones del usuario
+}
+
+// TokenResponse contiene el nuevo par de tokens emitido al renovar la sesión
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Segundos de validez del token
+}
+
+// ForgotPasswordRequest es el cuerpo de POST /auth/password/forgot. Se puede
+// identificar la cuenta por email o por username.
+type ForgotPasswordRequest struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+// ResetPasswordRequest es el cuerpo de POST /auth/password/reset
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// TwoFactorChallenge es el paso intermedio del login de un usuario con segundo
+// factor: la contraseña es correcta y falta el código TOTP
+type TwoFactorChallenge struct {
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"` // Segundos de validez del challenge
+	// SetupRequired indica que el usuario debe configurar el segundo factor
+	// para poder entrar (es obligatorio para los admins)
+	SetupRequired bool `json:"setup_required"`
+}
+
+// TwoFactorSetup es lo que necesita la app de autenticación para generar códigos
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+// TwoFactorCodeRequest es el cuerpo de POST /auth/2fa/verify y /auth/2fa/disable.
+// Code es un código TOTP o, al desactivar, un código de recuperación.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest es el cuerpo de POST /login/2fa. Code es un código TOTP
+// o un código de recuperación.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// ChallengeRequest es el cuerpo de POST /login/2fa/setup
+type ChallengeRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
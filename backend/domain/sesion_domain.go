@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+// Schedule es la recurrencia de una actividad: la clase se repite cada semana,
+// en los días y horarios de la actividad, desde FechaInicio hasta FechaFin.
+// Las fechas tienen el formato "2006-01-02".
+type Schedule struct {
+	ActividadId int      `json:"actividad_id"`
+	FechaInicio string   `json:"fecha_inicio" binding:"required"`
+	FechaFin    *string  `json:"fecha_fin,omitempty"` // Sin fecha de fin se repite indefinidamente
+	Excepciones []string `json:"excepciones"`         // Fechas sin clase: feriados, vacaciones
+	Dias        []int    `json:"dias"`                // Días de la semana de la actividad, solo lectura
+}
+
+// ClassSession es una clase concreta de una actividad, con su propio cupo
+type ClassSession struct {
+	Id               int       `json:"id"`
+	ActividadId      int       `json:"actividad_id"`
+	Inicio           time.Time `json:"inicio"`
+	Fin              time.Time `json:"fin"`
+	CuposDisponibles int       `json:"cupos_disponibles"` // Calculado: capacidad - reservas activas de la sesión
+}
@@ -1,12 +1,34 @@
 package domain
 
+import "time"
+
 type User struct {
 	ID       int    `json:"id"`
 	Name     string `json:"name"`
 	Username string `json:"username"`
-	Password string `json:"password"`
-	IsAdmin  bool   `json:"is_admin"`
-	Token    string `json:"token"` // Token opcional para autenticación
+	Email    string `json:"email,omitempty"`
+	// EmailVerified indica si el usuario confirmó su email; es necesario para inscribirse
+	EmailVerified bool     `json:"email_verified"`
+	Password      string   `json:"password"`
+	IsAdmin       bool     `json:"is_admin"` // Calculado: tiene el rol admin
+	Roles         []string `json:"roles"`
+	Token         string   `json:"token"` // Token opcional para autenticación
+	// RefreshToken permite obtener un nuevo Token cuando vence
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// RecoveryCodes se devuelven una sola vez, al terminar de configurar el segundo factor en el login
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+
+	// Datos del perfil
+	Phone            string            `json:"phone,omitempty"`      // Formato E.164: +5493511234567
+	BirthDate        string            `json:"birth_date,omitempty"` // AAAA-MM-DD
+	EmergencyContact *EmergencyContact `json:"emergency_contact,omitempty"`
+	PhotoURL         string            `json:"photo_url,omitempty"`
+}
+
+// EmergencyContact es a quién avisar ante una emergencia durante una clase
+type EmergencyContact struct {
+	Name  string `json:"name"`
+	Phone string `json:"phone"` // Formato E.164
 }
 
 type UserResponse struct {
@@ -14,3 +36,80 @@ type UserResponse struct {
 	Username string `json:"username"`
 	IsAdmin  bool   `json:"is_admin"`
 }
+
+// RegisterRequest es el cuerpo de POST /register. No tiene roles ni ningún
+// otro privilegio: quien se registra es socio. Las cuentas de staff se crean
+// con una invitación.
+type RegisterRequest struct {
+	Name             string            `json:"name"`
+	Username         string            `json:"username"`
+	Password         string            `json:"password"`
+	Email            string            `json:"email"`
+	Phone            string            `json:"phone"`
+	BirthDate        string            `json:"birth_date"`
+	EmergencyContact *EmergencyContact `json:"emergency_contact"`
+	PhotoURL         string            `json:"photo_url"`
+}
+
+// UserUpdateRequest son los campos que se pueden modificar de un usuario. Los
+// campos vacíos no se modifican. Los roles se cambian con RolesRequest.
+// Quien cambia su propia contraseña tiene que enviar también la actual.
+type UserUpdateRequest struct {
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
+	ProfileUpdateRequest
+}
+
+// ProfileUpdateRequest es el cuerpo de PATCH /me. Los campos ausentes no se
+// modifican y un string vacío borra el dato (salvo el nombre, que es obligatorio).
+// Cambiar el email obliga a verificarlo de nuevo.
+type ProfileUpdateRequest struct {
+	Name             *string           `json:"name"`
+	Email            *string           `json:"email"`
+	Phone            *string           `json:"phone"`
+	BirthDate        *string           `json:"birth_date"`
+	EmergencyContact *EmergencyContact `json:"emergency_contact"`
+	PhotoURL         *string           `json:"photo_url"`
+}
+
+// VerifyEmailRequest es el cuerpo de POST /auth/email/verify
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// InvitationRequest es el cuerpo de POST /admin/invitations
+type InvitationRequest struct {
+	Email string   `json:"email" binding:"required"`
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// Invitation es una invitación creada por un admin. El token se envía por email
+// y también se devuelve para poder compartirlo por otro medio.
+type Invitation struct {
+	Email     string    `json:"email"`
+	Roles     []string  `json:"roles"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AcceptInvitationRequest es el cuerpo de POST /invitations/accept. El email y
+// los roles salen de la invitación; el resto del perfil se completa con PATCH /me.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// RolesRequest es el cuerpo de PUT /users/:id/roles
+type RolesRequest struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+// Rol es un rol con sus permisos
+type Rol struct {
+	Nombre      string   `json:"nombre"`
+	Descripcion string   `json:"descripcion"`
+	Permisos    []string `json:"permisos"`
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailerWritesMessage(t *testing.T) {
+	dir := t.TempDir()
+	m := FileMailer{Dir: filepath.Join(dir, "mail"), From: "gimnasio@example.com"}
+
+	err := m.Send(Message{To: "ana@example.com", Subject: "Restablecer tu contraseña", Body: "Hola\nChau"})
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(m.Dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	content := string(data)
+
+	for _, want := range []string{
+		"From: gimnasio@example.com\r\n",
+		"To: ana@example.com\r\n",
+		"Subject: =?utf-8?q?Restablecer_tu_contrase=C3=B1a?=\r\n",
+		"\r\n\r\nHola\r\nChau",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected message to contain %q, got:\n%s", want, content)
+		}
+	}
+}
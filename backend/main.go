@@ -1,83 +1,142 @@
 package main
 
 import (
+	"backend/app"
 	"backend/clients"
-	"backend/controllers"
+	"backend/config"
+	"backend/mailer"
+	"backend/oidc"
+	"backend/services"
 	"backend/utils"
+	"fmt"
 	"log"
+	"os"
 	"time"
 
-	"github.com/gin-contrib/cors"
-	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 func main() {
 	// ========================================
-	// 1. INICIALIZAR BASE DE DATOS PRIMERO
+	// 1. CARGAR LA CONFIGURACIÓN
 	// ========================================
-	log.Println("Initializing database connection...")
-	mysqlClient := clients.NewMysqlClient()
-	if mysqlClient == nil {
-		panic("Failed to initialize MySQL client")
+	// Variables de entorno y, opcionalmente, config.yaml (o el archivo de CONFIG_FILE)
+	cfg, err := config.Load()
+	if err != nil {
+		panic("Invalid configuration: " + err.Error())
 	}
-	log.Println("Database connection established and migrations completed")
+	level, _ := logrus.ParseLevel(cfg.Log.Level)
+	logrus.SetLevel(level)
 
 	// ========================================
-	// 2. CONFIGURAR EL ROUTER
+	// 2. INICIALIZAR BASE DE DATOS
 	// ========================================
-	router := gin.Default()
-
-	// Set up CORS middleware directamente aquí, para permitir tu frontend React
-	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"}, // Cambia si frontend corre en otro origen
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	log.Printf("Initializing %s database connection...", cfg.Database.Driver)
+	databaseClient := clients.NewDatabaseClient(cfg.Database)
+	if databaseClient == nil {
+		panic("Failed to initialize database client")
+	}
+	log.Println("Database connection established")
+
+	// Comandos de administración: migrar el esquema o crear el primer admin
+	if len(os.Args) > 1 {
+		if err := runCommand(databaseClient, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if cfg.Database.AutoMigrate {
+		applied, err := clients.MigrateUp(databaseClient.DB)
+		if err != nil {
+			panic("Failed to migrate database: " + err.Error())
+		}
+		log.Printf("Applied %d migrations", applied)
+	}
+	// No atender pedidos con un esquema desactualizado
+	if err := databaseClient.Prepare(); err != nil {
+		panic("Database not ready: " + err.Error())
+	}
+
+	err = utils.InitJWTKeys(utils.KeyConfig{
+		SigningKeyFile:   cfg.JWT.SigningKeyFile,
+		SigningKeyID:     cfg.JWT.SigningKeyID,
+		Secret:           cfg.JWT.Secret,
+		VerificationKeys: cfg.JWT.VerificationKeys,
+	})
+	if err != nil {
+		panic("Failed to load JWT signing keys: " + err.Error())
+	}
+	utils.SetAccessTokenDuration(cfg.JWT.AccessTokenTTL)
+	services.SetRefreshTokenDuration(cfg.JWT.RefreshTokenTTL)
+
+	// Los fallos de login se guardan en la base para que sobrevivan a un
+	// reinicio y se compartan entre instancias
+	services.SetAttemptStore(services.NewDBAttemptStore())
+
+	mailSender, err := mailer.NewFromEnv()
+	if err != nil {
+		panic("Failed to configure mailer: " + err.Error())
+	}
+	services.SetMailer(mailSender)
+	if cfg.URLs.PasswordReset != "" {
+		services.SetPasswordResetURL(cfg.URLs.PasswordReset)
+	}
+	if cfg.URLs.EmailVerification != "" {
+		services.SetEmailVerificationURL(cfg.URLs.EmailVerification)
+	}
+	if cfg.URLs.Invitation != "" {
+		services.SetInvitationURL(cfg.URLs.Invitation)
+	}
+
+	providers, err := oidc.LoadProvidersFromEnv()
+	if err != nil {
+		panic("Failed to configure OIDC providers: " + err.Error())
+	}
+	services.SetOIDCProviders(providers)
 
 	// ========================================
-	// 3. CONFIGURAR RUTAS
+	// 3. ARMAR EL ROUTER CON TODAS LAS RUTAS
 	// ========================================
+	store := services.NewDBStore()
+	svc := app.NewServices(store, store, store)
+	router := app.NewRouter(cfg, svc)
+
+	// Generar las sesiones de las próximas semanas, marcar como completadas las
+	// reservas de sesiones que ya terminaron y limpiar los tokens vencidos y los
+	// fallos de login viejos
+	go func() {
+		for range time.Tick(15 * time.Minute) {
+			created, err := svc.Activities.GenerateUpcomingSessions(time.Now())
+			if err != nil {
+				log.Printf("Failed to generate upcoming sessions: %v", err)
+			} else if created > 0 {
+				log.Printf("Generated %d class sessions", created)
+			}
+
+			completed, err := svc.Inscriptions.CompleteFinishedInscriptions(time.Now())
+			if err != nil {
+				log.Printf("Failed to complete finished inscriptions: %v", err)
+			} else if completed > 0 {
+				log.Printf("Marked %d inscriptions as completed", completed)
+			}
+
+			if err := services.PurgeExpiredTokens(time.Now()); err != nil {
+				log.Printf("Failed to purge expired tokens: %v", err)
+			}
 
-	// Authentication routes
-	router.POST("/login", controllers.Login)
-	router.POST("/register", controllers.Register)
-
-	// User routes
-	router.GET("/users", controllers.GetAllUsers)
-	router.GET("/users/:id", controllers.GetUserByID)
-	router.PUT("/users/:id", utils.JwtAuthMiddleware(), controllers.UpdateUser)
-	router.DELETE("/users/:id", utils.JwtAuthMiddleware(), controllers.DeleteUser)
-
-	// Activity routes
-	router.GET("/activities", controllers.GetActivities)
-	router.GET("/activities/:id", controllers.GetActivityByID)
-	// Rutas de actividades que requieren rol de administrador
-	router.POST("/activities", utils.JwtAuthMiddleware(), utils.AdminAuthMiddleware(), controllers.CreateActivity)
-	router.PUT("/activities/:id", utils.JwtAuthMiddleware(), utils.AdminAuthMiddleware(), controllers.UpdateActivity)
-	router.DELETE("/activities/:id", utils.JwtAuthMiddleware(), utils.AdminAuthMiddleware(), controllers.DeleteActivity)
-
-	// Activity filters and search
-	router.GET("/activities/category/:categoria", controllers.GetActivitiesByCategory)
-	router.GET("/activities/profesor/:profesor", controllers.GetActivitiesByProfesor)
-	router.GET("/activities/day/:dia", controllers.GetActivitiesByDay)
-	router.GET("/activities/available", controllers.GetActivitiesWithAvailableSlots)
-	router.GET("/activities/search", controllers.SearchActivitiesByName)
-	router.PUT("/activities/:id/slots", utils.JwtAuthMiddleware(), utils.AdminAuthMiddleware(), controllers.UpdateActivitySlots) // También requiere admin para actualizar cupos
-
-	//Inscriptions routes
-	router.GET("/inscription/:id", controllers.GetInscriptionByID)
-	router.POST("/inscription", controllers.CreateInscription)
-	router.GET("/inscriptions/myactivities/:id", utils.JwtAuthMiddleware(), controllers.GetActivitiesByUser)
-	router.DELETE("/inscriptions/:id", utils.JwtAuthMiddleware(), controllers.DeleteInscription)
+			if err := services.PurgeLoginAttempts(time.Now()); err != nil {
+				log.Printf("Failed to purge login attempts: %v", err)
+			}
+		}
+	}()
 
 	// ========================================
 	// 4. INICIAR SERVIDOR
 	// ========================================
-	log.Println("Starting server on port 8080...")
-	if err := router.Run(":8080"); err != nil {
+	addr := fmt.Sprintf(":%d", cfg.Server.Port)
+	log.Printf("Starting server on %s...", addr)
+	if err := router.Run(addr); err != nil {
 		panic("Failed to start server: " + err.Error())
 	}
 }
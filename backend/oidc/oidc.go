@@ -0,0 +1,284 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider es un proveedor de identidad OpenID Connect (Google, Microsoft o
+// cualquier emisor compatible) con el que se hace login por authorization code + PKCE
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient permite cambiar el cliente usado para hablar con el proveedor
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *jwks
+}
+
+// discoveryDocument es lo que se usa de /.well-known/openid-configuration
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims son los datos del usuario que vienen en el ID token
+type Claims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+}
+
+// UnmarshalJSON acepta email_verified como booleano o como string, porque
+// algunos proveedores lo envían como "true"
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	aux := struct {
+		*plain
+		EmailVerified interface{} `json:"email_verified"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	switch value := aux.EmailVerified.(type) {
+	case bool:
+		c.EmailVerified = value
+	case string:
+		c.EmailVerified = value == "true"
+	}
+	return nil
+}
+
+func (p *Provider) client() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// discover obtiene y guarda los endpoints del proveedor
+func (p *Provider) discover() (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	wellKnown := strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("failed to discover provider %s: %w", p.Name, err)
+	}
+	if doc.Issuer != p.Issuer {
+		return nil, fmt.Errorf("provider %s reports issuer %q, expected %q", p.Name, doc.Issuer, p.Issuer)
+	}
+	p.discovery = &doc
+	return p.discovery, nil
+}
+
+// AuthCodeURL arma la URL a la que se redirige al usuario para que se autentique
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) (string, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "email", "profile"}
+	}
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", codeChallenge)
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return doc.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// Exchange canjea el authorization code por los tokens y devuelve los claims
+// del ID token ya verificado
+func (p *Provider) Exchange(code, codeVerifier, nonce string) (Claims, error) {
+	doc, err := p.discover()
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.ClientID)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	resp, err := p.client().PostForm(doc.TokenEndpoint, form)
+	if err != nil {
+		return Claims{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil || tokens.IDToken == "" {
+		return Claims{}, errors.New("token response without id_token")
+	}
+
+	return p.VerifyIDToken(tokens.IDToken, nonce)
+}
+
+// VerifyIDToken verifica la firma, el emisor, la audiencia, el vencimiento y
+// el nonce de un ID token
+func (p *Provider) VerifyIDToken(rawToken, nonce string) (Claims, error) {
+	if _, err := p.discover(); err != nil {
+		return Claims{}, err
+	}
+
+	var claims Claims
+	_, err := jwt.ParseWithClaims(rawToken, &claims, p.keyfunc,
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid id token: %w", err)
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("invalid id token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.New("invalid id token: missing subject")
+	}
+	return claims, nil
+}
+
+// keyfunc busca la clave del ID token en el JWKS del proveedor. Si el kid no
+// se conoce vuelve a descargar el JWKS, por si el proveedor rotó sus claves.
+func (p *Provider) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+	if keys != nil {
+		if key, ok := keys.find(kid, token.Method.Alg()); ok {
+			return key, nil
+		}
+	}
+
+	var fetched jwks
+	if err := p.getJSON(p.discovery.JWKSURI, &fetched); err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	p.mu.Lock()
+	p.keys = &fetched
+	p.mu.Unlock()
+
+	if key, ok := fetched.find(kid, token.Method.Alg()); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func (p *Provider) getJSON(endpoint string, target interface{}) error {
+	resp, err := p.client().Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// NewPKCE genera el code_verifier y su code_challenge S256 (RFC 7636)
+func NewPKCE() (verifier string, challenge string, err error) {
+	verifier, err = RandomString()
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// RandomString genera un valor aleatorio de 256 bits apto para state y nonce
+func RandomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// LoadProvidersFromEnv arma los proveedores listados en OIDC_PROVIDERS
+// ("google,microsoft"). Cada uno se configura con:
+//
+//	OIDC_<NOMBRE>_ISSUER         URL del emisor, por ejemplo https://accounts.google.com
+//	OIDC_<NOMBRE>_CLIENT_ID      client id registrado en el proveedor
+//	OIDC_<NOMBRE>_CLIENT_SECRET  client secret (opcional para clientes públicos)
+//	OIDC_<NOMBRE>_REDIRECT_URL   URL de callback registrada en el proveedor
+//	OIDC_<NOMBRE>_SCOPES         scopes separados por espacios (por defecto "openid email profile")
+func LoadProvidersFromEnv() (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &Provider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return nil, fmt.Errorf("OIDC provider %s requires %sISSUER, %sCLIENT_ID and %sREDIRECT_URL", name, prefix, prefix, prefix)
+		}
+		providers[name] = provider
+	}
+	return providers, nil
+}
@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"backend/oidc/oidctest"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	idp := oidctest.NewServer("gimnasio", "secreto")
+	t.Cleanup(idp.Close)
+
+	return &Provider{
+		Name:         "mock",
+		Issuer:       idp.Issuer(),
+		ClientID:     "gimnasio",
+		ClientSecret: "secreto",
+		RedirectURL:  "http://localhost:8080/auth/oidc/mock/callback",
+	}, idp
+}
+
+func TestExchangeWithPKCE(t *testing.T) {
+	provider, idp := newTestProvider(t)
+	verifier, challenge, _ := NewPKCE()
+
+	authURL, err := provider.AuthCodeURL("estado", "nonce", challenge)
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	identity := oidctest.Identity{Subject: "123", Email: "ana@example.com", EmailVerified: true, Name: "Ana"}
+
+	callback, err := idp.Authorize(authURL, identity)
+	if err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+	if !strings.Contains(callback, "state=estado") {
+		t.Errorf("expected state in callback %s", callback)
+	}
+	code := codeFrom(t, callback)
+
+	claims, err := provider.Exchange(code, verifier, "nonce")
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if claims.Subject != "123" || claims.Email != "ana@example.com" || !claims.EmailVerified || claims.Name != "Ana" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// El code es de un solo uso
+	if _, err := provider.Exchange(code, verifier, "nonce"); err == nil {
+		t.Error("expected a reused code to be rejected")
+	}
+}
+
+func TestExchangeRejectsWrongVerifierAndNonce(t *testing.T) {
+	provider, idp := newTestProvider(t)
+	_, challenge, _ := NewPKCE()
+	otherVerifier, _, _ := NewPKCE()
+
+	authURL, _ := provider.AuthCodeURL("estado", "nonce", challenge)
+	callback, _ := idp.Authorize(authURL, oidctest.Identity{Subject: "123"})
+	if _, err := provider.Exchange(codeFrom(t, callback), otherVerifier, "nonce"); err == nil {
+		t.Error("expected PKCE verification to fail with another verifier")
+	}
+
+	verifier, challenge, _ := NewPKCE()
+	authURL, _ = provider.AuthCodeURL("estado", "nonce", challenge)
+	callback, _ = idp.Authorize(authURL, oidctest.Identity{Subject: "123"})
+	if _, err := provider.Exchange(codeFrom(t, callback), verifier, "otro-nonce"); err == nil {
+		t.Error("expected a nonce mismatch to be rejected")
+	}
+}
+
+func TestVerifyIDTokenRejectsMalformedToken(t *testing.T) {
+	provider, _ := newTestProvider(t)
+	if _, err := provider.VerifyIDToken("not-a-token", "nonce"); err == nil {
+		t.Error("expected a malformed token to be rejected")
+	}
+}
+
+func TestClaimsAcceptStringEmailVerified(t *testing.T) {
+	var claims Claims
+	if err := json.Unmarshal([]byte(`{"sub":"1","email":"a@b.c","email_verified":"true","aud":"x"}`), &claims); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if !claims.EmailVerified || claims.Subject != "1" || claims.Audience[0] != "x" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func codeFrom(t *testing.T, callback string) string {
+	t.Helper()
+	_, query, _ := strings.Cut(callback, "?")
+	for _, param := range strings.Split(query, "&") {
+		if value, ok := strings.CutPrefix(param, "code="); ok {
+			return value
+		}
+	}
+	t.Fatalf("no code in callback %s", callback)
+	return ""
+}
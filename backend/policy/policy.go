@@ -0,0 +1,139 @@
+package policy
+
+import "backend/dao"
+
+// Permisos que se otorgan a los roles. Tienen la forma "recurso:acción".
+const (
+	// PermUsersRead permite ver y listar a cualquier usuario
+	PermUsersRead = "users:read"
+	// PermUsersWrite permite modificar o eliminar a cualquier usuario
+	PermUsersWrite = "users:write"
+	// PermRolesWrite permite asignar roles
+	PermRolesWrite = "roles:write"
+	// PermActivitiesWrite permite crear, modificar y eliminar actividades
+	PermActivitiesWrite = "activities:write"
+	// PermInscriptionsRead permite ver las inscripciones y listas de espera de cualquier usuario
+	PermInscriptionsRead = "inscriptions:read"
+	// PermInscriptionsWrite permite inscribir o dar de baja a cualquier usuario
+	PermInscriptionsWrite = "inscriptions:write"
+	// PermRostersRead permite ver los inscriptos de cualquier actividad
+	PermRostersRead = "rosters:read"
+	// PermRostersReadOwn permite ver los inscriptos de las actividades a cargo del usuario
+	PermRostersReadOwn = "rosters:read:own"
+	// PermAuditRead permite consultar el registro de auditoría
+	PermAuditRead = "audit:read"
+)
+
+// DefaultRoles son los roles que se crean al iniciar con sus permisos. Los
+// socios no tienen permisos extra: solo actúan sobre sus propios recursos.
+var DefaultRoles = map[string][]string{
+	dao.RolSocio:      {},
+	dao.RolInstructor: {PermRostersReadOwn},
+	dao.RolRecepcion:  {PermUsersRead, PermInscriptionsRead, PermInscriptionsWrite, PermRostersRead},
+	dao.RolAdmin: {
+		PermUsersRead, PermUsersWrite, PermRolesWrite, PermActivitiesWrite,
+		PermInscriptionsRead, PermInscriptionsWrite, PermRostersRead, PermAuditRead,
+	},
+}
+
+// Action es una operación sobre un recurso que requiere autorización
+type Action string
+
+const (
+	ListUsers  Action = "users:list"
+	ReadUser   Action = "users:read"
+	UpdateUser Action = "users:update"
+	DeleteUser Action = "users:delete"
+	// AssignRoles es cambiar los roles de un usuario
+	AssignRoles Action = "users:assign_roles"
+	// InviteUser es invitar a crear una cuenta con roles de staff o admin
+	InviteUser Action = "users:invite"
+	// UnlockUser es quitar el bloqueo de login de un usuario
+	UnlockUser Action = "users:unlock"
+	// ResetTwoFactor es quitar el segundo factor de un usuario que perdió el acceso
+	ResetTwoFactor Action = "users:reset_2fa"
+
+	WriteActivities Action = "activities:write"
+	// ReadRoster es ver los inscriptos de una actividad; el dueño es su instructor
+	ReadRoster Action = "activities:roster"
+
+	ReadInscription   Action = "inscriptions:read"
+	CreateInscription Action = "inscriptions:create"
+	CancelInscription Action = "inscriptions:cancel"
+
+	ReadWaitlist  Action = "waitlist:read"
+	LeaveWaitlist Action = "waitlist:leave"
+
+	// ReadAudit es consultar quién cambió qué
+	ReadAudit Action = "audit:read"
+)
+
+// Principal es el usuario autenticado que realiza la request
+type Principal struct {
+	UserID      int
+	Roles       []string
+	Permissions []string
+}
+
+// Has indica si el principal tiene el permiso
+func (p Principal) Has(permission string) bool {
+	for _, granted := range p.Permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// rule decide si el principal puede actuar sobre un recurso del usuario ownerID
+type rule func(p Principal, ownerID int) bool
+
+// ownerOr permite a cada usuario actuar sobre lo suyo y, con el permiso, sobre lo de todos
+func ownerOr(permission string) rule {
+	return func(p Principal, ownerID int) bool {
+		return (p.UserID != 0 && p.UserID == ownerID) || p.Has(permission)
+	}
+}
+
+// only permite la acción solo a quienes tienen el permiso
+func only(permission string) rule {
+	return func(p Principal, _ int) bool {
+		return p.Has(permission)
+	}
+}
+
+// rules es la política completa: cualquier acción que no figure se deniega
+var rules = map[Action]rule{
+	ListUsers:      only(PermUsersRead),
+	ReadUser:       ownerOr(PermUsersRead),
+	UpdateUser:     ownerOr(PermUsersWrite),
+	DeleteUser:     ownerOr(PermUsersWrite),
+	AssignRoles:    only(PermRolesWrite),
+	InviteUser:     only(PermRolesWrite),
+	UnlockUser:     only(PermUsersWrite),
+	ResetTwoFactor: only(PermUsersWrite),
+
+	WriteActivities: only(PermActivitiesWrite),
+	ReadRoster: func(p Principal, instructorID int) bool {
+		return p.Has(PermRostersRead) || (p.Has(PermRostersReadOwn) && p.UserID != 0 && p.UserID == instructorID)
+	},
+
+	ReadInscription:   ownerOr(PermInscriptionsRead),
+	CreateInscription: ownerOr(PermInscriptionsWrite),
+	CancelInscription: ownerOr(PermInscriptionsWrite),
+
+	ReadWaitlist:  ownerOr(PermInscriptionsRead),
+	LeaveWaitlist: ownerOr(PermInscriptionsWrite),
+
+	ReadAudit: only(PermAuditRead),
+}
+
+// Can indica si el principal puede realizar la acción sobre un recurso cuyo
+// dueño es el usuario ownerID
+func Can(p Principal, action Action, ownerID int) bool {
+	allowed, ok := rules[action]
+	if !ok {
+		return false
+	}
+	return allowed(p, ownerID)
+}
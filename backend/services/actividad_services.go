@@ -6,200 +6,159 @@ import (
 	"backend/domain"
 	"errors"
 	"fmt"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
 )
 
+// ActivityService administra las actividades. Los instructores se validan
+// contra el repositorio de usuarios.
+type ActivityService struct {
+	activities ActivityRepository
+	users      UserRepository
+}
+
+func NewActivityService(activities ActivityRepository, users UserRepository) *ActivityService {
+	return &ActivityService{activities: activities, users: users}
+}
+
 // GetActivityByID obtiene una actividad por ID y la convierte al formato domain
-func GetActivityByID(id int) (domain.Activity, error) {
-	activityDao, err := clients.GetActivityByID(id)
+func (s *ActivityService) GetActivityByID(id int) (domain.Activity, error) {
+	activityDao, err := s.activities.GetActivityByID(id)
 	if err != nil {
 		return domain.Activity{}, fmt.Errorf("activity not found with id %d: %w", id, err)
 	}
 
-	return domain.Activity{
-		ID:          activityDao.ID_actividad,
-		Name:        activityDao.Nombre,
-		Profesor:    activityDao.Profesor,
-		Categoria:   activityDao.Categoria,
-		Cupos:       activityDao.Cupos,
-		Description: activityDao.Descripcion,
-		Dia:         activityDao.Dia,
-		HoraInicio:  activityDao.Hora_inicio,
-		HoraFin:     activityDao.Hora_fin,
-	}, nil
+	return toActivity(activityDao), nil
 }
 
 // GetActivities obtiene todas las actividades
-func GetActivities() ([]domain.Activity, error) {
-	activitiesDao, err := clients.GetActivities()
+func (s *ActivityService) GetActivities() ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.GetActivities()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
-
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
-		})
+		activities = append(activities, toActivity(activityDao))
 	}
 
 	return activities, nil
 }
 
-// InsertActivity crea una nueva actividad
-func InsertActivity(activity domain.Activity) (domain.Activity, error) {
+// InsertActivity crea una nueva actividad. Si algún campo es inválido devuelve
+// un *ValidationError con todos los campos a corregir.
+func (s *ActivityService) InsertActivity(activity domain.Activity, actor domain.Actor) (domain.Activity, error) {
 	// Validaciones básicas
+	invalid := &ValidationError{}
 	if activity.Name == "" {
-		return domain.Activity{}, errors.New("activity name cannot be empty")
+		invalid.add("name", "is required")
 	}
 	if activity.Profesor == "" {
-		return domain.Activity{}, errors.New("profesor cannot be empty")
+		invalid.add("profesor", "is required")
 	}
 	if activity.Categoria == "" {
-		return domain.Activity{}, errors.New("categoria cannot be empty")
+		invalid.add("categoria", "is required")
 	}
 	if activity.Description == "" {
-		return domain.Activity{}, errors.New("description cannot be empty")
+		invalid.add("description", "is required")
 	}
-	if activity.Dia <= 0 && activity.Dia > 7 {
-		return domain.Activity{}, errors.New("dia cannot be empty or less than 1")
+	if activity.Capacidad <= 0 {
+		invalid.add("capacidad", "must be greater than 0")
 	}
-	if activity.Cupos <= 0 {
-		return domain.Activity{}, errors.New("cupos must be greater than 0")
+	horarios := toActivitySlots(timetableOf(activity), invalid)
+	if activity.InstructorId != nil {
+		if _, err := s.users.GetUserByID(*activity.InstructorId); err != nil {
+			invalid.add("instructor_id", "instructor not found")
+		}
 	}
-	if activity.HoraInicio == "" || activity.HoraFin == "" {
-		return domain.Activity{}, errors.New("hora_inicio and hora_fin are required")
+	if err := invalid.orNil(); err != nil {
+		return domain.Activity{}, err
 	}
 
 	// Convertir domain.Activity a dao.Activity
 	activityDao := dao.Activity{
-		Nombre:      activity.Name,
-		Profesor:    activity.Profesor,
-		Cupos:       activity.Cupos,
-		Categoria:   activity.Categoria,
-		Descripcion: activity.Description,
-		Dia:         activity.Dia,
-		Hora_inicio: activity.HoraInicio,
-		Hora_fin:    activity.HoraFin,
+		Nombre:        activity.Name,
+		Profesor:      activity.Profesor,
+		Capacidad:     activity.Capacidad,
+		Categoria:     activity.Categoria,
+		Descripcion:   activity.Description,
+		Horarios:      horarios,
+		ID_instructor: activity.InstructorId,
 	}
 
 	// Guardar en la base de datos
-	createdActivity, err := clients.InsertActivity(activityDao)
+	createdActivity, err := s.activities.InsertActivity(activityDao, auditFrom(actor))
 	if err != nil {
 		return domain.Activity{}, fmt.Errorf("failed to create activity: %w", err)
 	}
 
-	// Convertir de vuelta a domain.Activity
-
-	return domain.Activity{
-		ID:          createdActivity.ID_actividad,
-		Name:        createdActivity.Nombre,
-		Profesor:    createdActivity.Profesor,
-		Categoria:   createdActivity.Categoria,
-		Cupos:       createdActivity.Cupos,
-		Description: createdActivity.Descripcion,
-		Dia:         createdActivity.Dia,
-		HoraInicio:  createdActivity.Hora_inicio,
-		HoraFin:     createdActivity.Hora_fin,
-	}, nil
+	// Convertir de vuelta a domain.Activity (sin inscripciones todavía, todos los cupos están libres)
+	created := toActivity(createdActivity)
+	created.CuposDisponibles = createdActivity.Capacidad
+	return created, nil
 }
 
 // GetActivitiesByCategory obtiene actividades por categoría
-func GetActivitiesByCategory(categoria string) ([]domain.Activity, error) {
-	activitiesDao, err := clients.GetActivitiesByCategory(categoria)
+func (s *ActivityService) GetActivitiesByCategory(categoria string) ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.GetActivitiesByCategory(categoria)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities by category: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
-
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
-		})
+		activities = append(activities, toActivity(activityDao))
 	}
 
 	return activities, nil
 }
 
 // GetActivitiesByProfesor obtiene actividades por profesor
-func GetActivitiesByProfesor(profesor string) ([]domain.Activity, error) {
-	activitiesDao, err := clients.GetActivitiesByProfesor(profesor)
+func (s *ActivityService) GetActivitiesByProfesor(profesor string) ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.GetActivitiesByProfesor(profesor)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities by profesor: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
-
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
-		})
+		activities = append(activities, toActivity(activityDao))
 	}
 
 	return activities, nil
 }
 
 // GetActivitiesByDay obtiene actividades por día
-func GetActivitiesByDay(dia int) ([]domain.Activity, error) {
-	activitiesDao, err := clients.GetActivitiesByDay(strconv.Itoa(dia))
+func (s *ActivityService) GetActivitiesByDay(dia int) ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.GetActivitiesByDay(dia)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities by day: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
-
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
-		})
+		activities = append(activities, toActivity(activityDao))
 	}
 
 	return activities, nil
 }
 
-// UpdateActivity actualiza una actividad existente
-func UpdateActivity(activity domain.Activity) error {
+// UpdateActivity actualiza una actividad existente y, si tiene recurrencia,
+// regenera sus sesiones futuras. Los campos vacíos no se modifican; si alguno
+// de los enviados es inválido devuelve un *ValidationError.
+func (s *ActivityService) UpdateActivity(activity domain.Activity, actor domain.Actor) error {
 	// Obtener la actividad actual
-	currentActivity, err := clients.GetActivityByID(activity.ID)
+	currentActivity, err := s.activities.GetActivityByID(activity.ID)
 	if err != nil {
 		return fmt.Errorf("activity not found: %w", err)
 	}
 
 	// Actualizar los campos
+	invalid := &ValidationError{}
 	if activity.Name != "" {
 		currentActivity.Nombre = activity.Name
 	}
@@ -209,86 +168,314 @@ func UpdateActivity(activity domain.Activity) error {
 	if activity.Categoria != "" {
 		currentActivity.Categoria = activity.Categoria
 	}
-	if activity.Cupos > 0 {
-		currentActivity.Cupos = activity.Cupos
+	if activity.Capacidad < 0 {
+		invalid.add("capacidad", "must be greater than 0")
+	} else if activity.Capacidad > 0 {
+		currentActivity.Capacidad = activity.Capacidad
 	}
 	if activity.Description != "" {
 		currentActivity.Descripcion = activity.Description
 	}
-	if activity.Dia > 0 {
-		currentActivity.Dia = activity.Dia
-	}
-	if activity.HoraInicio != "" {
-		currentActivity.Hora_inicio = activity.HoraInicio
-	}
-	if activity.HoraFin != "" {
-		currentActivity.Hora_fin = activity.HoraFin
+	if len(activity.Horarios) > 0 {
+		currentActivity.Horarios = toActivitySlots(timetable{horarios: activity.Horarios}, invalid)
+	} else if activity.Dia != 0 || activity.HoraInicio != "" || activity.HoraFin != "" {
+		// dia, hora_inicio y hora_fin solo alcanzan para las actividades de un solo día
+		if len(currentActivity.Horarios) == 1 {
+			horario := toHorario(currentActivity.Horarios[0])
+			if activity.Dia != 0 {
+				horario.Dia = activity.Dia
+			}
+			if activity.HoraInicio != "" {
+				horario.HoraInicio = activity.HoraInicio
+			}
+			if activity.HoraFin != "" {
+				horario.HoraFin = activity.HoraFin
+			}
+			currentActivity.Horarios = toActivitySlots(timetable{horarios: []domain.Horario{horario}, single: true}, invalid)
+		} else {
+			invalid.add("horarios", "activity has several horarios, send all of them in horarios")
+		}
+	}
+	if activity.InstructorId != nil {
+		if _, err := s.users.GetUserByID(*activity.InstructorId); err != nil {
+			invalid.add("instructor_id", "instructor not found")
+		}
+		currentActivity.ID_instructor = activity.InstructorId
+	}
+	if err := invalid.orNil(); err != nil {
+		return err
+	}
+
+	// Si cambió el día o el horario, las sesiones futuras se mueven con él en
+	// la misma transacción
+	sessions, from, to, err := s.upcomingSessions(currentActivity)
+	if err != nil {
+		return fmt.Errorf("failed to update sessions: %w", err)
 	}
 
-	return clients.UpdateActivity(currentActivity)
+	if err := s.activities.UpdateActivity(currentActivity, sessions, from, to, auditFrom(actor)); err != nil {
+		if errors.Is(err, clients.ErrCapacityBelowInscriptions) {
+			return err
+		}
+		return fmt.Errorf("failed to update activity: %w", err)
+	}
+	return nil
 }
 
 // DeleteActivity elimina una actividad
-func DeleteActivity(id int) error {
-	return clients.DeleteActivity(id)
+func (s *ActivityService) DeleteActivity(id int, actor domain.Actor) error {
+	err := s.activities.DeleteActivity(id, auditFrom(actor))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("activity not found")
+	}
+	return err
 }
 
 // GetActivitiesWithAvailableSlots obtiene actividades con cupos disponibles
-func GetActivitiesWithAvailableSlots() ([]domain.Activity, error) {
-	activitiesDao, err := clients.GetActivitiesWithAvailableSlots()
+func (s *ActivityService) GetActivitiesWithAvailableSlots() ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.GetActivitiesWithAvailableSlots()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get activities with available slots: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
-
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
-		})
+		activities = append(activities, toActivity(activityDao))
 	}
 
 	return activities, nil
 }
 
-// UpdateActivitySlots actualiza los cupos de una actividad
-func UpdateActivitySlots(id int, newSlots int) error {
-	if newSlots < 0 {
-		return errors.New("slots cannot be negative")
+// UpdateActivitySlots actualiza la capacidad de una actividad. Los cupos
+// disponibles se recalculan a partir de las inscripciones activas.
+func (s *ActivityService) UpdateActivitySlots(id int, capacidad int, actor domain.Actor) error {
+	if capacidad <= 0 {
+		return errors.New("capacidad must be greater than 0")
 	}
-	return clients.UpdateActivitySlots(id, newSlots)
+	return s.activities.UpdateActivityCapacity(id, capacidad, auditFrom(actor))
 }
 
 // SearchActivitiesByName busca actividades por nombre
-func SearchActivitiesByName(name string) ([]domain.Activity, error) {
-	activitiesDao, err := clients.SearchActivitiesByName(name)
+func (s *ActivityService) SearchActivitiesByName(name string) ([]domain.Activity, error) {
+	activitiesDao, err := s.activities.SearchActivitiesByName(name)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search activities by name: %w", err)
 	}
 
 	var activities []domain.Activity
 	for _, activityDao := range activitiesDao {
+		activities = append(activities, toActivity(activityDao))
+	}
+
+	return activities, nil
+}
+
+// toActivity convierte una actividad al formato domain. Dia, HoraInicio y
+// HoraFin repiten el primer horario para los clientes que esperan un solo día.
+func toActivity(activity dao.Activity) domain.Activity {
+	result := domain.Activity{
+		ID:               activity.ID_actividad,
+		Name:             activity.Nombre,
+		Profesor:         activity.Profesor,
+		Categoria:        activity.Categoria,
+		Capacidad:        activity.Capacidad,
+		CuposDisponibles: activity.CuposDisponibles,
+		Description:      activity.Descripcion,
+		Horarios:         []domain.Horario{},
+		InstructorId:     activity.ID_instructor,
+	}
+	for _, slot := range activity.Horarios {
+		result.Horarios = append(result.Horarios, toHorario(slot))
+	}
+	if len(result.Horarios) > 0 {
+		result.Dia = result.Horarios[0].Dia
+		result.HoraInicio = result.Horarios[0].HoraInicio
+		result.HoraFin = result.Horarios[0].HoraFin
+	}
+	return result
+}
 
-		activities = append(activities, domain.Activity{
-			ID:          activityDao.ID_actividad,
-			Name:        activityDao.Nombre,
-			Profesor:    activityDao.Profesor,
-			Categoria:   activityDao.Categoria,
-			Cupos:       activityDao.Cupos,
-			Description: activityDao.Descripcion,
-			Dia:         activityDao.Dia,
-			HoraInicio:  activityDao.Hora_inicio,
-			HoraFin:     activityDao.Hora_fin,
+func toHorario(slot dao.ActivitySlot) domain.Horario {
+	return domain.Horario{
+		Dia:        slot.Dia,
+		HoraInicio: slot.Hora_inicio,
+		HoraFin:    slot.Hora_fin,
+	}
+}
+
+// minClassDuration y maxClassDuration limitan cuánto puede durar cada clase
+const (
+	minClassDuration = 15 * time.Minute
+	maxClassDuration = 4 * time.Hour
+)
+
+// ValidationError indica que el pedido tiene campos inválidos. Fields lista
+// cada campo con el motivo, para mostrarlos junto al campo en el formulario.
+type ValidationError struct {
+	Fields []domain.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		messages = append(messages, field.Field+" "+field.Message)
+	}
+	return "invalid fields: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, message string) {
+	e.Fields = append(e.Fields, domain.FieldError{Field: field, Message: message})
+}
+
+// orNil devuelve el error solo si algún campo resultó inválido
+func (e *ValidationError) orNil() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// timetable son los horarios pedidos para una actividad. single indica que
+// vinieron en dia, hora_inicio y hora_fin en lugar de horarios, y así se
+// nombran los campos en los errores.
+type timetable struct {
+	horarios []domain.Horario
+	single   bool
+}
+
+// field devuelve el nombre en el pedido de un campo del horario i
+func (t timetable) field(i int, name string) string {
+	if t.single {
+		return name
+	}
+	return fmt.Sprintf("horarios[%d].%s", i, name)
+}
+
+// timetableOf devuelve los horarios pedidos para la actividad: los de
+// Horarios o, si no vienen, el único día de dia, hora_inicio y hora_fin
+func timetableOf(activity domain.Activity) timetable {
+	if len(activity.Horarios) > 0 {
+		return timetable{horarios: activity.Horarios}
+	}
+	if activity.Dia == 0 && activity.HoraInicio == "" && activity.HoraFin == "" {
+		return timetable{}
+	}
+	return timetable{
+		horarios: []domain.Horario{{Dia: activity.Dia, HoraInicio: activity.HoraInicio, HoraFin: activity.HoraFin}},
+		single:   true,
+	}
+}
+
+// toActivitySlots valida los horarios de una actividad y los convierte al
+// formato dao, ordenados por día y hora. Tiene que haber al menos uno, cada
+// uno en un día de 1 a 7, con horas "HH:MM" y una duración entre
+// minClassDuration y maxClassDuration, y dos horarios del mismo día no pueden
+// superponerse. Los errores se agregan a invalid.
+func toActivitySlots(requested timetable, invalid *ValidationError) []dao.ActivitySlot {
+	if len(requested.horarios) == 0 {
+		invalid.add("horarios", "at least one horario is required")
+		return nil
+	}
+
+	type parsedSlot struct {
+		index      int
+		dia        int
+		start, end timeOfDay
+	}
+	var parsed []parsedSlot
+	slots := make([]dao.ActivitySlot, 0, len(requested.horarios))
+	for i, horario := range requested.horarios {
+		valid := true
+		if horario.Dia < 1 || horario.Dia > 7 {
+			invalid.add(requested.field(i, "dia"), "must be between 1 and 7")
+			valid = false
+		}
+		start, ok := parseTimeField(horario.HoraInicio, requested.field(i, "hora_inicio"), invalid)
+		valid = valid && ok
+		end, ok := parseTimeField(horario.HoraFin, requested.field(i, "hora_fin"), invalid)
+		valid = valid && ok
+		if !valid {
+			continue
+		}
+
+		switch duration := end.sub(start); {
+		case duration <= 0:
+			invalid.add(requested.field(i, "hora_fin"), "must be after hora_inicio")
+			continue
+		case duration < minClassDuration:
+			invalid.add(requested.field(i, "hora_fin"), fmt.Sprintf("class must last at least %d minutes", int(minClassDuration.Minutes())))
+			continue
+		case duration > maxClassDuration:
+			invalid.add(requested.field(i, "hora_fin"), fmt.Sprintf("class cannot last more than %d hours", int(maxClassDuration.Hours())))
+			continue
+		}
+
+		for _, other := range parsed {
+			if other.dia == horario.Dia && start < other.end && other.start < end {
+				invalid.add(requested.field(i, "hora_inicio"), "overlaps "+requested.field(other.index, "hora_inicio"))
+				break
+			}
+		}
+		parsed = append(parsed, parsedSlot{index: i, dia: horario.Dia, start: start, end: end})
+		slots = append(slots, dao.ActivitySlot{
+			Dia:         horario.Dia,
+			Hora_inicio: start.String(),
+			Hora_fin:    end.String(),
 		})
 	}
+	slices.SortStableFunc(slots, func(a, b dao.ActivitySlot) int {
+		if a.Dia != b.Dia {
+			return a.Dia - b.Dia
+		}
+		return strings.Compare(a.Hora_inicio, b.Hora_inicio)
+	})
+	return slots
+}
 
-	return activities, nil
+// parseTimeField interpreta la hora de un campo del pedido y agrega el error
+// a invalid si falta o no tiene el formato "HH:MM"
+func parseTimeField(value, field string, invalid *ValidationError) (timeOfDay, bool) {
+	if value == "" {
+		invalid.add(field, "is required")
+		return 0, false
+	}
+	t, err := parseTimeOfDay(value)
+	if err != nil {
+		invalid.add(field, "must be a time in HH:MM format")
+		return 0, false
+	}
+	return t, true
+}
+
+// timeOfDay es una hora del día, en minutos desde la medianoche
+type timeOfDay int
+
+// parseTimeOfDay interpreta una hora en formato "HH:MM" de 24 horas, con los
+// dos dígitos: "08:00" es válida, "8:00", "8" o "25:99" no
+func parseTimeOfDay(value string) (timeOfDay, error) {
+	if len(value) != len("15:04") {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return timeOfDay(t.Hour()*60 + t.Minute()), nil
+}
+
+func (t timeOfDay) hour() int {
+	return int(t) / 60
+}
+
+func (t timeOfDay) minute() int {
+	return int(t) % 60
+}
+
+// sub devuelve cuánto tiempo pasa desde u hasta t en el mismo día
+func (t timeOfDay) sub(u timeOfDay) time.Duration {
+	return time.Duration(t-u) * time.Minute
+}
+
+func (t timeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.hour(), t.minute())
 }
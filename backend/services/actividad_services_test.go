@@ -0,0 +1,102 @@
+package services
+
+import (
+	"backend/domain"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"08:00", "08:00", true},
+		{"23:59", "23:59", true},
+		{"00:00", "00:00", true},
+		{"8", "", false},
+		{"8:00", "", false},
+		{"25:99", "", false},
+		{"24:00", "", false},
+		{"08:00:00", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseTimeOfDay(tt.value)
+			if (err == nil) != tt.ok || (tt.ok && got.String() != tt.want) {
+				t.Errorf("parseTimeOfDay(%q) = %v, %v; want %v, ok %v", tt.value, got, err, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+// fieldsOf devuelve los campos de un *ValidationError, o nil si err es de otro tipo
+func fieldsOf(err error) []string {
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		return nil
+	}
+	var fields []string
+	for _, field := range invalid.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestInsertActivityValidation(t *testing.T) {
+	activities, _, _, users := newMemoryServices(t)
+	actor := domain.Actor{UserID: users[0].ID}
+	valid := func() domain.Activity {
+		return domain.Activity{Name: "Box", Profesor: "Tito", Categoria: "Fuerza", Description: "Box", Capacidad: 5}
+	}
+	slot := func(dia int, inicio, fin string) []domain.Horario {
+		return []domain.Horario{{Dia: dia, HoraInicio: inicio, HoraFin: fin}}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*domain.Activity)
+		fields []string
+	}{
+		{"missing fields", func(a *domain.Activity) { *a = domain.Activity{} }, []string{"name", "profesor", "categoria", "description", "capacidad", "horarios"}},
+		{"day out of range", func(a *domain.Activity) { a.Dia, a.HoraInicio, a.HoraFin = 8, "10:00", "11:00" }, []string{"dia"}},
+		{"negative day", func(a *domain.Activity) { a.Dia, a.HoraInicio, a.HoraFin = -1, "10:00", "11:00" }, []string{"dia"}},
+		{"not HH:MM", func(a *domain.Activity) { a.Dia, a.HoraInicio, a.HoraFin = 1, "8", "25:99" }, []string{"hora_inicio", "hora_fin"}},
+		{"end before start", func(a *domain.Activity) { a.Horarios = slot(1, "11:00", "10:00") }, []string{"horarios[0].hora_fin"}},
+		{"too short", func(a *domain.Activity) { a.Horarios = slot(1, "10:00", "10:10") }, []string{"horarios[0].hora_fin"}},
+		{"too long", func(a *domain.Activity) { a.Horarios = slot(1, "08:00", "12:30") }, []string{"horarios[0].hora_fin"}},
+		{"overlapping slots", func(a *domain.Activity) {
+			a.Horarios = append(slot(3, "10:00", "11:00"), domain.Horario{Dia: 3, HoraInicio: "10:30", HoraFin: "11:30"})
+		}, []string{"horarios[1].hora_inicio"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activity := valid()
+			tt.modify(&activity)
+			_, err := activities.InsertActivity(activity, actor)
+			if got := fieldsOf(err); !slices.Equal(got, tt.fields) {
+				t.Errorf("InsertActivity() invalid fields = %v (%v), want %v", got, err, tt.fields)
+			}
+		})
+	}
+
+	// Los mismos límites valen al modificar
+	activity := valid()
+	activity.Horarios = append(slot(1, "10:00", "11:00"), domain.Horario{Dia: 3, HoraInicio: "10:00", HoraFin: "11:00"})
+	created, err := activities.InsertActivity(activity, actor)
+	if err != nil {
+		t.Fatalf("InsertActivity() error = %v", err)
+	}
+	if got := fieldsOf(activities.UpdateActivity(domain.Activity{ID: created.ID, Horarios: slot(0, "10:00", "11:00")}, actor)); !slices.Equal(got, []string{"horarios[0].dia"}) {
+		t.Errorf("UpdateActivity() with day 0 invalid fields = %v", got)
+	}
+	if got := fieldsOf(activities.UpdateActivity(domain.Activity{ID: created.ID, HoraFin: "12:00"}, actor)); !slices.Equal(got, []string{"horarios"}) {
+		t.Errorf("UpdateActivity() with hora_fin on a multi-day activity invalid fields = %v", got)
+	}
+	if got := fieldsOf(activities.UpdateActivity(domain.Activity{ID: created.ID, Capacidad: -1}, actor)); !slices.Equal(got, []string{"capacidad"}) {
+		t.Errorf("UpdateActivity() with negative capacidad invalid fields = %v", got)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// defaultAuditPageSize es el tamaño de página de GET /audit si no se indica
+	defaultAuditPageSize = 50
+	// maxAuditPageSize evita que una sola consulta traiga toda la tabla
+	maxAuditPageSize = 200
+)
+
+// auditFrom arma el evento de auditoría base con los datos del actor. Los
+// clients completan la acción, la entidad y el diff dentro de la transacción.
+func auditFrom(actor domain.Actor) dao.AuditEvent {
+	event := dao.AuditEvent{IP: actor.IP, RequestID: actor.RequestID}
+	if actor.UserID != 0 {
+		userID := actor.UserID
+		event.ID_actor = &userID
+	}
+	return event
+}
+
+// GetAuditEvents devuelve una página de eventos de auditoría, del más nuevo al más viejo
+func GetAuditEvents(query domain.AuditQuery) (domain.AuditPage, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = defaultAuditPageSize
+	}
+	if query.PageSize > maxAuditPageSize {
+		query.PageSize = maxAuditPageSize
+	}
+
+	events, total, err := clients.GetAuditEvents(clients.AuditFilter{
+		ActorID:    query.ActorID,
+		Accion:     query.Action,
+		Entidad:    query.Entity,
+		ID_entidad: query.EntityID,
+		RequestID:  query.RequestID,
+		Desde:      query.From,
+		Hasta:      query.To,
+		Page:       query.Page,
+		PageSize:   query.PageSize,
+	})
+	if err != nil {
+		return domain.AuditPage{}, fmt.Errorf("failed to get audit events: %w", err)
+	}
+
+	page := domain.AuditPage{
+		Events:   make([]domain.AuditEvent, 0, len(events)),
+		Total:    total,
+		Page:     query.Page,
+		PageSize: query.PageSize,
+	}
+	for _, event := range events {
+		page.Events = append(page.Events, domain.AuditEvent{
+			ID:         event.ID_evento,
+			ActorID:    event.ID_actor,
+			Action:     event.Accion,
+			EntityType: event.Entidad,
+			EntityID:   event.ID_entidad,
+			Before:     auditDiff(event.Antes),
+			After:      auditDiff(event.Despues),
+			IP:         event.IP,
+			RequestID:  event.RequestID,
+			CreatedAt:  event.CreatedAt,
+		})
+	}
+	return page, nil
+}
+
+// auditDiff devuelve el JSON guardado, o null si el lado del cambio no existe
+func auditDiff(stored string) json.RawMessage {
+	if stored == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(stored)
+}
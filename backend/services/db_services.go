@@ -1,21 +0,0 @@
-package services
-
-import (
-	"fmt"
-
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
-)
-
-var DB *gorm.DB
-
-func InitializeDB() error {
-	var err error
-	DB, err = gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
-	if err != nil {
-		return fmt.Errorf("failed to connect database: %w", err)
-	}
-	// TODO: AutoMigrate your models here, e.g.:
-	// DB.AutoMigrate(&YourModel{})
-	return nil
-}
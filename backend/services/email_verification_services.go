@@ -0,0 +1,132 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/mailer"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// emailVerificationDuration es cuánto vale el link de verificación
+	emailVerificationDuration = 24 * time.Hour
+	// emailVerificationAudience distingue estos tokens de los access tokens,
+	// que se firman con las mismas claves
+	emailVerificationAudience = "email-verification"
+)
+
+// emailVerificationURL es la página del frontend que recibe el token
+var emailVerificationURL = "http://localhost:3000/verify-email"
+
+// SetEmailVerificationURL cambia la página a la que apunta el link de verificación
+func SetEmailVerificationURL(verificationURL string) {
+	emailVerificationURL = verificationURL
+}
+
+// emailVerificationClaims son los claims del link de verificación. Incluye el
+// email para que el link deje de valer si el usuario lo cambia.
+type emailVerificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// SendEmailVerification reenvía el link de verificación al email del usuario
+func SendEmailVerification(userID int) error {
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if user.Email == nil {
+		return errors.New("user has no email")
+	}
+	if user.EmailVerificadoEn != nil {
+		return errors.New("email already verified")
+	}
+	return sendEmailVerification(user)
+}
+
+// VerifyEmail confirma el email del usuario con el token del link. No se guarda
+// nada al enviarlo: el token está firmado con las claves de los JWT.
+func VerifyEmail(token string, actor domain.Actor) error {
+	keys, err := utils.CurrentKeySet()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	claims := &emailVerificationClaims{}
+	parsed, err := jwt.ParseWithClaims(token, claims, keys.Keyfunc, jwt.WithAudience(emailVerificationAudience), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid {
+		return clients.ErrInvalidVerificationToken
+	}
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return clients.ErrInvalidVerificationToken
+	}
+
+	// Quien tiene el link actúa como el usuario
+	actor.UserID = userID
+	if err := clients.MarkEmailVerified(userID, claims.Email, time.Now(), auditFrom(actor)); err != nil {
+		return err
+	}
+	log.WithField("user_id", userID).Info("Email verified")
+	return nil
+}
+
+// sendEmailVerification firma un link de verificación para el email actual del usuario y lo envía
+func sendEmailVerification(user dao.User) error {
+	now := time.Now()
+	token, err := signEmailVerification(user, now)
+	if err != nil {
+		return err
+	}
+
+	link := emailVerificationURL + "?token=" + url.QueryEscape(token)
+	return mailSender.Send(mailer.Message{
+		To:      *user.Email,
+		Subject: "Confirmá tu email",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Para confirmar el email de tu cuenta %s y poder inscribirte a las actividades,\n"+
+			"entrá a este link dentro de las próximas 24 horas:\n\n%s\n\n"+
+			"Si no creaste una cuenta en el gimnasio, ignorá este email.\n",
+			user.Name, user.Username, link),
+	})
+}
+
+func signEmailVerification(user dao.User, now time.Time) (string, error) {
+	keys, err := utils.CurrentKeySet()
+	if err != nil {
+		return "", fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	token, err := keys.Sign(&emailVerificationClaims{
+		Email: *user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "backend",
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(emailVerificationDuration)),
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verification token: %w", err)
+	}
+	return token, nil
+}
+
+// requireVerifiedEmail impide inscribirse a quien no confirmó su email
+func requireVerifiedEmail(user dao.User) error {
+	if user.Email == nil || user.EmailVerificadoEn == nil {
+		return errors.New("email not verified")
+	}
+	return nil
+}
@@ -5,163 +5,131 @@ import (
 	"backend/dao"
 	"backend/domain"
 	"errors"
+	"time"
+
+	"gorm.io/gorm"
 )
 
-func GetInscriptionByID(id int) (*domain.Inscripcion, error) {
-	inscripcion, err := clients.GetInscriptionByID(id)
+// InscriptionService administra las inscripciones y las listas de espera
+type InscriptionService struct {
+	inscriptions InscriptionRepository
+	activities   ActivityRepository
+	users        UserRepository
+}
+
+func NewInscriptionService(inscriptions InscriptionRepository, activities ActivityRepository, users UserRepository) *InscriptionService {
+	return &InscriptionService{inscriptions: inscriptions, activities: activities, users: users}
+}
+
+func (s *InscriptionService) GetInscriptionByID(id int) (*domain.Inscripcion, error) {
+	inscripcion, err := s.inscriptions.GetInscriptionByID(id)
 	if err != nil {
 		return nil, err
 	}
 
 	// Cargar las relaciones (Usuario y Actividad)
-	user, err := clients.GetUserByID(inscripcion.ID_usuario)
+	user, err := s.users.GetUserByID(inscripcion.ID_usuario)
 	if err != nil {
 		return nil, err
 	}
 
-	activity, err := clients.GetActivityByID(inscripcion.ID_actividad)
+	activity, err := s.activities.GetActivityByID(inscripcion.ID_actividad)
 	if err != nil {
 		return nil, err
 	}
 
-	return &domain.Inscripcion{
-		Id:          inscripcion.ID_inscripcion,
-		UsuarioId:   inscripcion.ID_usuario,
-		ActividadId: inscripcion.ID_actividad,
-		Usuario: domain.User{
-			ID:       user.ID,
-			Username: user.Username,
-			IsAdmin:  user.IsAdmin,
-		},
-		Actividad: domain.Activity{
-			ID:          activity.ID_actividad,
-			Name:        activity.Nombre,
-			Profesor:    activity.Profesor,
-			Categoria:   activity.Categoria,
-			Cupos:       activity.Cupos,
-			Description: activity.Descripcion,
-			Dia:         activity.Dia,
-			HoraInicio:  activity.Hora_inicio,
-			HoraFin:     activity.Hora_fin,
-		},
-	}, nil
+	history, err := s.inscriptions.GetInscriptionHistory(inscripcion.ID_inscripcion)
+	if err != nil {
+		return nil, err
+	}
+
+	if inscripcion.ID_sesion != nil {
+		session, err := s.activities.GetSessionByID(*inscripcion.ID_sesion)
+		if err != nil {
+			return nil, err
+		}
+		inscripcion.Sesion = &session
+	}
+
+	result := toInscripcion(inscripcion, user, activity)
+	result.Historial = toHistorialEstado(history)
+	return &result, nil
 }
 
-func CreateInscription(inscripcion domain.Inscripcion) (*domain.Inscripcion, error) {
+// CreateInscription inscribe a un usuario. Con SesionId reserva esa sesión (sin
+// ActividadId se toma la de la sesión); sin SesionId es la inscripción semanal,
+// que las actividades con recurrencia no admiten: se reservan por sesión.
+func (s *InscriptionService) CreateInscription(inscripcion domain.Inscripcion, actor domain.Actor) (*domain.Inscripcion, error) {
 	// Validar que el usuario existe
-	user, err := clients.GetUserByID(inscripcion.UsuarioId)
+	user, err := s.users.GetUserByID(inscripcion.UsuarioId)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
-
-	// Validar que la actividad existe
-	activity, err := clients.GetActivityByID(inscripcion.ActividadId)
-	if err != nil {
-		return nil, errors.New("activity not found")
+	if err := requireVerifiedEmail(user); err != nil {
+		return nil, err
 	}
 
-	// Validar que la actividad tiene cupos disponibles
-	if activity.Cupos <= 0 {
-		return nil, errors.New("activity has no available slots")
+	if inscripcion.SesionId != nil {
+		session, err := s.activities.GetSessionByID(*inscripcion.SesionId)
+		if err != nil {
+			return nil, errors.New("session not found")
+		}
+		if inscripcion.ActividadId == 0 {
+			inscripcion.ActividadId = session.ID_actividad
+		}
+		if session.ID_actividad != inscripcion.ActividadId {
+			return nil, errors.New("session not found")
+		}
 	}
 
-	// Verificar si el usuario ya está inscrito en esta actividad
-	existingInscription, err := clients.GetInscriptionByUserAndActivity(inscripcion.UsuarioId, inscripcion.ActividadId)
-	if err == nil && existingInscription.ID_inscripcion > 0 {
-		return nil, errors.New("user already inscribed in this activity")
+	// Validar que la actividad existe
+	if _, err := s.activities.GetActivityByID(inscripcion.ActividadId); err != nil {
+		return nil, errors.New("activity not found")
+	}
+	if inscripcion.SesionId == nil {
+		_, err := s.activities.GetSchedule(inscripcion.ActividadId)
+		if err == nil {
+			return nil, errors.New("session required")
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
 	}
 
-	// Crear la inscripción
+	// Crear la inscripción y descontar el cupo en una sola transacción
 	newInscription := dao.Inscription{
 		ID_usuario:   inscripcion.UsuarioId,
 		ID_actividad: inscripcion.ActividadId,
+		ID_sesion:    inscripcion.SesionId,
 	}
 
-	createdInscription, err := clients.CreateInscription(newInscription)
+	createdInscription, activity, err := s.inscriptions.EnrollUser(newInscription, auditFrom(actor))
 	if err != nil {
 		return nil, err
 	}
 
-	// Reducir los cupos de la actividad
-	newSlots := activity.Cupos - 1
-	err = clients.UpdateActivitySlots(activity.ID_actividad, newSlots)
-	if err != nil {
-		// Si falla la actualización de cupos, podrías considerar hacer rollback de la inscripción
-		// Por simplicidad, solo loggeamos el error
-		// log.Printf("Warning: Failed to update activity slots after inscription: %v", err)
-	}
-
 	// Retornar la inscripción completa con los datos relacionados
-	return &domain.Inscripcion{
-		Id:          createdInscription.ID_inscripcion,
-		UsuarioId:   createdInscription.ID_usuario,
-		ActividadId: createdInscription.ID_actividad,
-		Usuario: domain.User{
-			ID:       user.ID,
-			Username: user.Username,
-			IsAdmin:  user.IsAdmin,
-		},
-		Actividad: domain.Activity{
-			ID:          activity.ID_actividad,
-			Name:        activity.Nombre,
-			Profesor:    activity.Profesor,
-			Categoria:   activity.Categoria,
-			Cupos:       newSlots, // Cupos actualizados
-			Description: activity.Descripcion,
-			Dia:         activity.Dia,
-			HoraInicio:  activity.Hora_inicio,
-			HoraFin:     activity.Hora_fin,
-		},
-	}, nil
+	result := toInscripcion(createdInscription, user, activity)
+	return &result, nil
 }
 
-// Método adicional para obtener todas las inscripciones (opcional)
-func GetAllInscriptions() ([]domain.Inscripcion, error) {
-	inscriptions, err := clients.GetAllInscriptions()
-	if err != nil {
-		return nil, err
+// GetAllInscriptions obtiene las inscripciones de todos los usuarios,
+// opcionalmente filtradas por estado (activa, cancelada, completada)
+func (s *InscriptionService) GetAllInscriptions(estado string) ([]domain.Inscripcion, error) {
+	if estado != "" && !isValidEstado(estado) {
+		return nil, errors.New("invalid estado")
 	}
 
-	var result []domain.Inscripcion
-	for _, inscription := range inscriptions {
-		// Cargar usuario y actividad para cada inscripción
-		user, err := clients.GetUserByID(inscription.ID_usuario)
-		if err != nil {
-			continue // Skip this inscription if user not found
-		}
-
-		activity, err := clients.GetActivityByID(inscription.ID_actividad)
-		if err != nil {
-			continue // Skip this inscription if activity not found
-		}
-
-		result = append(result, domain.Inscripcion{
-			Id:          inscription.ID_inscripcion,
-			UsuarioId:   inscription.ID_usuario,
-			ActividadId: inscription.ID_actividad,
-			Usuario: domain.User{
-				ID:       user.ID,
-				Username: user.Username,
-				IsAdmin:  user.IsAdmin,
-			},
-			Actividad: domain.Activity{
-				ID:          activity.ID_actividad,
-				Name:        activity.Nombre,
-				Profesor:    activity.Profesor,
-				Categoria:   activity.Categoria,
-				Cupos:       activity.Cupos,
-				Description: activity.Descripcion,
-				Dia:         activity.Dia,
-				HoraInicio:  activity.Hora_inicio,
-				HoraFin:     activity.Hora_fin,
-			},
-		})
+	inscriptions, err := s.inscriptions.GetAllInscriptions(estado)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, nil
+	return toInscripciones(inscriptions), nil
 }
-func GetInscriptionByUserAndActivity(userID, activityID int) (*domain.Inscripcion, error) {
-	inscription, err := clients.GetInscriptionByUserAndActivity(userID, activityID)
+
+func (s *InscriptionService) GetInscriptionByUserAndActivity(userID, activityID int) (*domain.Inscripcion, error) {
+	inscription, err := s.inscriptions.GetInscriptionByUserAndActivity(userID, activityID)
 	if err != nil {
 		return nil, err
 	}
@@ -171,175 +139,242 @@ func GetInscriptionByUserAndActivity(userID, activityID int) (*domain.Inscripcio
 	}
 
 	// Cargar las relaciones (Usuario y Actividad)
-	user, err := clients.GetUserByID(inscription.ID_usuario)
+	user, err := s.users.GetUserByID(inscription.ID_usuario)
 	if err != nil {
 		return nil, err
 	}
 
-	activity, err := clients.GetActivityByID(inscription.ID_actividad)
+	activity, err := s.activities.GetActivityByID(inscription.ID_actividad)
 	if err != nil {
 		return nil, err
 	}
 
-	return &domain.Inscripcion{
-		Id:          inscription.ID_inscripcion,
-		UsuarioId:   inscription.ID_usuario,
-		ActividadId: inscription.ID_actividad,
-		Usuario: domain.User{
-			ID:       user.ID,
-			Username: user.Username,
-			IsAdmin:  user.IsAdmin,
-		},
-		Actividad: domain.Activity{
-			ID:          activity.ID_actividad,
-			Name:        activity.Nombre,
-			Profesor:    activity.Profesor,
-			Categoria:   activity.Categoria,
-			Cupos:       activity.Cupos,
-			Description: activity.Descripcion,
-			Dia:         activity.Dia,
-			HoraInicio:  activity.Hora_inicio,
-			HoraFin:     activity.Hora_fin,
-		},
-	}, nil
+	result := toInscripcion(inscription, user, activity)
+	return &result, nil
+}
+
+// GetInscriptionsByUserID obtiene el historial de inscripciones de un usuario,
+// opcionalmente filtrado por estado (activa, cancelada, completada)
+func (s *InscriptionService) GetInscriptionsByUserID(userID int, estado string) ([]domain.Inscripcion, error) {
+	if estado != "" && !isValidEstado(estado) {
+		return nil, errors.New("invalid estado")
+	}
+
+	inscriptions, err := s.inscriptions.GetInscriptionsByUserID(userID, estado)
+	if err != nil {
+		return nil, err
+	}
+
+	return toInscripciones(inscriptions), nil
 }
 
-func GetInscriptionsByUserID(userID int) ([]domain.Inscripcion, error) {
-	inscriptions, err := clients.GetInscriptionsByUserID(userID)
+// GetActivityRoster obtiene los inscriptos activos de una actividad
+func (s *InscriptionService) GetActivityRoster(activityID int) ([]domain.Inscripcion, error) {
+	activity, err := s.activities.GetActivityByID(activityID)
+	if err != nil {
+		return nil, errors.New("activity not found")
+	}
+
+	inscriptions, err := s.inscriptions.GetActiveInscriptionsByActivityID(activityID)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []domain.Inscripcion
+	result := []domain.Inscripcion{}
 	for _, inscription := range inscriptions {
-		// Cargar usuario y actividad para cada inscripción
-		user, err := clients.GetUserByID(inscription.ID_usuario)
-		if err != nil {
-			continue // Skip this inscription if user not found
-		}
-		activity, err := clients.GetActivityByID(inscription.ID_actividad)
-		if err != nil {
-			continue // Skip this inscription if activity not found
-		}
-		result = append(result, domain.Inscripcion{
-			Id:          inscription.ID_inscripcion,
-			UsuarioId:   inscription.ID_usuario,
-			ActividadId: inscription.ID_actividad,
-			Usuario: domain.User{
-				ID:       user.ID,
-				Username: user.Username,
-				IsAdmin:  user.IsAdmin,
-			},
-			Actividad: domain.Activity{
-				ID:          activity.ID_actividad,
-				Name:        activity.Nombre,
-				Profesor:    activity.Profesor,
-				Categoria:   activity.Categoria,
-				Cupos:       activity.Cupos,
-				Description: activity.Descripcion,
-				Dia:         activity.Dia,
-				HoraInicio:  activity.Hora_inicio,
-				HoraFin:     activity.Hora_fin,
-			},
-		})
+		result = append(result, toInscripcion(inscription, inscription.Usuario, activity))
 	}
 	return result, nil
 }
 
-func GetActivitiesByUser(userID int) ([]domain.Activity, error) {
-	inscriptions, err := clients.GetInscriptionsByUserID(userID)
+func (s *InscriptionService) GetActivitiesByUser(userID int) ([]domain.Activity, error) {
+	inscriptions, err := s.inscriptions.GetInscriptionsByUserID(userID, dao.EstadoActiva)
 	if err != nil {
 		return nil, err
 	}
 
+	// Con reservas a varias sesiones la actividad aparece una sola vez
 	var activities []domain.Activity
+	seen := map[int]bool{}
 	for _, inscription := range inscriptions {
-		activity, err := clients.GetActivityByID(inscription.ID_actividad)
-		if err != nil {
-			continue // Skip this inscription if activity not found
+		activity := inscription.Actividad
+		if seen[activity.ID_actividad] {
+			continue
 		}
-		activities = append(activities, domain.Activity{
-			ID:          activity.ID_actividad,
-			Name:        activity.Nombre,
-			Profesor:    activity.Profesor,
-			Categoria:   activity.Categoria,
-			Cupos:       activity.Cupos,
-			Description: activity.Descripcion,
-			Dia:         activity.Dia,
-			HoraInicio:  activity.Hora_inicio,
-			HoraFin:     activity.Hora_fin,
-		})
+		seen[activity.ID_actividad] = true
+		activities = append(activities, toActivity(activity))
 	}
 	return activities, nil
 }
-func GetMyActivities(userID int) ([]domain.Inscripcion, error) {
-	inscriptions, err := clients.GetInscriptionsByUserID(userID)
+
+// GetMyActivities obtiene las inscripciones activas de un usuario
+func (s *InscriptionService) GetMyActivities(userID int) ([]domain.Inscripcion, error) {
+	inscriptions, err := s.inscriptions.GetInscriptionsByUserID(userID, dao.EstadoActiva)
 	if err != nil {
 		return nil, err
 	}
 
-	var result []domain.Inscripcion
-	for _, inscription := range inscriptions {
-		// Cargar usuario y actividad para cada inscripción
-		user, err := clients.GetUserByID(inscription.ID_usuario)
-		if err != nil {
-			continue // Skip this inscription if user not found
+	return toInscripciones(inscriptions), nil
+}
+
+// DeleteInscription cancela una inscripción (se conserva con estado "cancelada")
+// y, en la misma transacción, promueve al primer usuario de la lista de espera.
+// Queda registrado que la canceló el actor.
+func (s *InscriptionService) DeleteInscription(id int, reason string, actor domain.Actor) error {
+	err := s.inscriptions.CancelInscription(id, actor.UserID, reason, auditFrom(actor))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("inscription not found")
+	}
+	return err
+}
+
+// CompleteFinishedInscriptions marca como completadas las reservas de sesiones
+// cuya clase ya terminó. Las inscripciones semanales no terminan con una clase:
+// siguen activas hasta que el socio las cancela. Devuelve cuántas reservas se
+// completaron. Lo hace el sistema, así que los eventos de auditoría no tienen actor.
+func (s *InscriptionService) CompleteFinishedInscriptions(now time.Time) (int, error) {
+	bookings, err := s.inscriptions.GetActiveSessionBookings()
+	if err != nil {
+		return 0, err
+	}
+
+	completed := 0
+	for _, booking := range bookings {
+		if booking.Sesion == nil || booking.Sesion.Fin.After(now) {
+			continue
 		}
-		activity, err := clients.GetActivityByID(inscription.ID_actividad)
-		if err != nil {
-			continue // Skip this inscription if activity not found
+		if err := s.inscriptions.CompleteInscription(booking.ID_inscripcion, auditFrom(domain.Actor{})); err != nil {
+			// Pudo haberse cancelado mientras tanto
+			if errors.Is(err, clients.ErrInscriptionNotActive) {
+				continue
+			}
+			return completed, err
 		}
-		result = append(result, domain.Inscripcion{
-			Id:          inscription.ID_inscripcion,
-			UsuarioId:   inscription.ID_usuario,
-			ActividadId: inscription.ID_actividad,
-			Usuario: domain.User{
-				ID:       user.ID,
-				Username: user.Username,
-				IsAdmin:  user.IsAdmin,
-			},
-			Actividad: domain.Activity{
-				ID:          activity.ID_actividad,
-				Name:        activity.Nombre,
-				Profesor:    activity.Profesor,
-				Categoria:   activity.Categoria,
-				Cupos:       activity.Cupos,
-				Description: activity.Descripcion,
-				Dia:         activity.Dia,
-				HoraInicio:  activity.Hora_inicio,
-				HoraFin:     activity.Hora_fin,
-			},
+		completed++
+	}
+	return completed, nil
+}
+
+func isValidEstado(estado string) bool {
+	switch estado {
+	case dao.EstadoActiva, dao.EstadoCancelada, dao.EstadoCompletada:
+		return true
+	}
+	return false
+}
+
+// toInscripciones convierte inscripciones que ya traen su Usuario y su Actividad
+func toInscripciones(inscriptions []dao.Inscription) []domain.Inscripcion {
+	result := []domain.Inscripcion{}
+	for _, inscription := range inscriptions {
+		result = append(result, toInscripcion(inscription, inscription.Usuario, inscription.Actividad))
+	}
+	return result
+}
+
+// toInscripcion convierte una inscripción de la base, con su usuario y actividad, al formato domain
+func toInscripcion(inscription dao.Inscription, user dao.User, activity dao.Activity) domain.Inscripcion {
+	var sesion *domain.ClassSession
+	if inscription.Sesion != nil {
+		session := toClassSession(*inscription.Sesion)
+		sesion = &session
+	}
+
+	return domain.Inscripcion{
+		Id:               inscription.ID_inscripcion,
+		UsuarioId:        inscription.ID_usuario,
+		ActividadId:      inscription.ID_actividad,
+		SesionId:         inscription.ID_sesion,
+		Sesion:           sesion,
+		Estado:           inscription.Estado,
+		FechaInscripcion: inscription.Fecha_inscripcion,
+		CancelledAt:      inscription.CancelledAt,
+		CancelledBy:      inscription.CancelledBy,
+		CancelReason:     inscription.CancelReason,
+		Usuario: domain.User{
+			ID:       user.ID,
+			Username: user.Username,
+			IsAdmin:  isAdmin(user),
+		},
+		Actividad: toActivity(activity),
+	}
+}
+
+// toHistorialEstado convierte el historial de la base al formato domain
+func toHistorialEstado(history []dao.InscriptionHistory) []domain.HistorialEstado {
+	var result []domain.HistorialEstado
+	for _, entry := range history {
+		result = append(result, domain.HistorialEstado{
+			Estado:  entry.Estado,
+			Detalle: entry.Detalle,
+			Fecha:   entry.CreatedAt,
 		})
 	}
-	return result, nil
+	return result
 }
 
-// DeleteInscription elimina una inscripción y actualiza los cupos de la actividad
-func DeleteInscription(id int) error {
-	inscription, err := clients.GetInscriptionByID(id)
+// JoinWaitlist anota a un usuario en la lista de espera de una actividad sin cupos
+func (s *InscriptionService) JoinWaitlist(userID, activityID int, actor domain.Actor) (domain.ListaEspera, error) {
+	user, err := s.users.GetUserByID(userID)
 	if err != nil {
-		return errors.New("inscription not found")
+		return domain.ListaEspera{}, errors.New("user not found")
+	}
+	if err := requireVerifiedEmail(user); err != nil {
+		return domain.ListaEspera{}, err
+	}
+	if _, err := s.activities.GetActivityByID(activityID); err != nil {
+		return domain.ListaEspera{}, errors.New("activity not found")
 	}
 
-	// Obtener la actividad para actualizar los cupos
-	activity, err := clients.GetActivityByID(inscription.ID_actividad)
+	entry, err := s.inscriptions.JoinWaitlist(dao.WaitlistEntry{
+		ID_usuario:   userID,
+		ID_actividad: activityID,
+	}, auditFrom(actor))
 	if err != nil {
-		// Esto no debería pasar si la FK está bien, pero es una buena práctica
-		return errors.New("associated activity not found")
+		return domain.ListaEspera{}, err
 	}
 
-	err = clients.DeleteInscription(id)
+	return toListaEspera(entry), nil
+}
+
+// GetWaitlistEntryByID obtiene una entrada de la lista de espera con su posición actual
+func (s *InscriptionService) GetWaitlistEntryByID(id int) (domain.ListaEspera, error) {
+	entry, err := s.inscriptions.GetWaitlistEntryByID(id)
 	if err != nil {
-		return err
+		return domain.ListaEspera{}, errors.New("waitlist entry not found")
 	}
+	return toListaEspera(entry), nil
+}
 
-	// Incrementar los cupos de la actividad
-	newSlots := activity.Cupos + 1
-	err = clients.UpdateActivitySlots(activity.ID_actividad, newSlots)
+// GetWaitlistByUserID obtiene las listas de espera de un usuario con su posición en cada una
+func (s *InscriptionService) GetWaitlistByUserID(userID int) ([]domain.ListaEspera, error) {
+	entries, err := s.inscriptions.GetWaitlistByUserID(userID)
 	if err != nil {
-		// Loggear el error, pero no fallar la eliminación de la inscripción
-		// log.Printf("Warning: Failed to update activity slots after inscription deletion: %v", err)
+		return nil, err
 	}
 
-	return nil
+	var result []domain.ListaEspera
+	for _, entry := range entries {
+		result = append(result, toListaEspera(entry))
+	}
+	return result, nil
+}
+
+// LeaveWaitlist saca al usuario de una lista de espera
+func (s *InscriptionService) LeaveWaitlist(id int, actor domain.Actor) error {
+	err := s.inscriptions.DeleteWaitlistEntry(id, auditFrom(actor))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("waitlist entry not found")
+	}
+	return err
+}
+
+func toListaEspera(entry dao.WaitlistEntry) domain.ListaEspera {
+	return domain.ListaEspera{
+		Id:          entry.ID_espera,
+		UsuarioId:   entry.ID_usuario,
+		ActividadId: entry.ID_actividad,
+		Posicion:    entry.Posicion,
+		FechaAlta:   entry.CreatedAt,
+	}
 }
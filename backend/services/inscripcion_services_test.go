@@ -0,0 +1,245 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newMemoryServices arma los servicios de actividades e inscripciones sobre un
+// MemoryStore, con una actividad de un cupo y tres socios con email verificado
+func newMemoryServices(t *testing.T) (*ActivityService, *InscriptionService, dao.Activity, []dao.User) {
+	t.Helper()
+	store := NewMemoryStore()
+
+	now := time.Now()
+	var users []dao.User
+	for _, username := range []string{"ana", "bruno", "carla"} {
+		email := username + "@example.com"
+		user, err := store.CreateUser(dao.User{Name: username, Username: username, PasswordHash: "x", Email: &email, EmailVerificadoEn: &now}, dao.AuditEvent{})
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		users = append(users, user)
+	}
+	activity, err := store.InsertActivity(dao.Activity{Nombre: "Yoga", Capacidad: 1, Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "10:00", Hora_fin: "11:00"}}}, dao.AuditEvent{})
+	if err != nil {
+		t.Fatalf("failed to create activity: %v", err)
+	}
+
+	return NewActivityService(store, store), NewInscriptionService(store, store, store), activity, users
+}
+
+func TestCancelInscriptionPromotesWaitlist(t *testing.T) {
+	activities, inscriptions, activity, users := newMemoryServices(t)
+	actor := domain.Actor{UserID: users[0].ID}
+
+	first, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[0].ID, ActividadId: activity.ID_actividad}, actor)
+	if err != nil {
+		t.Fatalf("CreateInscription() error = %v", err)
+	}
+	if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[1].ID, ActividadId: activity.ID_actividad}, actor); !errors.Is(err, clients.ErrNoAvailableSlots) {
+		t.Fatalf("CreateInscription() on a full activity error = %v, want %v", err, clients.ErrNoAvailableSlots)
+	}
+
+	for i, user := range users[1:] {
+		entry, err := inscriptions.JoinWaitlist(user.ID, activity.ID_actividad, actor)
+		if err != nil {
+			t.Fatalf("JoinWaitlist() error = %v", err)
+		}
+		if entry.Posicion != i+1 {
+			t.Errorf("waitlist position = %d, want %d", entry.Posicion, i+1)
+		}
+	}
+
+	if err := inscriptions.DeleteInscription(first.Id, "", actor); err != nil {
+		t.Fatalf("DeleteInscription() error = %v", err)
+	}
+
+	promoted, err := inscriptions.GetInscriptionByUserAndActivity(users[1].ID, activity.ID_actividad)
+	if err != nil || promoted.Estado != dao.EstadoActiva {
+		t.Fatalf("first in waitlist was not promoted: %+v, %v", promoted, err)
+	}
+	waiting, err := inscriptions.GetWaitlistByUserID(users[2].ID)
+	if err != nil || len(waiting) != 1 || waiting[0].Posicion != 1 {
+		t.Errorf("waitlist after promotion = %+v, %v; want carla first", waiting, err)
+	}
+
+	current, err := activities.GetActivityByID(activity.ID_actividad)
+	if err != nil {
+		t.Fatalf("GetActivityByID() error = %v", err)
+	}
+	if current.CuposDisponibles != 0 {
+		t.Errorf("CuposDisponibles = %d, want 0", current.CuposDisponibles)
+	}
+}
+
+func TestUpdateActivitySlotsRejectsCapacityBelowInscriptions(t *testing.T) {
+	activities, inscriptions, activity, users := newMemoryServices(t)
+	actor := domain.Actor{UserID: users[0].ID}
+
+	if err := activities.UpdateActivitySlots(activity.ID_actividad, 2, actor); err != nil {
+		t.Fatalf("UpdateActivitySlots() error = %v", err)
+	}
+	for _, user := range users[:2] {
+		if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: user.ID, ActividadId: activity.ID_actividad}, actor); err != nil {
+			t.Fatalf("CreateInscription() error = %v", err)
+		}
+	}
+
+	if err := activities.UpdateActivitySlots(activity.ID_actividad, 1, actor); !errors.Is(err, clients.ErrCapacityBelowInscriptions) {
+		t.Errorf("UpdateActivitySlots() error = %v, want %v", err, clients.ErrCapacityBelowInscriptions)
+	}
+	if err := activities.UpdateActivitySlots(activity.ID_actividad, 3, actor); err != nil {
+		t.Fatalf("UpdateActivitySlots() error = %v", err)
+	}
+	current, _ := activities.GetActivityByID(activity.ID_actividad)
+	if current.Capacidad != 3 || current.CuposDisponibles != 1 {
+		t.Errorf("activity = capacidad %d, cupos %d; want 3, 1", current.Capacidad, current.CuposDisponibles)
+	}
+}
+
+// seedInscriptionsDB abre una base SQLite en memoria migrada, con un socio
+// inscripto en n actividades, y devuelve el socio y un contador de consultas
+func seedInscriptionsDB(tb testing.TB, n int) (dao.User, *atomic.Int64) {
+	tb.Helper()
+	dsn := fmt.Sprintf("file:inscriptions_%d?mode=memory&cache=shared", n)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		tb.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	previous := clients.DB
+	tb.Cleanup(func() {
+		sqlDB.Close()
+		clients.DB = previous
+	})
+	if _, err := clients.MigrateUp(db); err != nil {
+		tb.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	var role dao.Role
+	db.Where("nombre = ?", dao.RolSocio).First(&role)
+	user := dao.User{Name: "Socio", Username: "socio", PasswordHash: "x", Roles: []dao.Role{role}}
+	db.Create(&user)
+	for i := 0; i < n; i++ {
+		activity := dao.Activity{Nombre: fmt.Sprintf("Clase %d", i), Capacidad: 10, Horarios: []dao.ActivitySlot{{Dia: i%7 + 1, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+		db.Create(&activity)
+		db.Create(&dao.Inscription{ID_usuario: user.ID, ID_actividad: activity.ID_actividad})
+	}
+
+	queries := &atomic.Int64{}
+	db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+		queries.Add(1)
+	})
+	clients.DB = db
+	return user, queries
+}
+
+// listings son los servicios que listan inscripciones con su usuario y su actividad
+func listings(s *InscriptionService, userID int) map[string]func() (int, error) {
+	return map[string]func() (int, error){
+		"GetInscriptionsByUserID": func() (int, error) {
+			result, err := s.GetInscriptionsByUserID(userID, "")
+			return len(result), err
+		},
+		"GetMyActivities": func() (int, error) {
+			result, err := s.GetMyActivities(userID)
+			return len(result), err
+		},
+		"GetActivitiesByUser": func() (int, error) {
+			result, err := s.GetActivitiesByUser(userID)
+			return len(result), err
+		},
+		"GetAllInscriptions": func() (int, error) {
+			result, err := s.GetAllInscriptions("")
+			return len(result), err
+		},
+	}
+}
+
+func TestListingInscriptionsUsesAFixedNumberOfQueries(t *testing.T) {
+	store := NewDBStore()
+	s := NewInscriptionService(store, store, store)
+
+	counts := map[string][]int64{}
+	for _, n := range []int{1, 25} {
+		user, queries := seedInscriptionsDB(t, n)
+		for name, list := range listings(s, user.ID) {
+			queries.Store(0)
+			got, err := list()
+			if err != nil || got != n {
+				t.Fatalf("%s() = %d rows, %v; want %d", name, got, err, n)
+			}
+			counts[name] = append(counts[name], queries.Load())
+		}
+	}
+
+	for name, count := range counts {
+		if count[0] != count[1] {
+			t.Errorf("%s ran %d queries for 1 inscription and %d for 25", name, count[0], count[1])
+		}
+	}
+}
+
+func BenchmarkGetInscriptionsByUserID(b *testing.B) {
+	store := NewDBStore()
+	s := NewInscriptionService(store, store, store)
+
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("inscriptions=%d", n), func(b *testing.B) {
+			user, queries := seedInscriptionsDB(b, n)
+			queries.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetInscriptionsByUserID(user.ID, ""); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(queries.Load())/float64(b.N), "queries/op")
+		})
+	}
+}
+
+func TestCompleteFinishedInscriptionsOnlyCompletesSessionBookings(t *testing.T) {
+	activities, inscriptions, activity, users := newMemoryServices(t)
+	actor := domain.Actor{UserID: users[0].ID}
+
+	weekly, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[0].ID, ActividadId: activity.ID_actividad}, actor)
+	if err != nil {
+		t.Fatalf("CreateInscription() error = %v", err)
+	}
+	if _, err := activities.SetSchedule(activity.ID_actividad, domain.Schedule{FechaInicio: time.Now().Format(dateLayout)}, actor); err != nil {
+		t.Fatalf("SetSchedule() error = %v", err)
+	}
+	sessions, err := activities.GetSessions(activity.ID_actividad, time.Time{}, time.Time{})
+	if err != nil || len(sessions) == 0 {
+		t.Fatalf("GetSessions() = %v, %v", sessions, err)
+	}
+	booking, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[1].ID, SesionId: &sessions[0].Id}, actor)
+	if err != nil {
+		t.Fatalf("booking a session error = %v", err)
+	}
+
+	// Un mes después la primera clase de la semanal ya pasó, pero sigue activa
+	completed, err := inscriptions.CompleteFinishedInscriptions(time.Now().AddDate(0, 1, 0))
+	if err != nil || completed != 1 {
+		t.Fatalf("CompleteFinishedInscriptions() = %d, %v; want 1", completed, err)
+	}
+	if got, _ := inscriptions.GetInscriptionByID(weekly.Id); got.Estado != dao.EstadoActiva {
+		t.Errorf("weekly inscription estado = %q, want %q", got.Estado, dao.EstadoActiva)
+	}
+	if got, _ := inscriptions.GetInscriptionByID(booking.Id); got.Estado != dao.EstadoCompletada {
+		t.Errorf("session booking estado = %q, want %q", got.Estado, dao.EstadoCompletada)
+	}
+}
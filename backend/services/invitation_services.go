@@ -0,0 +1,199 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/mailer"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// invitationDuration es cuánto tiempo tiene el invitado para crear su cuenta
+	invitationDuration = 7 * 24 * time.Hour
+	// invitationAudience distingue estos tokens de los access tokens
+	invitationAudience = "invitation"
+)
+
+// invitationURL es la página del frontend donde el invitado crea su cuenta
+var invitationURL = "http://localhost:3000/accept-invitation"
+
+// SetInvitationURL cambia la página a la que apunta el link de invitación
+func SetInvitationURL(acceptURL string) {
+	invitationURL = acceptURL
+}
+
+// invitationClaims son los claims del token de invitación. Los roles van
+// firmados: el invitado no puede cambiarlos al aceptar.
+type invitationClaims struct {
+	Email string   `json:"email"`
+	Roles []string `json:"invited_roles"`
+	jwt.RegisteredClaims
+}
+
+// CreateInvitation invita a crear una cuenta con los roles indicados (staff o
+// admin). Es la única forma de crear cuentas con roles distintos de socio.
+func CreateInvitation(request domain.InvitationRequest, actor domain.Actor) (domain.Invitation, error) {
+	email, err := normalizeEmail(request.Email)
+	if err != nil {
+		return domain.Invitation{}, err
+	}
+	if email == nil {
+		return domain.Invitation{}, errors.New("invalid email")
+	}
+	if _, err := clients.GetUserByEmail(*email); err == nil {
+		return domain.Invitation{}, errors.New("email already exists")
+	}
+
+	if len(request.Roles) == 0 {
+		return domain.Invitation{}, errors.New("at least one role is required")
+	}
+	roles, err := clients.GetRolesByNames(request.Roles)
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to load roles: %w", err)
+	}
+	if len(roles) != len(uniqueNames(request.Roles)) {
+		return domain.Invitation{}, errors.New("unknown role")
+	}
+	names := roleNames(dao.User{Roles: roles})
+
+	jti, err := utils.NewOpaqueToken()
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to generate invitation id: %w", err)
+	}
+	now := time.Now()
+	expiresAt := now.Add(invitationDuration)
+
+	keys, err := utils.CurrentKeySet()
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	token, err := keys.Sign(&invitationClaims{
+		Email: *email,
+		Roles: names,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "backend",
+			Audience:  jwt.ClaimStrings{invitationAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        jti,
+		},
+	})
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to sign invitation: %w", err)
+	}
+
+	err = clients.CreateInvitation(dao.Invitacion{
+		ID_invitacion: jti,
+		Email:         *email,
+		Roles:         strings.Join(names, ","),
+		ID_invitador:  actor.UserID,
+		ExpiresAt:     expiresAt,
+	}, auditFrom(actor))
+	if err != nil {
+		return domain.Invitation{}, fmt.Errorf("failed to store invitation: %w", err)
+	}
+
+	// El token también se devuelve: si el email falla el admin puede compartirlo
+	link := invitationURL + "?token=" + url.QueryEscape(token)
+	err = mailSender.Send(mailer.Message{
+		To:      *email,
+		Subject: "Te invitaron al gimnasio",
+		Body: fmt.Sprintf("Hola,\n\n"+
+			"Te invitaron a crear una cuenta en el gimnasio con el rol %s.\n"+
+			"Para elegir tu usuario y contraseña, entrá a este link dentro de los próximos 7 días:\n\n%s\n",
+			strings.Join(names, ", "), link),
+	})
+	if err != nil {
+		log.WithError(err).WithField("email", *email).Error("Failed to send invitation email")
+	}
+
+	log.WithFields(log.Fields{"email": *email, "roles": names, "by": actor.UserID}).Info("Invitation created")
+	return domain.Invitation{Email: *email, Roles: names, Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// AcceptInvitation crea la cuenta invitada con los roles de la invitación. El
+// email queda verificado porque el token llegó a esa casilla.
+func AcceptInvitation(request domain.AcceptInvitationRequest, actor domain.Actor) (domain.User, error) {
+	keys, err := utils.CurrentKeySet()
+	if err != nil {
+		return domain.User{}, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	claims := &invitationClaims{}
+	parsed, err := jwt.ParseWithClaims(request.Token, claims, keys.Keyfunc, jwt.WithAudience(invitationAudience), jwt.WithExpirationRequired())
+	if err != nil || !parsed.Valid || claims.ID == "" {
+		return domain.User{}, clients.ErrInvalidInvitation
+	}
+	now := time.Now()
+	invitation, err := clients.GetInvitation(claims.ID)
+	if err != nil || invitation.AceptadaEn != nil || !invitation.ExpiresAt.After(now) {
+		return domain.User{}, clients.ErrInvalidInvitation
+	}
+
+	userDao, err := newUser(request.Name, request.Username, request.Password, claims.Roles)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if _, err := clients.GetUserByEmail(claims.Email); err == nil {
+		return domain.User{}, errors.New("email already exists")
+	}
+	userDao.Email = &claims.Email
+	userDao.EmailVerificadoEn = &now
+
+	created, err := clients.AcceptInvitation(claims.ID, userDao, now, auditFrom(actor))
+	if err != nil {
+		if errors.Is(err, clients.ErrInvalidInvitation) {
+			return domain.User{}, err
+		}
+		return domain.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	log.WithFields(log.Fields{"user_id": created.ID, "roles": claims.Roles}).Info("Invitation accepted")
+	return toUser(created), nil
+}
+
+// BootstrapAdmin crea el primer admin desde la línea de comandos, cuando
+// todavía no hay nadie que pueda enviar invitaciones. Falla si ya hay un admin.
+func BootstrapAdmin(name, username, email, password string) (domain.User, error) {
+	admins, err := clients.CountUsersWithRole(dao.RolAdmin)
+	if err != nil {
+		return domain.User{}, fmt.Errorf("failed to count admins: %w", err)
+	}
+	if admins > 0 {
+		return domain.User{}, errors.New("admin already exists")
+	}
+
+	normalized, err := normalizeEmail(email)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if normalized == nil {
+		return domain.User{}, errors.New("email cannot be empty")
+	}
+	if _, err := clients.GetUserByEmail(*normalized); err == nil {
+		return domain.User{}, errors.New("email already exists")
+	}
+
+	userDao, err := newUser(name, username, password, []string{dao.RolAdmin})
+	if err != nil {
+		return domain.User{}, err
+	}
+	now := time.Now()
+	userDao.Email = normalized
+	userDao.EmailVerificadoEn = &now
+
+	created, err := clients.CreateUser(userDao, auditFrom(domain.Actor{}))
+	if err != nil {
+		return domain.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	log.WithField("user_id", created.ID).Info("First admin created")
+	return toUser(created), nil
+}
@@ -5,90 +5,138 @@ import (
 	"backend/dao"
 	"backend/domain"
 	"backend/utils"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
 )
 
-func Login(username, password string) (domain.User, error) {
-	// Obtener el usuario por nombre de usuario
-	userDao, err := clients.GetUserByUsername(username)
-	if err != nil {
-		return domain.User{}, fmt.Errorf("user not found with username %s: %w", username, err)
+// CreateUser registra un nuevo socio con contraseña hasheada. La request no
+// tiene campos de privilegios: los otros roles se asignan con una invitación.
+func CreateUser(request domain.RegisterRequest, actor domain.Actor) (domain.User, error) {
+	// El email es obligatorio: hay que verificarlo para poder inscribirse
+	if strings.TrimSpace(request.Email) == "" {
+		return domain.User{}, errors.New("email cannot be empty")
 	}
 
-	// Verificar la contraseña
-	if userDao.PasswordHash != hashPassword(password) {
-		return domain.User{}, errors.New("invalid password")
+	userDao, err := newUser(request.Name, request.Username, request.Password, []string{dao.RolSocio})
+	if err != nil {
+		return domain.User{}, err
+	}
+	// Validar los datos del perfil
+	if _, err := applyProfile(&userDao, profileOf(request), clients.GetUserByEmail); err != nil {
+		return domain.User{}, err
 	}
-	token, err := utils.GenerateJWT(userDao.ID)
-	fmt.Printf("Generated token for user %s: %s\n", userDao.Username, token)
+
+	// Guardar en la base de datos
+	createdUser, err := clients.CreateUser(userDao, auditFrom(actor))
 	if err != nil {
-		return domain.User{}, fmt.Errorf("failed to generate token: %w", err)
+		return domain.User{}, fmt.Errorf("failed to create user: %w", err)
 	}
-	return domain.User{
-		ID:       userDao.ID,
-		Name:     userDao.Name,
-		Username: userDao.Username,
-		IsAdmin:  userDao.IsAdmin,
-		Token:    token,
-	}, nil
+
+	notifyEmailVerification(createdUser)
+	return toUser(createdUser), nil
 }
 
-// CreateUser crea un nuevo usuario con contraseña hasheada
-func CreateUser(user domain.User) (domain.User, error) {
+// newUser valida los datos de una cuenta nueva y arma el usuario con la
+// contraseña hasheada y los roles, sin guardarlo
+func newUser(name, username, password string, roleNames []string) (dao.User, error) {
 	// Validaciones básicas
-	if user.Name == "" {
-		return domain.User{}, errors.New("name cannot be empty")
-
+	if strings.TrimSpace(name) == "" {
+		return dao.User{}, errors.New("name cannot be empty")
 	}
-	if user.Username == "" {
-		return domain.User{}, errors.New("username cannot be empty")
+	if username == "" {
+		return dao.User{}, errors.New("username cannot be empty")
 	}
-	if user.Password == "" {
-		return domain.User{}, errors.New("password cannot be empty")
+	if password == "" {
+		return dao.User{}, errors.New("password cannot be empty")
 	}
 
 	// Verificar si el usuario ya existe
-	_, err := clients.GetUserByUsername(user.Username)
-	if err == nil {
-		return domain.User{}, errors.New("username already exists")
+	if _, err := clients.GetUserByUsername(username); err == nil {
+		return dao.User{}, errors.New("username already exists")
 	}
 
 	// Hashear la contraseña
-	hashedPassword := hashPassword(user.Password)
-
-	// Crear el DAO object
-	userDao := dao.User{
-		Username:     user.Username,
-		Name:         user.Name,
-		PasswordHash: hashedPassword,
-		IsAdmin:      user.IsAdmin,
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return dao.User{}, fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Guardar en la base de datos
-	createdUser, err := clients.CreateUser(userDao)
+	roles, err := clients.GetRolesByNames(roleNames)
 	if err != nil {
-		return domain.User{}, fmt.Errorf("failed to create user: %w", err)
+		return dao.User{}, fmt.Errorf("failed to load roles: %w", err)
+	}
+	if len(roles) != len(uniqueNames(roleNames)) {
+		return dao.User{}, errors.New("unknown role")
 	}
 
-	return domain.User{
-		ID:       createdUser.ID,
-		Name:     createdUser.Name,
-		Username: createdUser.Username,
-		Password: "", // No devolvemos la contraseña
-		IsAdmin:  createdUser.IsAdmin,
+	return dao.User{
+		Name:         strings.TrimSpace(name),
+		Username:     username,
+		PasswordHash: hashedPassword,
+		Roles:        roles,
 	}, nil
 }
 
-// hashPassword hashea una contraseña usando SHA256
-func hashPassword(password string) string {
-	hash := sha256.Sum256([]byte(password))
-	return hex.EncodeToString(hash[:])
+// profileOf arma, con los datos de un registro, la request que valida el perfil
+func profileOf(request domain.RegisterRequest) domain.ProfileUpdateRequest {
+	return domain.ProfileUpdateRequest{
+		Name:             &request.Name,
+		Email:            &request.Email,
+		Phone:            &request.Phone,
+		BirthDate:        &request.BirthDate,
+		EmergencyContact: request.EmergencyContact,
+		PhotoURL:         &request.PhotoURL,
+	}
+}
+
+// PublicKeys devuelve las claves públicas con las que otros servicios pueden
+// verificar los tokens emitidos por el gimnasio
+func PublicKeys() (utils.JWKS, error) {
+	keys, err := utils.CurrentKeySet()
+	if err != nil {
+		return utils.JWKS{}, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+	return keys.JWKS(), nil
 }
 
-// verifyPassword verifica si una contraseña coincide con su hash
-func verifyPassword(password, hash string) bool {
-	return hashPassword(password) == hash
+// passwordHasher genera hashes argon2id y acepta los SHA-256 anteriores
+var passwordHasher utils.PasswordHasher = utils.NewPasswordHasher()
+
+// dummyHash se verifica cuando el usuario no existe, para que la respuesta
+// tarde lo mismo y no revele qué usernames están registrados
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := passwordHasher.Hash("dummy-password")
+	return hash
+})
+
+// hashPassword hashea una contraseña con sal aleatoria
+func hashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// checkPassword verifica la contraseña del usuario. Si el hash guardado es de un
+// algoritmo anterior (SHA-256) o con otros parámetros, lo regenera de forma
+// transparente tras el login exitoso.
+func checkPassword(userDao dao.User, password string) bool {
+	ok, err := passwordHasher.Verify(password, userDao.PasswordHash)
+	if err != nil || !ok {
+		return false
+	}
+
+	if passwordHasher.NeedsRehash(userDao.PasswordHash) {
+		newHash, err := hashPassword(password)
+		if err == nil {
+			err = clients.UpdatePasswordHash(userDao.ID, newHash)
+		}
+		if err != nil {
+			// No impedir el login: se volverá a intentar en el próximo
+			log.WithError(err).WithField("user_id", userDao.ID).Warn("Failed to upgrade password hash")
+		}
+	}
+
+	return true
 }
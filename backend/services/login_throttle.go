@@ -0,0 +1,335 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// AttemptState son los fallos de login recientes de una clave
+type AttemptState struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore guarda los fallos de login por clave. Update debe ser atómico
+// para que dos logins simultáneos no pierdan fallos.
+type AttemptStore interface {
+	// Get devuelve el estado de la clave, vacío si no tiene fallos
+	Get(key string) (AttemptState, error)
+	// Update aplica update sobre el estado de la clave y devuelve el resultado
+	Update(key string, update func(*AttemptState)) (AttemptState, error)
+	// Reset olvida los fallos de la clave
+	Reset(key string) error
+	// Purge borra las claves sin fallos ni bloqueos posteriores a before
+	Purge(before time.Time) error
+}
+
+// MemoryAttemptStore guarda los fallos en memoria. Sirve para tests y para una
+// sola instancia; los fallos se pierden al reiniciar.
+type MemoryAttemptStore struct {
+	mu     sync.Mutex
+	states map[string]AttemptState
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{states: map[string]AttemptState{}}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[key], nil
+}
+
+func (s *MemoryAttemptStore) Update(key string, update func(*AttemptState)) (AttemptState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[key]
+	update(&state)
+	s.states[key] = state
+	return state, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+	return nil
+}
+
+func (s *MemoryAttemptStore) Purge(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, state := range s.states {
+		if state.LastFailure.Before(before) && state.LockedUntil.Before(before) {
+			delete(s.states, key)
+		}
+	}
+	return nil
+}
+
+// DBAttemptStore guarda los fallos en la tabla login_throttles, compartida por
+// todas las instancias del backend
+type DBAttemptStore struct{}
+
+func NewDBAttemptStore() DBAttemptStore {
+	return DBAttemptStore{}
+}
+
+func (DBAttemptStore) Get(key string) (AttemptState, error) {
+	throttle, err := clients.GetLoginThrottle(key)
+	if err != nil {
+		return AttemptState{}, err
+	}
+	return attemptStateFromDao(throttle), nil
+}
+
+func (DBAttemptStore) Update(key string, update func(*AttemptState)) (AttemptState, error) {
+	throttle, err := clients.UpdateLoginThrottle(key, func(throttle *dao.LoginThrottle) {
+		state := attemptStateFromDao(*throttle)
+		update(&state)
+		throttle.Fallos = state.Failures
+		throttle.UltimoFallo = timeOrNil(state.LastFailure)
+		throttle.BloqueadoHasta = timeOrNil(state.LockedUntil)
+	})
+	if err != nil {
+		return AttemptState{}, err
+	}
+	return attemptStateFromDao(throttle), nil
+}
+
+func (DBAttemptStore) Reset(key string) error {
+	return clients.DeleteLoginThrottle(key)
+}
+
+func (DBAttemptStore) Purge(before time.Time) error {
+	return clients.PurgeLoginThrottles(before)
+}
+
+func attemptStateFromDao(throttle dao.LoginThrottle) AttemptState {
+	state := AttemptState{Failures: throttle.Fallos}
+	if throttle.UltimoFallo != nil {
+		state.LastFailure = *throttle.UltimoFallo
+	}
+	if throttle.BloqueadoHasta != nil {
+		state.LockedUntil = *throttle.BloqueadoHasta
+	}
+	return state
+}
+
+// timeOrNil devuelve nil para la fecha cero, que se guarda como NULL
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// ThrottleLimits define cuánto se demora y bloquea una clave según sus fallos
+type ThrottleLimits struct {
+	FreeAttempts int           // Fallos permitidos sin demora
+	BaseDelay    time.Duration // Demora tras el primer fallo que excede FreeAttempts; se duplica en cada fallo
+	MaxDelay     time.Duration
+	MaxFailures  int // Fallos a partir de los cuales se bloquea la clave por Lockout
+	Lockout      time.Duration
+	Window       time.Duration // Tiempo sin fallos tras el cual se olvidan los anteriores
+}
+
+// lockFor devuelve cuánto queda bloqueada una clave tras su fallo número failures
+func (l ThrottleLimits) lockFor(failures int) time.Duration {
+	if failures >= l.MaxFailures {
+		return l.Lockout
+	}
+	excess := failures - l.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+	delay := l.BaseDelay
+	for i := 1; i < excess && delay < l.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, l.MaxDelay)
+}
+
+// LoginLockedError indica que la cuenta o la IP tienen el login demorado o bloqueado
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return "too many login attempts"
+}
+
+// LoginThrottle limita los intentos de login por username y por IP.
+//
+// Falla cerrado: si Store no puede leer, Check rechaza el login; si no puede
+// guardar un fallo, el fallo se cuenta igual en memoria (local), para que un
+// error del store no deje probar contraseñas sin límite. Esos fallos solo los
+// ve esta instancia y se olvidan como los demás.
+type LoginThrottle struct {
+	Store    AttemptStore
+	Username ThrottleLimits
+	IP       ThrottleLimits
+	Now      func() time.Time
+
+	local *MemoryAttemptStore
+}
+
+// NewLoginThrottle crea un limitador con los límites por defecto. Por IP se
+// permiten más fallos, porque varios socios pueden compartir la misma IP.
+func NewLoginThrottle(store AttemptStore) *LoginThrottle {
+	return &LoginThrottle{
+		Store: store,
+		Username: ThrottleLimits{
+			FreeAttempts: 3,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			MaxFailures:  10,
+			Lockout:      30 * time.Minute,
+			Window:       time.Hour,
+		},
+		IP: ThrottleLimits{
+			FreeAttempts: 10,
+			BaseDelay:    time.Second,
+			MaxDelay:     5 * time.Minute,
+			MaxFailures:  100,
+			Lockout:      time.Hour,
+			Window:       time.Hour,
+		},
+		Now:   time.Now,
+		local: NewMemoryAttemptStore(),
+	}
+}
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check devuelve un *LoginLockedError si el username o la IP no pueden intentar
+// un login todavía
+func (t *LoginThrottle) Check(username, ip string) error {
+	now := t.Now()
+	var retryAfter time.Duration
+
+	for _, key := range []string{usernameKey(username), ipKey(ip)} {
+		state, err := t.Store.Get(key)
+		if err != nil {
+			return fmt.Errorf("failed to read login attempts: %w", err)
+		}
+		local, _ := t.local.Get(key)
+		for _, lockedUntil := range []time.Time{state.LockedUntil, local.LockedUntil} {
+			if lockedUntil.After(now) {
+				retryAfter = max(retryAfter, lockedUntil.Sub(now))
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return &LoginLockedError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RecordFailure suma un fallo al username y a la IP y los demora o bloquea
+// según corresponda. Si Store falla, el fallo queda contado en memoria y se
+// devuelve el error.
+func (t *LoginThrottle) RecordFailure(username, ip string) error {
+	now := t.Now()
+
+	var storeErr error
+	keys := map[string]ThrottleLimits{usernameKey(username): t.Username, ipKey(ip): t.IP}
+	for key, limits := range keys {
+		update := func(state *AttemptState) {
+			if now.Sub(state.LastFailure) > limits.Window {
+				state.Failures = 0
+			}
+			state.Failures++
+			state.LastFailure = now
+			if delay := limits.lockFor(state.Failures); delay > 0 {
+				state.LockedUntil = now.Add(delay)
+			}
+		}
+		state, err := t.Store.Update(key, update)
+		if err != nil {
+			storeErr = fmt.Errorf("failed to record login attempt: %w", err)
+			state, _ = t.local.Update(key, update)
+		}
+		if state.Failures == limits.MaxFailures {
+			log.WithFields(log.Fields{"key": key, "until": state.LockedUntil}).Warn("Login locked after too many failures")
+		}
+	}
+	return storeErr
+}
+
+// RecordSuccess olvida los fallos del username. Los de la IP se mantienen, para
+// que quien conoce una contraseña no pueda usarla para seguir probando otras.
+func (t *LoginThrottle) RecordSuccess(username string) error {
+	return t.reset(usernameKey(username))
+}
+
+// Unlock quita el bloqueo de un username
+func (t *LoginThrottle) Unlock(username string) error {
+	return t.reset(usernameKey(username))
+}
+
+// Purge olvida las claves que ya no tienen fallos dentro de la ventana ni bloqueos vigentes
+func (t *LoginThrottle) Purge(now time.Time) error {
+	before := now.Add(-max(t.Username.Window, t.IP.Window))
+	t.local.Purge(before)
+	return t.Store.Purge(before)
+}
+
+// reset olvida los fallos de una clave, en Store y en memoria
+func (t *LoginThrottle) reset(key string) error {
+	t.local.Reset(key)
+	return t.Store.Reset(key)
+}
+
+// loginThrottle limita los logins. Por defecto guarda los fallos en memoria;
+// main.go lo cambia por el store en la base.
+var loginThrottle = NewLoginThrottle(NewMemoryAttemptStore())
+
+// SetAttemptStore cambia dónde se guardan los fallos de login
+func SetAttemptStore(store AttemptStore) {
+	loginThrottle.Store = store
+}
+
+// PurgeLoginAttempts olvida los fallos de login que ya no cuentan
+func PurgeLoginAttempts(now time.Time) error {
+	return loginThrottle.Purge(now)
+}
+
+// UnlockUser quita el bloqueo de login de un usuario
+func UnlockUser(userID int, actor domain.Actor) error {
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if err := loginThrottle.Unlock(user.Username); err != nil {
+		return err
+	}
+	// El bloqueo puede vivir fuera de la base (MemoryAttemptStore), así que el
+	// evento se registra aparte
+	return clients.CreateAuditEvent(auditFrom(actor), dao.AccionUsuarioDesbloqueado, dao.EntidadUsuario, userID)
+}
+
+// auditLoginFailure registra un intento de login rechazado
+func auditLoginFailure(username, ip, reason string) {
+	err := clients.CreateLoginAttempt(dao.LoginAttempt{Username: username, IP: ip, Motivo: reason})
+	if err != nil {
+		log.WithError(err).WithField("username", username).Warn("Failed to record login attempt")
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestThrottleLimitsBackoff(t *testing.T) {
+	limits := ThrottleLimits{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, MaxFailures: 10, Lockout: time.Hour}
+
+	want := map[int]time.Duration{
+		1: 0, 3: 0,
+		4: time.Second, 5: 2 * time.Second, 6: 4 * time.Second, 7: 8 * time.Second,
+		8: 10 * time.Second, 9: 10 * time.Second,
+		10: time.Hour, 50: time.Hour,
+	}
+	for failures, delay := range want {
+		if got := limits.lockFor(failures); got != delay {
+			t.Errorf("lockFor(%d) = %v, want %v", failures, got, delay)
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	stores := map[string]func(t *testing.T) AttemptStore{
+		"memory": func(t *testing.T) AttemptStore { return NewMemoryAttemptStore() },
+		"db": func(t *testing.T) AttemptStore {
+			db, err := gorm.Open(sqlite.Open("file:login_throttle?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+			if err != nil {
+				t.Fatalf("failed to open test database: %v", err)
+			}
+			sqlDB, _ := db.DB()
+			sqlDB.SetMaxOpenConns(1)
+			t.Cleanup(func() { sqlDB.Close() })
+			if err := db.AutoMigrate(&dao.LoginThrottle{}); err != nil {
+				t.Fatalf("failed to migrate test database: %v", err)
+			}
+			clients.DB = db
+			return NewDBAttemptStore()
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)
+			throttle := NewLoginThrottle(newStore(t))
+			throttle.Now = func() time.Time { return now }
+			throttle.Username = ThrottleLimits{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 4, Lockout: 30 * time.Minute, Window: time.Hour}
+			throttle.IP = ThrottleLimits{FreeAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute, MaxFailures: 20, Lockout: time.Hour, Window: time.Hour}
+
+			retryAfter := func(username, ip string) time.Duration {
+				var locked *LoginLockedError
+				if err := throttle.Check(username, ip); errors.As(err, &locked) {
+					return locked.RetryAfter
+				} else if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return 0
+			}
+
+			throttle.RecordFailure("Socio", "10.0.0.1")
+			throttle.RecordFailure("socio", "10.0.0.1")
+			if d := retryAfter("socio", "10.0.0.1"); d != 0 {
+				t.Fatalf("expected free attempts to pass, got retry after %v", d)
+			}
+
+			throttle.RecordFailure("socio", "10.0.0.2")
+			if d := retryAfter("SOCIO", "10.0.0.3"); d != time.Second {
+				t.Fatalf("expected username backoff of 1s from any IP, got %v", d)
+			}
+			now = now.Add(time.Second)
+			if d := retryAfter("socio", "10.0.0.3"); d != 0 {
+				t.Fatalf("expected backoff to expire, got %v", d)
+			}
+
+			throttle.RecordFailure("socio", "10.0.0.3")
+			if d := retryAfter("socio", "10.0.0.3"); d != 30*time.Minute {
+				t.Fatalf("expected account lockout, got %v", d)
+			}
+
+			if err := throttle.Unlock("socio"); err != nil {
+				t.Fatalf("unlock failed: %v", err)
+			}
+			if d := retryAfter("socio", "10.0.0.3"); d != 0 {
+				t.Fatalf("expected unlocked account, got %v", d)
+			}
+
+			// Por IP: fallos contra distintos usernames
+			for _, username := range []string{"a", "b", "c", "d", "e", "f"} {
+				throttle.RecordFailure(username, "10.0.0.9")
+			}
+			if d := retryAfter("otro", "10.0.0.9"); d != time.Second {
+				t.Fatalf("expected IP backoff of 1s, got %v", d)
+			}
+			throttle.RecordSuccess("f")
+			if d := retryAfter("f", "10.0.0.9"); d != time.Second {
+				t.Fatalf("a successful login must not reset the IP, got %v", d)
+			}
+
+			// Pasada la ventana los fallos se olvidan
+			now = now.Add(2 * time.Hour)
+			throttle.RecordFailure("a", "10.0.0.9")
+			if d := retryAfter("a", "10.0.0.9"); d != 0 {
+				t.Fatalf("expected failures outside the window to be forgotten, got %v", d)
+			}
+
+			if err := throttle.Purge(now.Add(2 * time.Hour)); err != nil {
+				t.Fatalf("purge failed: %v", err)
+			}
+			for _, key := range []string{ipKey("10.0.0.9"), usernameKey("b")} {
+				if state, _ := throttle.Store.Get(key); state.Failures != 0 {
+					t.Errorf("expected purged state for %s, got %+v", key, state)
+				}
+			}
+		})
+	}
+}
+
+func TestDBAttemptStoreLeavesDatesNull(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:login_throttle_null?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&dao.LoginThrottle{}); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	clients.DB = db
+
+	// Un fallo por debajo del límite no bloquea: la fecha del bloqueo queda
+	// NULL y no la fecha cero, que MySQL en modo estricto rechaza
+	throttle := NewLoginThrottle(NewDBAttemptStore())
+	if err := throttle.RecordFailure("socio", "10.0.0.1"); err != nil {
+		t.Fatalf("failed to record failure: %v", err)
+	}
+	var nullLocks int64
+	db.Model(&dao.LoginThrottle{}).Where("bloqueado_hasta IS NULL AND ultimo_fallo IS NOT NULL").Count(&nullLocks)
+	if nullLocks != 2 {
+		t.Fatalf("expected both keys without a lock date, got %d", nullLocks)
+	}
+
+	if err := throttle.Purge(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatalf("purge failed: %v", err)
+	}
+	var remaining int64
+	db.Model(&dao.LoginThrottle{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expected keys without a lock to be purged, got %d", remaining)
+	}
+}
+
+// failingAttemptStore lee sin fallos pero no puede guardar ninguno
+type failingAttemptStore struct{ *MemoryAttemptStore }
+
+func (failingAttemptStore) Update(key string, update func(*AttemptState)) (AttemptState, error) {
+	return AttemptState{}, errors.New("store unavailable")
+}
+
+func TestLoginThrottleFailsClosedWhenStoreCannotRecord(t *testing.T) {
+	now := time.Date(2025, 6, 2, 10, 0, 0, 0, time.UTC)
+	throttle := NewLoginThrottle(failingAttemptStore{NewMemoryAttemptStore()})
+	throttle.Now = func() time.Time { return now }
+
+	for i := 0; i < throttle.Username.MaxFailures; i++ {
+		if err := throttle.RecordFailure("socio", "10.0.0.1"); err == nil {
+			t.Fatal("expected the store error to be returned")
+		}
+	}
+
+	var locked *LoginLockedError
+	if err := throttle.Check("socio", "10.0.0.2"); !errors.As(err, &locked) || locked.RetryAfter != throttle.Username.Lockout {
+		t.Fatalf("expected the account to be locked despite the store error, got %v", err)
+	}
+
+	if err := throttle.Unlock("socio"); err != nil {
+		t.Fatalf("unlock failed: %v", err)
+	}
+	if err := throttle.Check("socio", "10.0.0.2"); err != nil {
+		t.Errorf("expected unlock to clear the failures counted in memory, got %v", err)
+	}
+}
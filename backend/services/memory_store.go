@@ -0,0 +1,795 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MemoryStore implementa los repositorios de usuarios, actividades e
+// inscripciones en memoria, con las mismas reglas que la base: cupos, lista de
+// espera con promoción, sesiones con cupo propio, historial y borrado en
+// cascada. Sirve para tests de los servicios sin base de datos. No guarda la
+// auditoría.
+type MemoryStore struct {
+	mu           sync.Mutex
+	lastID       map[string]int
+	users        map[int]dao.User
+	activities   map[int]dao.Activity
+	schedules    map[int]dao.Schedule
+	sessions     map[int]dao.ClassSession
+	inscriptions map[int]dao.Inscription
+	history      []dao.InscriptionHistory
+	waitlist     map[int]dao.WaitlistEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		lastID:       map[string]int{},
+		users:        map[int]dao.User{},
+		activities:   map[int]dao.Activity{},
+		schedules:    map[int]dao.Schedule{},
+		sessions:     map[int]dao.ClassSession{},
+		inscriptions: map[int]dao.Inscription{},
+		waitlist:     map[int]dao.WaitlistEntry{},
+	}
+}
+
+// nextID devuelve el próximo ID autoincremental de la tabla
+func (s *MemoryStore) nextID(table string) int {
+	s.lastID[table]++
+	return s.lastID[table]
+}
+
+// byID devuelve los valores ordenados por ID, como los devuelve la base
+func byID[T any](rows map[int]T, keep func(T) bool) []T {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	result := []T{}
+	for _, id := range ids {
+		if keep == nil || keep(rows[id]) {
+			result = append(result, rows[id])
+		}
+	}
+	return result
+}
+
+// ================ USUARIOS ================
+
+func (s *MemoryStore) GetUserByID(id int) (dao.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return dao.User{}, gorm.ErrRecordNotFound
+	}
+	return user, nil
+}
+
+func (s *MemoryStore) GetUserByUsername(username string) (dao.User, error) {
+	return s.findUser(func(user dao.User) bool { return user.Username == username })
+}
+
+func (s *MemoryStore) GetUserByEmail(email string) (dao.User, error) {
+	return s.findUser(func(user dao.User) bool { return user.Email != nil && *user.Email == email })
+}
+
+func (s *MemoryStore) findUser(match func(dao.User) bool) (dao.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := byID(s.users, match)
+	if len(found) == 0 {
+		return dao.User{}, gorm.ErrRecordNotFound
+	}
+	return found[0], nil
+}
+
+func (s *MemoryStore) GetAllUsers() ([]dao.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return byID(s.users, nil), nil
+}
+
+func (s *MemoryStore) CreateUser(user dao.User, audit dao.AuditEvent) (dao.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkUniqueUser(user); err != nil {
+		return dao.User{}, err
+	}
+	user.ID = s.nextID("users")
+	s.users[user.ID] = user
+	return user, nil
+}
+
+func (s *MemoryStore) UpdateUser(user dao.User, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.users[user.ID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if err := s.checkUniqueUser(user); err != nil {
+		return err
+	}
+	// Los roles se cambian aparte, como en la base
+	user.Roles = current.Roles
+	s.users[user.ID] = user
+	return nil
+}
+
+// checkUniqueUser verifica los índices únicos de username y email
+func (s *MemoryStore) checkUniqueUser(user dao.User) error {
+	for _, other := range s.users {
+		if other.ID == user.ID {
+			continue
+		}
+		if other.Username == user.Username ||
+			(user.Email != nil && other.Email != nil && *user.Email == *other.Email) {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(id int, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.users, id)
+
+	// Las inscripciones y las listas de espera se borran en cascada
+	for inscriptionID, inscription := range s.inscriptions {
+		if inscription.ID_usuario == id {
+			delete(s.inscriptions, inscriptionID)
+		}
+	}
+	for entryID, entry := range s.waitlist {
+		if entry.ID_usuario == id {
+			delete(s.waitlist, entryID)
+		}
+	}
+	return nil
+}
+
+// ================ ACTIVIDADES ================
+
+func (s *MemoryStore) GetActivityByID(id int) (dao.Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, ok := s.activities[id]
+	if !ok {
+		return dao.Activity{}, gorm.ErrRecordNotFound
+	}
+	return s.withAvailableSlots(activity), nil
+}
+
+func (s *MemoryStore) GetActivities() (dao.Activities, error) {
+	return s.findActivities(nil), nil
+}
+
+func (s *MemoryStore) GetActivitiesByCategory(categoria string) (dao.Activities, error) {
+	return s.findActivities(func(activity dao.Activity) bool { return activity.Categoria == categoria }), nil
+}
+
+func (s *MemoryStore) GetActivitiesByProfesor(profesor string) (dao.Activities, error) {
+	return s.findActivities(func(activity dao.Activity) bool { return activity.Profesor == profesor }), nil
+}
+
+func (s *MemoryStore) GetActivitiesByDay(dia int) (dao.Activities, error) {
+	return s.findActivities(func(activity dao.Activity) bool {
+		return slices.ContainsFunc(activity.Horarios, func(slot dao.ActivitySlot) bool { return slot.Dia == dia })
+	}), nil
+}
+
+func (s *MemoryStore) GetActivitiesWithAvailableSlots() (dao.Activities, error) {
+	return s.findActivities(func(activity dao.Activity) bool { return activity.CuposDisponibles > 0 }), nil
+}
+
+// SearchActivitiesByName busca sin distinguir mayúsculas, como LOWER(nombre) LIKE
+func (s *MemoryStore) SearchActivitiesByName(name string) (dao.Activities, error) {
+	name = strings.ToLower(name)
+	return s.findActivities(func(activity dao.Activity) bool {
+		return strings.Contains(strings.ToLower(activity.Nombre), name)
+	}), nil
+}
+
+// findActivities filtra las actividades ya con sus cupos disponibles calculados
+func (s *MemoryStore) findActivities(keep func(dao.Activity) bool) dao.Activities {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var activities dao.Activities
+	for _, activity := range byID(s.activities, nil) {
+		activity = s.withAvailableSlots(activity)
+		if keep == nil || keep(activity) {
+			activities = append(activities, activity)
+		}
+	}
+	return activities
+}
+
+func (s *MemoryStore) InsertActivity(activity dao.Activity, audit dao.AuditEvent) (dao.Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity.ID_actividad = s.nextID("activities")
+	activity.CuposDisponibles = 0
+	activity.Horarios = s.newSlots(activity.ID_actividad, activity.Horarios)
+	s.activities[activity.ID_actividad] = activity
+	return s.withAvailableSlots(activity), nil
+}
+
+func (s *MemoryStore) UpdateActivity(activity dao.Activity, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureCapacity(activity.ID_actividad, activity.Capacidad); err != nil {
+		return err
+	}
+	activity.CuposDisponibles = 0
+	activity.Horarios = s.newSlots(activity.ID_actividad, activity.Horarios)
+	s.activities[activity.ID_actividad] = activity
+	if sessions != nil {
+		s.syncSessions(activity.ID_actividad, sessions, from, to, audit)
+	}
+	return nil
+}
+
+// newSlots copia los horarios de una actividad con IDs nuevos, ordenados por
+// día y hora como en la base
+func (s *MemoryStore) newSlots(activityID int, horarios []dao.ActivitySlot) []dao.ActivitySlot {
+	slots := slices.Clone(horarios)
+	for i := range slots {
+		slots[i].ID_horario = s.nextID("activity_slots")
+		slots[i].ID_actividad = activityID
+	}
+	slices.SortStableFunc(slots, func(a, b dao.ActivitySlot) int {
+		if a.Dia != b.Dia {
+			return a.Dia - b.Dia
+		}
+		return strings.Compare(a.Hora_inicio, b.Hora_inicio)
+	})
+	return slots
+}
+
+func (s *MemoryStore) UpdateActivityCapacity(id int, capacidad int, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.ensureCapacity(id, capacidad); err != nil {
+		return err
+	}
+	activity := s.activities[id]
+	activity.Capacidad = capacidad
+	s.activities[id] = activity
+	return nil
+}
+
+// ensureCapacity verifica que la actividad exista y que la capacidad alcance
+// para las inscripciones semanales activas y para las de cada sesión futura
+func (s *MemoryStore) ensureCapacity(id int, capacidad int) error {
+	if _, ok := s.activities[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if capacidad < s.countActive(id, nil) {
+		return clients.ErrCapacityBelowInscriptions
+	}
+	now := time.Now()
+	for _, session := range s.sessions {
+		if session.ID_actividad == id && session.Inicio.After(now) && capacidad < s.countActive(id, &session.ID_sesion) {
+			return clients.ErrCapacityBelowInscriptions
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteActivity(id int, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activities[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.activities, id)
+
+	// La recurrencia, las sesiones, las inscripciones y la lista de espera se
+	// borran en cascada
+	delete(s.schedules, id)
+	for sessionID, session := range s.sessions {
+		if session.ID_actividad == id {
+			delete(s.sessions, sessionID)
+		}
+	}
+	for inscriptionID, inscription := range s.inscriptions {
+		if inscription.ID_actividad == id {
+			delete(s.inscriptions, inscriptionID)
+		}
+	}
+	for entryID, entry := range s.waitlist {
+		if entry.ID_actividad == id {
+			delete(s.waitlist, entryID)
+		}
+	}
+	return nil
+}
+
+// withAvailableSlots completa CuposDisponibles con la capacidad menos las
+// inscripciones semanales activas. Copia los horarios para que quien la reciba
+// no modifique los guardados.
+func (s *MemoryStore) withAvailableSlots(activity dao.Activity) dao.Activity {
+	activity.Horarios = slices.Clone(activity.Horarios)
+	activity.CuposDisponibles = activity.Capacidad - s.countActive(activity.ID_actividad, nil)
+	return activity
+}
+
+// countActive cuenta las inscripciones activas de una actividad: las
+// semanales, o las de la sesión si sessionID no es nil
+func (s *MemoryStore) countActive(activityID int, sessionID *int) int {
+	count := 0
+	for _, inscription := range s.inscriptions {
+		if inscription.ID_actividad == activityID && sameSession(inscription.ID_sesion, sessionID) && inscription.Estado == dao.EstadoActiva {
+			count++
+		}
+	}
+	return count
+}
+
+// isInscribed indica si el usuario tiene una inscripción activa en la
+// actividad: la semanal, o la de la sesión si sessionID no es nil
+func (s *MemoryStore) isInscribed(userID int, activityID int, sessionID *int) bool {
+	for _, inscription := range s.inscriptions {
+		if inscription.ID_usuario == userID && inscription.ID_actividad == activityID &&
+			sameSession(inscription.ID_sesion, sessionID) && inscription.Estado == dao.EstadoActiva {
+			return true
+		}
+	}
+	return false
+}
+
+// sameSession compara dos sesiones; nil es la inscripción semanal
+func sameSession(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// ================ RECURRENCIAS Y SESIONES ================
+
+func (s *MemoryStore) GetSchedule(activityID int) (dao.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedule, ok := s.schedules[activityID]
+	if !ok {
+		return dao.Schedule{}, gorm.ErrRecordNotFound
+	}
+	return schedule, nil
+}
+
+func (s *MemoryStore) GetSchedules() ([]dao.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := byID(s.schedules, nil)
+	for i := range schedules {
+		schedules[i].Actividad = s.withAvailableSlots(s.activities[schedules[i].ID_actividad])
+	}
+	return schedules, nil
+}
+
+func (s *MemoryStore) SaveSchedule(schedule dao.Schedule, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activities[schedule.ID_actividad]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	schedule.Actividad = dao.Activity{}
+	schedule.Excepciones = slices.Clone(schedule.Excepciones)
+	slices.Sort(schedule.Excepciones)
+	schedule.UpdatedAt = time.Now()
+	s.schedules[schedule.ID_actividad] = schedule
+	s.syncSessions(schedule.ID_actividad, sessions, from, to, audit)
+	return nil
+}
+
+func (s *MemoryStore) SyncSessions(activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.activities[activityID]; !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return s.syncSessions(activityID, sessions, from, to, audit), nil
+}
+
+// syncSessions deja en [from, to) exactamente las sesiones pedidas, como clients.SyncSessions
+func (s *MemoryStore) syncSessions(activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) int {
+	wanted := make(map[int64]dao.ClassSession, len(sessions))
+	for _, session := range sessions {
+		wanted[session.Inicio.Unix()] = session
+	}
+
+	for id, session := range s.sessions {
+		if session.ID_actividad != activityID || session.Inicio.Before(from) || !session.Inicio.Before(to) {
+			continue
+		}
+		want, ok := wanted[session.Inicio.Unix()]
+		if !ok {
+			if !session.Cancelada {
+				s.cancelSession(session, audit)
+			}
+			continue
+		}
+		delete(wanted, session.Inicio.Unix())
+		session.Cancelada = false
+		session.Fin = want.Fin
+		s.sessions[id] = session
+	}
+
+	created := 0
+	for _, session := range sessions {
+		if _, ok := wanted[session.Inicio.Unix()]; !ok {
+			continue
+		}
+		session.ID_sesion = s.nextID("class_sessions")
+		session.ID_actividad = activityID
+		session.Cancelada = false
+		session.CuposDisponibles = 0
+		session.Actividad = dao.Activity{}
+		s.sessions[session.ID_sesion] = session
+		created++
+	}
+	return created
+}
+
+// cancelSession cancela la sesión y sus inscripciones activas, o la borra si nunca tuvo inscripciones
+func (s *MemoryStore) cancelSession(session dao.ClassSession, audit dao.AuditEvent) {
+	booked := false
+	now := time.Now()
+	for id, inscription := range s.inscriptions {
+		if !sameSession(inscription.ID_sesion, &session.ID_sesion) {
+			continue
+		}
+		booked = true
+		if inscription.Estado != dao.EstadoActiva {
+			continue
+		}
+		inscription.Estado = dao.EstadoCancelada
+		inscription.CancelledAt = &now
+		inscription.CancelledBy = audit.ID_actor
+		inscription.CancelReason = "clase suspendida"
+		inscription.UpdatedAt = now
+		s.inscriptions[id] = inscription
+		s.addHistory(id, dao.EstadoCancelada, "cancelada: clase suspendida")
+	}
+	if !booked {
+		delete(s.sessions, session.ID_sesion)
+		return
+	}
+	session.Cancelada = true
+	s.sessions[session.ID_sesion] = session
+}
+
+func (s *MemoryStore) GetSessions(activityID int, from, to time.Time) ([]dao.ClassSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := byID(s.sessions, func(session dao.ClassSession) bool {
+		return session.ID_actividad == activityID && !session.Cancelada &&
+			!session.Inicio.Before(from) && session.Inicio.Before(to)
+	})
+	slices.SortFunc(sessions, func(a, b dao.ClassSession) int { return a.Inicio.Compare(b.Inicio) })
+	for i := range sessions {
+		sessions[i] = s.withSessionSlots(sessions[i])
+	}
+	return sessions, nil
+}
+
+func (s *MemoryStore) GetSessionByID(id int) (dao.ClassSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[id]
+	if !ok {
+		return dao.ClassSession{}, gorm.ErrRecordNotFound
+	}
+	return s.withSessionSlots(session), nil
+}
+
+// withSessionSlots completa CuposDisponibles con la capacidad menos las reservas activas de la sesión
+func (s *MemoryStore) withSessionSlots(session dao.ClassSession) dao.ClassSession {
+	session.CuposDisponibles = s.activities[session.ID_actividad].Capacidad - s.countActive(session.ID_actividad, &session.ID_sesion)
+	return session
+}
+
+// ================ INSCRIPCIONES ================
+
+func (s *MemoryStore) EnrollUser(inscription dao.Inscription, audit dao.AuditEvent) (dao.Inscription, dao.Activity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, ok := s.activities[inscription.ID_actividad]
+	if !ok {
+		return dao.Inscription{}, dao.Activity{}, gorm.ErrRecordNotFound
+	}
+	if inscription.ID_sesion != nil {
+		session, ok := s.sessions[*inscription.ID_sesion]
+		if !ok || session.ID_actividad != activity.ID_actividad || session.Cancelada || !session.Inicio.After(time.Now()) {
+			return dao.Inscription{}, dao.Activity{}, clients.ErrSessionUnavailable
+		}
+	}
+	if s.isInscribed(inscription.ID_usuario, inscription.ID_actividad, inscription.ID_sesion) {
+		return dao.Inscription{}, dao.Activity{}, clients.ErrAlreadyInscribed
+	}
+	if s.countActive(activity.ID_actividad, inscription.ID_sesion) >= activity.Capacidad {
+		return dao.Inscription{}, dao.Activity{}, clients.ErrNoAvailableSlots
+	}
+
+	inscription = s.createInscription(inscription, "inscripción creada")
+	if inscription.ID_sesion != nil {
+		inscription.Sesion = s.sessionOf(inscription)
+		return inscription, s.withAvailableSlots(activity), nil
+	}
+
+	// Si estaba en la lista de espera de esta actividad ya no lo necesita
+	for entryID, entry := range s.waitlist {
+		if entry.ID_usuario == inscription.ID_usuario && entry.ID_actividad == inscription.ID_actividad {
+			delete(s.waitlist, entryID)
+		}
+	}
+
+	return inscription, s.withAvailableSlots(activity), nil
+}
+
+func (s *MemoryStore) CancelInscription(id int, cancelledBy int, reason string, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inscription, ok := s.inscriptions[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if inscription.Estado != dao.EstadoActiva {
+		return clients.ErrInscriptionNotActive
+	}
+
+	now := time.Now()
+	inscription.Estado = dao.EstadoCancelada
+	inscription.CancelledAt = &now
+	inscription.CancelledBy = &cancelledBy
+	inscription.CancelReason = reason
+	inscription.UpdatedAt = now
+	s.inscriptions[id] = inscription
+
+	detalle := "cancelada"
+	if reason != "" {
+		detalle += ": " + reason
+	}
+	s.addHistory(id, dao.EstadoCancelada, detalle)
+
+	if inscription.ID_sesion == nil {
+		s.promoteFromWaitlist(inscription.ID_actividad)
+	}
+	return nil
+}
+
+// promoteFromWaitlist inscribe a los primeros de la lista de espera mientras haya cupos
+func (s *MemoryStore) promoteFromWaitlist(activityID int) {
+	activity := s.activities[activityID]
+	for s.countActive(activityID, nil) < activity.Capacidad {
+		waiting := byID(s.waitlist, func(entry dao.WaitlistEntry) bool { return entry.ID_actividad == activityID })
+		if len(waiting) == 0 {
+			return
+		}
+		next := waiting[0]
+		delete(s.waitlist, next.ID_espera)
+
+		if s.isInscribed(next.ID_usuario, activityID, nil) {
+			continue
+		}
+		s.createInscription(dao.Inscription{ID_usuario: next.ID_usuario, ID_actividad: activityID}, "promovida desde lista de espera")
+	}
+}
+
+// createInscription crea una inscripción activa y registra el alta en su historial
+func (s *MemoryStore) createInscription(inscription dao.Inscription, detalle string) dao.Inscription {
+	now := time.Now()
+	inscription.ID_inscripcion = s.nextID("inscriptions")
+	inscription.Sesion = nil
+	inscription.Estado = dao.EstadoActiva
+	inscription.Fecha_inscripcion = now
+	inscription.CreatedAt = now
+	inscription.UpdatedAt = now
+	s.inscriptions[inscription.ID_inscripcion] = inscription
+	s.addHistory(inscription.ID_inscripcion, dao.EstadoActiva, detalle)
+	return inscription
+}
+
+// addHistory registra un cambio de estado en el historial de la inscripción
+func (s *MemoryStore) addHistory(inscriptionID int, estado string, detalle string) {
+	s.history = append(s.history, dao.InscriptionHistory{
+		ID_historial:   s.nextID("inscription_histories"),
+		ID_inscripcion: inscriptionID,
+		Estado:         estado,
+		Detalle:        detalle,
+		CreatedAt:      time.Now(),
+	})
+}
+
+func (s *MemoryStore) CompleteInscription(id int, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inscription, ok := s.inscriptions[id]
+	if !ok || inscription.Estado != dao.EstadoActiva {
+		return clients.ErrInscriptionNotActive
+	}
+	inscription.Estado = dao.EstadoCompletada
+	inscription.UpdatedAt = time.Now()
+	s.inscriptions[id] = inscription
+	s.addHistory(id, dao.EstadoCompletada, "clase finalizada")
+	return nil
+}
+
+func (s *MemoryStore) GetInscriptionByID(id int) (dao.Inscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inscription, ok := s.inscriptions[id]
+	if !ok {
+		return dao.Inscription{}, gorm.ErrRecordNotFound
+	}
+	return inscription, nil
+}
+
+func (s *MemoryStore) GetInscriptionByUserAndActivity(userID int, activityID int) (dao.Inscription, error) {
+	inscriptions := s.findInscriptions(func(inscription dao.Inscription) bool {
+		return inscription.ID_usuario == userID && inscription.ID_actividad == activityID &&
+			inscription.ID_sesion == nil && inscription.Estado == dao.EstadoActiva
+	})
+	if len(inscriptions) == 0 {
+		return dao.Inscription{}, gorm.ErrRecordNotFound
+	}
+	return inscriptions[0], nil
+}
+
+func (s *MemoryStore) GetInscriptionsByUserID(userID int, estado string) ([]dao.Inscription, error) {
+	return s.withRelations(s.findInscriptions(func(inscription dao.Inscription) bool {
+		return inscription.ID_usuario == userID && (estado == "" || inscription.Estado == estado)
+	})), nil
+}
+
+func (s *MemoryStore) GetAllInscriptions(estado string) ([]dao.Inscription, error) {
+	return s.withRelations(s.findInscriptions(func(inscription dao.Inscription) bool {
+		return estado == "" || inscription.Estado == estado
+	})), nil
+}
+
+// withRelations completa el Usuario, la Actividad y la Sesion de cada inscripción
+func (s *MemoryStore) withRelations(inscriptions []dao.Inscription) []dao.Inscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range inscriptions {
+		inscriptions[i].Usuario = s.users[inscriptions[i].ID_usuario]
+		inscriptions[i].Actividad = s.withAvailableSlots(s.activities[inscriptions[i].ID_actividad])
+		inscriptions[i].Sesion = s.sessionOf(inscriptions[i])
+	}
+	return inscriptions
+}
+
+// sessionOf devuelve la sesión reservada por la inscripción, o nil si es semanal
+func (s *MemoryStore) sessionOf(inscription dao.Inscription) *dao.ClassSession {
+	if inscription.ID_sesion == nil {
+		return nil
+	}
+	session := s.withSessionSlots(s.sessions[*inscription.ID_sesion])
+	return &session
+}
+
+func (s *MemoryStore) GetActiveSessionBookings() ([]dao.Inscription, error) {
+	inscriptions := s.findInscriptions(func(inscription dao.Inscription) bool {
+		return inscription.Estado == dao.EstadoActiva && inscription.ID_sesion != nil
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range inscriptions {
+		inscriptions[i].Sesion = s.sessionOf(inscriptions[i])
+	}
+	return inscriptions, nil
+}
+
+func (s *MemoryStore) GetActiveInscriptionsByActivityID(activityID int) ([]dao.Inscription, error) {
+	inscriptions := s.findInscriptions(func(inscription dao.Inscription) bool {
+		return inscription.ID_actividad == activityID && inscription.Estado == dao.EstadoActiva
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range inscriptions {
+		inscriptions[i].Usuario = s.users[inscriptions[i].ID_usuario]
+	}
+	return inscriptions, nil
+}
+
+func (s *MemoryStore) findInscriptions(keep func(dao.Inscription) bool) []dao.Inscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return byID(s.inscriptions, keep)
+}
+
+func (s *MemoryStore) GetInscriptionHistory(inscriptionID int) ([]dao.InscriptionHistory, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var history []dao.InscriptionHistory
+	for _, entry := range s.history {
+		if entry.ID_inscripcion == inscriptionID {
+			history = append(history, entry)
+		}
+	}
+	return history, nil
+}
+
+// ================ LISTA DE ESPERA ================
+
+func (s *MemoryStore) JoinWaitlist(entry dao.WaitlistEntry, audit dao.AuditEvent) (dao.WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	activity, ok := s.activities[entry.ID_actividad]
+	if !ok {
+		return dao.WaitlistEntry{}, gorm.ErrRecordNotFound
+	}
+	if s.isInscribed(entry.ID_usuario, entry.ID_actividad, nil) {
+		return dao.WaitlistEntry{}, clients.ErrAlreadyInscribed
+	}
+	if s.countActive(entry.ID_actividad, nil) < activity.Capacidad {
+		return dao.WaitlistEntry{}, clients.ErrSlotsAvailable
+	}
+	for _, other := range s.waitlist {
+		if other.ID_usuario == entry.ID_usuario && other.ID_actividad == entry.ID_actividad {
+			return dao.WaitlistEntry{}, clients.ErrAlreadyInWaitlist
+		}
+	}
+
+	entry.ID_espera = s.nextID("waitlist_entries")
+	entry.CreatedAt = time.Now()
+	s.waitlist[entry.ID_espera] = entry
+	return s.withPosition(entry), nil
+}
+
+func (s *MemoryStore) GetWaitlistEntryByID(id int) (dao.WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.waitlist[id]
+	if !ok {
+		return dao.WaitlistEntry{}, gorm.ErrRecordNotFound
+	}
+	return s.withPosition(entry), nil
+}
+
+func (s *MemoryStore) GetWaitlistByUserID(userID int) ([]dao.WaitlistEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := byID(s.waitlist, func(entry dao.WaitlistEntry) bool { return entry.ID_usuario == userID })
+	for i := range entries {
+		entries[i] = s.withPosition(entries[i])
+	}
+	return entries, nil
+}
+
+func (s *MemoryStore) DeleteWaitlistEntry(id int, audit dao.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.waitlist[id]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(s.waitlist, id)
+	return nil
+}
+
+// withPosition completa el lugar de la entrada en la fila de su actividad
+func (s *MemoryStore) withPosition(entry dao.WaitlistEntry) dao.WaitlistEntry {
+	entry.Posicion = 0
+	for _, other := range s.waitlist {
+		if other.ID_actividad == entry.ID_actividad && other.ID_espera <= entry.ID_espera {
+			entry.Posicion++
+		}
+	}
+	return entry
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/oidc"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// oidcStateDuration es cuánto tiempo tiene el usuario para autenticarse en el proveedor
+const oidcStateDuration = 10 * time.Minute
+
+// oidcProviders son los proveedores externos habilitados, por nombre
+var oidcProviders = map[string]*oidc.Provider{}
+
+// SetOIDCProviders cambia los proveedores externos habilitados
+func SetOIDCProviders(providers map[string]*oidc.Provider) {
+	oidcProviders = providers
+}
+
+// OIDCProviderNames devuelve los nombres de los proveedores habilitados
+func OIDCProviderNames() []string {
+	names := []string{}
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartOIDCLogin empieza un login con un proveedor externo y devuelve la URL a
+// la que hay que redirigir al usuario
+func StartOIDCLogin(providerName string) (string, error) {
+	provider, ok := oidcProviders[providerName]
+	if !ok {
+		return "", errors.New("unknown provider")
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate state: %w", err)
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate PKCE verifier: %w", err)
+	}
+
+	authURL, err := provider.AuthCodeURL(state, nonce, challenge)
+	if err != nil {
+		return "", err
+	}
+
+	err = clients.CreateOIDCLoginState(dao.OIDCLoginState{
+		StateHash:    utils.HashSHA256(state),
+		Proveedor:    providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(oidcStateDuration),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store login state: %w", err)
+	}
+	return authURL, nil
+}
+
+// CompleteOIDCLogin canjea el code del callback, vincula la identidad externa
+// con un usuario (o crea un socio nuevo) y termina el login igual que con
+// contraseña: devuelve los tokens o el challenge del segundo factor. El actor
+// todavía no está autenticado: solo trae la IP y el request ID.
+func CompleteOIDCLogin(providerName, code, state string, actor domain.Actor) (domain.User, *domain.TwoFactorChallenge, error) {
+	provider, ok := oidcProviders[providerName]
+	if !ok {
+		return domain.User{}, nil, errors.New("unknown provider")
+	}
+
+	loginState, err := clients.ConsumeOIDCLoginState(utils.HashSHA256(state), time.Now())
+	if err != nil || loginState.Proveedor != providerName {
+		return domain.User{}, nil, errors.New("invalid or expired state")
+	}
+
+	claims, err := provider.Exchange(code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.WithError(err).WithField("provider", providerName).Warn("OIDC code exchange failed")
+		return domain.User{}, nil, errors.New("external authentication failed")
+	}
+
+	user, err := resolveOIDCUser(providerName, claims, actor)
+	if err != nil {
+		return domain.User{}, nil, err
+	}
+	return finishLogin(user, actor.IP)
+}
+
+// resolveOIDCUser busca el usuario de una identidad externa. Si no está
+// vinculada, la vincula al usuario con el mismo email, solo si el proveedor lo
+// verificó y el usuario local también; si no hay ninguno, crea un socio nuevo.
+func resolveOIDCUser(providerName string, claims oidc.Claims, actor domain.Actor) (dao.User, error) {
+	if user, err := clients.GetUserByIdentity(providerName, claims.Subject); err == nil {
+		return user, nil
+	}
+
+	identity := dao.ExternalIdentity{Proveedor: providerName, Subject: claims.Subject, Email: claims.Email}
+
+	var email *string
+	if claims.EmailVerified {
+		email, _ = normalizeEmail(claims.Email)
+	}
+	if email != nil {
+		if user, err := clients.GetUserByEmail(*email); err == nil {
+			// Un email local sin verificar pudo haberlo cargado cualquiera que
+			// conozca la dirección: vincularlo le daría a esa persona la cuenta
+			// del dueño real. Se crea un socio aparte, sin email, porque el
+			// email ya está tomado.
+			if user.EmailVerificadoEn == nil {
+				log.WithFields(log.Fields{"user_id": user.ID, "provider": providerName}).Warn("Not linking external identity to an unverified email")
+				email = nil
+			} else {
+				identity.ID_usuario = user.ID
+				actor.UserID = user.ID
+				if err := clients.LinkIdentity(identity, auditFrom(actor)); err != nil {
+					return dao.User{}, fmt.Errorf("failed to link identity: %w", err)
+				}
+				log.WithFields(log.Fields{"user_id": user.ID, "provider": providerName}).Info("External identity linked by verified email")
+				return user, nil
+			}
+		}
+	}
+
+	roles, err := clients.GetRolesByNames([]string{dao.RolSocio})
+	if err != nil || len(roles) == 0 {
+		return dao.User{}, fmt.Errorf("failed to load default role: %v", err)
+	}
+	username, err := availableUsername(claims)
+	if err != nil {
+		return dao.User{}, err
+	}
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+	var verifiedAt *time.Time
+	if email != nil {
+		now := time.Now()
+		verifiedAt = &now
+	}
+
+	// Sin contraseña local: solo puede entrar con el proveedor o tras restablecerla
+	created, err := clients.CreateUserWithIdentity(dao.User{
+		Name:     name,
+		Username: username,
+		Email:    email,
+		Roles:    roles,
+		// Solo se guarda el email si el proveedor lo verificó
+		EmailVerificadoEn: verifiedAt,
+	}, identity, auditFrom(actor))
+	if err != nil {
+		return dao.User{}, fmt.Errorf("failed to create user: %w", err)
+	}
+	log.WithFields(log.Fields{"user_id": created.ID, "provider": providerName}).Info("User created from external identity")
+	return clients.GetUserByID(created.ID)
+}
+
+// availableUsername elige un username libre a partir del email o del nombre
+func availableUsername(claims oidc.Claims) (string, error) {
+	base, _, _ := strings.Cut(strings.ToLower(claims.Email), "@")
+	if base == "" {
+		base = strings.ToLower(strings.Join(strings.Fields(claims.Name), "."))
+	}
+	if base == "" {
+		base = "socio"
+	}
+
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = base + strconv.Itoa(i+1)
+		}
+		if _, err := clients.GetUserByUsername(candidate); err != nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("failed to find an available username")
+}
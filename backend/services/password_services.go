@@ -0,0 +1,128 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/mailer"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// passwordResetDuration es cuánto vale el link enviado por email
+	passwordResetDuration = time.Hour
+	// passwordResetLimit es cuántos emails de restablecimiento se envían por hora a un usuario
+	passwordResetLimit = 3
+)
+
+// mailSender envía los emails a los usuarios. Por defecto los guarda en
+// memoria; main.go lo configura según el entorno.
+var mailSender mailer.Mailer = mailer.NewMemoryMailer()
+
+// passwordResetURL es la página del frontend que recibe el token
+var passwordResetURL = "http://localhost:3000/reset-password"
+
+// SetMailer cambia cómo se envían los emails
+func SetMailer(m mailer.Mailer) {
+	mailSender = m
+}
+
+// SetPasswordResetURL cambia la página a la que apunta el link de restablecimiento
+func SetPasswordResetURL(resetURL string) {
+	passwordResetURL = resetURL
+}
+
+// RequestPasswordReset envía un link para restablecer la contraseña al email
+// del usuario. Si el usuario no existe o no tiene email no hace nada, para no
+// revelar qué cuentas están registradas.
+func RequestPasswordReset(email, username string) error {
+	user, err := findUserForReset(email, username)
+	if err != nil || user.Email == nil {
+		log.WithFields(log.Fields{"email": email, "username": username}).Info("Password reset requested for unknown account")
+		return nil
+	}
+
+	now := time.Now()
+	recent, err := clients.CountPasswordResetsSince(user.ID, now.Add(-time.Hour))
+	if err != nil {
+		return fmt.Errorf("failed to count password resets: %w", err)
+	}
+	if recent >= passwordResetLimit {
+		log.WithField("user_id", user.ID).Warn("Too many password reset requests")
+		return nil
+	}
+
+	token, err := utils.NewOpaqueToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	err = clients.CreatePasswordReset(dao.PasswordReset{
+		TokenHash:  utils.HashSHA256(token),
+		ID_usuario: user.ID,
+		ExpiresAt:  now.Add(passwordResetDuration),
+	}, now)
+	if err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	link := passwordResetURL + "?token=" + url.QueryEscape(token)
+	return mailSender.Send(mailer.Message{
+		To:      *user.Email,
+		Subject: "Restablecer tu contraseña",
+		Body: fmt.Sprintf("Hola %s,\n\n"+
+			"Recibimos un pedido para restablecer la contraseña de tu cuenta %s.\n"+
+			"Para elegir una nueva, entrá a este link dentro de la próxima hora:\n\n%s\n\n"+
+			"Si no lo pediste, ignorá este email: tu contraseña no cambia.\n",
+			user.Name, user.Username, link),
+	})
+}
+
+// ResetPassword cambia la contraseña con un token enviado por email. El token
+// se puede usar una sola vez y todas las sesiones del usuario se cierran.
+func ResetPassword(token, password string, actor domain.Actor) error {
+	if token == "" {
+		return errors.New("invalid or expired reset token")
+	}
+	if password == "" {
+		return errors.New("password cannot be empty")
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	userID, err := clients.ResetPassword(utils.HashSHA256(token), hashedPassword, time.Now(), auditFrom(actor))
+	if err != nil {
+		return err
+	}
+
+	// Quien restableció la contraseña recuperó la cuenta: ya no tiene sentido el bloqueo por fallos
+	if user, err := clients.GetUserByID(userID); err == nil {
+		if err := loginThrottle.Unlock(user.Username); err != nil {
+			log.WithError(err).WithField("user_id", userID).Warn("Failed to unlock user after password reset")
+		}
+	}
+	return nil
+}
+
+func findUserForReset(email, username string) (dao.User, error) {
+	if email != "" {
+		normalized, err := normalizeEmail(email)
+		if err != nil {
+			return dao.User{}, err
+		}
+		return clients.GetUserByEmail(*normalized)
+	}
+	if username != "" {
+		return clients.GetUserByUsername(username)
+	}
+	return dao.User{}, errors.New("email or username is required")
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// birthDateLayout es el formato de las fechas de nacimiento en la API
+const birthDateLayout = "2006-01-02"
+
+// e164 es un número de teléfono internacional: + código de país y hasta 15 dígitos
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// GetProfile devuelve el perfil completo del usuario autenticado
+func GetProfile(userID int) (domain.User, error) {
+	userDao, err := clients.GetUserByID(userID)
+	if err != nil {
+		return domain.User{}, errors.New("user not found")
+	}
+	return toUser(userDao), nil
+}
+
+// UpdateProfile modifica los datos del perfil del propio usuario. Si cambia el
+// email se le envía un nuevo link de verificación.
+func UpdateProfile(userID int, request domain.ProfileUpdateRequest, actor domain.Actor) (domain.User, error) {
+	userDao, err := clients.GetUserByID(userID)
+	if err != nil {
+		return domain.User{}, errors.New("user not found")
+	}
+
+	emailChanged, err := applyProfile(&userDao, request, clients.GetUserByEmail)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if err := clients.UpdateUser(userDao, auditFrom(actor)); err != nil {
+		return domain.User{}, fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	if emailChanged {
+		notifyEmailVerification(userDao)
+	}
+	return toUser(userDao), nil
+}
+
+// applyProfile valida y copia al usuario los campos presentes en la request.
+// Devuelve si cambió el email, en cuyo caso queda sin verificar. findByEmail
+// busca si otro usuario ya tiene el email nuevo.
+func applyProfile(user *dao.User, request domain.ProfileUpdateRequest, findByEmail func(string) (dao.User, error)) (bool, error) {
+	emailChanged := false
+
+	if request.Name != nil {
+		name := strings.TrimSpace(*request.Name)
+		if name == "" {
+			return false, errors.New("name cannot be empty")
+		}
+		user.Name = name
+	}
+	if request.Email != nil {
+		email, err := normalizeEmail(*request.Email)
+		if err != nil {
+			return false, err
+		}
+		newEmail := ""
+		if email != nil {
+			if existing, err := findByEmail(*email); err == nil && existing.ID != user.ID {
+				return false, errors.New("email already exists")
+			}
+			newEmail = *email
+		}
+		if newEmail != emailOf(*user) {
+			user.Email = email
+			user.EmailVerificadoEn = nil
+			emailChanged = email != nil
+		}
+	}
+	if request.Phone != nil {
+		phone, err := normalizePhone(*request.Phone)
+		if err != nil {
+			return false, err
+		}
+		user.Telefono = phone
+	}
+	if request.BirthDate != nil {
+		birthDate, err := parseBirthDate(*request.BirthDate, time.Now())
+		if err != nil {
+			return false, err
+		}
+		user.FechaNacimiento = birthDate
+	}
+	if request.EmergencyContact != nil {
+		name := strings.TrimSpace(request.EmergencyContact.Name)
+		phone, err := normalizePhone(request.EmergencyContact.Phone)
+		if err != nil {
+			return false, errors.New("invalid emergency contact")
+		}
+		// Se cargan los dos datos o ninguno (para borrarlo)
+		if (name == "") != (phone == "") {
+			return false, errors.New("invalid emergency contact")
+		}
+		user.ContactoEmergenciaNombre = name
+		user.ContactoEmergenciaTelefono = phone
+	}
+	if request.PhotoURL != nil {
+		photoURL, err := normalizePhotoURL(*request.PhotoURL)
+		if err != nil {
+			return false, err
+		}
+		user.FotoURL = photoURL
+	}
+
+	return emailChanged, nil
+}
+
+// normalizePhone valida un teléfono en formato E.164, ignorando espacios,
+// guiones y paréntesis. Un teléfono vacío es válido y borra el dato.
+func normalizePhone(phone string) (string, error) {
+	phone = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "").Replace(phone)
+	if phone == "" {
+		return "", nil
+	}
+	if !e164.MatchString(phone) {
+		return "", errors.New("invalid phone")
+	}
+	return phone, nil
+}
+
+// parseBirthDate interpreta una fecha AAAA-MM-DD, que no puede ser futura
+func parseBirthDate(value string, now time.Time) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	birthDate, err := time.Parse(birthDateLayout, value)
+	if err != nil || birthDate.After(now) || birthDate.Year() < 1900 {
+		return nil, errors.New("invalid birth date")
+	}
+	return &birthDate, nil
+}
+
+// normalizePhotoURL valida que la foto sea una URL http(s) absoluta
+func normalizePhotoURL(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(value) > 512 {
+		return "", errors.New("invalid photo url")
+	}
+	return value, nil
+}
+
+// notifyEmailVerification envía el link de verificación sin hacer fallar la
+// operación que cambió el email: el usuario puede pedir que se reenvíe.
+func notifyEmailVerification(user dao.User) {
+	if err := sendEmailVerification(user); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to send email verification")
+	}
+}
+
+// toUser convierte un usuario de la base al formato domain, con su perfil y sin la contraseña
+func toUser(userDao dao.User) domain.User {
+	user := domain.User{
+		ID:            userDao.ID,
+		Name:          userDao.Name,
+		Username:      userDao.Username,
+		Email:         emailOf(userDao),
+		EmailVerified: userDao.Email != nil && userDao.EmailVerificadoEn != nil,
+		Password:      "", // No devolvemos la contraseña hasheada
+		IsAdmin:       isAdmin(userDao),
+		Roles:         roleNames(userDao),
+		Phone:         userDao.Telefono,
+		PhotoURL:      userDao.FotoURL,
+	}
+	if userDao.FechaNacimiento != nil {
+		user.BirthDate = userDao.FechaNacimiento.Format(birthDateLayout)
+	}
+	if userDao.ContactoEmergenciaNombre != "" {
+		user.EmergencyContact = &domain.EmergencyContact{
+			Name:  userDao.ContactoEmergenciaNombre,
+			Phone: userDao.ContactoEmergenciaTelefono,
+		}
+	}
+	return user
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"strconv"
+	"time"
+)
+
+// UserRepository guarda los usuarios. Un usuario inexistente se informa con
+// gorm.ErrRecordNotFound, igual que en la base.
+type UserRepository interface {
+	GetUserByID(id int) (dao.User, error)
+	GetUserByUsername(username string) (dao.User, error)
+	GetUserByEmail(email string) (dao.User, error)
+	GetAllUsers() ([]dao.User, error)
+	CreateUser(user dao.User, audit dao.AuditEvent) (dao.User, error)
+	UpdateUser(user dao.User, audit dao.AuditEvent) error
+	DeleteUser(id int, audit dao.AuditEvent) error
+}
+
+// ActivityRepository guarda las actividades, su recurrencia y sus sesiones. Las
+// actividades y las sesiones se devuelven con CuposDisponibles calculado a
+// partir de las inscripciones activas.
+type ActivityRepository interface {
+	GetActivityByID(id int) (dao.Activity, error)
+	GetActivities() (dao.Activities, error)
+	GetActivitiesByCategory(categoria string) (dao.Activities, error)
+	GetActivitiesByProfesor(profesor string) (dao.Activities, error)
+	GetActivitiesByDay(dia int) (dao.Activities, error)
+	GetActivitiesWithAvailableSlots() (dao.Activities, error)
+	SearchActivitiesByName(name string) (dao.Activities, error)
+	InsertActivity(activity dao.Activity, audit dao.AuditEvent) (dao.Activity, error)
+	// UpdateActivity guarda la actividad y, si sessions no es nil, en la misma
+	// transacción deja entre from y to exactamente esas sesiones, como SyncSessions
+	UpdateActivity(activity dao.Activity, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error
+	DeleteActivity(id int, audit dao.AuditEvent) error
+	UpdateActivityCapacity(id int, capacidad int, audit dao.AuditEvent) error
+	// GetSchedule y GetSchedules devuelven la recurrencia con sus Excepciones;
+	// GetSchedules además con su Actividad
+	GetSchedule(activityID int) (dao.Schedule, error)
+	GetSchedules() ([]dao.Schedule, error)
+	// SaveSchedule y SyncSessions dejan entre from y to exactamente las sesiones
+	// recibidas, cancelando las reservas de las que ya no están
+	SaveSchedule(schedule dao.Schedule, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error
+	SyncSessions(activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) (int, error)
+	// GetSessions devuelve las sesiones no canceladas que empiezan entre from y to
+	GetSessions(activityID int, from, to time.Time) ([]dao.ClassSession, error)
+	GetSessionByID(id int) (dao.ClassSession, error)
+}
+
+// InscriptionRepository guarda las inscripciones, su historial y las listas de
+// espera. Inscribir, cancelar y anotarse en la lista de espera respetan los
+// cupos y devuelven los errores de clients (ErrNoAvailableSlots, ErrAlreadyInscribed...).
+type InscriptionRepository interface {
+	EnrollUser(inscription dao.Inscription, audit dao.AuditEvent) (dao.Inscription, dao.Activity, error)
+	CancelInscription(id int, cancelledBy int, reason string, audit dao.AuditEvent) error
+	CompleteInscription(id int, audit dao.AuditEvent) error
+	GetInscriptionByID(id int) (dao.Inscription, error)
+	GetInscriptionByUserAndActivity(userID int, activityID int) (dao.Inscription, error)
+	// GetInscriptionsByUserID y GetAllInscriptions devuelven las inscripciones
+	// con su Usuario (con roles) y su Actividad (con CuposDisponibles)
+	GetInscriptionsByUserID(userID int, estado string) ([]dao.Inscription, error)
+	GetAllInscriptions(estado string) ([]dao.Inscription, error)
+	// GetActiveSessionBookings devuelve las reservas activas de sesiones con su Sesion
+	GetActiveSessionBookings() ([]dao.Inscription, error)
+	// GetActiveInscriptionsByActivityID devuelve los inscriptos activos con su Usuario
+	GetActiveInscriptionsByActivityID(activityID int) ([]dao.Inscription, error)
+	GetInscriptionHistory(inscriptionID int) ([]dao.InscriptionHistory, error)
+	JoinWaitlist(entry dao.WaitlistEntry, audit dao.AuditEvent) (dao.WaitlistEntry, error)
+	GetWaitlistEntryByID(id int) (dao.WaitlistEntry, error)
+	GetWaitlistByUserID(userID int) ([]dao.WaitlistEntry, error)
+	DeleteWaitlistEntry(id int, audit dao.AuditEvent) error
+}
+
+// DBStore implementa los repositorios sobre la base de datos de clients
+type DBStore struct{}
+
+func NewDBStore() DBStore {
+	return DBStore{}
+}
+
+func (DBStore) GetUserByID(id int) (dao.User, error) {
+	return clients.GetUserByID(id)
+}
+
+func (DBStore) GetUserByUsername(username string) (dao.User, error) {
+	return clients.GetUserByUsername(username)
+}
+
+func (DBStore) GetUserByEmail(email string) (dao.User, error) {
+	return clients.GetUserByEmail(email)
+}
+
+func (DBStore) GetAllUsers() ([]dao.User, error) {
+	return clients.GetAllUsers()
+}
+
+func (DBStore) CreateUser(user dao.User, audit dao.AuditEvent) (dao.User, error) {
+	return clients.CreateUser(user, audit)
+}
+
+func (DBStore) UpdateUser(user dao.User, audit dao.AuditEvent) error {
+	return clients.UpdateUser(user, audit)
+}
+
+func (DBStore) DeleteUser(id int, audit dao.AuditEvent) error {
+	return clients.DeleteUser(id, audit)
+}
+
+func (DBStore) GetActivityByID(id int) (dao.Activity, error) {
+	return clients.GetActivityByID(id)
+}
+
+func (DBStore) GetActivities() (dao.Activities, error) {
+	return clients.GetActivities()
+}
+
+func (DBStore) GetActivitiesByCategory(categoria string) (dao.Activities, error) {
+	return clients.GetActivitiesByCategory(categoria)
+}
+
+func (DBStore) GetActivitiesByProfesor(profesor string) (dao.Activities, error) {
+	return clients.GetActivitiesByProfesor(profesor)
+}
+
+func (DBStore) GetActivitiesByDay(dia int) (dao.Activities, error) {
+	return clients.GetActivitiesByDay(strconv.Itoa(dia))
+}
+
+func (DBStore) GetActivitiesWithAvailableSlots() (dao.Activities, error) {
+	return clients.GetActivitiesWithAvailableSlots()
+}
+
+func (DBStore) SearchActivitiesByName(name string) (dao.Activities, error) {
+	return clients.SearchActivitiesByName(name)
+}
+
+func (DBStore) InsertActivity(activity dao.Activity, audit dao.AuditEvent) (dao.Activity, error) {
+	return clients.InsertActivity(activity, audit)
+}
+
+func (DBStore) UpdateActivity(activity dao.Activity, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	return clients.UpdateActivity(activity, sessions, from, to, audit)
+}
+
+func (DBStore) DeleteActivity(id int, audit dao.AuditEvent) error {
+	return clients.DeleteActivity(id, audit)
+}
+
+func (DBStore) UpdateActivityCapacity(id int, capacidad int, audit dao.AuditEvent) error {
+	return clients.UpdateActivityCapacity(id, capacidad, audit)
+}
+
+func (DBStore) GetSchedule(activityID int) (dao.Schedule, error) {
+	return clients.GetSchedule(activityID)
+}
+
+func (DBStore) GetSchedules() ([]dao.Schedule, error) {
+	return clients.GetSchedules()
+}
+
+func (DBStore) SaveSchedule(schedule dao.Schedule, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) error {
+	return clients.SaveSchedule(schedule, sessions, from, to, audit)
+}
+
+func (DBStore) SyncSessions(activityID int, sessions []dao.ClassSession, from, to time.Time, audit dao.AuditEvent) (int, error) {
+	return clients.SyncSessions(activityID, sessions, from, to, audit)
+}
+
+func (DBStore) GetSessions(activityID int, from, to time.Time) ([]dao.ClassSession, error) {
+	return clients.GetSessions(activityID, from, to)
+}
+
+func (DBStore) GetSessionByID(id int) (dao.ClassSession, error) {
+	return clients.GetSessionByID(id)
+}
+
+func (DBStore) EnrollUser(inscription dao.Inscription, audit dao.AuditEvent) (dao.Inscription, dao.Activity, error) {
+	return clients.EnrollUser(inscription, audit)
+}
+
+func (DBStore) CancelInscription(id int, cancelledBy int, reason string, audit dao.AuditEvent) error {
+	return clients.CancelInscription(id, cancelledBy, reason, audit)
+}
+
+func (DBStore) CompleteInscription(id int, audit dao.AuditEvent) error {
+	return clients.CompleteInscription(id, audit)
+}
+
+func (DBStore) GetInscriptionByID(id int) (dao.Inscription, error) {
+	return clients.GetInscriptionByID(id)
+}
+
+func (DBStore) GetInscriptionByUserAndActivity(userID int, activityID int) (dao.Inscription, error) {
+	return clients.GetInscriptionByUserAndActivity(userID, activityID)
+}
+
+func (DBStore) GetInscriptionsByUserID(userID int, estado string) ([]dao.Inscription, error) {
+	return clients.GetInscriptionsByUserID(userID, estado)
+}
+
+func (DBStore) GetAllInscriptions(estado string) ([]dao.Inscription, error) {
+	return clients.GetAllInscriptions(estado)
+}
+
+func (DBStore) GetActiveSessionBookings() ([]dao.Inscription, error) {
+	return clients.GetActiveSessionBookings()
+}
+
+func (DBStore) GetActiveInscriptionsByActivityID(activityID int) ([]dao.Inscription, error) {
+	return clients.GetActiveInscriptionsByActivityID(activityID)
+}
+
+func (DBStore) GetInscriptionHistory(inscriptionID int) ([]dao.InscriptionHistory, error) {
+	return clients.GetInscriptionHistory(inscriptionID)
+}
+
+func (DBStore) JoinWaitlist(entry dao.WaitlistEntry, audit dao.AuditEvent) (dao.WaitlistEntry, error) {
+	return clients.JoinWaitlist(entry, audit)
+}
+
+func (DBStore) GetWaitlistEntryByID(id int) (dao.WaitlistEntry, error) {
+	return clients.GetWaitlistEntryByID(id)
+}
+
+func (DBStore) GetWaitlistByUserID(userID int) ([]dao.WaitlistEntry, error) {
+	return clients.GetWaitlistByUserID(userID)
+}
+
+func (DBStore) DeleteWaitlistEntry(id int, audit dao.AuditEvent) error {
+	return clients.DeleteWaitlistEntry(id, audit)
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// GetRoles obtiene los roles disponibles con sus permisos
+func GetRoles() ([]domain.Rol, error) {
+	roles, err := clients.GetRoles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+
+	result := []domain.Rol{}
+	for _, role := range roles {
+		permisos := []string{}
+		for _, permiso := range role.Permisos {
+			permisos = append(permisos, permiso.Permiso)
+		}
+		result = append(result, domain.Rol{
+			Nombre:      role.Nombre,
+			Descripcion: role.Descripcion,
+			Permisos:    permisos,
+		})
+	}
+	return result, nil
+}
+
+// SetUserRoles reemplaza los roles de un usuario. Sus sesiones se revocan para
+// que los nuevos roles se apliquen de inmediato.
+func SetUserRoles(userID int, names []string, actor domain.Actor) (domain.User, error) {
+	if len(names) == 0 {
+		return domain.User{}, errors.New("at least one role is required")
+	}
+
+	if _, err := clients.GetUserByID(userID); err != nil {
+		return domain.User{}, errors.New("user not found")
+	}
+
+	roles, err := clients.GetRolesByNames(names)
+	if err != nil {
+		return domain.User{}, err
+	}
+	if len(roles) != len(uniqueNames(names)) {
+		return domain.User{}, errors.New("unknown role")
+	}
+
+	if err := clients.SetUserRoles(userID, roles, time.Now(), auditFrom(actor)); err != nil {
+		return domain.User{}, fmt.Errorf("failed to set roles: %w", err)
+	}
+
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return domain.User{}, err
+	}
+	return toUser(user), nil
+}
+
+// roleNames devuelve los nombres de los roles de un usuario
+func roleNames(user dao.User) []string {
+	names := []string{}
+	for _, role := range user.Roles {
+		names = append(names, role.Nombre)
+	}
+	return names
+}
+
+// isAdmin indica si el usuario tiene el rol admin
+func isAdmin(user dao.User) bool {
+	for _, role := range user.Roles {
+		if role.Nombre == dao.RolAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueNames(names []string) map[string]bool {
+	unique := map[string]bool{}
+	for _, name := range names {
+		unique[name] = true
+	}
+	return unique
+}
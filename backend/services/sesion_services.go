@@ -0,0 +1,272 @@
+package services
+
+import (
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// sessionHorizon es cuánto por adelantado se generan las sesiones
+const sessionHorizon = 8 * 7 * 24 * time.Hour
+
+// dateLayout es el formato de las fechas de la recurrencia
+const dateLayout = "2006-01-02"
+
+// GetSchedule obtiene la recurrencia de una actividad
+func (s *ActivityService) GetSchedule(activityID int) (domain.Schedule, error) {
+	activity, err := s.activities.GetActivityByID(activityID)
+	if err != nil {
+		return domain.Schedule{}, errors.New("activity not found")
+	}
+
+	schedule, err := s.activities.GetSchedule(activityID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domain.Schedule{}, errors.New("schedule not found")
+	}
+	if err != nil {
+		return domain.Schedule{}, err
+	}
+	return toSchedule(schedule, activity), nil
+}
+
+// SetSchedule crea o reemplaza la recurrencia de una actividad y regenera sus
+// sesiones de las próximas semanas. Las sesiones que dejan de estar en la
+// recurrencia se cancelan junto con sus reservas.
+func (s *ActivityService) SetSchedule(activityID int, request domain.Schedule, actor domain.Actor) (domain.Schedule, error) {
+	activity, err := s.activities.GetActivityByID(activityID)
+	if err != nil {
+		return domain.Schedule{}, errors.New("activity not found")
+	}
+
+	schedule, err := parseSchedule(activityID, request)
+	if err != nil {
+		return domain.Schedule{}, err
+	}
+
+	from := time.Now()
+	to := from.Add(sessionHorizon)
+	sessions, err := generateSessions(activity, schedule, from, to)
+	if err != nil {
+		return domain.Schedule{}, err
+	}
+	if err := s.activities.SaveSchedule(schedule, sessions, from, to, auditFrom(actor)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.Schedule{}, errors.New("activity not found")
+		}
+		return domain.Schedule{}, fmt.Errorf("failed to save schedule: %w", err)
+	}
+	return toSchedule(schedule, activity), nil
+}
+
+// GetSessions obtiene las sesiones de una actividad que empiezan entre from y
+// to. Sin from se listan desde ahora y sin to hasta donde están generadas.
+func (s *ActivityService) GetSessions(activityID int, from, to time.Time) ([]domain.ClassSession, error) {
+	if _, err := s.activities.GetActivityByID(activityID); err != nil {
+		return nil, errors.New("activity not found")
+	}
+	if from.IsZero() {
+		from = time.Now()
+	}
+	if to.IsZero() {
+		to = from.Add(sessionHorizon)
+	}
+	if !to.After(from) {
+		return nil, errors.New("invalid date range")
+	}
+
+	sessions, err := s.activities.GetSessions(activityID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	result := []domain.ClassSession{}
+	for _, session := range sessions {
+		result = append(result, toClassSession(session))
+	}
+	return result, nil
+}
+
+// GenerateUpcomingSessions genera las sesiones de las próximas semanas de todas
+// las actividades con recurrencia, a medida que avanza el tiempo. Devuelve
+// cuántas sesiones se crearon. Lo hace el sistema, así que los eventos de
+// auditoría no tienen actor.
+func (s *ActivityService) GenerateUpcomingSessions(now time.Time) (int, error) {
+	schedules, err := s.activities.GetSchedules()
+	if err != nil {
+		return 0, err
+	}
+
+	to := now.Add(sessionHorizon)
+	created := 0
+	for _, schedule := range schedules {
+		sessions, err := generateSessions(schedule.Actividad, schedule, now, to)
+		if err != nil {
+			log.WithError(err).WithField("activity_id", schedule.ID_actividad).Warn("Skipping sessions of activity")
+			continue
+		}
+		count, err := s.activities.SyncSessions(schedule.ID_actividad, sessions, now, to, auditFrom(domain.Actor{}))
+		if err != nil {
+			return created, err
+		}
+		created += count
+	}
+	return created, nil
+}
+
+// upcomingSessions genera las sesiones de las próximas semanas de una actividad
+// con el horario que va a tener. Si la actividad no tiene recurrencia devuelve
+// nil: sus sesiones no se tocan.
+func (s *ActivityService) upcomingSessions(activity dao.Activity) ([]dao.ClassSession, time.Time, time.Time, error) {
+	from := time.Now()
+	to := from.Add(sessionHorizon)
+	schedule, err := s.activities.GetSchedule(activity.ID_actividad)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, from, to, nil
+	}
+	if err != nil {
+		return nil, from, to, err
+	}
+
+	sessions, err := generateSessions(activity, schedule, from, to)
+	return sessions, from, to, err
+}
+
+// parseSchedule valida las fechas de la recurrencia y las normaliza
+func parseSchedule(activityID int, request domain.Schedule) (dao.Schedule, error) {
+	start, err := time.Parse(dateLayout, request.FechaInicio)
+	if err != nil {
+		return dao.Schedule{}, errors.New("invalid fecha_inicio")
+	}
+
+	schedule := dao.Schedule{
+		ID_actividad: activityID,
+		Fecha_inicio: start.Format(dateLayout),
+		Excepciones:  []string{},
+	}
+	if request.FechaFin != nil {
+		end, err := time.Parse(dateLayout, *request.FechaFin)
+		if err != nil {
+			return dao.Schedule{}, errors.New("invalid fecha_fin")
+		}
+		if end.Before(start) {
+			return dao.Schedule{}, errors.New("fecha_fin cannot be before fecha_inicio")
+		}
+		fechaFin := end.Format(dateLayout)
+		schedule.Fecha_fin = &fechaFin
+	}
+
+	for _, fecha := range request.Excepciones {
+		date, err := time.Parse(dateLayout, fecha)
+		if err != nil {
+			return dao.Schedule{}, errors.New("invalid excepcion")
+		}
+		schedule.Excepciones = append(schedule.Excepciones, date.Format(dateLayout))
+	}
+	slices.Sort(schedule.Excepciones)
+	schedule.Excepciones = slices.Compact(schedule.Excepciones)
+	return schedule, nil
+}
+
+// generateSessions calcula las sesiones de la recurrencia que empiezan entre
+// from y to, en los días y horarios de la actividad y en la zona horaria de from
+func generateSessions(activity dao.Activity, schedule dao.Schedule, from, to time.Time) ([]dao.ClassSession, error) {
+	loc := from.Location()
+	type slotTimes struct {
+		weekday    time.Weekday
+		start, end timeOfDay
+	}
+	var slots []slotTimes
+	for _, slot := range activity.Horarios {
+		start, errStart := parseTimeOfDay(slot.Hora_inicio)
+		end, errEnd := parseTimeOfDay(slot.Hora_fin)
+		if errStart != nil || errEnd != nil || end <= start || slot.Dia < 1 || slot.Dia > 7 {
+			return nil, errors.New("activity has an invalid timetable")
+		}
+		// Dia: 1 = lunes ... 7 = domingo; time.Weekday: 0 = domingo
+		slots = append(slots, slotTimes{weekday: time.Weekday(slot.Dia % 7), start: start, end: end})
+	}
+	if len(slots) == 0 {
+		return nil, errors.New("activity has an invalid timetable")
+	}
+
+	first, err := time.ParseInLocation(dateLayout, schedule.Fecha_inicio, loc)
+	if err != nil {
+		return nil, errors.New("invalid fecha_inicio")
+	}
+	var last time.Time
+	if schedule.Fecha_fin != nil {
+		if last, err = time.ParseInLocation(dateLayout, *schedule.Fecha_fin, loc); err != nil {
+			return nil, errors.New("invalid fecha_fin")
+		}
+	}
+
+	sessions := []dao.ClassSession{}
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	if day.Before(first) {
+		day = first
+	}
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if !last.IsZero() && day.After(last) {
+			break
+		}
+		if slices.Contains(schedule.Excepciones, day.Format(dateLayout)) {
+			continue
+		}
+		for _, slot := range slots {
+			if day.Weekday() != slot.weekday {
+				continue
+			}
+			inicio := time.Date(day.Year(), day.Month(), day.Day(), slot.start.hour(), slot.start.minute(), 0, 0, loc)
+			if inicio.Before(from) || !inicio.Before(to) {
+				continue
+			}
+			sessions = append(sessions, dao.ClassSession{
+				ID_actividad: activity.ID_actividad,
+				Inicio:       inicio,
+				Fin:          time.Date(day.Year(), day.Month(), day.Day(), slot.end.hour(), slot.end.minute(), 0, 0, loc),
+			})
+		}
+	}
+	slices.SortFunc(sessions, func(a, b dao.ClassSession) int { return a.Inicio.Compare(b.Inicio) })
+	return sessions, nil
+}
+
+func toSchedule(schedule dao.Schedule, activity dao.Activity) domain.Schedule {
+	excepciones := schedule.Excepciones
+	if excepciones == nil {
+		excepciones = []string{}
+	}
+	return domain.Schedule{
+		ActividadId: schedule.ID_actividad,
+		FechaInicio: schedule.Fecha_inicio,
+		FechaFin:    schedule.Fecha_fin,
+		Excepciones: excepciones,
+		Dias:        diasOf(activity),
+	}
+}
+
+// diasOf devuelve los días de la semana en que se dicta la actividad, sin repetir
+func diasOf(activity dao.Activity) []int {
+	dias := []int{}
+	for _, slot := range activity.Horarios {
+		dias = append(dias, slot.Dia)
+	}
+	slices.Sort(dias)
+	return slices.Compact(dias)
+}
+
+func toClassSession(session dao.ClassSession) domain.ClassSession {
+	return domain.ClassSession{
+		Id:               session.ID_sesion,
+		ActividadId:      session.ID_actividad,
+		Inicio:           session.Inicio,
+		Fin:              session.Fin,
+		CuposDisponibles: session.CuposDisponibles,
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenerateSessions(t *testing.T) {
+	// 2030-01-07 es lunes
+	activity := dao.Activity{ID_actividad: 1, Horarios: []dao.ActivitySlot{{Dia: 1, Hora_inicio: "10:00", Hora_fin: "11:00"}}}
+	fin := "2030-01-28"
+	schedule := dao.Schedule{Fecha_inicio: "2030-01-01", Fecha_fin: &fin, Excepciones: []string{"2030-01-14"}}
+
+	tests := []struct {
+		name string
+		from time.Time
+		want []string
+	}{
+		{"whole schedule", time.Date(2029, 12, 20, 0, 0, 0, 0, time.UTC), []string{"2030-01-07 10:00", "2030-01-21 10:00", "2030-01-28 10:00"}},
+		{"skips a class that already started", time.Date(2030, 1, 7, 10, 30, 0, 0, time.UTC), []string{"2030-01-21 10:00", "2030-01-28 10:00"}},
+		{"after fecha_fin", time.Date(2030, 1, 29, 0, 0, 0, 0, time.UTC), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sessions, err := generateSessions(activity, schedule, tt.from, tt.from.Add(sessionHorizon))
+			if err != nil {
+				t.Fatalf("generateSessions() error = %v", err)
+			}
+			var got []string
+			for _, session := range sessions {
+				got = append(got, session.Inicio.Format("2006-01-02 15:04"))
+				if session.Fin.Sub(session.Inicio) != time.Hour || session.ID_actividad != 1 {
+					t.Errorf("unexpected session %+v", session)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("sessions = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("sessions = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+
+	// Con varios días por semana las sesiones salen de todos, en orden
+	activity.Horarios = append(activity.Horarios, dao.ActivitySlot{Dia: 3, Hora_inicio: "18:00", Hora_fin: "19:00"})
+	sessions, err := generateSessions(activity, schedule, time.Date(2030, 1, 13, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 24, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(sessions) != 3 || sessions[0].Inicio.Day() != 16 || sessions[1].Inicio.Day() != 21 || sessions[2].Inicio.Day() != 23 {
+		t.Errorf("generateSessions() with two days = %v, %v", sessions, err)
+	}
+
+	activity.Horarios[0].Hora_fin = "09:00"
+	if _, err := generateSessions(activity, schedule, time.Now(), time.Now().Add(sessionHorizon)); err == nil {
+		t.Error("generateSessions() with end before start should fail")
+	}
+}
+
+func TestSessionBookingsHaveTheirOwnSlots(t *testing.T) {
+	activities, inscriptions, activity, users := newMemoryServices(t)
+	actor := domain.Actor{UserID: users[0].ID}
+
+	// La inscripción semanal ocupa el único cupo de la actividad, no el de las sesiones
+	if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[0].ID, ActividadId: activity.ID_actividad}, actor); err != nil {
+		t.Fatalf("CreateInscription() error = %v", err)
+	}
+	if _, err := activities.SetSchedule(activity.ID_actividad, domain.Schedule{FechaInicio: time.Now().Format(dateLayout)}, actor); err != nil {
+		t.Fatalf("SetSchedule() error = %v", err)
+	}
+	sessions, err := activities.GetSessions(activity.ID_actividad, time.Time{}, time.Time{})
+	if err != nil || len(sessions) < 7 {
+		t.Fatalf("GetSessions() = %v, %v", sessions, err)
+	}
+
+	if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[1].ID, ActividadId: activity.ID_actividad}, actor); err == nil || err.Error() != "session required" {
+		t.Errorf("weekly CreateInscription() on a scheduled activity error = %v, want session required", err)
+	}
+	booked, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[1].ID, SesionId: &sessions[0].Id}, actor)
+	if err != nil {
+		t.Fatalf("booking a session error = %v", err)
+	}
+	if booked.ActividadId != activity.ID_actividad || booked.Sesion == nil || booked.Sesion.CuposDisponibles != 0 {
+		t.Errorf("unexpected booking %+v", booked)
+	}
+	if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[2].ID, SesionId: &sessions[0].Id}, actor); !errors.Is(err, clients.ErrNoAvailableSlots) {
+		t.Errorf("booking a full session error = %v, want %v", err, clients.ErrNoAvailableSlots)
+	}
+	if _, err := inscriptions.CreateInscription(domain.Inscripcion{UsuarioId: users[2].ID, SesionId: &sessions[1].Id}, actor); err != nil {
+		t.Errorf("booking the next session error = %v", err)
+	}
+
+	// Mover la actividad a otro día cancela las reservas de las sesiones que ya no existen
+	if err := activities.UpdateActivity(domain.Activity{ID: activity.ID_actividad, Dia: activity.Horarios[0].Dia%7 + 1}, actor); err != nil {
+		t.Fatalf("UpdateActivity() error = %v", err)
+	}
+	moved, err := activities.GetSessions(activity.ID_actividad, time.Time{}, time.Time{})
+	if err != nil || len(moved) < 7 {
+		t.Fatalf("GetSessions() after moving = %v, %v", moved, err)
+	}
+	for _, session := range moved {
+		if int(session.Inicio.Weekday()) != (activity.Horarios[0].Dia+1)%7 || session.CuposDisponibles != 1 {
+			t.Errorf("unexpected session after moving the activity %+v", session)
+		}
+	}
+	cancelled, err := inscriptions.GetInscriptionByID(booked.Id)
+	if err != nil {
+		t.Fatalf("GetInscriptionByID() error = %v", err)
+	}
+	if cancelled.Estado != dao.EstadoCancelada || cancelled.CancelReason != "clase suspendida" {
+		t.Errorf("booking after moving the activity = %+v, want cancelled", cancelled)
+	}
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// refreshTokenDuration es cuánto puede usarse un refresh token sin canjearse
+var refreshTokenDuration = time.Hour * 24 * 30
+
+// SetRefreshTokenDuration cambia cuánto puede usarse un refresh token sin canjearse
+func SetRefreshTokenDuration(duration time.Duration) {
+	refreshTokenDuration = duration
+}
+
+// IssueTokens abre una sesión nueva para el usuario: crea una familia de
+// refresh tokens y devuelve el access token y el primer refresh token
+func IssueTokens(userID int) (domain.TokenResponse, error) {
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return domain.TokenResponse{}, errors.New("user not found")
+	}
+
+	familyID, err := utils.NewOpaqueToken()
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("failed to generate token family: %w", err)
+	}
+
+	refreshToken, err := utils.NewOpaqueToken()
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	_, err = clients.CreateRefreshToken(dao.RefreshToken{
+		TokenHash:  utils.HashSHA256(refreshToken),
+		FamilyID:   familyID,
+		ID_usuario: user.ID,
+		ExpiresAt:  time.Now().Add(refreshTokenDuration),
+	})
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return newTokenResponse(user, familyID, refreshToken)
+}
+
+// RefreshTokens canjea un refresh token por un nuevo par de tokens. El refresh
+// token usado deja de valer; si se lo vuelve a presentar se cierra la sesión.
+func RefreshTokens(refreshToken string) (domain.TokenResponse, error) {
+	if refreshToken == "" {
+		return domain.TokenResponse{}, errors.New("invalid refresh token")
+	}
+
+	nextToken, err := utils.NewOpaqueToken()
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	now := time.Now()
+	next, err := clients.RotateRefreshToken(utils.HashSHA256(refreshToken), dao.RefreshToken{
+		TokenHash: utils.HashSHA256(nextToken),
+		ExpiresAt: now.Add(refreshTokenDuration),
+	}, now)
+	if errors.Is(err, clients.ErrRefreshTokenReused) {
+		log.Warn("Refresh token reuse detected, token family revoked")
+		return domain.TokenResponse{}, err
+	}
+	if errors.Is(err, clients.ErrInvalidRefreshToken) {
+		return domain.TokenResponse{}, errors.New("invalid refresh token")
+	}
+	if err != nil {
+		return domain.TokenResponse{}, err
+	}
+
+	// El usuario pudo haberse eliminado después del login. Sus roles se leen de
+	// nuevo para que el access token refleje los actuales.
+	user, err := clients.GetUserByID(next.ID_usuario)
+	if err != nil {
+		clients.RevokeTokenFamily(next.FamilyID, now)
+		return domain.TokenResponse{}, errors.New("invalid refresh token")
+	}
+
+	return newTokenResponse(user, next.FamilyID, nextToken)
+}
+
+// Logout revoca el access token en uso y la sesión de la que proviene. Si se
+// envía un refresh token de otra sesión del mismo usuario también se revoca, y
+// con all se cierran todas sus sesiones.
+func Logout(userID int, jti string, familyID string, expiresAt time.Time, refreshToken string, all bool) error {
+	now := time.Now()
+
+	if err := clients.RevokeAccessToken(jti, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	if all {
+		return clients.RevokeUserTokens(userID, now)
+	}
+
+	if familyID != "" {
+		if err := clients.RevokeTokenFamily(familyID, now); err != nil {
+			return fmt.Errorf("failed to revoke session: %w", err)
+		}
+	}
+
+	if refreshToken != "" {
+		token, err := clients.GetRefreshTokenByHash(utils.HashSHA256(refreshToken))
+		if err == nil && token.ID_usuario == userID && token.FamilyID != familyID {
+			if err := clients.RevokeTokenFamily(token.FamilyID, now); err != nil {
+				return fmt.Errorf("failed to revoke session: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PurgeExpiredTokens borra de la base los tokens que ya vencieron
+func PurgeExpiredTokens(now time.Time) error {
+	return clients.PurgeExpiredTokens(now)
+}
+
+func newTokenResponse(user dao.User, familyID string, refreshToken string) (domain.TokenResponse, error) {
+	token, err := utils.GenerateJWT(user.ID, familyID, roleNames(user))
+	if err != nil {
+		return domain.TokenResponse{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return domain.TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenDuration().Seconds()),
+	}, nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"backend/clients"
+	"backend/dao"
+	"backend/domain"
+	"backend/utils"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// twoFactorIssuer es el nombre que muestra la app de autenticación
+	twoFactorIssuer = "Gimnasio"
+	// challengeDuration es cuánto tiempo hay para ingresar el código tras la contraseña
+	challengeDuration = 5 * time.Minute
+	// maxChallengeAttempts es cuántos códigos incorrectos admite un mismo challenge
+	maxChallengeAttempts = 5
+	// recoveryCodeCount es cuántos códigos de recuperación se generan
+	recoveryCodeCount = 10
+)
+
+// twoFactorRequired indica si el usuario no puede entrar sin segundo factor
+func twoFactorRequired(user dao.User) bool {
+	return isAdmin(user)
+}
+
+// EnrollTwoFactor empieza a configurar el segundo factor: genera un secreto
+// que queda pendiente hasta que se confirme con un código en ConfirmTwoFactor
+func EnrollTwoFactor(userID int) (domain.TwoFactorSetup, error) {
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return domain.TwoFactorSetup{}, errors.New("user not found")
+	}
+
+	if twoFactor, err := clients.GetTwoFactor(userID); err == nil && twoFactor.Activo {
+		return domain.TwoFactorSetup{}, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return domain.TwoFactorSetup{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	if err := clients.SaveTwoFactorSecret(userID, secret); err != nil {
+		return domain.TwoFactorSetup{}, fmt.Errorf("failed to store secret: %w", err)
+	}
+
+	return domain.TwoFactorSetup{
+		Secret:     secret,
+		OtpauthURI: utils.TOTPURI(twoFactorIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor activa el segundo factor con el primer código generado por
+// la app y devuelve los códigos de recuperación, que no se vuelven a mostrar
+func ConfirmTwoFactor(userID int, code string, actor domain.Actor) ([]string, error) {
+	twoFactor, err := clients.GetTwoFactor(userID)
+	if err != nil {
+		return nil, errors.New("two-factor enrolment not started")
+	}
+	if twoFactor.Activo {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+	return activateTwoFactor(twoFactor, code, actor)
+}
+
+// DisableTwoFactor desactiva el segundo factor con un código TOTP o de
+// recuperación. Los admins no pueden desactivarlo.
+func DisableTwoFactor(userID int, code string, actor domain.Actor) error {
+	user, err := clients.GetUserByID(userID)
+	if err != nil {
+		return errors.New("user not found")
+	}
+	if twoFactorRequired(user) {
+		return errors.New("two-factor authentication is required for admins")
+	}
+
+	twoFactor, err := clients.GetTwoFactor(userID)
+	if err != nil || !twoFactor.Activo {
+		return errors.New("two-factor authentication is not enabled")
+	}
+
+	ok, err := verifySecondFactor(twoFactor, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid two-factor code")
+	}
+	return clients.DeleteTwoFactor(userID, auditFrom(actor))
+}
+
+// ResetUserTwoFactor quita el segundo factor de un usuario que perdió el
+// teléfono y los códigos de recuperación. Si es obligatorio para él, deberá
+// configurarlo de nuevo en el próximo login.
+func ResetUserTwoFactor(userID int, actor domain.Actor) error {
+	if _, err := clients.GetUserByID(userID); err != nil {
+		return errors.New("user not found")
+	}
+	return clients.DeleteTwoFactor(userID, auditFrom(actor))
+}
+
+// TwoFactorSetupForChallenge empieza a configurar el segundo factor durante el
+// login de un usuario que está obligado a tenerlo y todavía no lo configuró
+func TwoFactorSetupForChallenge(challengeToken string) (domain.TwoFactorSetup, error) {
+	challenge, err := loadChallenge(challengeToken)
+	if err != nil {
+		return domain.TwoFactorSetup{}, err
+	}
+	return EnrollTwoFactor(challenge.ID_usuario)
+}
+
+// CompleteTwoFactorLogin termina el login de un usuario con segundo factor.
+// Si el usuario estaba configurándolo, el código lo activa y la respuesta
+// incluye los códigos de recuperación. El actor todavía no está autenticado:
+// solo trae la IP y el request ID.
+func CompleteTwoFactorLogin(challengeToken, code string, actor domain.Actor) (domain.User, error) {
+	ip := actor.IP
+	challenge, err := loadChallenge(challengeToken)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user, err := clients.GetUserByID(challenge.ID_usuario)
+	if err != nil {
+		return domain.User{}, errors.New("invalid or expired challenge")
+	}
+	actor.UserID = user.ID
+	if err := loginThrottle.Check(user.Username, ip); err != nil {
+		return domain.User{}, err
+	}
+
+	twoFactor, err := clients.GetTwoFactor(user.ID)
+	if err != nil {
+		return domain.User{}, errors.New("two-factor enrolment not started")
+	}
+
+	var recoveryCodes []string
+	if twoFactor.Activo {
+		ok, err := verifySecondFactor(twoFactor, code)
+		if err != nil {
+			return domain.User{}, err
+		}
+		if !ok {
+			return domain.User{}, rejectSecondFactor(challenge, user, ip)
+		}
+	} else {
+		recoveryCodes, err = activateTwoFactor(twoFactor, code, actor)
+		if err != nil {
+			if err.Error() == "invalid two-factor code" {
+				return domain.User{}, rejectSecondFactor(challenge, user, ip)
+			}
+			return domain.User{}, err
+		}
+	}
+
+	// Un challenge emite una sola sesión
+	consumed, err := clients.ConsumeTwoFactorChallenge(challenge.ID_challenge, time.Now())
+	if err != nil {
+		return domain.User{}, fmt.Errorf("failed to consume challenge: %w", err)
+	}
+	if !consumed {
+		return domain.User{}, errors.New("invalid or expired challenge")
+	}
+
+	if err := loginThrottle.RecordSuccess(user.Username); err != nil {
+		log.WithError(err).WithField("username", user.Username).Warn("Failed to reset login attempts")
+	}
+
+	loggedIn, err := newLoggedInUser(user)
+	if err != nil {
+		return domain.User{}, err
+	}
+	loggedIn.RecoveryCodes = recoveryCodes
+	return loggedIn, nil
+}
+
+// startTwoFactorChallenge crea el paso intermedio del login una vez verificada la contraseña
+func startTwoFactorChallenge(user dao.User, ip string, setupRequired bool) (domain.TwoFactorChallenge, error) {
+	token, err := utils.NewOpaqueToken()
+	if err != nil {
+		return domain.TwoFactorChallenge{}, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	err = clients.CreateTwoFactorChallenge(dao.TwoFactorChallenge{
+		TokenHash:  utils.HashSHA256(token),
+		ID_usuario: user.ID,
+		IP:         ip,
+		ExpiresAt:  time.Now().Add(challengeDuration),
+	})
+	if err != nil {
+		return domain.TwoFactorChallenge{}, fmt.Errorf("failed to store challenge: %w", err)
+	}
+
+	return domain.TwoFactorChallenge{
+		ChallengeToken: token,
+		ExpiresIn:      int(challengeDuration.Seconds()),
+		SetupRequired:  setupRequired,
+	}, nil
+}
+
+// loadChallenge obtiene un challenge que todavía se puede usar
+func loadChallenge(challengeToken string) (dao.TwoFactorChallenge, error) {
+	challenge, err := clients.GetTwoFactorChallenge(utils.HashSHA256(challengeToken))
+	if err != nil || challenge.UsedAt != nil || !challenge.ExpiresAt.After(time.Now()) ||
+		challenge.Intentos >= maxChallengeAttempts {
+		return dao.TwoFactorChallenge{}, errors.New("invalid or expired challenge")
+	}
+	return challenge, nil
+}
+
+// rejectSecondFactor cuenta y audita un código incorrecto
+func rejectSecondFactor(challenge dao.TwoFactorChallenge, user dao.User, ip string) error {
+	if err := clients.RecordChallengeAttempt(challenge.ID_challenge); err != nil {
+		log.WithError(err).WithField("user_id", user.ID).Error("Failed to record challenge attempt")
+	}
+	if err := loginThrottle.RecordFailure(user.Username, ip); err != nil {
+		log.WithError(err).WithField("username", user.Username).Error("Failed to record login failure")
+	}
+	auditLoginFailure(user.Username, ip, dao.MotivoSegundoFactorInvalido)
+	return errors.New("invalid two-factor code")
+}
+
+// activateTwoFactor confirma un segundo factor pendiente con un código TOTP
+func activateTwoFactor(twoFactor dao.TwoFactor, code string, actor domain.Actor) ([]string, error) {
+	now := time.Now()
+	step, ok := utils.ValidateTOTP(twoFactor.Secreto, code, now, twoFactor.UltimoPaso)
+	if !ok {
+		return nil, errors.New("invalid two-factor code")
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate recovery codes: %w", err)
+	}
+	if err := clients.ActivateTwoFactor(twoFactor.ID_usuario, step, hashes, now, auditFrom(actor)); err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	return codes, nil
+}
+
+// verifySecondFactor acepta un código TOTP que no se haya usado antes o un
+// código de recuperación, que queda usado
+func verifySecondFactor(twoFactor dao.TwoFactor, code string) (bool, error) {
+	now := time.Now()
+	if step, ok := utils.ValidateTOTP(twoFactor.Secreto, code, now, twoFactor.UltimoPaso); ok {
+		return clients.UseTOTPStep(twoFactor.ID_usuario, step)
+	}
+	return clients.UseRecoveryCode(twoFactor.ID_usuario, utils.HashSHA256(normalizeRecoveryCode(code)), now)
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// newRecoveryCodes genera los códigos de recuperación con el formato
+// xxxxx-xxxxx y sus hashes
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 7)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryEncoding.EncodeToString(buf))[:10]
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, utils.HashSHA256(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignora mayúsculas, espacios y guiones
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(code)))
+}
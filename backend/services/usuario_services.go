@@ -2,111 +2,207 @@ package services
 
 import (
 	"backend/clients"
+	"backend/dao"
 	"backend/domain"
-	"backend/utils"
 	"errors"
 	"fmt"
+	"net/mail"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
+// UserService administra las cuentas de usuario
+type UserService struct {
+	users UserRepository
+}
+
+func NewUserService(users UserRepository) *UserService {
+	return &UserService{users: users}
+}
+
 // GetUserByID obtiene un usuario por ID y lo convierte al formato domain
-func GetUserByID(id int) (domain.User, error) {
-	userDao, err := clients.GetUserByID(id)
+func (s *UserService) GetUserByID(id int) (domain.User, error) {
+	userDao, err := s.users.GetUserByID(id)
 	if err != nil {
 		return domain.User{}, fmt.Errorf("user not found with id %d: %w", id, err)
 	}
 
-	return domain.User{
-		ID:       userDao.ID,
-		Username: userDao.Username,
-		Password: "", // No devolvemos la contraseña hasheada
-		IsAdmin:  userDao.IsAdmin,
-	}, nil
+	return toUser(userDao), nil
 }
 
 // GetUserByUsername obtiene un usuario por username
-func GetUserByUsername(username string) (domain.User, error) {
-	userDao, err := clients.GetUserByUsername(username)
+func (s *UserService) GetUserByUsername(username string) (domain.User, error) {
+	userDao, err := s.users.GetUserByUsername(username)
 	if err != nil {
 		return domain.User{}, fmt.Errorf("user not found with username %s: %w", username, err)
 	}
 
-	return domain.User{
-		ID:       userDao.ID,
-		Name:     userDao.Name,
-		Username: userDao.Username,
-		Password: "", // No devolvemos la contraseña hasheada
-		IsAdmin:  userDao.IsAdmin,
-	}, nil
+	return toUser(userDao), nil
 }
 
-// ValidateUserCredentials valida las credenciales de un usuario para login
-func ValidateUserCredentials(username, password string) (domain.User, error) {
+// ValidateUserCredentials valida las credenciales de un usuario para login.
+// Los fallos se cuentan por username y por IP; si alguno de los dos está
+// bloqueado devuelve un *LoginLockedError sin verificar la contraseña.
+// Si el usuario tiene (o debe tener) segundo factor no devuelve los tokens sino
+// el challenge con el que se completa el login en CompleteTwoFactorLogin.
+func ValidateUserCredentials(username, password, ip string) (domain.User, *domain.TwoFactorChallenge, error) {
+	if err := loginThrottle.Check(username, ip); err != nil {
+		var locked *LoginLockedError
+		if errors.As(err, &locked) {
+			auditLoginFailure(username, ip, dao.MotivoBloqueado)
+		}
+		return domain.User{}, nil, err
+	}
+
 	userDao, err := clients.GetUserByUsername(username)
 	if err != nil {
-		return domain.User{}, errors.New("invalid credentials")
+		passwordHasher.Verify(password, dummyHash())
+		return domain.User{}, nil, rejectLogin(username, ip)
 	}
 
 	// Verificar la contraseña
-	if !verifyPassword(password, userDao.PasswordHash) {
-		return domain.User{}, errors.New("invalid credentials")
+	if !checkPassword(userDao, password) {
+		return domain.User{}, nil, rejectLogin(username, ip)
 	}
 
-	token, err := utils.GenerateJWT(userDao.ID)
-	fmt.Printf("Generated token for user %s: %s\n", userDao.Username, token)
+	return finishLogin(userDao, ip)
+}
+
+// finishLogin termina el login de un usuario ya autenticado, con contraseña o
+// con un proveedor externo. Si tiene (o debe tener) segundo factor devuelve el
+// challenge en lugar de los tokens.
+func finishLogin(userDao dao.User, ip string) (domain.User, *domain.TwoFactorChallenge, error) {
+	twoFactor, err := clients.GetTwoFactor(userDao.ID)
+	enabled := err == nil && twoFactor.Activo
+	if enabled || twoFactorRequired(userDao) {
+		challenge, err := startTwoFactorChallenge(userDao, ip, !enabled)
+		if err != nil {
+			return domain.User{}, nil, err
+		}
+		return domain.User{}, &challenge, nil
+	}
+
+	if err := loginThrottle.RecordSuccess(userDao.Username); err != nil {
+		log.WithError(err).WithField("username", userDao.Username).Warn("Failed to reset login attempts")
+	}
+
+	user, err := newLoggedInUser(userDao)
 	if err != nil {
-		return domain.User{}, fmt.Errorf("failed to generate token: %w", err)
+		return domain.User{}, nil, err
 	}
+	return user, nil, nil
+}
 
-	return domain.User{
-		ID:       userDao.ID,
-		Username: userDao.Username,
-		Password: "", // No devolvemos la contraseña
-		IsAdmin:  userDao.IsAdmin,
-		Token:    token,
-	}, nil
+// newLoggedInUser abre una sesión para el usuario y lo devuelve con sus tokens
+func newLoggedInUser(userDao dao.User) (domain.User, error) {
+	tokens, err := IssueTokens(userDao.ID)
+	if err != nil {
+		return domain.User{}, err
+	}
+
+	user := toUser(userDao)
+	user.Token = tokens.Token
+	user.RefreshToken = tokens.RefreshToken
+	return user, nil
 }
 
 // GetAllUsers obtiene todos los usuarios (solo para admins)
-func GetAllUsers() ([]domain.User, error) {
-	usersDao, err := clients.GetAllUsers()
+func (s *UserService) GetAllUsers() ([]domain.User, error) {
+	usersDao, err := s.users.GetAllUsers()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get users: %w", err)
 	}
 
 	var users []domain.User
 	for _, userDao := range usersDao {
-		users = append(users, domain.User{
-			ID:       userDao.ID,
-			Username: userDao.Username,
-			Password: "", // No devolvemos la contraseña
-			IsAdmin:  userDao.IsAdmin,
-		})
+		users = append(users, toUser(userDao))
 	}
 
 	return users, nil
 }
 
-// UpdateUser actualiza un usuario existente
-func UpdateUser(user domain.User) error {
+// UpdateUser actualiza un usuario existente. Los roles se cambian con SetUserRoles.
+// Cambiar la contraseña cierra todas las sesiones del usuario.
+func (s *UserService) UpdateUser(id int, request domain.UserUpdateRequest, actor domain.Actor) error {
 	// Obtener el usuario actual de la base de datos
-	currentUser, err := clients.GetUserByID(user.ID)
+	currentUser, err := s.users.GetUserByID(id)
 	if err != nil {
 		return fmt.Errorf("user not found: %w", err)
 	}
 
 	// Actualizar solo los campos que no están vacíos
-	if user.Username != "" {
-		currentUser.Username = user.Username
+	if request.Username != "" {
+		currentUser.Username = request.Username
+	}
+	if request.Password != "" {
+		// Un token robado no alcanza para quedarse con la cuenta: el propio
+		// usuario confirma su contraseña actual; un administrador no la conoce
+		if actor.UserID == id {
+			if request.CurrentPassword == "" {
+				return errors.New("current password is required")
+			}
+			if ok, err := passwordHasher.Verify(request.CurrentPassword, currentUser.PasswordHash); err != nil || !ok {
+				return errors.New("invalid current password")
+			}
+		}
+		currentUser.PasswordHash, err = hashPassword(request.Password)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
 	}
-	if user.Password != "" {
-		currentUser.PasswordHash = hashPassword(user.Password)
+	emailChanged, err := applyProfile(&currentUser, request.ProfileUpdateRequest, s.users.GetUserByEmail)
+	if err != nil {
+		return err
 	}
-	currentUser.IsAdmin = user.IsAdmin
 
-	return clients.UpdateUser(currentUser)
+	if err := s.users.UpdateUser(currentUser, auditFrom(actor)); err != nil {
+		return err
+	}
+	if emailChanged {
+		notifyEmailVerification(currentUser)
+	}
+	return nil
 }
 
 // DeleteUser elimina un usuario
-func DeleteUser(id int) error {
-	return clients.DeleteUser(id)
+func (s *UserService) DeleteUser(id int, actor domain.Actor) error {
+	err := s.users.DeleteUser(id, auditFrom(actor))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errors.New("user not found")
+	}
+	return err
+}
+
+// rejectLogin cuenta y audita un login fallido. Si el fallo no se pudo guardar
+// igual queda contado en memoria (ver LoginThrottle), así que alcanza con
+// registrar el error.
+func rejectLogin(username, ip string) error {
+	if err := loginThrottle.RecordFailure(username, ip); err != nil {
+		log.WithError(err).WithField("username", username).Error("Failed to record login failure")
+	}
+	auditLoginFailure(username, ip, dao.MotivoCredencialesInvalidas)
+	return errors.New("invalid credentials")
+}
+
+// emailOf devuelve el email del usuario, o "" si no tiene
+func emailOf(user dao.User) string {
+	if user.Email == nil {
+		return ""
+	}
+	return *user.Email
+}
+
+// normalizeEmail valida un email y lo pasa a minúsculas. Un email vacío es nil.
+func normalizeEmail(email string) (*string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, nil
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return nil, errors.New("invalid email")
+	}
+	return &email, nil
 }
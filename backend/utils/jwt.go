@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -8,36 +10,62 @@ import (
 	"time"
 
 	"backend/clients" // Importar el paquete clients para acceder a la base de datos
+	"backend/dao"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-const (
-	jwtDuration = time.Hour * 24
-	jwtSecret   = "jwtSecret"
-)
+// Los access tokens duran poco: para seguir operando se renuevan con el refresh token
+var jwtDuration = time.Minute * 15
+
+// SetAccessTokenDuration cambia cuánto dura un access token
+func SetAccessTokenDuration(duration time.Duration) {
+	jwtDuration = duration
+}
 
-func GenerateJWT(UserID int) (string, error) {
+// AccessClaims son los claims de un access token. El ID (jti) identifica al
+// token para poder revocarlo y el Subject es el ID del usuario.
+type AccessClaims struct {
+	// FamilyID es la familia de refresh tokens de la sesión que emitió el token
+	FamilyID string `json:"fid,omitempty"`
+	// Roles del usuario al emitir el token. Cambiar los roles revoca sus sesiones.
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+// GenerateJWT genera un access token para el usuario con sus roles, asociado a
+// la familia de refresh tokens de su sesión
+func GenerateJWT(UserID int, familyID string, roles []string) (string, error) {
 	//setear expiracion
 	expirationTime := time.Now().Add(jwtDuration)
 
-	//crear el claims
+	jti, err := NewOpaqueToken()
+	if err != nil {
+		return "", fmt.Errorf("error generating token id: %v", err)
+	}
 
-	claims := &jwt.RegisteredClaims{
-		ExpiresAt: jwt.NewNumericDate(expirationTime),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "backend",
-		Subject:   "auth",
-		ID:        fmt.Sprintf("%d", UserID),
+	//crear el claims
+	claims := &AccessClaims{
+		FamilyID: familyID,
+		Roles:    roles,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "backend",
+			Subject:   strconv.Itoa(UserID),
+			ID:        jti,
+		},
 	}
 
-	//crear el token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	//firmar el token con la clave activa
+	keys, err := CurrentKeySet()
+	if err != nil {
+		return "", fmt.Errorf("error loading signing keys: %v", err)
+	}
 
-	//firmar el token
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return "", fmt.Errorf("error signing token: %v", err)
 	}
@@ -45,7 +73,20 @@ func GenerateJWT(UserID int) (string, error) {
 	return tokenString, nil
 }
 
-var JWT_SECRET = []byte(jwtSecret)
+// AccessTokenDuration devuelve cuánto dura un access token
+func AccessTokenDuration() time.Duration {
+	return jwtDuration
+}
+
+// NewOpaqueToken genera un valor aleatorio de 256 bits apto para URLs, usado
+// como refresh token y como jti
+func NewOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
 
 func JwtAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -59,12 +100,16 @@ func JwtAuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de firma inesperado")
-			}
-			return JWT_SECRET, nil
-		})
+		keys, err := CurrentKeySet()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al cargar las claves de verificación"})
+			c.Abort()
+			return
+		}
+
+		// El kid del header elige la clave, así siguen valiendo los tokens firmados con claves rotadas
+		claims := &AccessClaims{}
+		token, err := jwt.ParseWithClaims(tokenString, claims, keys.Keyfunc)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token inválido"})
@@ -72,48 +117,81 @@ func JwtAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
+		// Los tokens con audience (verificación de email, invitaciones) se firman
+		// con las mismas claves pero no son access tokens
+		if claims.ID == "" || len(claims.Audience) > 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Claims inválidos"})
 			c.Abort()
 			return
 		}
 
-		if userIDStr, ok := claims["jti"].(string); ok {
-			if userID, err := strconv.Atoi(userIDStr); err == nil {
-				c.Set("user_id", userID)
-
-				// Obtener el usuario de la base de datos para verificar si es admin
-				user, err := clients.GetUserByID(userID) // Asumiendo que GetUserByID está en clients
-				if err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener información del usuario"})
-					c.Abort()
-					return
-				}
-				c.Set("is_admin", user.IsAdmin) // Almacenar el estado de administrador en el contexto
-
-			} else {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "ID de usuario inválido en token"})
-				c.Abort()
-				return
-			}
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "ID de usuario no encontrado en token"})
+		// Rechazar los tokens revocados por logout o por reutilización de su refresh token
+		revoked, err := clients.IsAccessTokenRevoked(claims.ID, claims.FamilyID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al verificar el token"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revocado"})
+			c.Abort()
+			return
+		}
+
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "ID de usuario inválido en token"})
+			c.Abort()
+			return
+		}
+		c.Set("user_id", userID)
+		c.Set("token_id", claims.ID)
+		c.Set("token_family", claims.FamilyID)
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+
+		// El usuario pudo haberse eliminado después de emitirse el token
+		if _, err := clients.GetUserByID(userID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Usuario inexistente"})
 			c.Abort()
 			return
 		}
 
+		// Los permisos se resuelven a partir de los roles del token
+		permissions, err := clients.GetPermissionsByRoles(claims.Roles)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al obtener los permisos del usuario"})
+			c.Abort()
+			return
+		}
+		c.Set("roles", claims.Roles)
+		c.Set("permissions", permissions)
+		c.Set("is_admin", HasRole(claims.Roles, dao.RolAdmin))
+
 		c.Next()
 	}
 }
-func AdminAuthMiddleware() gin.HandlerFunc {
+
+// RequirePermission exige que el usuario autenticado tenga el permiso. Debe
+// usarse después de JwtAuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		isAdmin, exists := c.Get("is_admin")
-		if !exists || isAdmin != true {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Acceso denegado. Se requiere rol de administrador."})
-			c.Abort()
-			return
+		for _, granted := range c.GetStringSlice("permissions") {
+			if granted == permission {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acceso denegado. Se requiere el permiso " + permission})
+		c.Abort()
+	}
+}
+
+// HasRole indica si la lista de roles incluye el rol
+func HasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
 		}
-		c.Next()
 	}
+	return false
 }
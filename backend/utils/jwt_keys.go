@@ -0,0 +1,291 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+// SigningKey es una clave para firmar o verificar tokens, identificada por su kid
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// private es la clave para firmar: []byte (HS256), *rsa.PrivateKey o ed25519.PrivateKey.
+	// Es nil en las claves que solo se usan para verificar.
+	private interface{}
+	// public es la clave para verificar: []byte (HS256), *rsa.PublicKey o ed25519.PublicKey
+	public interface{}
+}
+
+// KeySet contiene la clave activa de firma y todas las claves aceptadas para
+// verificar, lo que permite rotar claves sin invalidar los tokens emitidos
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// NewKeySet crea un KeySet que firma con active y acepta además las claves previous
+func NewKeySet(active *SigningKey, previous ...*SigningKey) (*KeySet, error) {
+	if active == nil || active.private == nil {
+		return nil, errors.New("active signing key must have a private key")
+	}
+
+	ks := &KeySet{active: active, keys: map[string]*SigningKey{}}
+	for _, key := range append([]*SigningKey{active}, previous...) {
+		if _, exists := ks.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicated key id %q", key.ID)
+		}
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+// NewHMACKey crea una clave HS256 a partir de un secreto compartido
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{ID: id, Method: jwt.SigningMethodHS256, private: secret, public: secret}
+}
+
+// NewSigningKeyFromPEM crea una clave RS256 o EdDSA a partir de un PEM con la
+// clave privada. Si id está vacío se usa el thumbprint de la clave pública.
+func NewSigningKeyFromPEM(id string, pemData []byte) (*SigningKey, error) {
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+		return newKey(id, jwt.SigningMethodRS256, private, &private.PublicKey)
+	}
+	if private, err := jwt.ParseEdPrivateKeyFromPEM(pemData); err == nil {
+		edPrivate := private.(ed25519.PrivateKey)
+		return newKey(id, jwt.SigningMethodEdDSA, edPrivate, edPrivate.Public())
+	}
+	return nil, errors.New("unsupported private key: expected RSA or Ed25519 PEM")
+}
+
+// NewVerificationKeyFromPEM crea una clave que solo verifica a partir de un PEM
+// con la clave pública RSA o Ed25519
+func NewVerificationKeyFromPEM(id string, pemData []byte) (*SigningKey, error) {
+	if public, err := jwt.ParseRSAPublicKeyFromPEM(pemData); err == nil {
+		return newKey(id, jwt.SigningMethodRS256, nil, public)
+	}
+	if public, err := jwt.ParseEdPublicKeyFromPEM(pemData); err == nil {
+		return newKey(id, jwt.SigningMethodEdDSA, nil, public)
+	}
+	// También se acepta el PEM privado de una clave anterior
+	key, err := NewSigningKeyFromPEM(id, pemData)
+	if err != nil {
+		return nil, errors.New("unsupported public key: expected RSA or Ed25519 PEM")
+	}
+	key.private = nil
+	return key, nil
+}
+
+// GenerateEd25519Key genera una clave EdDSA nueva
+func GenerateEd25519Key(id string) (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newKey(id, jwt.SigningMethodEdDSA, private, public)
+}
+
+func newKey(id string, method jwt.SigningMethod, private, public interface{}) (*SigningKey, error) {
+	key := &SigningKey{ID: id, Method: method, private: private, public: public}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key, nil
+}
+
+// thumbprint identifica una clave asimétrica por el hash de su JWK
+func (k *SigningKey) thumbprint() string {
+	jwk, ok := k.jwk()
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(jwk.N + jwk.E + jwk.X))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// Sign firma los claims con la clave activa e incluye su kid en el header
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.active.Method, claims)
+	token.Header["kid"] = ks.active.ID
+	return token.SignedString(ks.active.private)
+}
+
+// Keyfunc elige la clave de verificación según el kid del token. Rechaza los
+// tokens cuyo algoritmo no coincide con el de la clave.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := ks.active
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		key, ok = ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK es la representación pública de una clave según RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS es el documento publicado en /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS devuelve las claves públicas de verificación. Las claves HS256 son
+// secretas y nunca se publican.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk, ok := key.jwk(); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (k *SigningKey) jwk() (JWK, bool) {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: k.ID,
+			Use: "sig",
+			Alg: k.Method.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}, true
+	}
+	return JWK{}, false
+}
+
+// KeyConfig indica de dónde salen las claves de firma
+type KeyConfig struct {
+	SigningKeyFile   string // PEM con la clave privada RSA (RS256) o Ed25519 (EdDSA)
+	SigningKeyID     string // kid de la clave activa (por defecto, su thumbprint)
+	Secret           string // secreto HS256, si no se configura una clave asimétrica
+	VerificationKeys string // claves anteriores aún aceptadas: "kid=archivo.pem,kid2=archivo2.pem"
+}
+
+// LoadKeySet arma el KeySet a partir de la configuración. Sin clave ni secreto
+// se genera una clave Ed25519 efímera: los tokens dejan de ser válidos al
+// reiniciar el servidor.
+func LoadKeySet(cfg KeyConfig) (*KeySet, error) {
+	var (
+		active *SigningKey
+		err    error
+	)
+
+	switch {
+	case cfg.SigningKeyFile != "":
+		pemData, readErr := os.ReadFile(cfg.SigningKeyFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("error reading JWT signing key: %v", readErr)
+		}
+		active, err = NewSigningKeyFromPEM(cfg.SigningKeyID, pemData)
+	case cfg.Secret != "":
+		active = NewHMACKey(cfg.SigningKeyID, []byte(cfg.Secret))
+	default:
+		log.Warn("No JWT signing key configured, using an ephemeral Ed25519 key")
+		active, err = GenerateEd25519Key(cfg.SigningKeyID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	previous, err := parseVerificationKeys(cfg.VerificationKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeySet(active, previous...)
+}
+
+// parseVerificationKeys interpreta la lista "kid=archivo.pem,kid2=archivo2.pem"
+func parseVerificationKeys(value string) ([]*SigningKey, error) {
+	var keys []*SigningKey
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kid, path, found := strings.Cut(entry, "=")
+		if !found || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid verification key %q, expected kid=path", entry)
+		}
+
+		pemData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading verification key %s: %v", kid, err)
+		}
+		key, err := NewVerificationKeyFromPEM(kid, pemData)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %v", kid, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+var (
+	keySet     *KeySet
+	keySetOnce sync.Once
+	keySetErr  error
+)
+
+// InitJWTKeys carga las claves de la configuración. Conviene llamarla al
+// iniciar el servidor para fallar temprano ante una configuración inválida.
+func InitJWTKeys(cfg KeyConfig) error {
+	keySetOnce.Do(func() {
+		keySet, keySetErr = LoadKeySet(cfg)
+	})
+	return keySetErr
+}
+
+// SetKeySet reemplaza las claves en uso, por ejemplo en los tests
+func SetKeySet(ks *KeySet) {
+	keySetOnce.Do(func() {})
+	keySet, keySetErr = ks, nil
+}
+
+// CurrentKeySet devuelve las claves en uso. Si no se llamó a InitJWTKeys usa
+// una clave efímera.
+func CurrentKeySet() (*KeySet, error) {
+	if err := InitJWTKeys(KeyConfig{}); err != nil {
+		return nil, err
+	}
+	return keySet, nil
+}
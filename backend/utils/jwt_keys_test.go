@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		ID:        "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+}
+
+func writeRSAKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	path := filepath.Join(dir, name)
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if err := os.WriteFile(path, pemData, 0o600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	return path
+}
+
+func TestKeySetRotationKeepsOldTokensValid(t *testing.T) {
+	old, _ := GenerateEd25519Key("2024-01")
+	oldKeys, _ := NewKeySet(old)
+	oldToken, err := oldKeys.Sign(testClaims())
+	if err != nil {
+		t.Fatalf("Sign() error: %v", err)
+	}
+
+	dir := t.TempDir()
+	pemData, _ := os.ReadFile(writeRSAKey(t, dir, "new.pem"))
+	current, err := NewSigningKeyFromPEM("2025-01", pemData)
+	if err != nil {
+		t.Fatalf("NewSigningKeyFromPEM() error: %v", err)
+	}
+	verifyOnly := &SigningKey{ID: old.ID, Method: old.Method, public: old.public}
+	rotated, err := NewKeySet(current, verifyOnly)
+	if err != nil {
+		t.Fatalf("NewKeySet() error: %v", err)
+	}
+
+	if _, err := jwt.Parse(oldToken, rotated.Keyfunc); err != nil {
+		t.Errorf("token signed with the previous key should still verify: %v", err)
+	}
+
+	newToken, _ := rotated.Sign(testClaims())
+	parsed, err := jwt.Parse(newToken, rotated.Keyfunc)
+	if err != nil {
+		t.Fatalf("new token should verify: %v", err)
+	}
+	if parsed.Header["kid"] != "2025-01" || parsed.Method.Alg() != "RS256" {
+		t.Errorf("unexpected header: %v", parsed.Header)
+	}
+
+	if _, err := jwt.Parse(newToken, oldKeys.Keyfunc); err == nil {
+		t.Error("a key set without the new key must reject its tokens")
+	}
+
+	jwks := rotated.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 public keys in JWKS, got %d", len(jwks.Keys))
+	}
+}
+
+func TestKeySetRejectsAlgorithmMismatch(t *testing.T) {
+	key, _ := GenerateEd25519Key("ed")
+	keys, _ := NewKeySet(key)
+
+	// Token HS256 que dice usar el kid de una clave EdDSA
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "ed"
+	tokenString, _ := forged.SignedString([]byte("secreto"))
+
+	if _, err := jwt.Parse(tokenString, keys.Keyfunc); err == nil {
+		t.Error("expected token with mismatched algorithm to be rejected")
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	cfg := KeyConfig{
+		SigningKeyFile:   writeRSAKey(t, dir, "active.pem"),
+		SigningKeyID:     "active",
+		VerificationKeys: "old=" + writeRSAKey(t, dir, "old.pem"),
+	}
+
+	keys, err := LoadKeySet(cfg)
+	if err != nil {
+		t.Fatalf("LoadKeySet() error: %v", err)
+	}
+	if keys.active.ID != "active" || len(keys.keys) != 2 {
+		t.Errorf("unexpected key set: active=%s keys=%d", keys.active.ID, len(keys.keys))
+	}
+	if keys.keys["old"].private != nil {
+		t.Error("verification keys must not be able to sign")
+	}
+
+	cfg.VerificationKeys = "sin-archivo"
+	if _, err := LoadKeySet(cfg); err == nil {
+		t.Error("expected error for malformed verification keys")
+	}
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// PasswordHasher abstrae el algoritmo usado para guardar contraseñas
+type PasswordHasher interface {
+	// Hash devuelve la contraseña hasheada en formato codificado (incluye sal y parámetros)
+	Hash(password string) (string, error)
+	// Verify compara en tiempo constante la contraseña contra un hash codificado
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash indica si el hash fue generado con otro algoritmo o parámetros
+	NeedsRehash(encoded string) bool
+}
+
+var ErrInvalidHash = errors.New("invalid password hash format")
+
+// Argon2idHasher genera hashes argon2id con sal aleatoria por usuario.
+// El resultado usa el formato PHC: $argon2id$v=19$m=65536,t=3,p=2$<sal>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // En KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// NewArgon2idHasher crea un hasher con los parámetros recomendados por OWASP
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("error generating salt: %v", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength ||
+		uint32(len(key)) != h.KeyLength
+}
+
+// decodeArgon2id interpreta un hash en formato PHC
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrInvalidHash
+	}
+
+	return params, salt, key, nil
+}
+
+// LegacySHA256Hasher verifica los hashes SHA-256 sin sal de versiones anteriores.
+// Solo se usa para verificar: cualquier hash que valide debe regenerarse.
+type LegacySHA256Hasher struct{}
+
+func (LegacySHA256Hasher) Hash(password string) (string, error) {
+	return HashSHA256(password), nil
+}
+
+func (LegacySHA256Hasher) Verify(password, encoded string) (bool, error) {
+	return subtle.ConstantTimeCompare([]byte(HashSHA256(password)), []byte(encoded)) == 1, nil
+}
+
+func (LegacySHA256Hasher) NeedsRehash(encoded string) bool {
+	return true
+}
+
+// UpgradingHasher genera hashes con Current y acepta además los hashes de
+// Legacy, marcándolos para regenerarse en el próximo login exitoso
+type UpgradingHasher struct {
+	Current PasswordHasher
+	Legacy  PasswordHasher
+}
+
+// NewPasswordHasher crea el hasher por defecto: argon2id con soporte para los
+// hashes SHA-256 anteriores
+func NewPasswordHasher() *UpgradingHasher {
+	return &UpgradingHasher{
+		Current: NewArgon2idHasher(),
+		Legacy:  LegacySHA256Hasher{},
+	}
+}
+
+func (h *UpgradingHasher) Hash(password string) (string, error) {
+	return h.Current.Hash(password)
+}
+
+func (h *UpgradingHasher) Verify(password, encoded string) (bool, error) {
+	if strings.HasPrefix(encoded, "$") {
+		return h.Current.Verify(password, encoded)
+	}
+	return h.Legacy.Verify(password, encoded)
+}
+
+func (h *UpgradingHasher) NeedsRehash(encoded string) bool {
+	if strings.HasPrefix(encoded, "$") {
+		return h.Current.NeedsRehash(encoded)
+	}
+	return true
+}
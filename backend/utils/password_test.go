@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestArgon2idHasherRoundTrip(t *testing.T) {
+	hasher := NewArgon2idHasher()
+
+	first, err := hasher.Hash("secreto")
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	second, _ := hasher.Hash("secreto")
+
+	if !strings.HasPrefix(first, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("unexpected encoded hash: %s", first)
+	}
+	if first == second {
+		t.Error("expected different salts to produce different hashes")
+	}
+
+	if ok, err := hasher.Verify("secreto", first); err != nil || !ok {
+		t.Errorf("Verify() with correct password = %v, %v", ok, err)
+	}
+	if ok, _ := hasher.Verify("otra", first); ok {
+		t.Error("Verify() accepted a wrong password")
+	}
+	if hasher.NeedsRehash(first) {
+		t.Error("fresh hash should not need rehash")
+	}
+
+	weaker := &Argon2idHasher{Memory: 16 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	old, _ := weaker.Hash("secreto")
+	if !hasher.NeedsRehash(old) {
+		t.Error("hash with old parameters should need rehash")
+	}
+	if ok, _ := hasher.Verify("secreto", old); !ok {
+		t.Error("hash with old parameters should still verify")
+	}
+}
+
+func TestArgon2idHasherRejectsMalformedHash(t *testing.T) {
+	hasher := NewArgon2idHasher()
+	for _, encoded := range []string{"", "$argon2id$", "$argon2i$v=19$m=65536,t=3,p=2$c2FsdA$aGFzaA", "$argon2id$v=19$m=x$c2FsdA$aGFzaA"} {
+		if _, err := hasher.Verify("secreto", encoded); err == nil {
+			t.Errorf("expected error for %q", encoded)
+		}
+	}
+}
+
+func TestUpgradingHasherAcceptsLegacySHA256(t *testing.T) {
+	hasher := NewPasswordHasher()
+	legacy := HashSHA256("secreto")
+
+	if ok, err := hasher.Verify("secreto", legacy); err != nil || !ok {
+		t.Errorf("Verify() legacy hash = %v, %v", ok, err)
+	}
+	if ok, _ := hasher.Verify("otra", legacy); ok {
+		t.Error("Verify() accepted a wrong password for a legacy hash")
+	}
+	if !hasher.NeedsRehash(legacy) {
+		t.Error("legacy hash should need rehash")
+	}
+
+	upgraded, _ := hasher.Hash("secreto")
+	if hasher.NeedsRehash(upgraded) {
+		t.Error("argon2id hash should not need rehash")
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader es el header con el que se propaga el ID de la request
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limita los IDs que aceptamos del cliente, porque terminan en
+// los logs y en la tabla de auditoría
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID asigna a cada request un ID, que queda en el contexto como
+// request_id y se devuelve en el header X-Request-ID. Si el cliente (o un proxy)
+// ya mandó uno válido se respeta, para poder seguir la request de punta a punta.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			buf := make([]byte, 16)
+			if _, err := rand.Read(buf); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error al generar el ID de la request"})
+				c.Abort()
+				return
+			}
+			id = hex.EncodeToString(buf)
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// Secreto de los vectores de prueba del RFC 6238 para SHA-1; los códigos
+	// son los últimos 6 dígitos de los de 8 dígitos del RFC
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("TOTPCode at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	previous, _ := TOTPCode(secret, step-1)
+	if got, ok := ValidateTOTP(secret, previous, now, 0); !ok || got != step-1 {
+		t.Errorf("expected previous step to be accepted for clock skew, got %d %v", got, ok)
+	}
+
+	current, _ := TOTPCode(secret, step)
+	if _, ok := ValidateTOTP(secret, current, now, step); ok {
+		t.Error("expected an already used step to be rejected")
+	}
+
+	old, _ := TOTPCode(secret, step-2)
+	if _, ok := ValidateTOTP(secret, old, now, 0); ok {
+		t.Error("expected a code outside the window to be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("expected a short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Gimnasio", "ana maría", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/Gimnasio:ana%20mar%C3%ADa?") {
+		t.Errorf("unexpected label in %s", uri)
+	}
+	for _, param := range []string{"secret=JBSWY3DPEHPK3PXP", "issuer=Gimnasio", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("expected %s in %s", param, uri)
+		}
+	}
+}
@@ -88,7 +88,7 @@ const ActivityForm = ({ onSubmit, onCancel }) => {
             dia: parseInt(formData.dia),     // Asegurar que sea entero
             hora_inicio: formData.hora_inicio,
             hora_fin: formData.hora_fin,     // Backend espera 'hora_fin'
-            cupos: parseInt(formData.cupos), // Asegurar que sea entero
+            capacidad: parseInt(formData.cupos), // Backend espera 'capacidad'
             description: formData.descripcion // Backend espera 'description'
         }
 
@@ -199,7 +199,7 @@ const ActivityForm = ({ onSubmit, onCancel }) => {
                 </div>
 
                 <div className="form-group">
-                    <label htmlFor="cupos">Cupos Disponibles</label>
+                    <label htmlFor="cupos">Capacidad</label>
                     <input
                         type="number"
                         id="cupos"
@@ -15,6 +15,14 @@ const getDayName = (dayNumber) => {
     return days[dayNumber] || 'Día inválido';
 };
 
+// Una actividad puede dictarse varios días por semana
+const getDaysText = (activity) => {
+    if (!activity.horarios?.length) return getDayName(activity.dia);
+    return activity.horarios.map(horario => getDayName(horario.dia)).join(', ');
+};
+
+const isMultiDay = (activity) => activity.horarios?.length > 1;
+
 // Recibir la prop isAdmin
 const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) => {
     const [editingActivity, setEditingActivity] = useState(null);
@@ -41,9 +49,10 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
             nombre: activity.name || '',
             categoria: activity.categoria || '',
             profesor: activity.profesor || '',
-            dia: activity.dia || 1,
+            // En las actividades de varios días los horarios no se editan acá
+            ...(isMultiDay(activity) ? {} : { dia: activity.dia || 1 }),
             horario: activity.hora_inicio + '' + activity.hora_fin || '',
-            cupos: activity.cupos || 0,
+            capacidad: activity.capacidad || 0,
             descripcion: activity.description || ''
         });
         setSelectedActivity(activity);
@@ -147,7 +156,7 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                     </div>
                                     <div className="activity-day">
                                         <span className="info-label">📅</span>
-                                        <span>{getDayName(activity.dia)}</span>
+                                        <span>{getDaysText(activity)}</span>
                                     </div>
                                     <div className="activity-time">
                                         <span className="info-label">🕐</span>
@@ -155,7 +164,7 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                     </div>
                                     <div className="activity-spots">
                                         <span className="info-label">👥</span>
-                                        <span>{activity.cupos} cupos</span>
+                                        <span>{activity.cupos_disponibles} cupos</span>
                                     </div>
                                 </div>
                             </div>
@@ -163,7 +172,7 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                 <button
                                     className="accion-btn-accion-btn-inscribe"
                                     onClick={() => handleInscribe(activity.id)}
-                                    disabled={!activity.id || isInscribing || activity.cupos <= 0}
+                                    disabled={!activity.id || isInscribing || activity.cupos_disponibles <= 0}
                                 >
                                     {isInscribing ? 'Inscribiendo...' : 'Inscribirse'}
                                 </button>
@@ -224,22 +233,24 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                                 className="edit-input"
                                             />
                                         </div>
-                                        <div className="form-group">
-                                            <label>Día:</label>
-                                            <select
-                                                value={editForm.dia || 1}
-                                                onChange={(e) => handleInputChange('dia', parseInt(e.target.value))}
-                                                className='edit-select'
-                                            >
-                                                <option value={1}>Lunes</option>
-                                                <option value={2}>Martes</option>
-                                                <option value={3}>Miércoles</option>
-                                                <option value={4}>Jueves</option>
-                                                <option value={5}>Viernes</option>
-                                                <option value={6}>Sábado</option>
-                                                <option value={7}>Domingo</option>
-                                            </select>
-                                        </div>
+                                        {editForm.dia !== undefined && (
+                                            <div className="form-group">
+                                                <label>Día:</label>
+                                                <select
+                                                    value={editForm.dia || 1}
+                                                    onChange={(e) => handleInputChange('dia', parseInt(e.target.value))}
+                                                    className='edit-select'
+                                                >
+                                                    <option value={1}>Lunes</option>
+                                                    <option value={2}>Martes</option>
+                                                    <option value={3}>Miércoles</option>
+                                                    <option value={4}>Jueves</option>
+                                                    <option value={5}>Viernes</option>
+                                                    <option value={6}>Sábado</option>
+                                                    <option value={7}>Domingo</option>
+                                                </select>
+                                            </div>
+                                        )}
                                         <div className="form-group">
                                             <label>Horario:</label>
                                             <input
@@ -250,11 +261,11 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                             />
                                         </div>
                                         <div className="form-group">
-                                            <label>Cupos:</label>
+                                            <label>Capacidad:</label>
                                             <input
                                                 type="number"
-                                                value={editForm.cupos || ''}
-                                                onChange={(e) => handleInputChange('cupos', parseInt(e.target.value))}
+                                                value={editForm.capacidad || ''}
+                                                onChange={(e) => handleInputChange('capacidad', parseInt(e.target.value))}
                                                 className="edit-input"
                                             />
                                         </div>
@@ -292,7 +303,7 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                     </div>
                                     <div className="detail-row">
                                         <span className="detail-label">Día:</span>
-                                        <span className="detail-value">{getDayName(selectedActivity.dia)}</span>
+                                        <span className="detail-value">{getDaysText(selectedActivity)}</span>
                                     </div>
                                     <div className="detail-row">
                                         <span className="detail-label">Horario:</span>
@@ -300,7 +311,7 @@ const ActivityList = ({ activities, onUpdate, onDelete, onInscribe, isAdmin }) =
                                     </div>
                                     <div className="detail-row">
                                         <span className="detail-label">Cupos:</span>
-                                        <span className="detail-value">{selectedActivity.cupos}</span>
+                                        <span className="detail-value">{selectedActivity.cupos_disponibles}</span>
                                     </div>
                                     {selectedActivity.description && (
                                         <div className="detail-row description">
@@ -79,7 +79,7 @@ const MyActivities = () => {
                         nombre: inscription.actividad?.name || 'Sin nombre',
                         profesor: inscription.actividad?.profesor || 'No asignado',
                         categoria: inscription.actividad?.categoria || 'Sin categoría',
-                        cupos: inscription.actividad?.cupos || 0,
+                        cupos: inscription.actividad?.cupos_disponibles || 0,
                         descripcion: inscription.actividad?.description || 'Sin descripción',
                         dia: inscription.actividad?.dia || 0,
                         hora_inicio: inscription.actividad?.hora_inicio || 'No especificado',
@@ -8,9 +8,29 @@ const Login = () => {
   const [username, setUsername] = useState("");
   const [password, setPassword] = useState("");
   const [error, setError] = useState("");
+  // Segundo factor: challenge devuelto por /login, secreto a configurar y códigos de recuperación
+  const [challenge, setChallenge] = useState(null);
+  const [setup, setSetup] = useState(null);
+  const [code, setCode] = useState("");
+  const [recoveryCodes, setRecoveryCodes] = useState(null);
   const navigate = useNavigate();
   const { login } = useAuth();
 
+  const completeLogin = (user) => {
+    // Extraer el token y los datos del usuario, incluyendo is_admin
+    const { token, refresh_token, is_admin, recovery_codes, ...userData } = user;
+
+    // Pasar is_admin a la función login del contexto
+    login({ ...userData, is_admin }, token, refresh_token);
+
+    // Los códigos de recuperación se muestran una sola vez, antes de entrar
+    if (recovery_codes && recovery_codes.length > 0) {
+      setRecoveryCodes(recovery_codes);
+      return;
+    }
+    navigate("/pagina-principal");
+  };
+
   const handleLogin = async (e) => {
     e.preventDefault();
     setError("");
@@ -24,22 +44,101 @@ const Login = () => {
         body: JSON.stringify({ username, password }),
       });
 
+      if (response.status === 429) {
+        setError("Demasiados intentos. Probá de nuevo en unos minutos");
+        return;
+      }
       if (!response.ok) throw new Error("Login failed");
 
       const data = await response.json();
 
-      // Extraer el token y los datos del usuario, incluyendo is_admin
-      const { token, is_admin, ...userData } = data.user; // Asegúrate de que el backend envía 'is_admin'
-
-      // Pasar is_admin a la función login del contexto
-      login({ ...userData, is_admin }, token); // Pasa is_admin como parte de userData
+      if (data.two_factor) {
+        setChallenge(data.two_factor);
+        if (data.two_factor.setup_required) {
+          const setupResponse = await fetch("http://localhost:8080/login/2fa/setup", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ challenge_token: data.two_factor.challenge_token }),
+          });
+          const setupData = await setupResponse.json();
+          setSetup(setupData.two_factor);
+        }
+        return;
+      }
 
-      navigate("/pagina-principal");
+      completeLogin(data.user);
     } catch {
       setError("Credenciales incorrectas");
     }
   };
 
+  const handleTwoFactor = async (e) => {
+    e.preventDefault();
+    setError("");
+
+    try {
+      const response = await fetch("http://localhost:8080/login/2fa", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ challenge_token: challenge.challenge_token, code }),
+      });
+
+      if (response.status === 429) {
+        setError("Demasiados intentos. Probá de nuevo en unos minutos");
+        return;
+      }
+      if (!response.ok) throw new Error("Invalid code");
+
+      const data = await response.json();
+      completeLogin(data.user);
+    } catch {
+      setError("Código incorrecto");
+    }
+  };
+
+  if (recoveryCodes) {
+    return (
+      <div className="login-container">
+        <div className="login-form">
+          <h2>Códigos de recuperación</h2>
+          <p>Guardalos en un lugar seguro: sirven para entrar si perdés el teléfono y no se vuelven a mostrar.</p>
+          <ul>
+            {recoveryCodes.map((recoveryCode) => (
+              <li key={recoveryCode}><code>{recoveryCode}</code></li>
+            ))}
+          </ul>
+          <button type="button" onClick={() => navigate("/pagina-principal")}>Continuar</button>
+        </div>
+      </div>
+    );
+  }
+
+  if (challenge) {
+    return (
+      <div className="login-container">
+        <form className="login-form" onSubmit={handleTwoFactor}>
+          <h2>Verificación en dos pasos</h2>
+          {error && <div className="error">{error}</div>}
+          {setup && (
+            <div>
+              <p>Agregá esta cuenta en tu app de autenticación con la clave:</p>
+              <p><code>{setup.secret}</code></p>
+            </div>
+          )}
+          <input
+            type="text"
+            placeholder="Código de 6 dígitos o de recuperación"
+            value={code}
+            onChange={(e) => setCode(e.target.value)}
+            autoComplete="one-time-code"
+            required
+          />
+          <button type="submit">Verificar</button>
+        </form>
+      </div>
+    );
+  }
+
   return (
     <div className="login-container">
       <form className="login-form" onSubmit={handleLogin}>
@@ -102,6 +102,13 @@ const PaginaPrincipal = () => {
     }
   };
 
+  // Muestra los campos inválidos que devuelve el backend al crear o modificar una actividad
+  const showActivityErrors = async (response, prefix) => {
+    const data = await response.json().catch(() => ({}));
+    const fields = (data.fields || []).map(field => `${field.field}: ${field.message}`);
+    setError(`${prefix}: ${fields.length ? fields.join(', ') : data.error || response.status}`);
+  };
+
   const createActivity = async (activityData) => {
     try {
       const fetchFunction = authenticatedFetch || makeAuthenticatedRequest;
@@ -113,6 +120,7 @@ const PaginaPrincipal = () => {
         await loadActivities();
         return true;
       }
+      await showActivityErrors(response, 'Error creando actividad');
       return false;
     } catch (err) {
       setError('Error creando actividad: ' + err.message);
@@ -131,6 +139,7 @@ const PaginaPrincipal = () => {
         await loadActivities();
         return true;
       }
+      await showActivityErrors(response, 'Error actualizando actividad');
       return false;
     } catch (err) {
       setError('Error actualizando actividad: ' + err.message);
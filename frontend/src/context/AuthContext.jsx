@@ -34,9 +34,11 @@ export const AuthProvider = ({ children }) => {
         setLoading(false);
     }, []);
 
-    const login = (userData, token) => {
-        console.log('Login called with:', { userData, token });
+    const login = (userData, token, refreshToken) => {
         localStorage.setItem('authToken', token);
+        if (refreshToken) {
+            localStorage.setItem('refreshToken', refreshToken);
+        }
         // Asegurarse de que isAdmin esté en userData antes de guardarlo
         const userToSave = { ...userData, isAdmin: userData.is_admin || false }; // Asume que el backend envía 'is_admin'
         localStorage.setItem('user', JSON.stringify(userToSave));
@@ -45,9 +47,18 @@ export const AuthProvider = ({ children }) => {
     };
 
     const logout = () => {
+        const token = localStorage.getItem('authToken');
+        if (token) {
+            // Revocar la sesión en el servidor; si falla igual se cierra localmente
+            fetch('http://localhost:8080/auth/logout', {
+                method: 'POST',
+                headers: { 'Authorization': `Bearer ${token}` },
+            }).catch(() => {});
+        }
         setUser(null);
         setIsAuthenticated(false);
         localStorage.removeItem('authToken');
+        localStorage.removeItem('refreshToken');
         localStorage.removeItem('user');
         document.cookie = 'token=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;';
     };
@@ -56,10 +67,28 @@ export const AuthProvider = ({ children }) => {
         return localStorage.getItem('authToken');
     };
 
-    const authenticatedFetch = async (url, options = {}) => {
-        const token = getToken();
+    // Canjea el refresh token por un nuevo par de tokens. Devuelve el nuevo token o null.
+    const refreshSession = async () => {
+        const refreshToken = localStorage.getItem('refreshToken');
+        if (!refreshToken) {
+            return null;
+        }
+        const response = await fetch('http://localhost:8080/auth/refresh', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+        });
+        if (!response.ok) {
+            return null;
+        }
+        const data = await response.json();
+        localStorage.setItem('authToken', data.token);
+        localStorage.setItem('refreshToken', data.refresh_token);
+        return data.token;
+    };
 
-        return fetch(url, {
+    const authenticatedFetch = async (url, options = {}) => {
+        const doFetch = (token) => fetch(url, {
             ...options,
             headers: {
                 'Content-Type': 'application/json',
@@ -67,6 +96,19 @@ export const AuthProvider = ({ children }) => {
                 ...options.headers,
             },
         });
+
+        const response = await doFetch(getToken());
+        if (response.status !== 401) {
+            return response;
+        }
+
+        // El access token dura poco: renovarlo y reintentar una vez
+        const newToken = await refreshSession();
+        if (!newToken) {
+            logout();
+            return response;
+        }
+        return doFetch(newToken);
     };
 
     const getUserId = () => {